@@ -9,6 +9,7 @@ import (
 
 type Config struct {
 	BGP   BGPConfig   `mapstructure:"bgp"`
+	RPKI  RPKIConfig  `mapstructure:"rpki"`
 	OSPF  OSPFConfig  `mapstructure:"ospf"`
 	MPLS  MPLSConfig  `mapstructure:"mpls"`
 	Auto  AutoConfig  `mapstructure:"auto"`
@@ -17,13 +18,131 @@ type Config struct {
 }
 
 type BGPConfig struct {
-	Peers []BGPPeer `mapstructure:"peers"`
+	Global    GlobalConfig    `mapstructure:"global"`
+	Peers     []BGPPeer       `mapstructure:"peers"`
+	BMP       BMPConfig       `mapstructure:"bmp"`
+	MRTFiles  []string        `mapstructure:"mrt_files"`
+	PCAP      PCAPConfig      `mapstructure:"pcap"`
+	Dampening DampeningConfig `mapstructure:"dampening"`
+	Detection DetectionConfig `mapstructure:"detection"`
+	Snapshots SnapshotConfig  `mapstructure:"snapshots"`
+	Injection InjectionConfig `mapstructure:"injection"`
+	VRFs      []VRFConfig     `mapstructure:"vrfs"`
+
+	// File mapping community values to friendly names
+	CommunityNames string `mapstructure:"community_names"`
+}
+
+type GlobalConfig struct {
+	ASN                 uint32   `mapstructure:"asn"`
+	RouterID            string   `mapstructure:"router_id"`
+	ListenAddresses     []string `mapstructure:"listen_addresses"`
+	ListenPort          int      `mapstructure:"listen_port"`
+	DefaultImportPolicy string   `mapstructure:"default_import_policy"`
+	DefaultExportPolicy string   `mapstructure:"default_export_policy"`
 }
 
 type BGPPeer struct {
-	Address string `mapstructure:"address"`
-	ASN     uint32 `mapstructure:"asn"`
-	Port    uint16 `mapstructure:"port"`
+	Address              string                `mapstructure:"address"`
+	ASN                  uint32                `mapstructure:"asn"`
+	Port                 uint16                `mapstructure:"port"`
+	Families             []string              `mapstructure:"families"`
+	Description          string                `mapstructure:"description"`
+	Password             string                `mapstructure:"password"`
+	LocalAddress         string                `mapstructure:"local_address"`
+	EBGPMultihopTTL      int                   `mapstructure:"ebgp_multihop_ttl"`
+	TTLSecurityHops      int                   `mapstructure:"ttl_security_hops"`
+	HoldTime             int                   `mapstructure:"hold_time"`
+	KeepaliveInterval    int                   `mapstructure:"keepalive_interval"`
+	GracefulRestart      GracefulRestartConfig `mapstructure:"graceful_restart"`
+	RouteReflectorClient bool                  `mapstructure:"route_reflector_client"`
+	ClusterID            string                `mapstructure:"cluster_id"`
+	Passive              bool                  `mapstructure:"passive"`
+	Role                 string                `mapstructure:"role"`
+	MaxPrefixes          []MaxPrefixConfig     `mapstructure:"max_prefixes"`
+}
+
+type GracefulRestartConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	RestartTime int  `mapstructure:"restart_time"`
+}
+
+// MaxPrefixConfig limits the prefixes a peer may announce for one family.
+// The warning and critical levels default to 80% and 100% of the limit.
+type MaxPrefixConfig struct {
+	Family      string `mapstructure:"family"`
+	Limit       int64  `mapstructure:"limit"`
+	WarningPct  int    `mapstructure:"warning_pct"`
+	CriticalPct int    `mapstructure:"critical_pct"`
+	Action      string `mapstructure:"action"`
+}
+
+type BMPConfig struct {
+	Listen string `mapstructure:"listen"`
+}
+
+// PCAPConfig decodes BGP sessions from packet captures. local_addresses are
+// the capturing router's own addresses; without any, both ends of every
+// session are treated as peers.
+type PCAPConfig struct {
+	Files          []string `mapstructure:"files"`
+	Interface      string   `mapstructure:"interface"`
+	LocalAddresses []string `mapstructure:"local_addresses"`
+}
+
+type DampeningConfig struct {
+	HalfLifeSec      int     `mapstructure:"half_life_sec"`
+	SuppressLimit    float64 `mapstructure:"suppress_limit"`
+	ReuseLimit       float64 `mapstructure:"reuse_limit"`
+	MaxSuppressSec   int     `mapstructure:"max_suppress_sec"`
+	WithdrawPenalty  float64 `mapstructure:"withdraw_penalty"`
+	AttributePenalty float64 `mapstructure:"attribute_penalty"`
+}
+
+type DetectionConfig struct {
+	Prefixes      []OwnedPrefix    `mapstructure:"prefixes"`
+	Relationships []ASRelationship `mapstructure:"relationships"`
+}
+
+// SnapshotConfig controls the RIB snapshots written to the DB. An interval of
+// 0 disables them; a retention or max_snapshots of 0 keeps every snapshot.
+type SnapshotConfig struct {
+	IntervalSec    int `mapstructure:"interval_sec"`
+	RetentionHours int `mapstructure:"retention_hours"`
+	MaxSnapshots   int `mapstructure:"max_snapshots"`
+}
+
+// InjectionConfig guards routes announced through the injection API. Only
+// prefixes within allowed_prefixes may be injected; without any, injection
+// is disabled.
+type InjectionConfig struct {
+	AllowedPrefixes []string `mapstructure:"allowed_prefixes"`
+	MaxTTLSec       int      `mapstructure:"max_ttl_sec"`
+}
+
+// VRFConfig maps the VPNv4 and VPNv6 routes carrying any of its import
+// route targets (e.g. "65000:100" or "192.0.2.1:100") to a named VRF
+type VRFConfig struct {
+	Name               string   `mapstructure:"name"`
+	ImportRouteTargets []string `mapstructure:"import_route_targets"`
+}
+
+type OwnedPrefix struct {
+	Prefix    string   `mapstructure:"prefix"`
+	Origins   []uint32 `mapstructure:"origins"`
+	MaxLength int      `mapstructure:"max_length"`
+}
+
+type ASRelationship struct {
+	AS1  uint32 `mapstructure:"as1"`
+	AS2  uint32 `mapstructure:"as2"`
+	Type string `mapstructure:"type"`
+}
+
+type RPKIConfig struct {
+	Server     string `mapstructure:"server"`
+	RefreshSec int    `mapstructure:"refresh_sec"`
+	ASPAFile   string `mapstructure:"aspa_file"`
 }
 
 type OSPFConfig struct {
@@ -39,6 +158,9 @@ type AutoConfig struct {
 	Enabled        bool `mapstructure:"enabled"`
 	FlapThreshold  int  `mapstructure:"flap_threshold"`
 	FlapWindowSec  int  `mapstructure:"flap_window_sec"`
+	DampenPrefixes bool `mapstructure:"dampen_prefixes"`
+	RejectInvalid  bool `mapstructure:"reject_invalid"`
+	RejectHijacks  bool `mapstructure:"reject_hijacks"`
 }
 
 type APIConfig struct {
@@ -63,6 +185,21 @@ func Load() (*Config, error) {
 	viper.SetDefault("auto.enabled", true)
 	viper.SetDefault("auto.flap_threshold", 3)
 	viper.SetDefault("auto.flap_window_sec", 300)
+	viper.SetDefault("auto.dampen_prefixes", false)
+	viper.SetDefault("auto.reject_invalid", false)
+	viper.SetDefault("auto.reject_hijacks", false)
+	viper.SetDefault("bgp.global.listen_port", 179)
+	viper.SetDefault("bgp.global.default_import_policy", "accept")
+	viper.SetDefault("bgp.global.default_export_policy", "reject")
+	viper.SetDefault("bgp.dampening.half_life_sec", 900)
+	viper.SetDefault("bgp.dampening.suppress_limit", 2000)
+	viper.SetDefault("bgp.dampening.reuse_limit", 750)
+	viper.SetDefault("bgp.dampening.max_suppress_sec", 3600)
+	viper.SetDefault("bgp.dampening.withdraw_penalty", 1000)
+	viper.SetDefault("bgp.dampening.attribute_penalty", 500)
+	viper.SetDefault("bgp.snapshots.interval_sec", 300)
+	viper.SetDefault("bgp.snapshots.retention_hours", 168)
+	viper.SetDefault("bgp.injection.max_ttl_sec", 86400)
 	viper.SetDefault("mpls.enabled", true)
 
 	// Environment variables
@@ -81,6 +218,10 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	// Ensure DB directory exists
 	if cfg.DB.Path != "" {
 		if err := os.MkdirAll(cfg.DB.Path, 0755); err != nil {
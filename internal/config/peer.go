@@ -0,0 +1,70 @@
+package config
+
+import (
+	"github.com/namesarnav/netmeta/pkg/bgp"
+)
+
+// PeerConfig converts a validated peer into the monitor's neighbor
+// configuration
+func (p *BGPPeer) PeerConfig() bgp.PeerConfig {
+	port := p.Port
+	if port == 0 {
+		port = 179
+	}
+
+	return bgp.PeerConfig{
+		Address:              p.Address,
+		ASN:                  p.ASN,
+		Port:                 port,
+		Families:             p.Families,
+		Description:          p.Description,
+		Password:             p.Password,
+		LocalAddress:         p.LocalAddress,
+		EBGPMultihopTTL:      uint8(p.EBGPMultihopTTL),
+		TTLSecurityHops:      uint8(p.TTLSecurityHops),
+		HoldTime:             uint32(p.HoldTime),
+		KeepaliveInterval:    uint32(p.KeepaliveInterval),
+		GracefulRestart:      p.GracefulRestart.Enabled,
+		RestartTime:          uint32(p.GracefulRestart.RestartTime),
+		RouteReflectorClient: p.RouteReflectorClient,
+		ClusterID:            p.ClusterID,
+		Passive:              p.Passive,
+		Role:                 p.Role,
+		PrefixLimits:         p.prefixLimits(),
+	}
+}
+
+func (p *BGPPeer) prefixLimits() []bgp.PrefixLimit {
+	var limits []bgp.PrefixLimit
+	for _, l := range p.MaxPrefixes {
+		limits = append(limits, bgp.PrefixLimit{
+			Family:          l.Family,
+			MaxPrefixes:     l.Limit,
+			WarningPercent:  l.warningPct(),
+			CriticalPercent: l.criticalPct(),
+			Action:          l.action(),
+		})
+	}
+	return limits
+}
+
+func (l *MaxPrefixConfig) warningPct() int {
+	if l.WarningPct == 0 {
+		return 80
+	}
+	return l.WarningPct
+}
+
+func (l *MaxPrefixConfig) criticalPct() int {
+	if l.CriticalPct == 0 {
+		return 100
+	}
+	return l.CriticalPct
+}
+
+func (l *MaxPrefixConfig) action() string {
+	if l.Action == "" {
+		return bgp.LimitActionAlert
+	}
+	return l.Action
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/namesarnav/netmeta/pkg/bgp"
+	"github.com/spf13/viper"
+)
+
+// PolicyConfig is a routing policy file for the policy simulator
+type PolicyConfig struct {
+	Name          string               `mapstructure:"name"`
+	Peers         []string             `mapstructure:"peers"`
+	DefaultAction string               `mapstructure:"default_action"`
+	PrefixSets    []PrefixSetConfig    `mapstructure:"prefix_sets"`
+	ASPathSets    []ASPathSetConfig    `mapstructure:"as_path_sets"`
+	CommunitySets []CommunitySetConfig `mapstructure:"community_sets"`
+	Statements    []StatementConfig    `mapstructure:"statements"`
+}
+
+type PrefixSetConfig struct {
+	Name     string              `mapstructure:"name"`
+	Prefixes []PrefixMatchConfig `mapstructure:"prefixes"`
+}
+
+type PrefixMatchConfig struct {
+	Prefix          string `mapstructure:"prefix"`
+	MaskLengthRange string `mapstructure:"masklength_range"`
+}
+
+type ASPathSetConfig struct {
+	Name    string   `mapstructure:"name"`
+	ASPaths []string `mapstructure:"as_paths"`
+}
+
+type CommunitySetConfig struct {
+	Name        string   `mapstructure:"name"`
+	Communities []string `mapstructure:"communities"`
+}
+
+type StatementConfig struct {
+	Name       string           `mapstructure:"name"`
+	Conditions ConditionsConfig `mapstructure:"conditions"`
+	Actions    ActionsConfig    `mapstructure:"actions"`
+}
+
+type ConditionsConfig struct {
+	PrefixSet         string `mapstructure:"prefix_set"`
+	PrefixSetMatch    string `mapstructure:"prefix_set_match"`
+	ASPathSet         string `mapstructure:"as_path_set"`
+	ASPathSetMatch    string `mapstructure:"as_path_set_match"`
+	CommunitySet      string `mapstructure:"community_set"`
+	CommunitySetMatch string `mapstructure:"community_set_match"`
+}
+
+type ActionsConfig struct {
+	RouteAction       string        `mapstructure:"route_action"`
+	SetLocalPref      uint32        `mapstructure:"set_local_pref"`
+	SetMED            *uint32       `mapstructure:"set_med"`
+	AddCommunities    []string      `mapstructure:"add_communities"`
+	RemoveCommunities []string      `mapstructure:"remove_communities"`
+	Prepend           PrependConfig `mapstructure:"prepend"`
+}
+
+// PrependConfig prepends an ASN repeat times; without an ASN the peer's is used
+type PrependConfig struct {
+	ASN    uint32 `mapstructure:"asn"`
+	Repeat int    `mapstructure:"repeat"`
+}
+
+// LoadPolicy reads a routing policy from a YAML, JSON or TOML file
+func LoadPolicy(path string) (*PolicyConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+	defer f.Close()
+
+	return ReadPolicy(f, strings.TrimPrefix(filepath.Ext(path), "."), path)
+}
+
+// ReadPolicy reads a routing policy in format, one of yaml, json or toml.
+// A policy without a name is named name.
+func ReadPolicy(r io.Reader, format, name string) (*PolicyConfig, error) {
+	switch format {
+	case "yaml", "yml", "json", "toml":
+	default:
+		return nil, fmt.Errorf("unsupported policy format %q", format)
+	}
+
+	v := viper.New()
+	v.SetConfigType(format)
+	v.SetDefault("default_action", bgp.OutcomeAccept)
+
+	// Viper ignores read errors, and would parse a cut off policy
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+
+	var policy PolicyConfig
+	if err := v.Unmarshal(&policy); err != nil {
+		return nil, fmt.Errorf("error unmarshaling policy: %w", err)
+	}
+	if policy.Name == "" {
+		policy.Name = name
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", policy.Name, err)
+	}
+	return &policy, nil
+}
+
+// Validate checks the route actions, match options and set names. Prefixes
+// and expressions are checked when the policy is compiled.
+func (p *PolicyConfig) Validate() error {
+	if p.DefaultAction != bgp.OutcomeAccept && p.DefaultAction != bgp.OutcomeReject {
+		return fmt.Errorf("default_action must be accept or reject")
+	}
+
+	sets := make(map[string]bool)
+	for _, name := range p.setNames() {
+		if name == "" {
+			return fmt.Errorf("every set needs a name")
+		}
+		if sets[name] {
+			return fmt.Errorf("duplicate set name %s", name)
+		}
+		sets[name] = true
+	}
+
+	for i, s := range p.Statements {
+		if s.Name == "" {
+			p.Statements[i].Name = fmt.Sprintf("statement-%d", i+1)
+		}
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("statements[%d] (%s): %w", i, p.Statements[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *PolicyConfig) setNames() []string {
+	var names []string
+	for _, s := range p.PrefixSets {
+		names = append(names, s.Name)
+	}
+	for _, s := range p.ASPathSets {
+		names = append(names, s.Name)
+	}
+	for _, s := range p.CommunitySets {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func (s *StatementConfig) validate() error {
+	c := s.Conditions
+	if !validMatch(c.PrefixSetMatch) || c.PrefixSetMatch == bgp.MatchAll {
+		return fmt.Errorf("prefix_set_match must be any or invert")
+	}
+	if !validMatch(c.ASPathSetMatch) || !validMatch(c.CommunitySetMatch) {
+		return fmt.Errorf("as_path_set_match and community_set_match must be any, all or invert")
+	}
+
+	a := s.Actions
+	if a.RouteAction != "" && a.RouteAction != bgp.OutcomeAccept && a.RouteAction != bgp.OutcomeReject {
+		return fmt.Errorf("route_action must be accept or reject")
+	}
+	if a.Prepend.Repeat < 0 || a.Prepend.Repeat > 16 {
+		return fmt.Errorf("prepend.repeat must be between 0 and 16")
+	}
+	return nil
+}
+
+func validMatch(option string) bool {
+	return option == "" || option == bgp.MatchAny || option == bgp.MatchAll || option == bgp.MatchInvert
+}
+
+// Policy converts a validated policy file into the simulator's policy
+func (p *PolicyConfig) Policy() *bgp.Policy {
+	policy := &bgp.Policy{
+		Name:          p.Name,
+		Peers:         p.Peers,
+		DefaultAction: p.DefaultAction,
+	}
+	for _, s := range p.PrefixSets {
+		set := bgp.PrefixSet{Name: s.Name}
+		for _, pm := range s.Prefixes {
+			set.Prefixes = append(set.Prefixes, bgp.PrefixMatch{Prefix: pm.Prefix, MaskLengthRange: pm.MaskLengthRange})
+		}
+		policy.PrefixSets = append(policy.PrefixSets, set)
+	}
+	for _, s := range p.ASPathSets {
+		policy.ASPathSets = append(policy.ASPathSets, bgp.ASPathSet{Name: s.Name, ASPaths: s.ASPaths})
+	}
+	for _, s := range p.CommunitySets {
+		policy.CommunitySets = append(policy.CommunitySets, bgp.CommunitySet{Name: s.Name, Communities: s.Communities})
+	}
+	for _, s := range p.Statements {
+		policy.Statements = append(policy.Statements, bgp.PolicyStatement{
+			Name:       s.Name,
+			Conditions: bgp.PolicyConditions(s.Conditions),
+			Actions: bgp.PolicyActions{
+				RouteAction:       s.Actions.RouteAction,
+				SetLocalPref:      s.Actions.SetLocalPref,
+				SetMED:            s.Actions.SetMED,
+				AddCommunities:    s.Actions.AddCommunities,
+				RemoveCommunities: s.Actions.RemoveCommunities,
+				PrependASN:        s.Actions.Prepend.ASN,
+				PrependCount:      s.Actions.Prepend.Repeat,
+			},
+		})
+	}
+	return policy
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/namesarnav/netmeta/pkg/bgp"
+)
+
+// Longest TCP MD5 key accepted by Linux (TCP_MD5SIG_MAXKEYLEN)
+const maxPasswordLen = 80
+
+// Validate checks the settings that cannot be enforced by their types
+func (c *Config) Validate() error {
+	if err := c.BGP.Global.validate(); err != nil {
+		return fmt.Errorf("bgp.global: %w", err)
+	}
+	if len(c.BGP.Peers) > 0 && c.BGP.Global.ASN == 0 {
+		return fmt.Errorf("bgp.global.asn and bgp.global.router_id are required to establish sessions with bgp.peers")
+	}
+
+	seen := make(map[string]bool)
+	for i, peer := range c.BGP.Peers {
+		if err := peer.Validate(); err != nil {
+			return fmt.Errorf("bgp.peers[%d] (%s): %w", i, peer.Address, err)
+		}
+		if seen[peer.Address] {
+			return fmt.Errorf("bgp.peers[%d] (%s): duplicate peer address", i, peer.Address)
+		}
+		seen[peer.Address] = true
+	}
+
+	if err := c.BGP.Detection.validate(); err != nil {
+		return fmt.Errorf("bgp.detection: %w", err)
+	}
+
+	s := c.BGP.Snapshots
+	if s.IntervalSec < 0 || s.RetentionHours < 0 || s.MaxSnapshots < 0 {
+		return fmt.Errorf("bgp.snapshots: interval_sec, retention_hours and max_snapshots must not be negative")
+	}
+
+	for i, prefix := range c.BGP.Injection.AllowedPrefixes {
+		if _, err := netip.ParsePrefix(prefix); err != nil {
+			return fmt.Errorf("bgp.injection.allowed_prefixes[%d]: invalid prefix %q", i, prefix)
+		}
+	}
+	if c.BGP.Injection.MaxTTLSec < 0 {
+		return fmt.Errorf("bgp.injection.max_ttl_sec must not be negative")
+	}
+
+	for i, addr := range c.BGP.PCAP.LocalAddresses {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("bgp.pcap.local_addresses[%d]: %q is not an IP address", i, addr)
+		}
+	}
+
+	vrfs := make(map[string]bool)
+	for i, v := range c.BGP.VRFs {
+		if err := bgp.ValidateVRF(bgp.VRFConfig{Name: v.Name, ImportTargets: v.ImportRouteTargets}); err != nil {
+			return fmt.Errorf("bgp.vrfs[%d]: %w", i, err)
+		}
+		if vrfs[v.Name] {
+			return fmt.Errorf("bgp.vrfs[%d] (%s): duplicate VRF name", i, v.Name)
+		}
+		vrfs[v.Name] = true
+	}
+
+	d := c.BGP.Dampening
+	if d.HalfLifeSec <= 0 || d.MaxSuppressSec <= 0 || d.ReuseLimit <= 0 || d.SuppressLimit <= d.ReuseLimit {
+		return fmt.Errorf("bgp.dampening: half_life_sec and max_suppress_sec must be positive and suppress_limit above reuse_limit")
+	}
+
+	return nil
+}
+
+func (g *GlobalConfig) validate() error {
+	// Without a local ASN the speaker is not started and netmeta only
+	// monitors through BMP and MRT
+	if g.ASN == 0 {
+		if g.RouterID != "" {
+			return fmt.Errorf("asn must be set together with router_id")
+		}
+		return nil
+	}
+
+	if id := net.ParseIP(g.RouterID); id == nil || id.To4() == nil {
+		return fmt.Errorf("router_id must be an IPv4 address")
+	}
+	for _, addr := range g.ListenAddresses {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("listen address %q is not an IP address", addr)
+		}
+	}
+	if g.ListenPort < -1 || g.ListenPort > 65535 {
+		return fmt.Errorf("listen_port must be between 0 and 65535, or -1 to disable the listener")
+	}
+
+	for name, policy := range map[string]string{
+		"default_import_policy": g.DefaultImportPolicy,
+		"default_export_policy": g.DefaultExportPolicy,
+	} {
+		if policy != "accept" && policy != "reject" {
+			return fmt.Errorf("%s must be accept or reject", name)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a single peer, as configured or added at runtime
+func (p *BGPPeer) Validate() error {
+	addr := net.ParseIP(p.Address)
+	if addr == nil {
+		return fmt.Errorf("address must be an IP address")
+	}
+	if p.ASN == 0 {
+		return fmt.Errorf("asn must be set")
+	}
+
+	for _, family := range p.Families {
+		if err := bgp.ValidateFamily(family); err != nil {
+			return err
+		}
+	}
+
+	if p.LocalAddress != "" {
+		local := net.ParseIP(p.LocalAddress)
+		if local == nil {
+			return fmt.Errorf("local_address must be an IP address")
+		}
+		if (local.To4() == nil) != (addr.To4() == nil) {
+			return fmt.Errorf("local_address %s is not in the same address family as the peer", p.LocalAddress)
+		}
+	}
+
+	if len(p.Password) > maxPasswordLen {
+		return fmt.Errorf("password must be at most %d characters", maxPasswordLen)
+	}
+
+	if p.EBGPMultihopTTL < 0 || p.EBGPMultihopTTL > 255 {
+		return fmt.Errorf("ebgp_multihop_ttl must be 0 (disabled) or between 1 and 255")
+	}
+	if p.TTLSecurityHops < 0 || p.TTLSecurityHops > 254 {
+		return fmt.Errorf("ttl_security_hops must be 0 (disabled) or between 1 and 254")
+	}
+	if p.EBGPMultihopTTL > 0 && p.TTLSecurityHops > 0 {
+		return fmt.Errorf("ebgp_multihop_ttl and ttl_security_hops are mutually exclusive")
+	}
+
+	// RFC 4271: the hold time is either zero or at least three seconds
+	if p.HoldTime < 0 || p.HoldTime > 65535 || (p.HoldTime > 0 && p.HoldTime < 3) {
+		return fmt.Errorf("hold_time must be 0 or between 3 and 65535")
+	}
+	if p.KeepaliveInterval < 0 {
+		return fmt.Errorf("keepalive_interval must not be negative")
+	}
+	if p.HoldTime > 0 && p.KeepaliveInterval > p.HoldTime/3 {
+		return fmt.Errorf("keepalive_interval must be at most a third of hold_time")
+	}
+
+	// RFC 4724: the restart time is a 12-bit field
+	if p.GracefulRestart.RestartTime < 0 || p.GracefulRestart.RestartTime > 4095 {
+		return fmt.Errorf("graceful_restart.restart_time must be between 0 and 4095")
+	}
+
+	switch p.Role {
+	case "", bgp.RoleCustomer, bgp.RoleProvider, bgp.RolePeer, bgp.RoleRS, bgp.RoleRSClient:
+	default:
+		return fmt.Errorf("role must be one of customer, provider, peer, rs or rs-client")
+	}
+
+	seen := make(map[string]bool)
+	for i, l := range p.MaxPrefixes {
+		if err := l.validate(p.Families); err != nil {
+			return fmt.Errorf("max_prefixes[%d]: %w", i, err)
+		}
+		if seen[l.Family] {
+			return fmt.Errorf("max_prefixes[%d]: duplicate limit for %s", i, l.Family)
+		}
+		seen[l.Family] = true
+	}
+
+	if p.ClusterID != "" {
+		if !p.RouteReflectorClient {
+			return fmt.Errorf("cluster_id requires route_reflector_client")
+		}
+		if id := net.ParseIP(p.ClusterID); id == nil || id.To4() == nil {
+			return fmt.Errorf("cluster_id must be an IPv4 address")
+		}
+	}
+
+	return nil
+}
+
+func (l *MaxPrefixConfig) validate(families []string) error {
+	if len(families) == 0 {
+		families = bgp.DefaultFamilies
+	}
+	configured := false
+	for _, family := range families {
+		configured = configured || family == l.Family
+	}
+	if !configured {
+		return fmt.Errorf("family %q is not configured on the peer", l.Family)
+	}
+
+	if l.Limit <= 0 {
+		return fmt.Errorf("limit must be positive")
+	}
+	if l.WarningPct < 0 || l.WarningPct > 100 || l.CriticalPct < 0 || l.CriticalPct > 100 {
+		return fmt.Errorf("warning_pct and critical_pct must be between 1 and 100")
+	}
+	if l.warningPct() >= l.criticalPct() {
+		return fmt.Errorf("warning_pct (%d) must be below critical_pct (%d)", l.warningPct(), l.criticalPct())
+	}
+
+	switch l.Action {
+	case "", bgp.LimitActionAlert, bgp.LimitActionTeardown:
+	default:
+		return fmt.Errorf("action must be alert or teardown")
+	}
+	return nil
+}
+
+func (d *DetectionConfig) validate() error {
+	for i, o := range d.Prefixes {
+		p, err := netip.ParsePrefix(o.Prefix)
+		if err != nil {
+			return fmt.Errorf("prefixes[%d]: invalid prefix %q", i, o.Prefix)
+		}
+		if len(o.Origins) == 0 {
+			return fmt.Errorf("prefixes[%d] (%s): at least one origin ASN is required", i, o.Prefix)
+		}
+		if o.MaxLength != 0 && (o.MaxLength < p.Bits() || o.MaxLength > p.Addr().BitLen()) {
+			return fmt.Errorf("prefixes[%d] (%s): max_length must be between %d and %d", i, o.Prefix, p.Bits(), p.Addr().BitLen())
+		}
+	}
+
+	for i, r := range d.Relationships {
+		if r.AS1 == 0 || r.AS2 == 0 || r.AS1 == r.AS2 {
+			return fmt.Errorf("relationships[%d]: as1 and as2 must be two different ASNs", i)
+		}
+		if r.Type != bgp.RelationshipP2C && r.Type != bgp.RelationshipP2P {
+			return fmt.Errorf("relationships[%d]: type must be p2c or p2p", i)
+		}
+	}
+
+	return nil
+}
@@ -49,6 +49,24 @@ func (s *Store) Delete(key []byte) error {
 	})
 }
 
+// Keys returns every key starting with prefix, in order
+func (s *Store) Keys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	return keys, err
+}
+
 func (s *Store) Close() error {
 	return s.db.Close()
 }
@@ -11,6 +11,10 @@ type EventType string
 const (
 	EventTypeBGPFlap        EventType = "bgp_flap"
 	EventTypeRPKIInvalid    EventType = "rpki_invalid"
+	EventTypeBGPHijack      EventType = "bgp_hijack"
+	EventTypeBGPRouteLeak   EventType = "bgp_route_leak"
+	EventTypeBGPPrefixLimit EventType = "bgp_prefix_limit"
+	EventTypeBGPInjection   EventType = "bgp_injection"
 	EventTypeOSPFAdjacency  EventType = "ospf_adjacency"
 	EventTypeRemediation    EventType = "remediation"
 	EventTypeMPLSCorruption EventType = "mpls_corruption"
@@ -1,16 +1,27 @@
 package api
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/namesarnav/netmeta/internal/config"
+	"github.com/namesarnav/netmeta/internal/db"
+	"github.com/namesarnav/netmeta/internal/telemetry"
 	"github.com/namesarnav/netmeta/pkg/auto"
 	"github.com/namesarnav/netmeta/pkg/bgp"
 	"github.com/namesarnav/netmeta/pkg/mpls"
 	"github.com/namesarnav/netmeta/pkg/monitor"
 	"github.com/namesarnav/netmeta/pkg/ospf"
+	"github.com/namesarnav/netmeta/pkg/rpki"
 	"github.com/namesarnav/netmeta/pkg/ui"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -19,13 +30,22 @@ var (
 	bgpMonitor    *bgp.Monitor
 	ospfParser    *ospf.Parser
 	mplsValidator *mpls.Validator
+	rpkiClient    *rpki.Client
 	autoEngine    *auto.Engine
 	uiServer      *ui.Server
 	exporter      *monitor.Exporter
+	eventLogger   *telemetry.Logger
+	store         *db.Store
+
+	// Cancel the subscriptions and background loops started by Initialize
+	unsubscribe []func()
+	stop        context.CancelFunc
 )
 
 func Initialize(cfg *config.Config) error {
 	var err error
+	var ctx context.Context
+	ctx, stop = context.WithCancel(context.Background())
 
 	// Initialize BGP monitor
 	bgpMonitor, err = bgp.NewMonitor()
@@ -33,17 +53,133 @@ func Initialize(cfg *config.Config) error {
 		return fmt.Errorf("failed to initialize BGP monitor: %w", err)
 	}
 
+	bgpMonitor.SetDampening(bgp.DampeningParams{
+		HalfLife:         time.Duration(cfg.BGP.Dampening.HalfLifeSec) * time.Second,
+		SuppressLimit:    cfg.BGP.Dampening.SuppressLimit,
+		ReuseLimit:       cfg.BGP.Dampening.ReuseLimit,
+		MaxSuppress:      time.Duration(cfg.BGP.Dampening.MaxSuppressSec) * time.Second,
+		WithdrawPenalty:  cfg.BGP.Dampening.WithdrawPenalty,
+		AttributePenalty: cfg.BGP.Dampening.AttributePenalty,
+	})
+
+	// Check received routes against our prefixes and AS relationships
+	eventLogger = telemetry.NewLogger()
+	if err := bgpMonitor.SetDetection(detectionConfig(cfg)); err != nil {
+		return fmt.Errorf("failed to configure hijack detection: %w", err)
+	}
+	findings, cancelFindings := bgpMonitor.SubscribeFindings()
+	go logFindings(findings)
+	limits, cancelLimits := bgpMonitor.SubscribePrefixLimits()
+	go logPrefixLimits(limits)
+	unsubscribe = append(unsubscribe, cancelFindings, cancelLimits)
+
+	// Guard routes announced through the injection API and audit them
+	if err := bgpMonitor.SetInjection(bgp.InjectionParams{
+		AllowedPrefixes: cfg.BGP.Injection.AllowedPrefixes,
+		MaxTTL:          time.Duration(cfg.BGP.Injection.MaxTTLSec) * time.Second,
+	}); err != nil {
+		return fmt.Errorf("failed to configure route injection: %w", err)
+	}
+	injections, cancelInjections := bgpMonitor.SubscribeInjections()
+	go logInjections(injections)
+	unsubscribe = append(unsubscribe, cancelInjections)
+
+	// Split VPN routes into VRFs by route target
+	var vrfs []bgp.VRFConfig
+	for _, v := range cfg.BGP.VRFs {
+		vrfs = append(vrfs, bgp.VRFConfig{Name: v.Name, ImportTargets: v.ImportRouteTargets})
+	}
+	if err := bgpMonitor.SetVRFs(vrfs); err != nil {
+		return fmt.Errorf("failed to configure VRFs: %w", err)
+	}
+
+	if cfg.BGP.CommunityNames != "" {
+		if err := bgpMonitor.LoadCommunityNames(cfg.BGP.CommunityNames); err != nil {
+			return err
+		}
+	}
+
+	// Snapshot the RIB to the DB for point-in-time lookups and diffs
+	if s := cfg.BGP.Snapshots; s.IntervalSec > 0 && cfg.DB.Path != "" {
+		store, err = db.NewStore(cfg.DB.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: RIB snapshots disabled: %v\n", err)
+		} else {
+			bgpMonitor.SetSnapshots(store, bgp.SnapshotParams{
+				Interval:     time.Duration(s.IntervalSec) * time.Second,
+				Retention:    time.Duration(s.RetentionHours) * time.Hour,
+				MaxSnapshots: s.MaxSnapshots,
+			})
+		}
+	}
+
+	// Start BMP station
+	if cfg.BGP.BMP.Listen != "" {
+		if err := bgpMonitor.StartBMP(cfg.BGP.BMP.Listen); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to start BMP station: %v\n", err)
+		}
+	}
+
+	// Load archived MRT dumps for offline analysis
+	for _, file := range cfg.BGP.MRTFiles {
+		if _, err := bgpMonitor.ImportMRTFile(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to import MRT file %s: %v\n", file, err)
+		}
+	}
+
+	// Rebuild BGP sessions from packet captures
+	pcapOpts := bgp.PCAPOptions{Local: cfg.BGP.PCAP.LocalAddresses}
+	for _, file := range cfg.BGP.PCAP.Files {
+		if _, err := bgpMonitor.ImportPCAPFile(file, pcapOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to import pcap file %s: %v\n", file, err)
+		}
+	}
+	if cfg.BGP.PCAP.Interface != "" {
+		if err := bgpMonitor.StartPCAPCapture(cfg.BGP.PCAP.Interface, pcapOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to start BGP capture: %v\n", err)
+		}
+	}
+
+	// Start the local speaker that configured peers establish sessions with
+	if cfg.BGP.Global.ASN != 0 {
+		if err := bgpMonitor.StartBGP(bgp.GlobalConfig{
+			ASN:                 cfg.BGP.Global.ASN,
+			RouterID:            cfg.BGP.Global.RouterID,
+			ListenAddresses:     cfg.BGP.Global.ListenAddresses,
+			ListenPort:          int32(cfg.BGP.Global.ListenPort),
+			DefaultImportPolicy: cfg.BGP.Global.DefaultImportPolicy,
+			DefaultExportPolicy: cfg.BGP.Global.DefaultExportPolicy,
+		}); err != nil {
+			return err
+		}
+	}
+
 	// Add configured peers
 	for _, peer := range cfg.BGP.Peers {
-		port := peer.Port
-		if port == 0 {
-			port = 179
-		}
-		if err := bgpMonitor.AddPeer(peer.Address, peer.ASN, port); err != nil {
+		if err := bgpMonitor.AddPeer(peer.PeerConfig()); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: failed to add BGP peer %s: %v\n", peer.Address, err)
 		}
 	}
 
+	// Validate route origins against the RPKI cache
+	if cfg.RPKI.Server != "" {
+		rpkiClient = rpki.NewClient(cfg.RPKI.Server, time.Duration(cfg.RPKI.RefreshSec)*time.Second)
+		bgpMonitor.SetRPKI(rpkiClient.Table())
+		go rpkiClient.Start(ctx)
+	}
+
+	// Verify AS paths against ASPAs from a file, or else from the RTR v2 feed
+	if cfg.RPKI.ASPAFile != "" {
+		aspaTable := rpki.NewTable()
+		if err := aspaTable.LoadASPAFile(cfg.RPKI.ASPAFile); err != nil {
+			return fmt.Errorf("failed to load ASPAs: %w", err)
+		}
+		go aspaTable.WatchASPAFile(ctx, cfg.RPKI.ASPAFile, time.Duration(cfg.RPKI.RefreshSec)*time.Second)
+		bgpMonitor.SetASPA(aspaTable)
+	} else if rpkiClient != nil {
+		bgpMonitor.SetASPA(rpkiClient.Table())
+	}
+
 	// Initialize OSPF parser
 	ospfParser = ospf.NewParser()
 	if cfg.OSPF.PCAPFile != "" {
@@ -63,28 +199,128 @@ func Initialize(cfg *config.Config) error {
 	autoEngine = auto.NewEngine(cfg, bgpMonitor)
 
 	// Start auto-remediation engine
-	ctx := context.Background()
 	go autoEngine.Start(ctx)
 
 	// Initialize Prometheus exporter
 	exporter = monitor.NewExporter(bgpMonitor, mplsValidator, autoEngine)
-	exporter.Start()
+	exporter.Start(ctx)
 
 	// Initialize UI server
-	uiServer = ui.NewServer(cfg, bgpMonitor, ospfParser, autoEngine)
+	uiServer = ui.NewServer(cfg, bgpMonitor, ospfParser, rpkiClient, autoEngine)
 
 	return nil
 }
 
+func detectionConfig(cfg *config.Config) bgp.DetectionConfig {
+	detection := bgp.DetectionConfig{}
+	for _, p := range cfg.BGP.Detection.Prefixes {
+		detection.Prefixes = append(detection.Prefixes, bgp.OwnedPrefix{
+			Prefix:    p.Prefix,
+			Origins:   p.Origins,
+			MaxLength: p.MaxLength,
+		})
+	}
+	for _, r := range cfg.BGP.Detection.Relationships {
+		detection.Relationships = append(detection.Relationships, bgp.ASRelationship{
+			AS1:  r.AS1,
+			AS2:  r.AS2,
+			Type: r.Type,
+		})
+	}
+	return detection
+}
+
+// logFindings turns hijack and route leak findings into telemetry events
+func logFindings(findings <-chan *bgp.Finding) {
+	for f := range findings {
+		eventType := telemetry.EventTypeBGPHijack
+		if f.Type == bgp.FindingRouteLeak {
+			eventType = telemetry.EventTypeBGPRouteLeak
+		}
+		eventLogger.LogEvent(eventType, f.Peer, fmt.Sprintf("%s %s: %s", f.Type, f.Route.Prefix, f.Detail), map[string]interface{}{
+			"finding":   f.Type,
+			"peer_asn":  f.PeerASN,
+			"prefix":    f.Route.Prefix,
+			"origin_as": f.Route.OriginAS,
+			"as_path":   f.Route.ASPath,
+		})
+	}
+}
+
+// logPrefixLimits turns prefix limit threshold crossings into telemetry
+// events
+func logPrefixLimits(limits <-chan *bgp.PrefixLimitEvent) {
+	for ev := range limits {
+		eventLogger.LogEvent(telemetry.EventTypeBGPPrefixLimit, ev.Peer, ev.String(), map[string]interface{}{
+			"family":         ev.Family,
+			"peer_asn":       ev.PeerASN,
+			"count":          ev.Count,
+			"limit":          ev.Limit,
+			"level":          ev.Level,
+			"previous_level": ev.PreviousLevel,
+			"action":         ev.Action,
+		})
+	}
+}
+
+// logInjections turns the injection audit trail into telemetry events
+func logInjections(entries <-chan *bgp.InjectionAudit) {
+	for a := range entries {
+		eventLogger.LogEvent(telemetry.EventTypeBGPInjection, a.User, a.String(), map[string]interface{}{
+			"action":         a.Action,
+			"prefix":         a.Prefix,
+			"next_hop":       a.NextHop,
+			"communities":    a.Communities,
+			"local_pref":     a.LocalPref,
+			"traffic_action": a.TrafficAction,
+			"ttl_sec":        a.TTL.Seconds(),
+			"reason":         a.Reason,
+			"error":          a.Error,
+		})
+	}
+}
+
+// Shutdown ends the subscriptions and background loops started by
+// Initialize and closes the BGP monitor
+func Shutdown() {
+	for _, cancel := range unsubscribe {
+		cancel()
+	}
+	unsubscribe = nil
+	if stop != nil {
+		stop()
+	}
+	if bgpMonitor != nil {
+		bgpMonitor.Close()
+	}
+}
+
+// Serve runs the API and dashboard until the server fails or the process is
+// interrupted
 func Serve(cfg *config.Config) error {
 	if err := Initialize(cfg); err != nil {
 		return err
 	}
+	defer Shutdown()
 
 	// Add Prometheus metrics endpoint to UI server
 	uiServer.GetRouter().GET("/metrics", promhttp.Handler())
 
-	return uiServer.Start()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- uiServer.Start()
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-interrupt:
+		return nil
+	}
 }
 
 func ListBGPPeers(cfg *config.Config) {
@@ -97,11 +333,761 @@ func ListBGPPeers(cfg *config.Config) {
 
 	peers := bgpMonitor.GetAllPeers()
 	fmt.Println("BGP Peers:")
-	fmt.Println("Address\t\tASN\tState\t\tPrefixes\tFlaps")
+	fmt.Println("Address\t\tASN\tState\t\tPrefixes\tFlaps\tInvalid")
 	fmt.Println("------------------------------------------------------------")
 	for _, peer := range peers {
-		fmt.Printf("%s\t%d\t%s\t%d\t\t%d\n",
-			peer.Address, peer.ASN, peer.State, peer.PrefixCount, peer.FlapCount)
+		fmt.Printf("%s\t%d\t%s\t%d\t\t%d\t%d\n",
+			peer.Address, peer.ASN, peer.State, peer.PrefixCount, peer.FlapCount, peer.RPKI.Invalid)
+	}
+}
+
+func ShowBGPPeer(cfg *config.Config, address string) {
+	peer, err := ui.NewClient(cfg).Peer(address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := peer.Config
+	fmt.Printf("BGP Peer %s:\n", peer.Address)
+	fmt.Printf("  Description:        %s\n", c.Description)
+	fmt.Printf("  ASN:                %d\n", peer.ASN)
+	fmt.Printf("  Source:             %s\n", peer.Source)
+	fmt.Printf("  State:              %s\n", peer.State)
+	fmt.Printf("  Prefixes:           %d\n", peer.PrefixCount)
+	fmt.Printf("  Flaps:              %d\n", peer.FlapCount)
+	u := peer.Updates
+	fmt.Printf("  Announcements:      %d (%.1f/s)\n", u.Announcements, u.AnnounceRate)
+	fmt.Printf("  Withdrawals:        %d (%.1f/s)\n", u.Withdrawals, u.WithdrawRate)
+	if u.ConvergenceTime > 0 {
+		fmt.Printf("  Convergence:        %s to End-of-RIB\n", u.ConvergenceTime)
+	}
+	if u.StabilizationTime > 0 {
+		fmt.Printf("  Stabilization:      %s after the last flap\n", u.StabilizationTime)
+	}
+	if s := peer.BMP; !s.Updated.IsZero() {
+		fmt.Printf("  Router Adj-RIB-In:  %d (Loc-RIB %d, as of %s)\n", s.AdjRIBIn, s.LocRIB, s.Updated.Format(time.RFC3339))
+		fmt.Printf("  Router Rejected:    %d (%d duplicate prefixes, %d duplicate withdraws)\n",
+			s.Rejected, s.DuplicatePrefixes, s.DuplicateWithdraws)
+	}
+	if peer.Source != bgp.SourceBGP {
+		return
+	}
+	fmt.Printf("  Port:               %d\n", c.Port)
+	fmt.Printf("  Families:           %s\n", strings.Join(c.Families, ", "))
+	fmt.Printf("  Local Address:      %s\n", c.LocalAddress)
+	fmt.Printf("  Password:           %s\n", c.Password)
+	fmt.Printf("  Passive:            %t\n", c.Passive)
+	fmt.Printf("  eBGP Multihop TTL:  %d\n", c.EBGPMultihopTTL)
+	fmt.Printf("  TTL Security Hops:  %d\n", c.TTLSecurityHops)
+	fmt.Printf("  Hold Time:          %d\n", c.HoldTime)
+	fmt.Printf("  Keepalive Interval: %d\n", c.KeepaliveInterval)
+	fmt.Printf("  Graceful Restart:   %t (restart time %d)\n", c.GracefulRestart, c.RestartTime)
+	fmt.Printf("  RR Client:          %t (cluster id %s)\n", c.RouteReflectorClient, c.ClusterID)
+	for _, l := range c.PrefixLimits {
+		status := peer.Limits[l.Family]
+		fmt.Printf("  Max Prefixes:       %s %d/%d (%.0f%%, %s; warning %d%%, critical %d%%, %s)\n",
+			l.Family, status.Count, l.MaxPrefixes, status.Percent, status.Level,
+			l.WarningPercent, l.CriticalPercent, l.Action)
+	}
+}
+
+// AddBGPPeer and the other peer commands change the peers of the running
+// server through its REST API
+func AddBGPPeer(cfg *config.Config, peer config.BGPPeer) {
+	if err := peer.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ui.NewClient(cfg).AddPeer(peer); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s (AS%d) added\n", peer.Address, peer.ASN)
+}
+
+func UpdateBGPPeer(cfg *config.Config, peer config.BGPPeer) {
+	if err := peer.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ui.NewClient(cfg).UpdatePeer(peer); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s updated\n", peer.Address)
+}
+
+func RemoveBGPPeer(cfg *config.Config, address string) {
+	if err := ui.NewClient(cfg).RemovePeer(address); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s removed\n", address)
+}
+
+func EnableBGPPeer(cfg *config.Config, address string) {
+	if err := ui.NewClient(cfg).EnablePeer(address); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s enabled\n", address)
+}
+
+func DisableBGPPeer(cfg *config.Config, address, reason string) {
+	if err := ui.NewClient(cfg).DisablePeer(address, reason); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s disabled\n", address)
+}
+
+func ResetBGPPeer(cfg *config.Config, address, direction string) {
+	if err := ui.NewClient(cfg).ResetPeer(address, direction); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s soft reset (%s)\n", address, direction)
+}
+
+func RestoreBGPPeer(cfg *config.Config, address string) {
+	if err := ui.NewClient(cfg).RestorePeer(address); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Peer %s restored\n", address)
+}
+
+func ShowBGPGlobal(cfg *config.Config) {
+	global, err := ui.NewClient(cfg).Global()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("BGP Speaker:")
+	fmt.Printf("  ASN:                   %d\n", global.ASN)
+	fmt.Printf("  Router ID:             %s\n", global.RouterID)
+	fmt.Printf("  Listen Addresses:      %s\n", strings.Join(global.ListenAddresses, ", "))
+	fmt.Printf("  Listen Port:           %d\n", global.ListenPort)
+	fmt.Printf("  Default Import Policy: %s\n", global.DefaultImportPolicy)
+	fmt.Printf("  Default Export Policy: %s\n", global.DefaultExportPolicy)
+}
+
+func ShowBGPPeerHistory(cfg *config.Config, address string) {
+	history, err := ui.NewClient(cfg).PeerHistory(address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("FSM history of %s:\n", address)
+	fmt.Println("Time\t\t\t\tTransition\t\t\tUptime\t\tReason")
+	fmt.Println("------------------------------------------------------------")
+	for _, t := range history {
+		reason := t.Reason
+		if t.Notification != nil {
+			reason = t.Notification.String()
+		}
+		uptime := "-"
+		if t.Uptime > 0 {
+			uptime = t.Uptime.Round(time.Second).String()
+		}
+		fmt.Printf("%s\t%s -> %s\t\t%s\t\t%s\n",
+			t.Timestamp.Format(time.RFC3339), t.OldState, t.NewState, uptime, reason)
+	}
+}
+
+func ListBGPFindings(cfg *config.Config, peer string) {
+	findings, err := ui.NewClient(cfg).Findings(peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Hijack and Route Leak Findings:")
+	fmt.Println("Peer\t\tType\t\tPrefix\t\t\tAS Path\t\tDetail")
+	fmt.Println("------------------------------------------------------------")
+	for _, f := range findings {
+		fmt.Printf("%s\t%s\t%s\t\t%s\t\t%s\n",
+			f.Peer, f.Type, f.Route.Prefix, formatASPath(f.Route.ASPath), f.Detail)
+	}
+}
+
+func ListRPKIInvalidRoutes(cfg *config.Config, peer string) {
+	invalid, err := ui.NewClient(cfg).InvalidRoutes(peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("RPKI Invalid Routes:")
+	fmt.Println("Peer\t\tPrefix\t\t\tOrigin AS\tAS Path")
+	fmt.Println("------------------------------------------------------------")
+	for _, r := range invalid {
+		fmt.Printf("%s\t%s\t\t%d\t\t%s\n",
+			r.Peer, r.Route.Prefix, r.Route.OriginAS, formatASPath(r.Route.ASPath))
+	}
+}
+
+func ShowASPA(cfg *config.Config, peer, state string, samples int) {
+	summaries, err := ui.NewClient(cfg).ASPASummary(peer, state, samples)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ASPA Path Verification:")
+	fmt.Println("Peer		ASN	Role		Valid	Invalid	Unknown")
+	fmt.Println("------------------------------------------------------------")
+	for _, sum := range summaries {
+		role := sum.Role
+		if role == "" {
+			role = "-"
+		}
+		fmt.Printf("%s\t%d\t%s\t\t%d\t%d\t%d\n",
+			sum.Peer, sum.PeerASN, role, sum.Counts.Valid, sum.Counts.Invalid, sum.Counts.Unknown)
+	}
+
+	for _, sum := range summaries {
+		if len(sum.Samples) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", sum.Peer)
+		for _, sample := range sum.Samples {
+			fmt.Printf("  %s\t%s\t%s\n", sample.Route.Prefix, formatASPath(sample.Route.ASPath), sample.Reason)
+		}
+	}
+}
+
+// ListBGPPeerRoutes queries the running server, which holds the BGP sessions
+func ListBGPPeerRoutes(cfg *config.Config, address, rib, prefix, match string) {
+	routes, err := ui.NewClient(cfg).PeerRoutes(address, rib, prefix, match)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	table := "Adj-RIB-In"
+	if rib == bgp.RIBOut {
+		table = "Adj-RIB-Out"
+	}
+	fmt.Printf("%s of %s:\n", table, address)
+	fmt.Println("Prefix\t\t\tNext Hop\tMED\tLocPrf\tAS Path\t\tCommunities")
+	fmt.Println("------------------------------------------------------------")
+	for _, route := range routes {
+		fmt.Printf("%s\t\t%s\t%d\t%d\t%s\t\t%s\n",
+			route.Prefix, route.NextHop, route.MED, route.LocalPref,
+			formatASPath(route.ASPath), strings.Join(route.Communities, " "))
+	}
+}
+
+func ShowBGPVRFs(cfg *config.Config, peer string) {
+	vrfs, err := ui.NewClient(cfg).VRFs(peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("VRFs:")
+	fmt.Println("Name		Prefixes	Route Targets")
+	fmt.Println("------------------------------------------------------------")
+	for _, v := range vrfs {
+		fmt.Printf("%s\t\t%d\t\t%s\n", v.Name, v.Prefixes, strings.Join(v.ImportTargets, " "))
+	}
+
+	for _, v := range vrfs {
+		if len(v.Peers) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", v.Name)
+		peers := make([]string, 0, len(v.Peers))
+		for address := range v.Peers {
+			peers = append(peers, address)
+		}
+		sort.Strings(peers)
+		for _, address := range peers {
+			counts := v.Peers[address]
+			families := make([]string, 0, len(counts.Prefixes))
+			for family, n := range counts.Prefixes {
+				families = append(families, fmt.Sprintf("%s %d", family, n))
+			}
+			sort.Strings(families)
+			fmt.Printf("  %s\t%s\t(%d withdrawn)\n", address, strings.Join(families, ", "), counts.Withdrawals)
+		}
+		rds := make([]string, 0, len(v.RDs))
+		for rd := range v.RDs {
+			rds = append(rds, rd)
+		}
+		sort.Strings(rds)
+		for _, rd := range rds {
+			fmt.Printf("  RD %s\t%d\n", rd, v.RDs[rd])
+		}
+	}
+}
+
+func ListBGPVRFRoutes(cfg *config.Config, vrf, peer, prefix, match string) {
+	routes, err := ui.NewClient(cfg).VRFRoutes(vrf, peer, prefix, match)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Routes in VRF %s:\n", vrf)
+	fmt.Println("Peer\t\tPrefix\t\t\tNext Hop\tAS Path\t\tRoute Targets")
+	fmt.Println("------------------------------------------------------------")
+	for _, r := range routes {
+		fmt.Printf("%s\t%s\t\t%s\t%s\t\t%s\n",
+			r.Peer, r.Route.Prefix, r.Route.NextHop, formatASPath(r.Route.ASPath),
+			strings.Join(r.Route.ExtendedCommunities, " "))
+	}
+}
+
+// WithdrawBGPVRF and RestoreBGPVRF change the policies of the running
+// server through its REST API
+func WithdrawBGPVRF(cfg *config.Config, peer, vrf string) {
+	report, err := ui.NewClient(cfg).WithdrawVRF(peer, vrf)
+	if report != nil {
+		for family, prefixes := range report.Withdrawn {
+			fmt.Printf("Withdrawn %s: %d prefixes\n", family, len(prefixes))
+		}
+		for family, prefixes := range report.Failed {
+			fmt.Printf("Failed %s: %s\n", family, strings.Join(prefixes, " "))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Routes of VRF %s from %s withdrawn\n", vrf, peer)
+}
+
+func RestoreBGPVRF(cfg *config.Config, peer, vrf string) {
+	if err := ui.NewClient(cfg).RestoreVRF(peer, vrf); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Routes of VRF %s from %s restored\n", vrf, peer)
+}
+
+func ImportMRT(cfg *config.Config, files ...string) {
+	client := ui.NewClient(cfg)
+
+	fmt.Println("File\t\t\tRecords\tRIB Entries\tUpdates\tState Changes\tPeers\tSkipped")
+	fmt.Println("------------------------------------------------------------")
+	for _, file := range files {
+		stats, err := client.ImportMRT(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%d\t%d\t\t%d\t%d\t\t%d\t%d\n",
+			file, stats.Records, stats.RIBEntries, stats.Updates, stats.StateChanges, stats.Peers, stats.Skipped)
+	}
+}
+
+func ExportMRT(cfg *config.Config, path string) {
+	if err := exportMRTFile(ui.NewClient(cfg), path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("RIB exported to %s\n", path)
+}
+
+// exportMRTFile downloads the RIB of the running server to path, compressed
+// with gzip if the name ends in .gz
+func exportMRTFile(client *ui.Client, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create MRT file: %w", err)
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	var w io.Writer = buf
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+	if err := client.ExportMRT(w); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to write MRT file: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write MRT file: %w", err)
+	}
+	return f.Close()
+}
+
+func ImportPCAP(cfg *config.Config, local []string, files ...string) {
+	client := ui.NewClient(cfg)
+
+	fmt.Println("File\t\t\tPackets\tSessions\tPeers\tOPEN\tUPDATE\tNOTIFICATION\tSkipped")
+	fmt.Println("------------------------------------------------------------")
+	for _, file := range files {
+		stats, err := client.ImportPCAP(file, local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%d\t%d\t\t%d\t%d\t%d\t%d\t\t%d\n",
+			file, stats.Packets, stats.Sessions, stats.Peers, stats.Messages["OPEN"], stats.Messages["UPDATE"],
+			stats.Messages["NOTIFICATION"], stats.Skipped)
+	}
+}
+
+func ShowBGPPCAPSessions(cfg *config.Config, peer string) {
+	sessions, err := ui.NewClient(cfg).PCAPSessions(peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No captured BGP sessions")
+		return
+	}
+
+	for _, s := range sessions {
+		a, b := s.Speakers[0], s.Speakers[1]
+		fmt.Printf("Session %s:%d <-> %s:%d\n", a.Address, a.Port, b.Address, b.Port)
+		for _, speaker := range s.Speakers {
+			fmt.Printf("  %s: AS%d, router ID %s, hold time %ds, %d announced, %d withdrawn\n",
+				speaker.Address, speaker.ASN, speaker.RouterID, speaker.HoldTime, speaker.Announced, speaker.Withdrawn)
+		}
+		fmt.Println("  Time\t\t\t\tFrom\t\tEvent\t\tDetail")
+		for _, e := range s.Events {
+			fmt.Printf("  %s\t%s\t%s\t%s\n", e.Timestamp.Format(time.RFC3339Nano), e.From, e.Type, e.Detail)
+		}
+		fmt.Println()
+	}
+}
+
+func ListNoisyPrefixes(cfg *config.Config, limit int) {
+	prefixes, err := ui.NewClient(cfg).NoisyPrefixes(limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Noisy Prefixes:")
+	fmt.Println("Peer\t\tPrefix\t\t\tPenalty\tWithdrawn\tChanged\tSuppressed")
+	fmt.Println("------------------------------------------------------------")
+	for _, d := range prefixes {
+		suppressed := "no"
+		if d.Suppressed {
+			suppressed = "until " + d.ReuseAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s\t%s\t\t%.0f\t%d\t\t%d\t%s\n",
+			d.Peer, d.Prefix, d.Penalty, d.Withdrawals, d.AttributeChanges, suppressed)
+	}
+}
+
+func LookupBGPRoute(cfg *config.Config, ip string) {
+	result, err := ui.NewClient(cfg).Lookup(ip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Routing entry for %s, longest match %s, %d paths:\n", result.Address, result.Prefix, len(result.Paths))
+	fmt.Println("  Peer\t\tNext Hop\tLocPrf\tMED\tOrigin\t\tAS Path\t\tStatus")
+	for _, p := range result.Paths {
+		status := "lost on " + p.EliminatedBy
+		if p.Best {
+			status = "best"
+		}
+		if p.Installed {
+			status += ", installed"
+		}
+		fmt.Printf("  %s\t%s\t%d\t%d\t%s\t\t%s\t\t%s\n",
+			p.Peer, p.Route.NextHop, p.LocalPref, p.Route.MED, p.Route.Origin, formatASPath(p.Route.ASPath), status)
+	}
+
+	fmt.Println("Best path selection:")
+	for i, s := range result.Steps {
+		fmt.Printf("  %d. %-16s %s (%d left)\n", i+1, s.Step, s.Detail, s.Remaining)
+	}
+}
+
+func SimulateBGPPolicy(cfg *config.Config, path, peer string) {
+	result, err := ui.NewClient(cfg).SimulatePolicy(path, peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Policy %s (dry run)\n", result.Policy)
+	for _, p := range result.Peers {
+		fmt.Printf("BGP Peer %s (AS%d): %d accepted, %d modified, %d rejected\n",
+			p.Peer, p.PeerASN, p.Accepted, p.Modified, p.Rejected)
+		for _, r := range p.Routes {
+			fmt.Printf("  %-8s %-20s %-24s %s\n", r.Outcome, r.Prefix, formatASPath(r.Route.ASPath), strings.Join(r.Statements, ","))
+			for _, change := range r.Changes {
+				fmt.Printf("           %s\n", change)
+			}
+		}
+	}
+}
+
+// ListBGPSnapshots, ShowBGPRIBAt and DiffBGPRIB query the snapshots of the
+// running server, which holds the DB open
+func ListBGPSnapshots(cfg *config.Config) {
+	snapshots, err := ui.NewClient(cfg).ListSnapshots()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("RIB Snapshots:")
+	fmt.Println("Time			Peers	Routes		Size")
+	fmt.Println("------------------------------------------------------------")
+	for _, s := range snapshots {
+		fmt.Printf("%s\t%d\t%d\t\t%d\n", s.Time.UTC().Format(time.RFC3339), s.Peers, s.Routes, s.Bytes)
+	}
+}
+
+// ShowBGPRIBAt prints the RIB as of the newest snapshot taken at or before
+// a time
+func ShowBGPRIBAt(cfg *config.Config, at time.Time, peer string) {
+	snapshot, err := ui.NewClient(cfg).RIBAt(at, peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("RIB as of snapshot %s:\n", snapshot.Time.UTC().Format(time.RFC3339))
+	for _, p := range snapshot.Peers {
+		fmt.Printf("BGP Peer %s (AS%d): %d routes\n", p.Address, p.ASN, len(p.Routes))
+		for _, r := range p.Routes {
+			fmt.Printf("  %-20s %-16s %s\n", r.Prefix, r.NextHop, formatASPath(r.ASPath))
+		}
+	}
+}
+
+// DiffBGPRIB prints the routes added, removed and changed between two
+// points in time. A zero to compares against the current RIB.
+func DiffBGPRIB(cfg *config.Config, from, to time.Time, peer string) {
+	diff, err := ui.NewClient(cfg).DiffRIB(from, to, peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	end := "now"
+	if !diff.To.IsZero() {
+		end = diff.To.UTC().Format(time.RFC3339)
+	}
+	fmt.Printf("RIB changes from %s to %s: %d added, %d removed, %d changed\n",
+		diff.From.UTC().Format(time.RFC3339), end, len(diff.Added), len(diff.Removed), len(diff.Changed))
+	for _, r := range diff.Added {
+		fmt.Printf("+ %s\t%-20s %s\n", r.Peer, r.Route.Prefix, formatASPath(r.Route.ASPath))
+	}
+	for _, r := range diff.Removed {
+		fmt.Printf("- %s\t%-20s %s\n", r.Peer, r.Route.Prefix, formatASPath(r.Route.ASPath))
+	}
+	for _, c := range diff.Changed {
+		fmt.Printf("~ %s\t%-20s %s\n", c.Peer, c.Prefix, strings.Join(c.Changes, ", "))
+		fmt.Printf("    was %s via %s\n", formatASPath(c.Old.ASPath), c.Old.NextHop)
+		fmt.Printf("    now %s via %s\n", formatASPath(c.New.ASPath), c.New.NextHop)
+	}
+}
+
+// InjectBGPRoute announces a route through the running server and waits for
+// it to expire, withdrawing it early on interrupt
+func InjectBGPRoute(cfg *config.Config, req bgp.InjectRequest) {
+	client := ui.NewClient(cfg)
+	injection, err := client.InjectRoute(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Injected %s via %s", injection.Prefix, injection.NextHop)
+	if len(injection.Communities) > 0 {
+		fmt.Printf(" with communities %s", strings.Join(injection.Communities, " "))
+	}
+	fmt.Printf(", withdrawn at %s\n", injection.Expires.Format(time.RFC3339))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	select {
+	case <-time.After(time.Until(injection.Expires) + time.Second):
+		fmt.Printf("TTL expired, %s withdrawn\n", injection.Prefix)
+	case <-interrupt:
+		if err := client.WithdrawInjectedRoute(injection.Prefix, "interrupted"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Interrupted, %s withdrawn\n", injection.Prefix)
+	}
+}
+
+func ListFlowSpecRules(cfg *config.Config, peer string) {
+	client := ui.NewClient(cfg)
+	rules, err := client.FlowSpecRules(peer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("FlowSpec Rules:")
+	fmt.Println("Peer\t\tRule\t\t\t\t\tActions")
+	fmt.Println("------------------------------------------------------------")
+	for _, r := range rules {
+		actions := make([]string, 0, len(r.Actions))
+		for _, a := range r.Actions {
+			actions = append(actions, strings.TrimSpace(a.Type+" "+a.Value))
+		}
+		fmt.Printf("%s\t%s\t%s\n", r.Peer, r.Rule, strings.Join(actions, ", "))
+	}
+
+	injected, err := client.FlowSpecInjections()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(injected) > 0 {
+		fmt.Println("\nOriginated:")
+		for _, r := range injected {
+			fmt.Printf("%s\t%s\tby %s, expires %s\n",
+				r.Rule, r.TrafficAction(), r.User, r.Expires.Format(time.RFC3339))
+		}
+	}
+}
+
+// InjectFlowSpecRule originates a FlowSpec rule through the running server
+// and waits for it to expire, withdrawing it early on interrupt
+func InjectFlowSpecRule(cfg *config.Config, req bgp.FlowSpecRequest) {
+	client := ui.NewClient(cfg)
+	rule, err := client.InjectFlowSpec(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Announced %s %s, withdrawn at %s\n", rule.Rule, rule.TrafficAction(), rule.Expires.Format(time.RFC3339))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	select {
+	case <-time.After(time.Until(rule.Expires) + time.Second):
+		fmt.Println("TTL expired, rule withdrawn")
+	case <-interrupt:
+		if err := client.WithdrawFlowSpec(rule.Rule, "interrupted"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Interrupted, rule withdrawn")
+	}
+}
+
+func ShowBGPAnalytics(cfg *config.Config, peer string, top int) {
+	analytics, err := ui.NewClient(cfg).Analytics(peer, top)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, a := range analytics {
+		fmt.Printf("BGP Peer %s (AS%d): %d routes\n", a.Peer, a.PeerASN, a.Routes)
+		fmt.Printf("  AS Path Length:  avg %.2f, max %d\n", a.AvgPathLength, a.MaxPathLength)
+
+		lengths := make([]int, 0, len(a.PathLengths))
+		for length := range a.PathLengths {
+			lengths = append(lengths, length)
+		}
+		sort.Ints(lengths)
+		for _, length := range lengths {
+			fmt.Printf("    %2d: %d\n", length, a.PathLengths[length])
+		}
+
+		fmt.Printf("  Prepended:       %d routes\n", a.Prepended)
+		printASNCounts("Top Prepending", a.TopPrepending)
+		printASNCounts("Top Origins", a.TopOrigins)
+		printASNCounts("Top Transit", a.TopTransit)
+
+		fmt.Println("  Top Communities:")
+		for _, c := range a.TopCommunities {
+			fmt.Printf("    %-24s %-8s %-24s %d\n", c.Value, c.Type, c.Name, c.Routes)
+		}
+		fmt.Println()
+	}
+}
+
+func printASNCounts(title string, counts []bgp.ASNCount) {
+	fmt.Printf("  %s:\n", title)
+	for _, c := range counts {
+		fmt.Printf("    AS%-10d %d\n", c.ASN, c.Routes)
+	}
+}
+
+func formatASPath(path []uint32) string {
+	asns := make([]string, len(path))
+	for i, asn := range path {
+		asns[i] = fmt.Sprintf("%d", asn)
+	}
+	return strings.Join(asns, " ")
+}
+
+// ShowBGPLSTopology prints the IGP topology learned through BGP-LS, in the
+// same layout as the OSPF topology
+func ShowBGPLSTopology(cfg *config.Config) {
+	topology, err := ui.NewClient(cfg).LinkStateTopology()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ids := make([]string, 0, len(topology.Nodes))
+	for id := range topology.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Println("BGP-LS Topology:")
+	fmt.Println("Router ID\t\tName\t\tProtocol\tLinks\tPrefixes")
+	fmt.Println("------------------------------------------------------------")
+	for _, id := range ids {
+		node := topology.Nodes[id]
+		links := topology.Routers[id]
+		fmt.Printf("%s\t%s\t\t%s\t\t%d\t%d\n", id, node.Name, node.Protocol, len(links), len(node.Prefixes))
+		if len(node.SRGB) > 0 {
+			fmt.Printf("  SRGB %d-%d\n", node.SRGB[0].Begin, node.SRGB[0].End)
+		}
+		for _, link := range links {
+			fmt.Printf("  -> %s (igp metric: %d, te metric: %d, bandwidth: %.0f Mbps",
+				link.RemoteRouterID, link.IGPMetric, link.TEMetric, link.MaxBandwidth/1e6)
+			if link.AdjacencySID != nil {
+				fmt.Printf(", adj-sid: %d", *link.AdjacencySID)
+			}
+			fmt.Println(")")
+		}
+		for _, p := range node.Prefixes {
+			if p.PrefixSID != nil {
+				fmt.Printf("  %s (prefix-sid: %d)\n", p.Prefix, *p.PrefixSID)
+			} else {
+				fmt.Printf("  %s\n", p.Prefix)
+			}
+		}
 	}
 }
 
@@ -3,6 +3,8 @@ package auto
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,6 +28,18 @@ type Engine struct {
 	mu            sync.RWMutex
 	flapHistory   map[string][]time.Time
 	flapHistoryMu sync.RWMutex
+
+	// Peers whose prefixes were withdrawn for flapping, with the time they
+	// were withdrawn. Guarded by flapHistoryMu.
+	withdrawn map[string]time.Time
+
+	// RPKI-invalid routes already rejected, dampened prefixes and hijacked
+	// or leaked routes, keyed by peer and prefix. Hijacked routes map to
+	// the reason they were rejected for.
+	rejected   map[string]bool
+	dampened   map[string]bool
+	hijacked   map[string]string
+	rejectedMu sync.Mutex
 }
 
 func NewEngine(cfg *config.Config, bgpMonitor *bgp.Monitor) *Engine {
@@ -34,6 +48,10 @@ func NewEngine(cfg *config.Config, bgpMonitor *bgp.Monitor) *Engine {
 		bgpMonitor:  bgpMonitor,
 		events:      make([]RemediationEvent, 0),
 		flapHistory: make(map[string][]time.Time),
+		withdrawn:   make(map[string]time.Time),
+		rejected:    make(map[string]bool),
+		dampened:    make(map[string]bool),
+		hijacked:    make(map[string]string),
 	}
 }
 
@@ -45,12 +63,21 @@ func (e *Engine) Start(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
+	// Prefix limits are acted on as soon as they are crossed, before the
+	// rest of a leaked table arrives
+	limits, cancel := e.bgpMonitor.SubscribePrefixLimits()
+	defer cancel()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			e.checkAndRemediate()
+		case event := <-limits:
+			if event.Level == bgp.LimitCritical && event.Action == bgp.LimitActionTeardown {
+				e.RemediatePrefixLimit(event)
+			}
 		}
 	}
 }
@@ -61,10 +88,9 @@ func (e *Engine) checkAndRemediate() {
 	window := time.Duration(e.cfg.Auto.FlapWindowSec) * time.Second
 
 	for _, peer := range peers {
-		peer.mu.RLock()
+		// GetAllPeers returns copies, so no locking is needed
 		flapCount := peer.FlapCount
 		lastFlapTime := peer.LastFlapTime
-		peer.mu.RUnlock()
 
 		// Check flap threshold
 		if flapCount > int64(e.cfg.Auto.FlapThreshold) {
@@ -74,6 +100,255 @@ func (e *Engine) checkAndRemediate() {
 			}
 		}
 	}
+	e.restoreStablePeers(peers, now, window)
+
+	if e.cfg.Auto.RejectInvalid {
+		e.remediateInvalidRoutes(peers)
+	}
+
+	if e.cfg.Auto.DampenPrefixes {
+		e.remediateDampenedPrefixes(peers)
+	}
+
+	if e.cfg.Auto.RejectHijacks {
+		e.remediateFindings(peers)
+	}
+}
+
+// remediateFindings rejects hijacked and leaked routes from the peer that
+// sent them and accepts them again once the finding clears. Like
+// RPKI-invalid routes they stay in the Adj-RIB-In, so they are tracked to
+// avoid remediating them again.
+func (e *Engine) remediateFindings(peers []*bgp.PeerState) {
+	findings, err := e.bgpMonitor.Findings("")
+	if err != nil {
+		return
+	}
+
+	// Only routes from live sessions can be filtered
+	live := make(map[string]bool)
+	established := make(map[string]bool)
+	for _, peer := range peers {
+		live[peer.Address] = peer.Source == bgp.SourceBGP
+		established[peer.Address] = peer.Established
+	}
+
+	e.rejectedMu.Lock()
+	defer e.rejectedMu.Unlock()
+
+	current := make(map[string]bool, len(findings))
+	reject := make(map[string]map[string]RemediationEvent)
+	for _, f := range findings {
+		key := f.Peer + "|" + f.Route.Prefix
+		if !live[f.Peer] || current[key] {
+			continue
+		}
+		current[key] = true
+		if e.hijacked[key] != "" {
+			continue
+		}
+		reason := findingReason(f)
+		addToBatch(reject, f.Peer, f.Route.Prefix, RemediationEvent{
+			Type:   "bgp_" + reason,
+			Reason: reason,
+			Action: "reject_prefix",
+		})
+	}
+
+	for peer, events := range reject {
+		if err := e.applyBatch(peer, events, false); err == nil {
+			for prefix, event := range events {
+				e.hijacked[peer+"|"+prefix] = event.Reason
+			}
+		}
+	}
+
+	// Accept routes again that are gone or no longer anomalous. Peers that
+	// are down keep their rejects until their routes are back.
+	accept := make(map[string]map[string]RemediationEvent)
+	for key, reason := range e.hijacked {
+		peer, prefix, _ := strings.Cut(key, "|")
+		switch {
+		case current[key] || (live[peer] && !established[peer]):
+			continue
+		case !live[peer] || e.dampened[key] || e.rejected[key]:
+			// Removed peers cannot be reset, and prefixes rejected for
+			// another reason stay rejected
+			delete(e.hijacked, key)
+			continue
+		}
+		addToBatch(accept, peer, prefix, RemediationEvent{
+			Type:   "bgp_" + reason,
+			Reason: reason,
+			Action: "accept_prefix",
+		})
+	}
+
+	for peer, events := range accept {
+		if err := e.applyBatch(peer, events, true); err == nil {
+			for prefix := range events {
+				delete(e.hijacked, peer+"|"+prefix)
+			}
+		}
+	}
+}
+
+// remediateDampenedPrefixes rejects prefixes whose flap penalty crossed the
+// suppress limit and accepts them again once it has decayed below the reuse
+// limit, like RFC 2439 dampening on a router would
+func (e *Engine) remediateDampenedPrefixes(peers []*bgp.PeerState) {
+	// Only prefixes from live sessions can be filtered
+	live := make(map[string]bool)
+	for _, peer := range peers {
+		live[peer.Address] = peer.Source == bgp.SourceBGP
+	}
+
+	suppressed := make(map[string]*bgp.PrefixDampening)
+	for _, d := range e.bgpMonitor.SuppressedPrefixes() {
+		if live[d.Peer] {
+			suppressed[d.Peer+"|"+d.Prefix] = d
+		}
+	}
+
+	e.rejectedMu.Lock()
+	defer e.rejectedMu.Unlock()
+
+	for key, d := range suppressed {
+		if e.dampened[key] {
+			continue
+		}
+		if err := e.RemediateDampening(d.Peer, d.Prefix); err == nil {
+			e.dampened[key] = true
+		}
+	}
+
+	for key := range e.dampened {
+		if _, ok := suppressed[key]; ok {
+			continue
+		}
+		peer, prefix, _ := strings.Cut(key, "|")
+		if !live[peer] || e.rejected[key] || e.hijacked[key] != "" {
+			// Removed peers cannot be reset, and prefixes rejected for
+			// another reason stay rejected
+			delete(e.dampened, key)
+			continue
+		}
+		if err := e.reuseDampened(peer, prefix); err == nil {
+			delete(e.dampened, key)
+		}
+	}
+}
+
+// remediateInvalidRoutes rejects RPKI-invalid routes from live peers and
+// accepts them again once they are no longer invalid or gone. Rejected
+// routes stay in the Adj-RIB-In, so they are tracked here to avoid
+// remediating them again.
+func (e *Engine) remediateInvalidRoutes(peers []*bgp.PeerState) {
+	invalid, err := e.bgpMonitor.InvalidRoutes("")
+	if err != nil {
+		return
+	}
+
+	// Only routes from live sessions can be filtered
+	live := make(map[string]bool)
+	established := make(map[string]bool)
+	for _, peer := range peers {
+		live[peer.Address] = peer.Source == bgp.SourceBGP
+		established[peer.Address] = peer.Established
+	}
+
+	e.rejectedMu.Lock()
+	defer e.rejectedMu.Unlock()
+
+	current := make(map[string]bool, len(invalid))
+	reject := make(map[string]map[string]RemediationEvent)
+	for _, r := range invalid {
+		key := r.Peer + "|" + r.Route.Prefix
+		if !live[r.Peer] || current[key] {
+			continue
+		}
+		current[key] = true
+		if e.rejected[key] {
+			continue
+		}
+		addToBatch(reject, r.Peer, r.Route.Prefix, RemediationEvent{
+			Type:   "rpki_invalid",
+			Reason: "rpki",
+			Action: "reject_prefix",
+		})
+	}
+
+	for peer, events := range reject {
+		if err := e.applyBatch(peer, events, false); err == nil {
+			for prefix := range events {
+				e.rejected[peer+"|"+prefix] = true
+			}
+		}
+	}
+
+	// Accept routes again that are gone or no longer invalid. Peers that are
+	// down keep their rejects until their routes are back.
+	accept := make(map[string]map[string]RemediationEvent)
+	for key := range e.rejected {
+		peer, prefix, _ := strings.Cut(key, "|")
+		switch {
+		case current[key] || (live[peer] && !established[peer]):
+			continue
+		case !live[peer] || e.dampened[key] || e.hijacked[key] != "":
+			// Removed peers cannot be reset, and prefixes rejected for
+			// another reason stay rejected
+			delete(e.rejected, key)
+			continue
+		}
+		addToBatch(accept, peer, prefix, RemediationEvent{
+			Type:   "rpki_invalid",
+			Reason: "rpki",
+			Action: "accept_prefix",
+		})
+	}
+
+	for peer, events := range accept {
+		if err := e.applyBatch(peer, events, true); err == nil {
+			for prefix := range events {
+				delete(e.rejected, peer+"|"+prefix)
+			}
+		}
+	}
+}
+
+// addToBatch adds the event for a prefix to the batch of its peer
+func addToBatch(batches map[string]map[string]RemediationEvent, peer, prefix string, event RemediationEvent) {
+	if batches[peer] == nil {
+		batches[peer] = make(map[string]RemediationEvent)
+	}
+	event.Target = peer + " " + prefix
+	batches[peer][prefix] = event
+}
+
+// applyBatch rejects, or accepts again, prefixes from one peer with a single
+// soft reset and records the event of each prefix
+func (e *Engine) applyBatch(peer string, events map[string]RemediationEvent, accept bool) error {
+	prefixes := make([]string, 0, len(events))
+	for prefix := range events {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var err error
+	if accept {
+		err = e.bgpMonitor.AcceptPrefixes(peer, prefixes)
+	} else {
+		err = e.bgpMonitor.RejectPrefixes(peer, prefixes)
+	}
+
+	now := time.Now()
+	for _, prefix := range prefixes {
+		event := events[prefix]
+		event.Timestamp = now
+		event.Success = err == nil
+		e.recordEvent(event)
+	}
+	return err
 }
 
 func (e *Engine) remediateFlap(peerAddress string) {
@@ -86,7 +361,7 @@ func (e *Engine) remediateFlap(peerAddress string) {
 		Success:   false,
 	}
 
-	if err := e.bgpMonitor.WithdrawAllPrefixes(peerAddress); err != nil {
+	if _, err := e.bgpMonitor.WithdrawAllPrefixes(peerAddress); err != nil {
 		event.Success = false
 		e.recordEvent(event)
 		return
@@ -94,23 +369,232 @@ func (e *Engine) remediateFlap(peerAddress string) {
 
 	event.Success = true
 	e.recordEvent(event)
+
+	e.flapHistoryMu.Lock()
+	e.withdrawn[peerAddress] = event.Timestamp
+	e.flapHistoryMu.Unlock()
 }
 
-func (e *Engine) RemediateRPKI(prefix string) error {
+// restoreStablePeers accepts the prefixes of peers withdrawn for flapping
+// again once their session has been up without flapping for the flap window
+func (e *Engine) restoreStablePeers(peers []*bgp.PeerState, now time.Time, window time.Duration) {
+	states := make(map[string]*bgp.PeerState, len(peers))
+	for _, peer := range peers {
+		states[peer.Address] = peer
+	}
+
+	e.flapHistoryMu.Lock()
+	defer e.flapHistoryMu.Unlock()
+
+	for address, withdrawn := range e.withdrawn {
+		peer, ok := states[address]
+		if !ok {
+			// Removed peers cannot be reset
+			delete(e.withdrawn, address)
+			continue
+		}
+		stable := withdrawn
+		if peer.LastFlapTime.After(stable) {
+			stable = peer.LastFlapTime
+		}
+		if !peer.Established || now.Sub(stable) < window {
+			continue
+		}
+
+		err := e.bgpMonitor.RestorePrefixes(address)
+		e.recordEvent(RemediationEvent{
+			Timestamp: now,
+			Type:      "bgp_flap",
+			Target:    address,
+			Reason:    "flap",
+			Action:    "restore_prefixes",
+			Success:   err == nil,
+		})
+		if err == nil {
+			delete(e.withdrawn, address)
+		}
+	}
+}
+
+// RestorePeer accepts the prefixes of a peer withdrawn for flapping or by
+// manual remediation again
+func (e *Engine) RestorePeer(address string) error {
+	err := e.bgpMonitor.RestorePrefixes(address)
+	e.recordEvent(RemediationEvent{
+		Timestamp: time.Now(),
+		Type:      "manual",
+		Target:    address,
+		Reason:    "manual",
+		Action:    "restore_prefixes",
+		Success:   err == nil,
+	})
+	if err != nil {
+		return err
+	}
+
+	e.flapHistoryMu.Lock()
+	delete(e.withdrawn, address)
+	e.flapHistoryMu.Unlock()
+	return nil
+}
+
+// RemovePeer removes a peer and forgets the remediations applied to it, so
+// that a peer added again with the same address starts clean
+func (e *Engine) RemovePeer(address string) error {
+	if err := e.bgpMonitor.RemovePeer(address); err != nil {
+		return err
+	}
+
+	e.flapHistoryMu.Lock()
+	delete(e.withdrawn, address)
+	e.flapHistoryMu.Unlock()
+
+	e.rejectedMu.Lock()
+	defer e.rejectedMu.Unlock()
+
+	for key := range e.rejected {
+		if strings.HasPrefix(key, address+"|") {
+			delete(e.rejected, key)
+		}
+	}
+	for key := range e.dampened {
+		if strings.HasPrefix(key, address+"|") {
+			delete(e.dampened, key)
+		}
+	}
+	for key := range e.hijacked {
+		if strings.HasPrefix(key, address+"|") {
+			delete(e.hijacked, key)
+		}
+	}
+	return nil
+}
+
+// RemediateRPKI rejects a prefix learned from a peer. An empty peer rejects
+// the prefix from every peer that announces it.
+func (e *Engine) RemediateRPKI(peer, prefix string) error {
+	target := prefix
+	if peer != "" {
+		target = peer + " " + prefix
+	}
+
 	event := RemediationEvent{
 		Timestamp: time.Now(),
 		Type:      "rpki_invalid",
-		Target:    prefix,
+		Target:    target,
 		Reason:    "rpki",
-		Action:    "withdraw_prefix",
+		Action:    "reject_prefix",
 		Success:   false,
 	}
 
-	// In a real implementation, this would withdraw the specific prefix
-	// For now, we'll just record the event
+	if err := e.bgpMonitor.RejectPrefix(peer, prefix); err != nil {
+		event.Success = false
+		e.recordEvent(event)
+		return fmt.Errorf("failed to reject %s: %w", prefix, err)
+	}
+
+	event.Success = true
+	e.recordEvent(event)
+
+	return nil
+}
+
+// RemediateFinding rejects a hijacked or leaked route from the peer it was
+// learned from
+func (e *Engine) RemediateFinding(f *bgp.Finding) error {
+	reason := findingReason(f)
+
+	event := RemediationEvent{
+		Timestamp: time.Now(),
+		Type:      "bgp_" + reason,
+		Target:    f.Peer + " " + f.Route.Prefix,
+		Reason:    reason,
+		Action:    "reject_prefix",
+		Success:   false,
+	}
+
+	if err := e.bgpMonitor.RejectPrefix(f.Peer, f.Route.Prefix); err != nil {
+		event.Success = false
+		e.recordEvent(event)
+		return fmt.Errorf("failed to reject %s from %s: %w", f.Route.Prefix, f.Peer, err)
+	}
+
 	event.Success = true
 	e.recordEvent(event)
+	return nil
+}
+
+// findingReason is the remediation reason of a finding
+func findingReason(f *bgp.Finding) string {
+	if f.Type == bgp.FindingRouteLeak {
+		return "route_leak"
+	}
+	return "hijack"
+}
 
+// RemediatePrefixLimit shuts down a peer that exceeded its prefix limit.
+// The peer stays down until it is enabled again.
+func (e *Engine) RemediatePrefixLimit(event *bgp.PrefixLimitEvent) error {
+	remediation := RemediationEvent{
+		Timestamp: time.Now(),
+		Type:      "bgp_max_prefix",
+		Target:    event.Peer,
+		Reason:    "max_prefix",
+		Action:    "teardown",
+		Success:   false,
+	}
+
+	if err := e.bgpMonitor.DisablePeer(event.Peer, "maximum number of prefixes reached: "+event.String()); err != nil {
+		remediation.Success = false
+		e.recordEvent(remediation)
+		return fmt.Errorf("failed to tear down peer %s: %w", event.Peer, err)
+	}
+
+	remediation.Success = true
+	e.recordEvent(remediation)
+	return nil
+}
+
+// RemediateDampening rejects a flapping prefix learned from a peer
+func (e *Engine) RemediateDampening(peer, prefix string) error {
+	event := RemediationEvent{
+		Timestamp: time.Now(),
+		Type:      "bgp_dampening",
+		Target:    peer + " " + prefix,
+		Reason:    "dampening",
+		Action:    "reject_prefix",
+		Success:   false,
+	}
+
+	if err := e.bgpMonitor.RejectPrefix(peer, prefix); err != nil {
+		event.Success = false
+		e.recordEvent(event)
+		return fmt.Errorf("failed to reject %s from %s: %w", prefix, peer, err)
+	}
+
+	event.Success = true
+	e.recordEvent(event)
+	return nil
+}
+
+func (e *Engine) reuseDampened(peer, prefix string) error {
+	event := RemediationEvent{
+		Timestamp: time.Now(),
+		Type:      "bgp_dampening",
+		Target:    peer + " " + prefix,
+		Reason:    "dampening",
+		Action:    "reuse_prefix",
+		Success:   false,
+	}
+
+	if err := e.bgpMonitor.AcceptPrefix(peer, prefix); err != nil {
+		event.Success = false
+		e.recordEvent(event)
+		return fmt.Errorf("failed to accept %s from %s: %w", prefix, peer, err)
+	}
+
+	event.Success = true
+	e.recordEvent(event)
 	return nil
 }
 
@@ -143,7 +627,7 @@ func (e *Engine) RemediateManual(peer, prefix, reason string) error {
 	}
 
 	if peer != "" {
-		if err := e.bgpMonitor.WithdrawAllPrefixes(peer); err != nil {
+		if _, err := e.bgpMonitor.WithdrawAllPrefixes(peer); err != nil {
 			event.Success = false
 			e.recordEvent(event)
 			return fmt.Errorf("failed to remediate peer %s: %w", peer, err)
@@ -151,7 +635,7 @@ func (e *Engine) RemediateManual(peer, prefix, reason string) error {
 	}
 
 	if prefix != "" {
-		if err := e.RemediateRPKI(prefix); err != nil {
+		if err := e.RemediateRPKI(peer, prefix); err != nil {
 			event.Success = false
 			e.recordEvent(event)
 			return fmt.Errorf("failed to remediate prefix %s: %w", prefix, err)
@@ -0,0 +1,120 @@
+package auto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/namesarnav/netmeta/internal/config"
+	"github.com/namesarnav/netmeta/pkg/bgp"
+)
+
+func TestRemediateDampenedPrefixes(t *testing.T) {
+	const key = "192.0.2.1|198.51.100.0/24"
+
+	tests := []struct {
+		name     string
+		rejected bool
+		hijacked string
+		removed  bool
+		reused   bool
+	}{
+		{name: "only dampened", reused: true},
+		{name: "also RPKI-invalid", rejected: true},
+		{name: "also hijacked", hijacked: "hijack"},
+		{name: "peer removed", removed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := bgp.NewMonitor()
+			if err != nil {
+				t.Fatalf("NewMonitor: %v", err)
+			}
+			t.Cleanup(m.Close)
+			if err := m.StartBGP(bgp.GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenPort: -1}); err != nil {
+				t.Fatalf("StartBGP: %v", err)
+			}
+			if err := m.AddPeer(bgp.PeerConfig{Address: "192.0.2.1", ASN: 64500, Passive: true}); err != nil {
+				t.Fatalf("AddPeer: %v", err)
+			}
+			if err := m.RejectPrefix("192.0.2.1", "198.51.100.0/24"); err != nil {
+				t.Fatalf("RejectPrefix: %v", err)
+			}
+
+			// The penalty has decayed, so the prefix is no longer suppressed
+			e := NewEngine(&config.Config{}, m)
+			e.dampened[key] = true
+			if tt.rejected {
+				e.rejected[key] = true
+			}
+			if tt.hijacked != "" {
+				e.hijacked[key] = tt.hijacked
+			}
+			peers := m.GetAllPeers()
+			if tt.removed {
+				peers = nil
+			}
+			e.remediateDampenedPrefixes(peers)
+
+			if e.dampened[key] {
+				t.Error("prefix still tracked as dampened")
+			}
+			if e.rejected[key] != tt.rejected || e.hijacked[key] != tt.hijacked {
+				t.Errorf("rejected = %v and hijacked = %q, want %v and %q", e.rejected[key], e.hijacked[key], tt.rejected, tt.hijacked)
+			}
+
+			events := e.GetEvents(0)
+			if !tt.reused {
+				if len(events) != 0 {
+					t.Errorf("events = %+v, want none", events)
+				}
+				return
+			}
+			if len(events) != 1 || events[0].Action != "reuse_prefix" || !events[0].Success {
+				t.Errorf("events = %+v, want a successful reuse_prefix", events)
+			}
+		})
+	}
+}
+
+func TestRemovePeer(t *testing.T) {
+	m, err := bgp.NewMonitor()
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	t.Cleanup(m.Close)
+	if err := m.StartBGP(bgp.GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenPort: -1}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+
+	e := NewEngine(&config.Config{}, m)
+	for _, address := range []string{"192.0.2.1", "192.0.2.10"} {
+		if err := m.AddPeer(bgp.PeerConfig{Address: address, ASN: 64500, Passive: true}); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+		e.withdrawn[address] = time.Now()
+		e.rejected[address+"|198.51.100.0/24"] = true
+		e.dampened[address+"|203.0.113.0/24"] = true
+		e.hijacked[address+"|192.0.2.0/24"] = "hijack"
+	}
+
+	if err := e.RemovePeer("192.0.2.1"); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+	if _, err := m.GetPeer("192.0.2.1"); err == nil {
+		t.Error("peer still monitored")
+	}
+
+	// 192.0.2.10 shares the prefix of the removed address but is kept
+	if len(e.withdrawn) != 1 || e.withdrawn["192.0.2.10"].IsZero() {
+		t.Errorf("withdrawn = %v, want only 192.0.2.10", e.withdrawn)
+	}
+	if len(e.rejected) != 1 || len(e.dampened) != 1 || len(e.hijacked) != 1 ||
+		!e.rejected["192.0.2.10|198.51.100.0/24"] || !e.dampened["192.0.2.10|203.0.113.0/24"] || e.hijacked["192.0.2.10|192.0.2.0/24"] == "" {
+		t.Errorf("rejected = %v, dampened = %v, hijacked = %v, want only 192.0.2.10", e.rejected, e.dampened, e.hijacked)
+	}
+
+	if err := e.RemovePeer("192.0.2.1"); err == nil {
+		t.Error("removing the peer twice succeeded")
+	}
+}
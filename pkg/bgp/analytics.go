@@ -0,0 +1,182 @@
+package bgp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ASNCount is the number of routes an ASN appears in
+type ASNCount struct {
+	ASN    uint32
+	Routes int64
+}
+
+// CommunityCount is the number of routes carrying a community
+type CommunityCount struct {
+	Community
+	Routes int64
+}
+
+// RouteAnalytics summarizes the AS paths and communities of a peer's
+// Adj-RIB-In
+type RouteAnalytics struct {
+	Peer    string
+	PeerASN uint32
+	Routes  int64
+
+	// Number of routes per AS path length, prepends included
+	PathLengths   map[int]int64
+	AvgPathLength float64
+	MaxPathLength int
+
+	// Routes whose AS path repeats an ASN, and the ASNs doing it
+	Prepended     int64
+	TopPrepending []ASNCount
+
+	TopOrigins     []ASNCount
+	TopTransit     []ASNCount
+	TopCommunities []CommunityCount
+}
+
+// Analytics computes AS path and community analytics for every peer, or for
+// one peer. Only the top n ASNs and communities are returned; n <= 0 returns
+// all of them.
+func (m *Monitor) Analytics(address string, n int) ([]*RouteAnalytics, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	analytics := make([]*RouteAnalytics, 0, len(m.peers))
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		analytics = append(analytics, m.analyze(peer, n))
+		peer.mu.RUnlock()
+	}
+
+	sort.Slice(analytics, func(i, j int) bool {
+		return analytics[i].Peer < analytics[j].Peer
+	})
+	return analytics, nil
+}
+
+// analyze walks the Adj-RIB-In of a peer. Callers must hold peer.mu.
+func (m *Monitor) analyze(peer *PeerState, n int) *RouteAnalytics {
+	a := &RouteAnalytics{
+		Peer:        peer.Address,
+		PeerASN:     peer.ASN,
+		PathLengths: make(map[int]int64),
+	}
+	if peer.routes == nil {
+		return a
+	}
+
+	origins := make(map[uint32]int64)
+	transit := make(map[uint32]int64)
+	prepending := make(map[uint32]int64)
+	communities := make(map[Community]int64)
+
+	var totalLength int64
+	for _, route := range peer.routes.routes {
+		a.Routes++
+		a.PathLengths[len(route.ASPath)]++
+		totalLength += int64(len(route.ASPath))
+		if len(route.ASPath) > a.MaxPathLength {
+			a.MaxPathLength = len(route.ASPath)
+		}
+
+		if route.OriginAS != 0 {
+			origins[route.OriginAS]++
+		}
+
+		// Every AS but the origin carried the route. Each ASN is counted once
+		// per route, however often it is prepended.
+		ases, prepends := collapsePrepending(route.ASPath)
+		if len(ases) > 1 {
+			for asn := range distinct(ases[:len(ases)-1]) {
+				transit[asn]++
+			}
+		}
+		for asn := range distinct(prepends) {
+			prepending[asn]++
+		}
+		if len(prepends) > 0 {
+			a.Prepended++
+		}
+
+		for _, c := range m.communities(route) {
+			communities[c]++
+		}
+	}
+	if a.Routes > 0 {
+		a.AvgPathLength = float64(totalLength) / float64(a.Routes)
+	}
+
+	a.TopOrigins = topASNs(origins, n)
+	a.TopTransit = topASNs(transit, n)
+	a.TopPrepending = topASNs(prepending, n)
+
+	a.TopCommunities = make([]CommunityCount, 0, len(communities))
+	for c, routes := range communities {
+		a.TopCommunities = append(a.TopCommunities, CommunityCount{Community: c, Routes: routes})
+	}
+	sort.Slice(a.TopCommunities, func(i, j int) bool {
+		if a.TopCommunities[i].Routes != a.TopCommunities[j].Routes {
+			return a.TopCommunities[i].Routes > a.TopCommunities[j].Routes
+		}
+		return a.TopCommunities[i].Value < a.TopCommunities[j].Value
+	})
+	if n > 0 && len(a.TopCommunities) > n {
+		a.TopCommunities = a.TopCommunities[:n]
+	}
+
+	return a
+}
+
+// collapsePrepending removes repeated ASNs from an AS path and returns the
+// ASNs that were prepended
+func collapsePrepending(path []uint32) ([]uint32, []uint32) {
+	ases := make([]uint32, 0, len(path))
+	var prepends []uint32
+	for _, asn := range path {
+		if len(ases) > 0 && ases[len(ases)-1] == asn {
+			prepends = append(prepends, asn)
+			continue
+		}
+		ases = append(ases, asn)
+	}
+	return ases, prepends
+}
+
+func distinct(asns []uint32) map[uint32]bool {
+	set := make(map[uint32]bool, len(asns))
+	for _, asn := range asns {
+		set[asn] = true
+	}
+	return set
+}
+
+// topASNs returns up to n ASNs with the most routes, most first
+func topASNs(counts map[uint32]int64, n int) []ASNCount {
+	top := make([]ASNCount, 0, len(counts))
+	for asn, routes := range counts {
+		top = append(top, ASNCount{ASN: asn, Routes: routes})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Routes != top[j].Routes {
+			return top[i].Routes > top[j].Routes
+		}
+		return top[i].ASN < top[j].ASN
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
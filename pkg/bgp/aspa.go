@@ -0,0 +1,235 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Default number of sample routes per peer in an ASPA summary
+const defaultASPASamples = 10
+
+// ASPACounts holds the number of routes in a peer's Adj-RIB-In per ASPA
+// path verification state
+type ASPACounts struct {
+	Valid   int64
+	Invalid int64
+	Unknown int64
+}
+
+// ASPASample is a verified route and why it got its state
+type ASPASample struct {
+	Route  *Route
+	Reason string
+}
+
+// ASPASummary is the outcome of AS path verification for one peer, with
+// sample routes in the requested state
+type ASPASummary struct {
+	Peer       string
+	PeerASN    uint32
+	Role       string
+	Downstream bool
+	Counts     ASPACounts
+	Samples    []*ASPASample
+}
+
+// SetASPA enables AS path verification against the ASPAs of a table. Every
+// route is reverified whenever the table changes.
+func (m *Monitor) SetASPA(table *rpki.Table) {
+	m.rpkiMu.Lock()
+	m.aspa = table
+	m.rpkiMu.Unlock()
+
+	table.OnChange(m.reverify)
+	m.reverify()
+}
+
+func (m *Monitor) aspaTable() *rpki.Table {
+	m.rpkiMu.RLock()
+	defer m.rpkiMu.RUnlock()
+	return m.aspa
+}
+
+// verifyPath sets the ASPA verification state of a route received from a
+// peer. Callers must hold peer.mu.
+func (m *Monitor) verifyPath(peer *PeerState, route *Route) {
+	if table := m.aspaTable(); table != nil {
+		route.PathValidation, _ = verifyRoute(table, peer, route)
+	}
+}
+
+// verifyRoute runs upstream verification on routes from customers, peers
+// and route servers, and downstream verification on routes from providers
+// and peers without a role. Routes that are not plain IP prefixes, and
+// routes of peers without a role whose path does not start with the peer's
+// AS, which are taken to be iBGP routes, are left unverified. Callers must
+// hold peer.mu.
+func verifyRoute(table *rpki.Table, peer *PeerState, route *Route) (rpki.State, string) {
+	if _, err := netip.ParsePrefix(route.Prefix); err != nil {
+		return "", ""
+	}
+
+	path, ok := asSequence(route)
+	if !ok {
+		return rpki.StateInvalid, "AS_SET in path"
+	}
+
+	role := peer.Config.Role
+	fromNeighbor := len(path) > 0 && path[0] == peer.ASN
+	switch {
+	case role == "" && !fromNeighbor:
+		return "", ""
+	// Route servers do not add their AS to the path
+	case role != RoleRS && !fromNeighbor:
+		return rpki.StateInvalid, fmt.Sprintf("path does not start with the neighbor AS%d", peer.ASN)
+	}
+	return table.VerifyASPath(path, downstream(role))
+}
+
+func downstream(role string) bool {
+	return role == RoleProvider || role == ""
+}
+
+// asSequence returns the AS path of a route, or false if it contains an
+// AS_SET. Confederation segments are skipped.
+func asSequence(route *Route) ([]uint32, bool) {
+	for _, attr := range route.attrs {
+		a, ok := attr.(*bgp.PathAttributeAsPath)
+		if !ok {
+			continue
+		}
+		var path []uint32
+		for _, param := range a.Value {
+			switch param.GetType() {
+			case bgp.BGP_ASPATH_ATTR_TYPE_SEQ:
+				path = append(path, param.GetAS()...)
+			case bgp.BGP_ASPATH_ATTR_TYPE_SET, bgp.BGP_ASPATH_ATTR_TYPE_CONFED_SET:
+				return nil, false
+			}
+		}
+		return path, true
+	}
+	return route.ASPath, true
+}
+
+// reverify reruns AS path verification on every Adj-RIB-In
+func (m *Monitor) reverify() {
+	table := m.aspaTable()
+	if table == nil {
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, peer := range m.peers {
+		peer.mu.Lock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				state, _ := verifyRoute(table, peer, route)
+				if state == route.PathValidation {
+					continue
+				}
+				updated := *route
+				updated.PathValidation = state
+				peer.routes.insert(&updated)
+			}
+		}
+		peer.mu.Unlock()
+	}
+}
+
+// aspaCounts returns the path verification counts of the Adj-RIB-In.
+// Callers must hold p.mu.
+func (p *PeerState) aspaCounts() ASPACounts {
+	if p.routes == nil {
+		return ASPACounts{}
+	}
+	return ASPACounts{
+		Valid:   p.routes.pathValidation[rpki.StateValid],
+		Invalid: p.routes.pathValidation[rpki.StateInvalid],
+		Unknown: p.routes.pathValidation[rpki.StateUnknown],
+	}
+}
+
+// ASPASummary returns the path verification counts of every peer, or of one
+// peer, with up to samples routes in the given state (Invalid by default)
+// and why they got it
+func (m *Monitor) ASPASummary(address string, state rpki.State, samples int) ([]*ASPASummary, error) {
+	table := m.aspaTable()
+	if table == nil {
+		return nil, fmt.Errorf("ASPA verification is not configured")
+	}
+	if state == "" {
+		state = rpki.StateInvalid
+	}
+	switch state {
+	case rpki.StateValid, rpki.StateInvalid, rpki.StateUnknown:
+	default:
+		return nil, fmt.Errorf("invalid state %q, must be Valid, Invalid or Unknown", state)
+	}
+	if samples <= 0 {
+		samples = defaultASPASamples
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	summaries := make([]*ASPASummary, 0, len(m.peers))
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		summary := &ASPASummary{
+			Peer:       peer.Address,
+			PeerASN:    peer.ASN,
+			Role:       peer.Config.Role,
+			Downstream: downstream(peer.Config.Role),
+			Counts:     peer.aspaCounts(),
+			Samples:    make([]*ASPASample, 0),
+		}
+		if peer.routes != nil && peer.routes.pathValidation[state] > 0 {
+			var routes []*Route
+			for _, route := range peer.routes.routes {
+				if route.PathValidation == state {
+					routes = append(routes, route)
+				}
+			}
+			sort.Slice(routes, func(i, j int) bool { return routes[i].Prefix < routes[j].Prefix })
+			if len(routes) > samples {
+				routes = routes[:samples]
+			}
+			for _, route := range routes {
+				_, reason := verifyRoute(table, peer, route)
+				summary.Samples = append(summary.Samples, &ASPASample{Route: route, Reason: reason})
+			}
+		}
+		peer.mu.RUnlock()
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Peer < summaries[j].Peer })
+	return summaries, nil
+}
+
+// ParseASPAState parses a path verification state regardless of case
+func ParseASPAState(s string) (rpki.State, error) {
+	for _, state := range []rpki.State{rpki.StateValid, rpki.StateInvalid, rpki.StateUnknown} {
+		if strings.EqualFold(s, string(state)) {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("invalid state %q, must be valid, invalid or unknown", s)
+}
@@ -0,0 +1,181 @@
+package bgp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/mrt"
+)
+
+func testASPATable() *rpki.Table {
+	table := rpki.NewTable()
+	table.Replace(nil, map[uint32][]uint32{
+		64500: {64510},
+		64510: {64520},
+		64520: {0},
+		64530: {64520},
+	}, 1)
+	return table
+}
+
+func pathRoute(prefix bgp.AddrPrefixInterface, segments ...bgp.AsPathParamInterface) *Route {
+	return newRoute(prefix, []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+		bgp.NewPathAttributeAsPath(segments),
+		bgp.NewPathAttributeNextHop("192.0.2.1"),
+	}, mrtTime)
+}
+
+func seq(path ...uint32) bgp.AsPathParamInterface {
+	return bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, path)
+}
+
+func TestVerifyRoute(t *testing.T) {
+	table := testASPATable()
+	flowSpec := bgp.NewFlowSpecIPv4Unicast([]bgp.FlowSpecComponentInterface{
+		bgp.NewFlowSpecDestinationPrefix(bgp.NewIPAddrPrefix(24, "198.51.100.0")),
+	})
+
+	tests := []struct {
+		name   string
+		role   string
+		asn    uint32
+		route  *Route
+		want   rpki.State
+		reason string
+	}{
+		{name: "from customer", role: RoleCustomer, asn: 64510, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64510, 64500)), want: rpki.StateValid},
+		{name: "from customer, origin without ASPA", role: RoleCustomer, asn: 64510, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64510, 64540)), want: rpki.StateUnknown, reason: "no ASPA for AS64540"},
+		{name: "from peer, leaked", role: RolePeer, asn: 64530, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64530, 64500)), want: rpki.StateInvalid, reason: "AS64530 is not a provider of AS64500"},
+		{
+			name:   "path not starting with the neighbor",
+			role:   RoleCustomer,
+			asn:    64510,
+			route:  pathRoute(ipPrefix("198.51.100.0/24"), seq(64500)),
+			want:   rpki.StateInvalid,
+			reason: "path does not start with the neighbor AS64510",
+		},
+		{name: "from route server", role: RoleRS, asn: 64999, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64510, 64500)), want: rpki.StateValid},
+		{name: "from provider, up and down", role: RoleProvider, asn: 64530, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64530, 64520, 64510, 64500)), want: rpki.StateValid},
+		{name: "without role, from the neighbor", asn: 64530, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64530, 64520, 64510, 64500)), want: rpki.StateValid},
+		{name: "without role, iBGP", asn: 64496, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64510, 64500))},
+		{
+			name:   "AS_SET",
+			role:   RoleCustomer,
+			asn:    64510,
+			route:  pathRoute(ipPrefix("198.51.100.0/24"), seq(64510), bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SET, []uint32{64500, 64501})),
+			want:   rpki.StateInvalid,
+			reason: "AS_SET in path",
+		},
+		{name: "FlowSpec rule", role: RoleCustomer, asn: 64510, route: pathRoute(flowSpec, seq(64510, 64500))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &PeerState{ASN: tt.asn, Config: PeerConfig{Role: tt.role}}
+			got, reason := verifyRoute(table, peer, tt.route)
+			if got != tt.want || reason != tt.reason {
+				t.Errorf("verifyRoute() = %q %q, want %q %q", got, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestASPASummary(t *testing.T) {
+	m := newTestMonitor(t)
+	if _, err := m.ASPASummary("", "", 0); err == nil {
+		t.Error("ASPASummary() without ASPAs did not fail")
+	}
+
+	table := rpki.NewTable()
+	m.SetASPA(table)
+
+	// Routes from AS64500, without a role, are verified downstream
+	dump := mrtDump(t,
+		peerIndex(mrt.NewPeer("192.0.2.1", "192.0.2.1", 64500, true)),
+		mrtRecord{mrt.TABLE_DUMPv2, mrt.RIB_IPV4_UNICAST, mrt.NewRib(0, ipPrefix("198.51.100.0/24"), []*mrt.RibEntry{
+			mrt.NewRibEntry(0, 0, 0, testAttrs(64500, 64510, 64520, 64530), false),
+		})},
+		mrtRecord{mrt.TABLE_DUMPv2, mrt.RIB_IPV4_UNICAST, mrt.NewRib(1, ipPrefix("203.0.113.0/24"), []*mrt.RibEntry{
+			mrt.NewRibEntry(0, 0, 0, testAttrs(64500, 64502, 64501), false),
+		})},
+	)
+	if _, err := m.ImportMRT(bytes.NewReader(dump)); err != nil {
+		t.Fatalf("ImportMRT: %v", err)
+	}
+
+	// Loading ASPAs reverifies every route
+	table.Replace(nil, map[uint32][]uint32{
+		64500: {0},
+		64510: {0},
+		64520: {0},
+		64530: {64520},
+	}, 1)
+
+	tests := []struct {
+		name    string
+		state   rpki.State
+		counts  ASPACounts
+		samples []string
+		wantErr bool
+	}{
+		{name: "invalid by default", counts: ASPACounts{Invalid: 1, Unknown: 1}, samples: []string{"198.51.100.0/24"}},
+		{name: "unknown", state: rpki.StateUnknown, counts: ASPACounts{Invalid: 1, Unknown: 1}, samples: []string{"203.0.113.0/24"}},
+		{name: "valid", state: rpki.StateValid, counts: ASPACounts{Invalid: 1, Unknown: 1}},
+		{name: "not a path verification state", state: rpki.StateNotFound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaries, err := m.ASPASummary("192.0.2.1", tt.state, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ASPASummary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(summaries) != 1 {
+				t.Fatalf("got %d summaries, want 1", len(summaries))
+			}
+			s := summaries[0]
+			if !s.Downstream || s.Counts != tt.counts {
+				t.Errorf("summary = downstream %v with %+v, want downstream with %+v", s.Downstream, s.Counts, tt.counts)
+			}
+			var samples []string
+			for _, sample := range s.Samples {
+				samples = append(samples, sample.Route.Prefix)
+				if sample.Reason == "" {
+					t.Errorf("sample %s has no reason", sample.Route.Prefix)
+				}
+			}
+			if len(samples) != len(tt.samples) || (len(samples) > 0 && samples[0] != tt.samples[0]) {
+				t.Errorf("samples = %v, want %v", samples, tt.samples)
+			}
+		})
+	}
+}
+
+func TestParseASPAState(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    rpki.State
+		wantErr bool
+	}{
+		{value: "valid", want: rpki.StateValid},
+		{value: "INVALID", want: rpki.StateInvalid},
+		{value: "Unknown", want: rpki.StateUnknown},
+		{value: "notfound", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseASPAState(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseASPAState(%q) = %q, %v, want %q, wantErr %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package bgp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+// Maximum size of a single BMP message (1MB), well above the 64KB BGP
+// extended message (RFC 8654) a route monitoring message carries
+const bmpMaxMessageSize = 1 << 20
+
+// BMPStats are the counters and gauges a router last sent for a peer in
+// BMP Statistics Reports. They are kept apart from PrefixCount, which
+// counts the routes netmeta holds for the peer.
+type BMPStats struct {
+	Rejected           uint64
+	DuplicatePrefixes  uint64
+	DuplicateWithdraws uint64
+	ClusterListLoops   uint64
+	ASPathLoops        uint64
+	OriginatorIDLoops  uint64
+	ASConfedLoops      uint64
+	AdjRIBIn           uint64
+	LocRIB             uint64
+	Updated            time.Time
+}
+
+// StartBMP starts a BMP (RFC 7854) station on the given address. Routers
+// that connect to it feed peer state, prefix counts and flaps into the
+// monitor without netmeta having to form BGP sessions itself.
+func (m *Monitor) StartBMP(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start BMP listener on %s: %w", address, err)
+	}
+
+	m.mu.Lock()
+	m.bmpListener = listener
+	m.mu.Unlock()
+
+	go m.acceptBMP(listener)
+
+	return nil
+}
+
+func (m *Monitor) acceptBMP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-m.ctx.Done():
+				return
+			default:
+			}
+			log.Printf("BMP accept error: %v", err)
+			return
+		}
+
+		go m.handleBMPSession(conn)
+	}
+}
+
+func (m *Monitor) handleBMPSession(conn net.Conn) {
+	defer conn.Close()
+
+	router, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		router = conn.RemoteAddr().String()
+	}
+
+	// Close the connection when the monitor shuts down, and stop watching
+	// once the session is gone
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), bmpMaxMessageSize)
+	scanner.Split(bmp.SplitBMP)
+
+	for scanner.Scan() {
+		msg, err := bmp.ParseBMPMessage(scanner.Bytes())
+		if err != nil {
+			log.Printf("BMP parse error from %s: %v", router, err)
+			continue
+		}
+		m.processBMPMessage(router, msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("BMP session with %s closed: %v", router, err)
+	}
+
+	m.expireBMPRouter(router)
+}
+
+func (m *Monitor) processBMPMessage(router string, msg *bmp.BMPMessage) {
+	switch body := msg.Body.(type) {
+	case *bmp.BMPPeerUpNotification:
+		peer := m.bmpPeer(router, &msg.PeerHeader)
+		m.setPeerState(peer, "Established", true, bmpTimestamp(&msg.PeerHeader))
+		peer.mu.Lock()
+		peer.expectEndOfRIB(openFamilies(body.SentOpenMsg, body.ReceivedOpenMsg))
+		peer.mu.Unlock()
+
+	case *bmp.BMPPeerDownNotification:
+		peer := m.bmpPeer(router, &msg.PeerHeader)
+		reason, notification := bmpDownCause(body)
+		m.setDownCause(peer.Address, reason, notification)
+		m.setPeerState(peer, "Idle", false, bmpTimestamp(&msg.PeerHeader))
+
+	case *bmp.BMPRouteMonitoring:
+		if body.BGPUpdate == nil {
+			return
+		}
+		update, ok := body.BGPUpdate.Body.(*bgp.BGPUpdate)
+		if !ok {
+			return
+		}
+
+		peer := m.bmpPeer(router, &msg.PeerHeader)
+		peer.mu.Lock()
+		m.applyUpdate(peer, msg.PeerHeader.IsAdjRIBOut(), update, bmpTimestamp(&msg.PeerHeader))
+		m.unlockPeer(peer)
+
+	case *bmp.BMPStatisticsReport:
+		peer := m.bmpPeer(router, &msg.PeerHeader)
+		peer.mu.Lock()
+		for _, stat := range body.Stats {
+			peer.BMP.set(stat)
+		}
+		peer.BMP.Updated = bmpTimestamp(&msg.PeerHeader)
+		peer.mu.Unlock()
+	}
+}
+
+// set stores one statistic of a Statistics Report. Per-family gauges and
+// types beyond RFC 7854 are ignored.
+func (s *BMPStats) set(stat bmp.BMPStatsTLVInterface) {
+	var value uint64
+	var typ uint16
+	switch tlv := stat.(type) {
+	case *bmp.BMPStatsTLV32:
+		typ, value = tlv.Type, uint64(tlv.Value)
+	case *bmp.BMPStatsTLV64:
+		typ, value = tlv.Type, tlv.Value
+	default:
+		return
+	}
+
+	switch typ {
+	case bmp.BMP_STAT_TYPE_REJECTED:
+		s.Rejected = value
+	case bmp.BMP_STAT_TYPE_DUPLICATE_PREFIX:
+		s.DuplicatePrefixes = value
+	case bmp.BMP_STAT_TYPE_DUPLICATE_WITHDRAW:
+		s.DuplicateWithdraws = value
+	case bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_CLUSTER_LIST_LOOP:
+		s.ClusterListLoops = value
+	case bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_PATH_LOOP:
+		s.ASPathLoops = value
+	case bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_ORIGINATOR_ID:
+		s.OriginatorIDLoops = value
+	case bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_CONFED_LOOP:
+		s.ASConfedLoops = value
+	case bmp.BMP_STAT_TYPE_ADJ_RIB_IN:
+		s.AdjRIBIn = value
+	case bmp.BMP_STAT_TYPE_LOC_RIB:
+		s.LocRIB = value
+	}
+}
+
+// bmpPeerAddress names a peer monitored over BMP. Several routers can
+// report the same neighbor, and one router can report it in several VRFs,
+// so the router and the peer distinguisher are part of the name:
+// 10.0.0.1@192.0.2.1, or 10.0.0.1[65000:100]@192.0.2.1 in a VRF.
+func bmpPeerAddress(router string, hdr *bmp.BMPPeerHeader) string {
+	address := hdr.PeerAddress.String()
+	if hdr.PeerDistinguisher != 0 {
+		rd := make([]byte, 8)
+		binary.BigEndian.PutUint64(rd, hdr.PeerDistinguisher)
+		address += "[" + bgp.GetRouteDistinguisher(rd).String() + "]"
+	}
+	return address + "@" + router
+}
+
+// bmpPeer returns the peer described by a BMP per-peer header, creating it
+// on first sight
+func (m *Monitor) bmpPeer(router string, hdr *bmp.BMPPeerHeader) *PeerState {
+	address := bmpPeerAddress(router, hdr)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peer, ok := m.peers[address]
+	if !ok {
+		peer = &PeerState{
+			Address:  address,
+			ASN:      hdr.PeerAS,
+			State:    "Idle",
+			Source:   SourceBMP,
+			neighbor: hdr.PeerAddress.String(),
+		}
+		m.peers[address] = peer
+	}
+
+	peer.mu.Lock()
+	peer.Router = router
+	peer.RouterID = hdr.PeerBGPID.String()
+	if peer.routes == nil {
+		peer.routes = newRIBTable()
+		peer.routesOut = newRIBTable()
+	}
+	peer.mu.Unlock()
+
+	return peer
+}
+
+// expireBMPRouter marks every peer learned from a router as unknown once its
+// BMP session is gone, since their state can no longer be trusted
+func (m *Monitor) expireBMPRouter(router string) {
+	m.mu.RLock()
+	expired := make([]*PeerState, 0)
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if peer.Source == SourceBMP && peer.Router == router {
+			expired = append(expired, peer)
+		}
+		peer.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+
+	for _, peer := range expired {
+		m.setDownCause(peer.Address, "bmp-session-closed", nil)
+		m.setPeerState(peer, StateUnknown, false, time.Now())
+	}
+}
+
+func bmpTimestamp(hdr *bmp.BMPPeerHeader) time.Time {
+	if hdr.Timestamp == 0 {
+		return time.Now()
+	}
+	sec := int64(hdr.Timestamp)
+	nsec := int64((hdr.Timestamp - float64(sec)) * 1e9)
+	return time.Unix(sec, nsec)
+}
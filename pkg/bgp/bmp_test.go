@@ -0,0 +1,256 @@
+package bgp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+const bmpRouter = "198.51.100.1"
+
+func bmpHeader(flags uint8, rd uint64) bmp.BMPPeerHeader {
+	return *bmp.NewBMPPeerHeader(bmp.BMP_PEER_TYPE_GLOBAL, flags, rd, "192.0.2.1", 64500, "192.0.2.1", 1704067200)
+}
+
+func bmpOpen(asn uint16, id string) *bgp.BGPMessage {
+	caps := []bgp.ParameterCapabilityInterface{bgp.NewCapMultiProtocol(bgp.RF_IPv4_UC)}
+	return bgp.NewBGPOpenMessage(asn, 90, id, []bgp.OptionParameterInterface{bgp.NewOptionParameterCapability(caps)})
+}
+
+func bmpPeerUp() *bmp.BMPMessage {
+	return bmp.NewBMPPeerUpNotification(bmpHeader(0, 0), "192.0.2.254", 179, 40000,
+		bmpOpen(64496, "192.0.2.254"), bmpOpen(64500, "192.0.2.1"))
+}
+
+func bmpRoutes(flags uint8, withdrawn, announced []string) *bmp.BMPMessage {
+	var nlri, gone []*bgp.IPAddrPrefix
+	for _, p := range announced {
+		nlri = append(nlri, ipPrefix(p))
+	}
+	for _, p := range withdrawn {
+		gone = append(gone, ipPrefix(p))
+	}
+	var attrs []bgp.PathAttributeInterface
+	if len(nlri) > 0 {
+		attrs = []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+			bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{bgp.NewAsPathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint16{64500, 64501})}),
+			bgp.NewPathAttributeNextHop("192.0.2.1"),
+		}
+	}
+	return bmp.NewBMPRouteMonitoring(bmpHeader(flags, 0), bgp.NewBGPUpdateMessage(gone, attrs, nlri))
+}
+
+// bmpWire serializes a message and parses it back, as the station reads it
+// off the wire
+func bmpWire(t *testing.T, msg *bmp.BMPMessage) *bmp.BMPMessage {
+	t.Helper()
+	data, err := msg.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize BMP message: %v", err)
+	}
+	parsed, err := bmp.ParseBMPMessage(data)
+	if err != nil {
+		t.Fatalf("failed to parse BMP message: %v", err)
+	}
+	return parsed
+}
+
+func TestBMPPeerAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		rd      uint64
+		want    string
+	}{
+		{name: "global", address: "192.0.2.1", want: "192.0.2.1@" + bmpRouter},
+		{name: "IPv6", address: "2001:db8::1", want: "2001:db8::1@" + bmpRouter},
+		{name: "two-octet AS distinguisher", address: "192.0.2.1", rd: 65000<<32 | 100, want: "192.0.2.1[65000:100]@" + bmpRouter},
+		{name: "IPv4 distinguisher", address: "192.0.2.1", rd: 1<<48 | 0xc0000201<<16 | 7, want: "192.0.2.1[192.0.2.1:7]@" + bmpRouter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := bmp.NewBMPPeerHeader(bmp.BMP_PEER_TYPE_L3VPN, 0, tt.rd, tt.address, 64500, "192.0.2.1", 0)
+			if got := bmpPeerAddress(bmpRouter, hdr); got != tt.want {
+				t.Errorf("bmpPeerAddress() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBMPStatsSet(t *testing.T) {
+	tests := []struct {
+		name string
+		stat bmp.BMPStatsTLVInterface
+		want BMPStats
+	}{
+		{name: "rejected", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_REJECTED, 3), want: BMPStats{Rejected: 3}},
+		{name: "duplicate prefixes", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_DUPLICATE_PREFIX, 4), want: BMPStats{DuplicatePrefixes: 4}},
+		{name: "duplicate withdraws", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_DUPLICATE_WITHDRAW, 5), want: BMPStats{DuplicateWithdraws: 5}},
+		{name: "cluster list loops", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_CLUSTER_LIST_LOOP, 6), want: BMPStats{ClusterListLoops: 6}},
+		{name: "AS path loops", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_PATH_LOOP, 7), want: BMPStats{ASPathLoops: 7}},
+		{name: "originator ID loops", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_ORIGINATOR_ID, 8), want: BMPStats{OriginatorIDLoops: 8}},
+		{name: "confederation loops", stat: bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_CONFED_LOOP, 9), want: BMPStats{ASConfedLoops: 9}},
+		{name: "Adj-RIB-In gauge", stat: bmp.NewBMPStatsTLV64(bmp.BMP_STAT_TYPE_ADJ_RIB_IN, 1<<40), want: BMPStats{AdjRIBIn: 1 << 40}},
+		{name: "Loc-RIB gauge", stat: bmp.NewBMPStatsTLV64(bmp.BMP_STAT_TYPE_LOC_RIB, 900000), want: BMPStats{LocRIB: 900000}},
+		{name: "per-family gauge ignored", stat: bmp.NewBMPStatsTLVPerAfiSafi64(bmp.BMP_STAT_TYPE_PER_AFI_SAFI_ADJ_RIB_IN, bgp.AFI_IP, bgp.SAFI_UNICAST, 10)},
+		{name: "unknown type ignored", stat: bmp.NewBMPStatsTLV32(100, 11)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got BMPStats
+			got.set(tt.stat)
+			if got != tt.want {
+				t.Errorf("set() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessBMPMessage(t *testing.T) {
+	address := "192.0.2.1@" + bmpRouter
+	notification := bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_CEASE, bgp.BGP_ERROR_SUB_ADMINISTRATIVE_RESET, nil)
+
+	tests := []struct {
+		name     string
+		messages []*bmp.BMPMessage
+		state    string
+		prefixes int64
+		out      int
+		flaps    int64
+		reason   string
+		stats    BMPStats
+	}{
+		{
+			name:     "peer up with routes",
+			messages: []*bmp.BMPMessage{bmpPeerUp(), bmpRoutes(0, nil, []string{"203.0.113.0/24", "198.51.100.0/24"})},
+			state:    "Established",
+			prefixes: 2,
+		},
+		{
+			name: "withdrawal",
+			messages: []*bmp.BMPMessage{
+				bmpPeerUp(),
+				bmpRoutes(0, nil, []string{"203.0.113.0/24", "198.51.100.0/24"}),
+				bmpRoutes(0, []string{"198.51.100.0/24"}, nil),
+			},
+			state:    "Established",
+			prefixes: 1,
+		},
+		{
+			name:     "Adj-RIB-Out routes",
+			messages: []*bmp.BMPMessage{bmpPeerUp(), bmpRoutes(bmp.BMP_PEER_FLAG_ADJ_RIB_TYP, nil, []string{"203.0.113.0/24"})},
+			state:    "Established",
+			out:      1,
+		},
+		{
+			name: "peer down with notification",
+			messages: []*bmp.BMPMessage{
+				bmpPeerUp(),
+				bmpRoutes(0, nil, []string{"203.0.113.0/24"}),
+				bmp.NewBMPPeerDownNotification(bmpHeader(0, 0), bmp.BMP_PEER_DOWN_REASON_REMOTE_BGP_NOTIFICATION, notification, nil),
+			},
+			state:  "Idle",
+			flaps:  1,
+			reason: "remote-notification",
+		},
+		{
+			name: "statistics report",
+			messages: []*bmp.BMPMessage{
+				bmpPeerUp(),
+				bmp.NewBMPStatisticsReport(bmpHeader(0, 0), []bmp.BMPStatsTLVInterface{
+					bmp.NewBMPStatsTLV32(bmp.BMP_STAT_TYPE_REJECTED, 2),
+					bmp.NewBMPStatsTLV64(bmp.BMP_STAT_TYPE_ADJ_RIB_IN, 800000),
+				}),
+			},
+			state: "Established",
+			stats: BMPStats{Rejected: 2, AdjRIBIn: 800000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMonitor(t)
+			for _, msg := range tt.messages {
+				m.processBMPMessage(bmpRouter, bmpWire(t, msg))
+			}
+
+			peer, err := m.GetPeer(address)
+			if err != nil {
+				t.Fatalf("GetPeer: %v", err)
+			}
+			if peer.Source != SourceBMP || peer.Router != bmpRouter {
+				t.Errorf("peer source = %s via %s, want %s via %s", peer.Source, peer.Router, SourceBMP, bmpRouter)
+			}
+			if peer.State != tt.state {
+				t.Errorf("state = %s, want %s", peer.State, tt.state)
+			}
+			if peer.PrefixCount != tt.prefixes {
+				t.Errorf("prefixes = %d, want %d", peer.PrefixCount, tt.prefixes)
+			}
+			if peer.FlapCount != tt.flaps {
+				t.Errorf("flaps = %d, want %d", peer.FlapCount, tt.flaps)
+			}
+			out, err := m.ListAdjRIBOut(address, "", MatchExact)
+			if err != nil {
+				t.Fatalf("ListAdjRIBOut: %v", err)
+			}
+			if len(out) != tt.out {
+				t.Errorf("Adj-RIB-Out has %d routes, want %d", len(out), tt.out)
+			}
+
+			stats := peer.BMP
+			stats.Updated = tt.stats.Updated
+			if stats != tt.stats {
+				t.Errorf("BMP stats = %+v, want %+v", stats, tt.stats)
+			}
+
+			if tt.reason != "" {
+				history, err := m.PeerHistory(address)
+				if err != nil {
+					t.Fatalf("PeerHistory: %v", err)
+				}
+				if last := history[len(history)-1]; last.Reason != tt.reason {
+					t.Errorf("down reason = %q, want %q", last.Reason, tt.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestBMPSessionClose(t *testing.T) {
+	m := newTestMonitor(t)
+	station, router := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		m.handleBMPSession(station)
+		close(done)
+	}()
+
+	for _, msg := range []*bmp.BMPMessage{bmpPeerUp(), bmpRoutes(0, nil, []string{"203.0.113.0/24"})} {
+		data, err := msg.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize BMP message: %v", err)
+		}
+		if _, err := router.Write(data); err != nil {
+			t.Fatalf("failed to write BMP message: %v", err)
+		}
+	}
+	router.Close()
+	<-done
+
+	// Pipes have no port, so the station names the router "pipe"
+	peer, err := m.GetPeer("192.0.2.1@pipe")
+	if err != nil {
+		t.Fatalf("GetPeer: %v", err)
+	}
+	if peer.State != StateUnknown || peer.PrefixCount != 0 || peer.FlapCount != 0 {
+		t.Errorf("peer after session close = %s with %d prefixes and %d flaps, want %s with none",
+			peer.State, peer.PrefixCount, peer.FlapCount, StateUnknown)
+	}
+}
@@ -0,0 +1,219 @@
+package bgp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Community types
+const (
+	CommunityStandard = "standard"
+	CommunityExtended = "extended"
+	CommunityLarge    = "large"
+)
+
+// Community is a decoded standard, extended or large community. Extended
+// communities are prefixed with their kind, e.g. "rt:65000:100".
+type Community struct {
+	Value string
+	Type  string
+	Name  string
+}
+
+// Well-known communities from the IANA registry
+var wellKnownCommunities = map[string]string{
+	"65535:0":     "GRACEFUL_SHUTDOWN",
+	"65535:1":     "ACCEPT_OWN",
+	"65535:2":     "ROUTE_FILTER_TRANSLATED_v4",
+	"65535:3":     "ROUTE_FILTER_v4",
+	"65535:4":     "ROUTE_FILTER_TRANSLATED_v6",
+	"65535:5":     "ROUTE_FILTER_v6",
+	"65535:6":     "LLGR_STALE",
+	"65535:7":     "NO_LLGR",
+	"65535:8":     "ACCEPT_OWN_NEXTHOP",
+	"65535:666":   "BLACKHOLE",
+	"65535:65281": "NO_EXPORT",
+	"65535:65282": "NO_ADVERTISE",
+	"65535:65283": "NO_EXPORT_SUBCONFED",
+	"65535:65284": "NOPEER",
+}
+
+// communityNames maps community values to operator supplied names. Patterns
+// may use "*" for any value in a field, e.g. "65000:1:*".
+type communityNames struct {
+	exact    map[string]string
+	patterns []communityPattern
+}
+
+type communityPattern struct {
+	fields []string
+	name   string
+}
+
+// LoadCommunityNames reads a file mapping community values to friendly
+// names, one "<community> <name>" pair per line. Blank lines and lines
+// starting with # are ignored. Extended communities use their decoded form,
+// e.g. "rt:65000:100". Names from the file take precedence over the
+// well-known names.
+func (m *Monitor) LoadCommunityNames(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open community names: %w", err)
+	}
+	defer f.Close()
+
+	names := &communityNames{exact: make(map[string]string)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		value, name, ok := strings.Cut(text, " ")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("%s:%d: expected a community and a name", path, line)
+		}
+		if strings.Contains(value, "*") {
+			names.patterns = append(names.patterns, communityPattern{fields: strings.Split(value, ":"), name: name})
+		} else {
+			names.exact[value] = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read community names: %w", err)
+	}
+
+	m.namesMu.Lock()
+	m.communityNames = names
+	m.namesMu.Unlock()
+	return nil
+}
+
+// communityName returns the name of a community value, or an empty string
+func (m *Monitor) communityName(value string) string {
+	m.namesMu.RLock()
+	names := m.communityNames
+	m.namesMu.RUnlock()
+
+	if names != nil {
+		if name, ok := names.exact[value]; ok {
+			return name
+		}
+		fields := strings.Split(value, ":")
+		for _, p := range names.patterns {
+			if p.matches(fields) {
+				return p.name
+			}
+		}
+	}
+	return wellKnownCommunities[value]
+}
+
+func (p communityPattern) matches(fields []string) bool {
+	if len(fields) != len(p.fields) {
+		return false
+	}
+	for i, f := range p.fields {
+		if f != "*" && f != fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// communities decodes every community carried by a route
+func (m *Monitor) communities(route *Route) []Community {
+	var communities []Community
+	add := func(value, typ string) {
+		communities = append(communities, Community{Value: value, Type: typ, Name: m.communityName(value)})
+	}
+
+	for _, c := range route.Communities {
+		add(c, CommunityStandard)
+	}
+	for _, attr := range route.attrs {
+		if a, ok := attr.(*bgp.PathAttributeExtendedCommunities); ok {
+			for _, c := range a.Value {
+				add(formatExtendedCommunity(c), CommunityExtended)
+			}
+		}
+	}
+	for _, c := range route.LargeCommunities {
+		add(c, CommunityLarge)
+	}
+	return communities
+}
+
+// formatExtendedCommunity prefixes an extended community with its kind
+func formatExtendedCommunity(c bgp.ExtendedCommunityInterface) string {
+	return extendedCommunityKind(c) + ":" + c.String()
+}
+
+func extendedCommunityKind(c bgp.ExtendedCommunityInterface) string {
+	typ, subtype := c.GetTypes()
+
+	switch typ {
+	case bgp.EC_TYPE_TRANSITIVE_TWO_OCTET_AS_SPECIFIC, bgp.EC_TYPE_TRANSITIVE_IP4_SPECIFIC, bgp.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC:
+		switch subtype {
+		case bgp.EC_SUBTYPE_ROUTE_TARGET:
+			return "rt"
+		case bgp.EC_SUBTYPE_ROUTE_ORIGIN:
+			return "soo"
+		case bgp.EC_SUBTYPE_OSPF_DOMAIN_ID:
+			return "ospf-domain-id"
+		case bgp.EC_SUBTYPE_SOURCE_AS:
+			return "source-as"
+		case bgp.EC_SUBTYPE_L2VPN_ID:
+			return "l2vpn-id"
+		case bgp.EC_SUBTYPE_VRF_ROUTE_IMPORT:
+			return "vrf-import"
+		}
+	case bgp.EC_TYPE_TRANSITIVE_OPAQUE:
+		switch subtype {
+		case bgp.EC_SUBTYPE_COLOR:
+			return "color"
+		case bgp.EC_SUBTYPE_ENCAPSULATION:
+			return "encap"
+		case bgp.EC_SUBTYPE_DEFAULT_GATEWAY:
+			return "default-gateway"
+		case bgp.EC_SUBTYPE_OSPF_ROUTE_TYPE:
+			return "ospf-route-type"
+		}
+	case bgp.EC_TYPE_EVPN:
+		switch subtype {
+		case bgp.EC_SUBTYPE_MAC_MOBILITY:
+			return "mac-mobility"
+		case bgp.EC_SUBTYPE_ESI_LABEL:
+			return "esi-label"
+		case bgp.EC_SUBTYPE_ES_IMPORT:
+			return "es-import"
+		case bgp.EC_SUBTYPE_ROUTER_MAC:
+			return "router-mac"
+		}
+	case bgp.EC_TYPE_NON_TRANSITIVE_LINK_BANDWIDTH:
+		if subtype == bgp.EC_SUBTYPE_LINK_BANDWIDTH {
+			return "link-bandwidth"
+		}
+	case bgp.EC_TYPE_NON_TRANSITIVE_OPAQUE:
+		if subtype == bgp.EC_SUBTYPE_ORIGIN_VALIDATION {
+			return "origin-validation"
+		}
+	case bgp.EC_TYPE_GENERIC_TRANSITIVE_EXPERIMENTAL:
+		switch subtype {
+		case bgp.EC_SUBTYPE_FLOWSPEC_TRAFFIC_RATE:
+			return "traffic-rate"
+		case bgp.EC_SUBTYPE_FLOWSPEC_TRAFFIC_ACTION:
+			return "traffic-action"
+		case bgp.EC_SUBTYPE_FLOWSPEC_REDIRECT:
+			return "redirect"
+		case bgp.EC_SUBTYPE_FLOWSPEC_TRAFFIC_REMARK:
+			return "traffic-remark"
+		}
+	}
+	return fmt.Sprintf("0x%02x%02x", uint8(typ), uint8(subtype))
+}
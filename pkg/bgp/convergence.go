@@ -0,0 +1,304 @@
+package bgp
+
+import (
+	"context"
+	"log"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// How often End-of-RIB, stability and update rates are checked
+const convergenceInterval = time.Second
+
+// RateInterval is the window announcement and withdrawal rates are computed
+// over
+const RateInterval = time.Minute
+
+// StableAfter is how long a peer must stay quiet after a flap before its
+// routes are considered stable
+const StableAfter = 30 * time.Second
+
+// Peers that never send End-of-RIB stop being tracked after this long
+const endOfRIBTimeout = 10 * time.Minute
+
+// Convergence event types
+const (
+	ConvergenceEndOfRIB = "end_of_rib"
+	ConvergenceStable   = "stable"
+)
+
+// UpdateStats counts the UPDATE traffic received from a peer. Totals are
+// kept across sessions; rates are per second over the last RateInterval.
+type UpdateStats struct {
+	Announcements int64
+	Withdrawals   int64
+	AnnounceRate  float64
+	WithdrawRate  float64
+	LastUpdate    time.Time
+
+	// Time from Established to End-of-RIB on every negotiated family for
+	// the current session, zero until then
+	ConvergenceTime time.Duration
+
+	// Time from the last flap until the peer sent no UPDATE for
+	// StableAfter, zero until then
+	StabilizationTime time.Duration
+}
+
+// ConvergenceEvent is published when a peer finishes its initial table
+// transfer or settles after a flap
+type ConvergenceEvent struct {
+	Timestamp time.Time
+	Peer      string
+	PeerASN   uint32
+	Type      string
+	Duration  time.Duration
+}
+
+// convergence tracks a peer's progress towards a converged Adj-RIB-In
+type convergence struct {
+	// Waiting for End-of-RIB since the session came up. Families are only
+	// known for BMP and MRT peers, GoBGP is polled for live ones.
+	converging bool
+	eorPending map[string]bool
+
+	// Waiting for the peer to go quiet since the last flap
+	stabilizing bool
+
+	// Totals at the start of the current rate interval
+	rateStart         time.Time
+	rateAnnouncements int64
+	rateWithdrawals   int64
+}
+
+// countUpdate records announcements and withdrawals received at the given
+// time. An UPDATE after a quiet period ends a pending stabilization at the
+// previous one, which keeps archived MRT data accurate. Callers must hold
+// peer.mu and release it with unlockPeer.
+func (m *Monitor) countUpdate(peer *PeerState, announcements, withdrawals int64, at time.Time) {
+	if peer.Established && peer.convergence.stabilizing && at.Sub(peer.quietSince()) >= StableAfter {
+		m.stabilized(peer)
+	}
+
+	peer.Updates.Announcements += announcements
+	peer.Updates.Withdrawals += withdrawals
+	if at.After(peer.Updates.LastUpdate) {
+		peer.Updates.LastUpdate = at
+	}
+}
+
+// startConvergence is called when a session comes up. Callers must hold
+// peer.mu.
+func (p *PeerState) startConvergence() {
+	p.convergence.converging = true
+	p.convergence.eorPending = nil
+	p.Updates.ConvergenceTime = 0
+}
+
+// stopConvergence is called when a session goes down. Callers must hold
+// peer.mu.
+func (p *PeerState) stopConvergence(flapped bool) {
+	p.convergence.converging = false
+	p.convergence.eorPending = nil
+	if flapped {
+		p.convergence.stabilizing = true
+		p.Updates.StabilizationTime = 0
+	}
+}
+
+// expectEndOfRIB sets the families a BMP or MRT peer will send End-of-RIB
+// for. Callers must hold peer.mu.
+func (p *PeerState) expectEndOfRIB(families map[string]bool) {
+	if p.convergence.converging {
+		p.convergence.eorPending = families
+	}
+}
+
+// endOfRIB records an End-of-RIB marker from a BMP or MRT peer. Callers
+// must hold peer.mu.
+func (m *Monitor) endOfRIB(peer *PeerState, family bgp.RouteFamily, at time.Time) {
+	if !peer.convergence.converging {
+		return
+	}
+	// Without the OPEN messages every family is assumed to be done
+	if peer.convergence.eorPending != nil {
+		delete(peer.convergence.eorPending, family.String())
+		if len(peer.convergence.eorPending) > 0 {
+			return
+		}
+	}
+	m.converged(peer, at)
+}
+
+// converged records the initial convergence time. Callers must hold
+// peer.mu and release it with unlockPeer.
+func (m *Monitor) converged(peer *PeerState, at time.Time) {
+	peer.convergence.converging = false
+	peer.convergence.eorPending = nil
+	peer.Updates.ConvergenceTime = max(at.Sub(peer.establishedAt), 0)
+
+	peer.pending.convergence = append(peer.pending.convergence, &ConvergenceEvent{
+		Timestamp: at,
+		Peer:      peer.Address,
+		PeerASN:   peer.ASN,
+		Type:      ConvergenceEndOfRIB,
+		Duration:  peer.Updates.ConvergenceTime,
+	})
+}
+
+// quietSince returns when the peer last sent an UPDATE on the current
+// session, or when the session came up if it sent none. Callers must hold
+// p.mu.
+func (p *PeerState) quietSince() time.Time {
+	if p.Updates.LastUpdate.After(p.establishedAt) {
+		return p.Updates.LastUpdate
+	}
+	return p.establishedAt
+}
+
+// stabilized records the time from the last flap until the peer went quiet.
+// Callers must hold peer.mu and release it with unlockPeer.
+func (m *Monitor) stabilized(peer *PeerState) {
+	stable := peer.quietSince()
+	peer.convergence.stabilizing = false
+	peer.Updates.StabilizationTime = max(stable.Sub(peer.LastFlapTime), 0)
+
+	peer.pending.convergence = append(peer.pending.convergence, &ConvergenceEvent{
+		Timestamp: stable,
+		Peer:      peer.Address,
+		PeerASN:   peer.ASN,
+		Type:      ConvergenceStable,
+		Duration:  peer.Updates.StabilizationTime,
+	})
+}
+
+func (m *Monitor) watchConvergence() {
+	ticker := time.NewTicker(convergenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkConvergence(now)
+		}
+	}
+}
+
+// checkConvergence polls GoBGP for End-of-RIB, ends stabilizations of live
+// peers that went quiet and rolls the update rates over
+func (m *Monitor) checkConvergence(now time.Time) {
+	m.mu.RLock()
+	peers := make([]*PeerState, 0, len(m.peers))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	m.mu.RUnlock()
+
+	for _, peer := range peers {
+		peer.mu.Lock()
+		c := &peer.convergence
+
+		live := peer.Source == SourceBGP || peer.Source == SourceBMP
+		if live && peer.Established && c.stabilizing && now.Sub(peer.quietSince()) >= StableAfter {
+			m.stabilized(peer)
+		}
+
+		if live && c.converging && now.Sub(peer.establishedAt) > endOfRIBTimeout {
+			log.Printf("No End-of-RIB from BGP peer %s after %s, not tracking its convergence", peer.Address, endOfRIBTimeout)
+			c.converging = false
+		}
+		polled := peer.Source == SourceBGP && c.converging
+		address := peer.Address
+
+		if elapsed := now.Sub(c.rateStart); elapsed >= RateInterval {
+			if !c.rateStart.IsZero() {
+				peer.Updates.AnnounceRate = float64(peer.Updates.Announcements-c.rateAnnouncements) / elapsed.Seconds()
+				peer.Updates.WithdrawRate = float64(peer.Updates.Withdrawals-c.rateWithdrawals) / elapsed.Seconds()
+			}
+			c.rateStart = now
+			c.rateAnnouncements = peer.Updates.Announcements
+			c.rateWithdrawals = peer.Updates.Withdrawals
+		}
+		m.unlockPeer(peer)
+
+		if polled && m.receivedEndOfRIB(address) {
+			peer.mu.Lock()
+			if peer.convergence.converging {
+				m.converged(peer, now)
+			}
+			m.unlockPeer(peer)
+		}
+	}
+}
+
+// receivedEndOfRIB reports whether a live peer sent End-of-RIB for every
+// family negotiated on its session
+func (m *Monitor) receivedEndOfRIB(address string) bool {
+	done := false
+	m.server.ListPeer(context.Background(), &api.ListPeerRequest{Address: address}, func(p *api.Peer) {
+		if p.State == nil || p.State.SessionState != api.PeerState_ESTABLISHED {
+			return
+		}
+		caps, _ := apiutil.UnmarshalCapabilities(p.State.RemoteCap)
+		negotiated := multiprotocolFamilies(caps)
+
+		done = true
+		for _, a := range p.AfiSafis {
+			if a.Config == nil || !negotiated[apiutil.ToRouteFamily(a.Config.Family).String()] {
+				continue
+			}
+			if gr := a.MpGracefulRestart; gr == nil || gr.State == nil || !gr.State.EndOfRibReceived {
+				done = false
+			}
+		}
+	})
+	return done
+}
+
+// openFamilies returns the families both OPEN messages of a session carry
+func openFamilies(sent, received *bgp.BGPMessage) map[string]bool {
+	local := multiprotocolFamilies(openCapabilities(sent))
+	families := make(map[string]bool)
+	for family := range multiprotocolFamilies(openCapabilities(received)) {
+		if local[family] {
+			families[family] = true
+		}
+	}
+	return families
+}
+
+func openCapabilities(msg *bgp.BGPMessage) []bgp.ParameterCapabilityInterface {
+	var caps []bgp.ParameterCapabilityInterface
+	if msg == nil {
+		return caps
+	}
+	if open, ok := msg.Body.(*bgp.BGPOpen); ok {
+		for _, param := range open.OptParams {
+			if p, ok := param.(*bgp.OptionParameterCapability); ok {
+				caps = append(caps, p.Capability...)
+			}
+		}
+	}
+	return caps
+}
+
+// multiprotocolFamilies returns the families of the multiprotocol
+// capabilities in a capability list. Without any, only IPv4 unicast is
+// supported.
+func multiprotocolFamilies(caps []bgp.ParameterCapabilityInterface) map[string]bool {
+	families := make(map[string]bool)
+	for _, c := range caps {
+		if mp, ok := c.(*bgp.CapMultiProtocol); ok {
+			families[mp.CapValue.String()] = true
+		}
+	}
+	if len(families) == 0 {
+		families[bgp.RF_IPv4_UC.String()] = true
+	}
+	return families
+}
@@ -0,0 +1,269 @@
+package bgp
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DampeningParams are the RFC 2439 route flap dampening parameters. They
+// only drive analytics; netmeta never suppresses routes on its own unless
+// the auto-remediation engine is told to.
+type DampeningParams struct {
+	HalfLife         time.Duration
+	SuppressLimit    float64
+	ReuseLimit       float64
+	MaxSuppress      time.Duration
+	WithdrawPenalty  float64
+	AttributePenalty float64
+}
+
+// DefaultDampening uses the common vendor defaults
+var DefaultDampening = DampeningParams{
+	HalfLife:         15 * time.Minute,
+	SuppressLimit:    2000,
+	ReuseLimit:       750,
+	MaxSuppress:      60 * time.Minute,
+	WithdrawPenalty:  1000,
+	AttributePenalty: 500,
+}
+
+// maxPenalty is the ceiling that keeps a route from being suppressed for
+// longer than MaxSuppress
+func (p DampeningParams) maxPenalty() float64 {
+	return p.ReuseLimit * math.Pow(2, p.MaxSuppress.Seconds()/p.HalfLife.Seconds())
+}
+
+// decay returns a penalty after it has decayed for d
+func (p DampeningParams) decay(penalty float64, d time.Duration) float64 {
+	if d <= 0 {
+		return penalty
+	}
+	return penalty * math.Pow(2, -d.Seconds()/p.HalfLife.Seconds())
+}
+
+// PrefixDampening is the churn history and current penalty of one prefix
+// received from one peer
+type PrefixDampening struct {
+	Peer             string
+	Prefix           string
+	Family           string
+	Penalty          float64
+	Withdrawals      int64
+	Announcements    int64
+	AttributeChanges int64
+	Suppressed       bool
+	SuppressedSince  time.Time
+	ReuseAt          time.Time
+	LastChange       time.Time
+
+	withdrawn bool
+}
+
+// dampeningTracker keeps per-prefix penalties for every Adj-RIB-In
+type dampeningTracker struct {
+	params   DampeningParams
+	prefixes map[string]*PrefixDampening
+	latest   time.Time
+	mu       sync.Mutex
+}
+
+func newDampeningTracker(params DampeningParams) *dampeningTracker {
+	return &dampeningTracker{
+		params:   params,
+		prefixes: make(map[string]*PrefixDampening),
+	}
+}
+
+// SetDampening replaces the dampening parameters. Existing penalties are
+// kept.
+func (m *Monitor) SetDampening(params DampeningParams) {
+	m.dampening.mu.Lock()
+	defer m.dampening.mu.Unlock()
+	m.dampening.params = params
+}
+
+func (t *dampeningTracker) entry(peer string, route *Route) *PrefixDampening {
+	key := peer + "|" + route.Prefix
+	d, ok := t.prefixes[key]
+	if !ok {
+		d = &PrefixDampening{Peer: peer, Prefix: route.Prefix, Family: route.Family}
+		t.prefixes[key] = d
+	}
+	return d
+}
+
+// penalize decays the penalty to the time of a new event and adds to it
+func (t *dampeningTracker) penalize(d *PrefixDampening, penalty float64, at time.Time) {
+	d.Penalty = t.params.decay(d.Penalty, at.Sub(d.LastChange))
+	d.Penalty = math.Min(d.Penalty+penalty, t.params.maxPenalty())
+	d.LastChange = at
+
+	if d.Suppressed && d.Penalty < t.params.ReuseLimit {
+		d.Suppressed = false
+		d.SuppressedSince = time.Time{}
+	}
+	if !d.Suppressed && d.Penalty > t.params.SuppressLimit {
+		d.Suppressed = true
+		d.SuppressedSince = at
+	}
+
+	if at.After(t.latest) {
+		t.latest = at
+	}
+}
+
+// withdraw records the withdrawal of a route
+func (t *dampeningTracker) withdraw(peer string, old *Route, at time.Time) {
+	if old == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d := t.entry(peer, old)
+	d.Withdrawals++
+	d.withdrawn = true
+	t.penalize(d, t.params.WithdrawPenalty, at)
+}
+
+// announce records a (re-)advertisement. Re-advertising a withdrawn route
+// carries no penalty of its own, since the withdrawal was already charged,
+// but changing the attributes of a route that is still present does.
+func (t *dampeningTracker) announce(peer string, old, route *Route, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := peer + "|" + route.Prefix
+	d, tracked := t.prefixes[key]
+
+	switch {
+	case old != nil && !sameAttributes(old, route):
+		d = t.entry(peer, route)
+		d.Announcements++
+		d.AttributeChanges++
+		t.penalize(d, t.params.AttributePenalty, at)
+	case tracked && d.withdrawn:
+		d.Announcements++
+		d.withdrawn = false
+		t.penalize(d, 0, at)
+	case tracked:
+		d.Announcements++
+	}
+}
+
+// sameAttributes compares the attributes that matter for route selection
+func sameAttributes(a, b *Route) bool {
+	if a.NextHop != b.NextHop || a.Origin != b.Origin || a.MED != b.MED || a.LocalPref != b.LocalPref {
+		return false
+	}
+	if len(a.ASPath) != len(b.ASPath) || len(a.Communities) != len(b.Communities) {
+		return false
+	}
+	for i := range a.ASPath {
+		if a.ASPath[i] != b.ASPath[i] {
+			return false
+		}
+	}
+	for i := range a.Communities {
+		if a.Communities[i] != b.Communities[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// forget drops the history of a removed peer
+func (t *dampeningTracker) forget(peer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, d := range t.prefixes {
+		if d.Peer == peer {
+			delete(t.prefixes, key)
+		}
+	}
+}
+
+// at returns a copy of an entry with its penalty and suppression state
+// evaluated at the given time
+func (t *dampeningTracker) at(d *PrefixDampening, at time.Time) *PrefixDampening {
+	c := *d
+	c.Penalty = t.params.decay(d.Penalty, at.Sub(d.LastChange))
+	if c.Suppressed {
+		if c.Penalty < t.params.ReuseLimit {
+			c.Suppressed = false
+			c.SuppressedSince = time.Time{}
+		} else {
+			// Time until the penalty decays to the reuse limit
+			reuse := time.Duration(math.Log2(c.Penalty/t.params.ReuseLimit) * float64(t.params.HalfLife))
+			c.ReuseAt = at.Add(reuse)
+		}
+	}
+	return &c
+}
+
+// prune drops entries whose penalty has decayed to nothing by the time of
+// the latest event seen
+func (t *dampeningTracker) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, d := range t.prefixes {
+		if !d.Suppressed && t.params.decay(d.Penalty, t.latest.Sub(d.LastChange)) < 1 {
+			delete(t.prefixes, key)
+		}
+	}
+}
+
+// NoisyPrefixes returns up to n prefixes with the highest flap penalty as of
+// the given time, highest first. A zero time means now; pass the time of an
+// imported archive to analyze it as it was. n <= 0 returns all of them.
+func (m *Monitor) NoisyPrefixes(n int, at time.Time) []*PrefixDampening {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	t := m.dampening
+	t.mu.Lock()
+	prefixes := make([]*PrefixDampening, 0, len(t.prefixes))
+	for _, d := range t.prefixes {
+		// Events after the evaluation time are not known yet
+		if d.LastChange.After(at) {
+			continue
+		}
+		if e := t.at(d, at); e.Penalty >= 1 || e.Suppressed {
+			prefixes = append(prefixes, e)
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Penalty != prefixes[j].Penalty {
+			return prefixes[i].Penalty > prefixes[j].Penalty
+		}
+		if prefixes[i].Peer != prefixes[j].Peer {
+			return prefixes[i].Peer < prefixes[j].Peer
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+
+	if n > 0 && len(prefixes) > n {
+		prefixes = prefixes[:n]
+	}
+	return prefixes
+}
+
+// SuppressedPrefixes returns every prefix whose penalty is currently above
+// the reuse limit after having crossed the suppress limit
+func (m *Monitor) SuppressedPrefixes() []*PrefixDampening {
+	suppressed := make([]*PrefixDampening, 0)
+	for _, d := range m.NoisyPrefixes(0, time.Time{}) {
+		if d.Suppressed {
+			suppressed = append(suppressed, d)
+		}
+	}
+	return suppressed
+}
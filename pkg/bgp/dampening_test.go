@@ -0,0 +1,262 @@
+package bgp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDampeningDecay(t *testing.T) {
+	p := DefaultDampening
+
+	tests := []struct {
+		name    string
+		penalty float64
+		after   time.Duration
+		want    float64
+	}{
+		{name: "no time passed", penalty: 1000, want: 1000},
+		{name: "one half-life", penalty: 1000, after: 15 * time.Minute, want: 500},
+		{name: "two half-lives", penalty: 1000, after: 30 * time.Minute, want: 250},
+		{name: "half a half-life", penalty: 1000, after: 450 * time.Second, want: 1000 / math.Sqrt2},
+		{name: "negative duration", penalty: 1000, after: -time.Minute, want: 1000},
+		{name: "zero penalty", after: time.Hour, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.decay(tt.penalty, tt.after); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("decay(%v, %s) = %v, want %v", tt.penalty, tt.after, got, tt.want)
+			}
+		})
+	}
+
+	// Four half-lives of suppression at most, from 750 to 12000
+	if got := p.maxPenalty(); got != 12000 {
+		t.Errorf("maxPenalty() = %v, want 12000", got)
+	}
+}
+
+// dampeningEvent is a change of 198.51.100.0/24 from one peer, after some
+// time from the start
+type dampeningEvent struct {
+	after    time.Duration
+	withdraw bool
+	path     []uint32
+}
+
+func TestNoisyPrefixes(t *testing.T) {
+	withdraw := func(after time.Duration) dampeningEvent { return dampeningEvent{after: after, withdraw: true} }
+	announce := func(after time.Duration, path ...uint32) dampeningEvent {
+		return dampeningEvent{after: after, path: path}
+	}
+	flaps := func(n int) []dampeningEvent {
+		var events []dampeningEvent
+		events = append(events, announce(0, 64500))
+		for i := 0; i < n; i++ {
+			events = append(events, withdraw(0), announce(0, 64500))
+		}
+		return events
+	}
+
+	tests := []struct {
+		name         string
+		events       []dampeningEvent
+		at           time.Duration
+		found        bool
+		penalty      float64
+		suppressed   bool
+		reuseAfter   time.Duration
+		withdrawals  int64
+		announced    int64
+		attrsChanged int64
+	}{
+		{name: "first announcement", events: []dampeningEvent{announce(0, 64500)}},
+		{name: "same attributes again", events: []dampeningEvent{announce(0, 64500), announce(time.Minute, 64500)}},
+		{
+			name:        "withdrawal",
+			events:      []dampeningEvent{announce(0, 64500), withdraw(0)},
+			found:       true,
+			penalty:     1000,
+			withdrawals: 1,
+		},
+		{
+			name:        "withdrawal decayed for a half-life",
+			events:      []dampeningEvent{announce(0, 64500), withdraw(0)},
+			at:          15 * time.Minute,
+			found:       true,
+			penalty:     500,
+			withdrawals: 1,
+		},
+		{
+			name:        "re-announcement is free",
+			events:      []dampeningEvent{announce(0, 64500), withdraw(0), announce(time.Minute, 64500)},
+			at:          time.Minute,
+			found:       true,
+			penalty:     1000 * math.Pow(2, -1.0/15),
+			withdrawals: 1,
+			announced:   1,
+		},
+		{
+			name:         "attribute change",
+			events:       []dampeningEvent{announce(0, 64500), announce(0, 64501, 64500)},
+			found:        true,
+			penalty:      500,
+			announced:    1,
+			attrsChanged: 1,
+		},
+		{
+			name:        "suppressed after three flaps",
+			events:      flaps(3),
+			found:       true,
+			penalty:     3000,
+			suppressed:  true,
+			reuseAfter:  30 * time.Minute,
+			withdrawals: 3,
+			announced:   3,
+		},
+		{
+			name:        "reused once decayed below the reuse limit",
+			events:      flaps(3),
+			at:          31 * time.Minute,
+			found:       true,
+			penalty:     3000 * math.Pow(2, -31.0/15),
+			withdrawals: 3,
+			announced:   3,
+		},
+		{
+			name:        "still suppressed between the limits",
+			events:      flaps(3),
+			at:          20 * time.Minute,
+			found:       true,
+			penalty:     3000 * math.Pow(2, -20.0/15),
+			suppressed:  true,
+			reuseAfter:  30 * time.Minute,
+			withdrawals: 3,
+			announced:   3,
+		},
+		{
+			name:        "capped at the maximum penalty",
+			events:      flaps(20),
+			found:       true,
+			penalty:     12000,
+			suppressed:  true,
+			reuseAfter:  time.Hour,
+			withdrawals: 20,
+			announced:   20,
+		},
+		{
+			name:   "events after the evaluation time",
+			events: []dampeningEvent{announce(0, 64500), withdraw(time.Hour)},
+			at:     30 * time.Minute,
+		},
+		{
+			name:   "decayed to nothing",
+			events: []dampeningEvent{announce(0, 64500), withdraw(0)},
+			at:     4 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Monitor{dampening: newDampeningTracker(DefaultDampening)}
+
+			var current *Route
+			for _, e := range tt.events {
+				at := mrtTime.Add(e.after)
+				if e.withdraw {
+					m.dampening.withdraw("192.0.2.1", current, at)
+					current = nil
+					continue
+				}
+				route := pathRoute(ipPrefix("198.51.100.0/24"), seq(e.path...))
+				m.dampening.announce("192.0.2.1", current, route, at)
+				current = route
+			}
+
+			at := mrtTime.Add(tt.at)
+			noisy := m.NoisyPrefixes(0, at)
+			if !tt.found {
+				if len(noisy) != 0 {
+					t.Errorf("NoisyPrefixes() = %+v, want none", *noisy[0])
+				}
+				return
+			}
+			if len(noisy) != 1 {
+				t.Fatalf("got %d noisy prefixes, want 1", len(noisy))
+			}
+
+			d := noisy[0]
+			if d.Peer != "192.0.2.1" || d.Prefix != "198.51.100.0/24" || d.Family != "ipv4-unicast" {
+				t.Errorf("entry for %s %s %s, want 192.0.2.1 198.51.100.0/24 ipv4-unicast", d.Peer, d.Prefix, d.Family)
+			}
+			if math.Abs(d.Penalty-tt.penalty) > 1e-6 {
+				t.Errorf("penalty = %v, want %v", d.Penalty, tt.penalty)
+			}
+			if d.Withdrawals != tt.withdrawals || d.Announcements != tt.announced || d.AttributeChanges != tt.attrsChanged {
+				t.Errorf("counts = %d withdrawals, %d announcements, %d attribute changes, want %d, %d and %d",
+					d.Withdrawals, d.Announcements, d.AttributeChanges, tt.withdrawals, tt.announced, tt.attrsChanged)
+			}
+			if d.Suppressed != tt.suppressed {
+				t.Errorf("suppressed = %v, want %v", d.Suppressed, tt.suppressed)
+			}
+			if tt.suppressed {
+				if want := mrtTime.Add(tt.reuseAfter); d.ReuseAt.Sub(want).Abs() > time.Millisecond {
+					t.Errorf("reuse at %s, want %s", d.ReuseAt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDampeningPrune(t *testing.T) {
+	tracker := newDampeningTracker(DefaultDampening)
+	old := pathRoute(ipPrefix("198.51.100.0/24"), seq(64500))
+	recent := pathRoute(ipPrefix("203.0.113.0/24"), seq(64500))
+
+	tracker.withdraw("192.0.2.1", old, mrtTime)
+	tracker.withdraw("192.0.2.1", recent, mrtTime.Add(4*time.Hour))
+	tracker.prune()
+
+	if len(tracker.prefixes) != 1 || tracker.prefixes["192.0.2.1|203.0.113.0/24"] == nil {
+		t.Errorf("prefixes after prune = %v, want only 203.0.113.0/24", tracker.prefixes)
+	}
+
+	tracker.forget("192.0.2.1")
+	if len(tracker.prefixes) != 0 {
+		t.Errorf("%d prefixes left after forgetting the peer", len(tracker.prefixes))
+	}
+}
+
+func TestSameAttributes(t *testing.T) {
+	base := Route{NextHop: "192.0.2.1", Origin: "igp", ASPath: []uint32{64500, 64501}, Communities: []string{"64500:1"}}
+
+	tests := []struct {
+		name   string
+		change func(r *Route)
+		want   bool
+	}{
+		{name: "unchanged", change: func(r *Route) {}, want: true},
+		{name: "received later", change: func(r *Route) { r.Received = mrtTime }, want: true},
+		{name: "next hop", change: func(r *Route) { r.NextHop = "192.0.2.2" }},
+		{name: "origin", change: func(r *Route) { r.Origin = "incomplete" }},
+		{name: "MED", change: func(r *Route) { r.MED = 10 }},
+		{name: "local preference", change: func(r *Route) { r.LocalPref = 200 }},
+		{name: "prepended path", change: func(r *Route) { r.ASPath = []uint32{64500, 64500, 64501} }},
+		{name: "different path", change: func(r *Route) { r.ASPath = []uint32{64502, 64501} }},
+		{name: "added community", change: func(r *Route) { r.Communities = []string{"64500:1", "64500:2"} }},
+		{name: "different community", change: func(r *Route) { r.Communities = []string{"64500:2"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := base
+			changed.ASPath = append([]uint32(nil), base.ASPath...)
+			changed.Communities = append([]string(nil), base.Communities...)
+			tt.change(&changed)
+			if got := sameAttributes(&base, &changed); got != tt.want {
+				t.Errorf("sameAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Finding types
+const (
+	FindingMOAS         = "moas"
+	FindingMoreSpecific = "more_specific"
+	FindingRouteLeak    = "route_leak"
+)
+
+// Peer roles, describing the neighbor as seen from the local AS
+const (
+	RoleCustomer = "customer"
+	RoleProvider = "provider"
+	RolePeer     = "peer"
+	RoleRS       = "rs"
+	RoleRSClient = "rs-client"
+)
+
+// AS relationship types. In a p2c relationship AS1 is the provider of AS2.
+const (
+	RelationshipP2C = "p2c"
+	RelationshipP2P = "p2p"
+)
+
+// OwnedPrefix is a prefix of ours and the ASNs allowed to originate it. More
+// specifics up to MaxLength are expected; zero allows the prefix itself only.
+type OwnedPrefix struct {
+	Prefix    string
+	Origins   []uint32
+	MaxLength int
+}
+
+// ASRelationship is a known business relationship between two ASes
+type ASRelationship struct {
+	AS1  uint32
+	AS2  uint32
+	Type string
+}
+
+// DetectionConfig is the registry that received routes are checked against
+type DetectionConfig struct {
+	Prefixes      []OwnedPrefix
+	Relationships []ASRelationship
+}
+
+// Anomaly is a hijack or leak indicator found on a route
+type Anomaly struct {
+	Type   string
+	Detail string
+}
+
+// Finding is an anomalous route and the peer it was learned from
+type Finding struct {
+	Peer    string
+	PeerASN uint32
+	Type    string
+	Detail  string
+	Route   *Route
+}
+
+// Direction of a hop along the propagation of a route
+type hop int
+
+const (
+	hopUnknown hop = iota
+	hopUp          // customer to provider
+	hopFlat        // peer to peer
+	hopDown        // provider to customer
+)
+
+type ownedPrefix struct {
+	prefix    netip.Prefix
+	origins   map[uint32]bool
+	maxLength int
+}
+
+type detector struct {
+	owned []ownedPrefix
+	hops  map[[2]uint32]hop
+}
+
+func newDetector(cfg DetectionConfig) (*detector, error) {
+	d := &detector{hops: make(map[[2]uint32]hop)}
+
+	for _, o := range cfg.Prefixes {
+		p, err := netip.ParsePrefix(o.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q: %w", o.Prefix, err)
+		}
+		p = p.Masked()
+		maxLength := o.MaxLength
+		if maxLength == 0 {
+			maxLength = p.Bits()
+		}
+		if maxLength < p.Bits() || maxLength > p.Addr().BitLen() {
+			return nil, fmt.Errorf("invalid max length %d for %s", o.MaxLength, p)
+		}
+		owned := ownedPrefix{prefix: p, origins: make(map[uint32]bool), maxLength: maxLength}
+		for _, asn := range o.Origins {
+			owned.origins[asn] = true
+		}
+		d.owned = append(d.owned, owned)
+	}
+	// Most specific first, so a route is checked against its closest match
+	sort.Slice(d.owned, func(i, j int) bool {
+		return d.owned[i].prefix.Bits() > d.owned[j].prefix.Bits()
+	})
+
+	for _, r := range cfg.Relationships {
+		switch r.Type {
+		case RelationshipP2C:
+			d.hops[[2]uint32{r.AS2, r.AS1}] = hopUp
+			d.hops[[2]uint32{r.AS1, r.AS2}] = hopDown
+		case RelationshipP2P:
+			d.hops[[2]uint32{r.AS1, r.AS2}] = hopFlat
+			d.hops[[2]uint32{r.AS2, r.AS1}] = hopFlat
+		default:
+			return nil, fmt.Errorf("invalid relationship type %q between AS%d and AS%d", r.Type, r.AS1, r.AS2)
+		}
+	}
+
+	return d, nil
+}
+
+// SetDetection replaces the hijack and leak detection registry and checks
+// every received route against it
+func (m *Monitor) SetDetection(cfg DetectionConfig) error {
+	d, err := newDetector(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.detectMu.Lock()
+	m.detector = d
+	m.detectMu.Unlock()
+
+	m.mu.RLock()
+	peers := make([]*PeerState, 0, len(m.peers))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	m.mu.RUnlock()
+
+	for _, peer := range peers {
+		peer.mu.Lock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				updated := *route
+				updated.Anomalies = nil
+				if m.inspect(peer, &updated) {
+					peer.routes.insert(&updated)
+				}
+			}
+		}
+		m.unlockPeer(peer)
+	}
+	return nil
+}
+
+func (m *Monitor) currentDetector() *detector {
+	m.detectMu.RLock()
+	defer m.detectMu.RUnlock()
+	return m.detector
+}
+
+// inspect checks a received route before it is stored in the peer's
+// Adj-RIB-In, and queues findings for the anomalies the previous version of
+// the route did not have. It reports whether the anomalies changed. Callers
+// must hold peer.mu and release it with unlockPeer.
+func (m *Monitor) inspect(peer *PeerState, route *Route) bool {
+	d := m.currentDetector()
+	if d == nil {
+		return false
+	}
+	route.Anomalies = d.check(route, peer.Config.Role)
+
+	var previous []Anomaly
+	if old, ok := peer.routes.routes[route.Prefix]; ok {
+		previous = old.Anomalies
+	}
+
+	changed := len(previous) != len(route.Anomalies)
+	for _, a := range route.Anomalies {
+		if hasAnomaly(previous, a.Type) {
+			continue
+		}
+		changed = true
+		peer.pending.findings = append(peer.pending.findings, &Finding{
+			Peer:    peer.Address,
+			PeerASN: peer.ASN,
+			Type:    a.Type,
+			Detail:  a.Detail,
+			Route:   route,
+		})
+	}
+	return changed
+}
+
+func hasAnomaly(anomalies []Anomaly, typ string) bool {
+	for _, a := range anomalies {
+		if a.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *detector) check(route *Route, role string) []Anomaly {
+	var anomalies []Anomaly
+
+	if p, err := netip.ParsePrefix(route.Prefix); err == nil {
+		anomalies = append(anomalies, d.checkOrigin(p, route)...)
+	}
+	if detail, ok := d.checkValleyFree(route.ASPath, role); !ok {
+		anomalies = append(anomalies, Anomaly{Type: FindingRouteLeak, Detail: detail})
+	}
+
+	return anomalies
+}
+
+// checkOrigin compares a route against the closest owned prefix covering it
+func (d *detector) checkOrigin(p netip.Prefix, route *Route) []Anomaly {
+	// Routes without an AS path are our own, learned over iBGP
+	if len(route.ASPath) == 0 {
+		return nil
+	}
+
+	for _, o := range d.owned {
+		if o.prefix.Addr().Is4() != p.Addr().Is4() || p.Bits() < o.prefix.Bits() || !o.prefix.Contains(p.Addr()) {
+			continue
+		}
+
+		var anomalies []Anomaly
+		if p.Bits() > o.maxLength {
+			anomalies = append(anomalies, Anomaly{
+				Type:   FindingMoreSpecific,
+				Detail: fmt.Sprintf("more-specific of %s beyond max length /%d, originated by AS%d", o.prefix, o.maxLength, route.OriginAS),
+			})
+		}
+		if !o.origins[route.OriginAS] {
+			origin := "an AS_SET"
+			if route.OriginAS != 0 {
+				origin = fmt.Sprintf("AS%d", route.OriginAS)
+			}
+			anomalies = append(anomalies, Anomaly{
+				Type:   FindingMOAS,
+				Detail: fmt.Sprintf("originated by %s, expected %s for %s", origin, formatOrigins(o.origins), o.prefix),
+			})
+		}
+		return anomalies
+	}
+	return nil
+}
+
+func formatOrigins(origins map[uint32]bool) string {
+	asns := make([]uint32, 0, len(origins))
+	for asn := range origins {
+		asns = append(asns, asn)
+	}
+	sort.Slice(asns, func(i, j int) bool { return asns[i] < asns[j] })
+
+	names := make([]string, len(asns))
+	for i, asn := range asns {
+		names[i] = fmt.Sprintf("AS%d", asn)
+	}
+	return strings.Join(names, " or ")
+}
+
+// checkValleyFree walks an AS path from the origin towards us. A route may
+// climb customer-to-provider links, cross at most one peering link and then
+// only descend provider-to-customer links (Gao-Rexford); anything else means
+// an AS announced a route from a provider or peer to another provider or
+// peer. Hops with unknown relationships are skipped.
+func (d *detector) checkValleyFree(path []uint32, role string) (string, bool) {
+	ases, _ := collapsePrepending(path)
+
+	descending := hopUnknown
+	step := func(sender uint32, h hop) (string, bool) {
+		if h == hopUnknown {
+			return "", true
+		}
+		if descending != hopUnknown && h != hopDown {
+			return fmt.Sprintf("AS%d announces a route learned from its %s to its %s",
+				sender, hopSource(descending), hopTarget(h)), false
+		}
+		if h != hopUp {
+			descending = h
+		}
+		return "", true
+	}
+
+	for i := len(ases) - 1; i > 0; i-- {
+		if detail, ok := step(ases[i], d.hops[[2]uint32{ases[i], ases[i-1]}]); !ok {
+			return detail, false
+		}
+	}
+
+	// The last hop is from the neighbor to us
+	if len(ases) > 0 {
+		var h hop
+		switch role {
+		case RoleCustomer:
+			h = hopUp
+		case RoleProvider:
+			h = hopDown
+		case RolePeer, RoleRS, RoleRSClient:
+			h = hopFlat
+		}
+		if detail, ok := step(ases[0], h); !ok {
+			return detail, false
+		}
+	}
+
+	return "", true
+}
+
+// hopSource names where a route came from after a hop
+func hopSource(h hop) string {
+	if h == hopDown {
+		return "provider"
+	}
+	return "peer"
+}
+
+// hopTarget names who a route is announced to by a hop
+func hopTarget(h hop) string {
+	if h == hopUp {
+		return "provider"
+	}
+	return "peer"
+}
+
+// anomalyCounts returns the number of Adj-RIB-In routes per anomaly type.
+// Callers must hold p.mu.
+func (p *PeerState) anomalyCounts() map[string]int64 {
+	counts := make(map[string]int64)
+	if p.routes == nil {
+		return counts
+	}
+	for typ, n := range p.routes.anomalies {
+		if n > 0 {
+			counts[typ] = n
+		}
+	}
+	return counts
+}
+
+// Findings returns every route with a hijack or leak anomaly, optionally
+// limited to one peer
+func (m *Monitor) Findings(address string) ([]*Finding, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	findings := make([]*Finding, 0)
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				for _, a := range route.Anomalies {
+					findings = append(findings, &Finding{
+						Peer:    peer.Address,
+						PeerASN: peer.ASN,
+						Type:    a.Type,
+						Detail:  a.Detail,
+						Route:   route,
+					})
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Peer != findings[j].Peer {
+			return findings[i].Peer < findings[j].Peer
+		}
+		if findings[i].Route.Prefix != findings[j].Route.Prefix {
+			return findings[i].Route.Prefix < findings[j].Route.Prefix
+		}
+		return findings[i].Type < findings[j].Type
+	})
+	return findings, nil
+}
@@ -0,0 +1,163 @@
+package bgp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewDetector(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DetectionConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "invalid prefix", cfg: DetectionConfig{Prefixes: []OwnedPrefix{{Prefix: "198.51.100.0"}}}, wantErr: "invalid prefix"},
+		{name: "max length shorter than the prefix", cfg: DetectionConfig{Prefixes: []OwnedPrefix{{Prefix: "198.51.100.0/24", MaxLength: 16}}}, wantErr: "invalid max length 16"},
+		{name: "max length past the address", cfg: DetectionConfig{Prefixes: []OwnedPrefix{{Prefix: "198.51.100.0/24", MaxLength: 33}}}, wantErr: "invalid max length 33"},
+		{name: "invalid relationship", cfg: DetectionConfig{Relationships: []ASRelationship{{AS1: 64500, AS2: 64501, Type: "c2p"}}}, wantErr: `invalid relationship type "c2p"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newDetector(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("newDetector: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newDetector() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectorCheck(t *testing.T) {
+	d, err := newDetector(DetectionConfig{
+		Prefixes: []OwnedPrefix{
+			{Prefix: "198.51.0.0/16", Origins: []uint32{64510}, MaxLength: 24},
+			{Prefix: "198.51.100.0/24", Origins: []uint32{64500}},
+			{Prefix: "203.0.113.0/24", Origins: []uint32{64501, 64500}, MaxLength: 25},
+			{Prefix: "2001:db8::/32", Origins: []uint32{64500}, MaxLength: 48},
+		},
+		Relationships: []ASRelationship{
+			{AS1: 64500, AS2: 64501, Type: RelationshipP2C},
+			{AS1: 64500, AS2: 64502, Type: RelationshipP2P},
+			{AS1: 64503, AS2: 64500, Type: RelationshipP2C},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newDetector: %v", err)
+	}
+
+	// route is received with an AS path from the neighbor to the origin
+	route := func(prefix string, path ...uint32) *Route {
+		r := &Route{Prefix: prefix, ASPath: path}
+		if len(path) > 0 {
+			r.OriginAS = path[len(path)-1]
+		}
+		return r
+	}
+	asSet := route("198.51.100.0/24", 64500)
+	asSet.OriginAS = 0
+
+	tests := []struct {
+		name  string
+		route *Route
+		role  string
+		want  []Anomaly
+	}{
+		{name: "expected origin", route: route("198.51.100.0/24", 64500)},
+		{
+			name:  "unexpected origin",
+			route: route("198.51.100.0/24", 64999),
+			want:  []Anomaly{{FindingMOAS, "originated by AS64999, expected AS64500 for 198.51.100.0/24"}},
+		},
+		{
+			name:  "origin in an AS_SET",
+			route: asSet,
+			want:  []Anomaly{{FindingMOAS, "originated by an AS_SET, expected AS64500 for 198.51.100.0/24"}},
+		},
+		{
+			name:  "one of several expected origins",
+			route: route("203.0.113.0/24", 64501),
+		},
+		{
+			name:  "other origins listed in order",
+			route: route("203.0.113.0/24", 64999),
+			want:  []Anomaly{{FindingMOAS, "originated by AS64999, expected AS64500 or AS64501 for 203.0.113.0/24"}},
+		},
+		{name: "more-specific within max length", route: route("203.0.113.128/25", 64500)},
+		{
+			name:  "more-specific beyond max length",
+			route: route("198.51.100.0/25", 64500),
+			want:  []Anomaly{{FindingMoreSpecific, "more-specific of 198.51.100.0/24 beyond max length /24, originated by AS64500"}},
+		},
+		{
+			name:  "more-specific from another origin",
+			route: route("203.0.113.0/26", 64999),
+			want: []Anomaly{
+				{FindingMoreSpecific, "more-specific of 203.0.113.0/24 beyond max length /25, originated by AS64999"},
+				{FindingMOAS, "originated by AS64999, expected AS64500 or AS64501 for 203.0.113.0/24"},
+			},
+		},
+		{name: "covered by the less specific owned prefix", route: route("198.51.5.0/24", 64510)},
+		{
+			name:  "checked against the closest owned prefix",
+			route: route("198.51.100.0/24", 64510),
+			want:  []Anomaly{{FindingMOAS, "originated by AS64510, expected AS64500 for 198.51.100.0/24"}},
+		},
+		{name: "less specific than owned", route: route("198.0.0.0/8", 64999)},
+		{name: "IPv6 within max length", route: route("2001:db8:1::/48", 64500)},
+		{
+			name:  "IPv6 beyond max length",
+			route: route("2001:db8:1::/49", 64500),
+			want:  []Anomaly{{FindingMoreSpecific, "more-specific of 2001:db8::/32 beyond max length /48, originated by AS64500"}},
+		},
+		{name: "own route over iBGP", route: route("198.51.100.0/25")},
+
+		{name: "customer route from a customer", route: route("192.0.2.0/24", 64500, 64501), role: RoleCustomer},
+		{name: "customer route from a provider", route: route("192.0.2.0/24", 64503, 64500, 64501), role: RoleProvider},
+		{name: "provider route from a provider", route: route("192.0.2.0/24", 64500, 64503), role: RoleProvider},
+		{name: "prepending ignored", route: route("192.0.2.0/24", 64500, 64500, 64501, 64501), role: RoleCustomer},
+		{name: "unknown relationships skipped", route: route("192.0.2.0/24", 64999, 64501, 64998)},
+		{
+			name:  "provider route to a peer",
+			route: route("192.0.2.0/24", 64502, 64500, 64503, 64999),
+			role:  RolePeer,
+			want:  []Anomaly{{FindingRouteLeak, "AS64500 announces a route learned from its provider to its peer"}},
+		},
+		{
+			name:  "provider route to a provider",
+			route: route("192.0.2.0/24", 64500, 64503),
+			role:  RoleCustomer,
+			want:  []Anomaly{{FindingRouteLeak, "AS64500 announces a route learned from its provider to its provider"}},
+		},
+		{
+			name:  "peer route to a peer",
+			route: route("192.0.2.0/24", 64502, 64500, 64501),
+			role:  RoleRS,
+			want:  []Anomaly{{FindingRouteLeak, "AS64502 announces a route learned from its peer to its peer"}},
+		},
+		{
+			name:  "hijack and leak",
+			route: route("198.51.100.0/24", 64500, 64503),
+			role:  RoleCustomer,
+			want: []Anomaly{
+				{FindingMOAS, "originated by AS64503, expected AS64500 for 198.51.100.0/24"},
+				{FindingRouteLeak, "AS64500 announces a route learned from its provider to its provider"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.check(tt.route, tt.role); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package bgp
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// PeerEvent describes a single FSM transition of a monitored peer
+type PeerEvent struct {
+	Timestamp   time.Time
+	Address     string
+	ASN         uint32
+	OldState    string
+	NewState    string
+	Established bool
+
+	// Why the session went down, when known
+	Reason       string
+	Notification *Notification
+}
+
+// pendingEvents are the events raised while a peer is locked. They are
+// published once the lock is released, so that subscribers are never
+// notified under the monitor's locks.
+type pendingEvents struct {
+	findings    []*Finding
+	limits      []*PrefixLimitEvent
+	convergence []*ConvergenceEvent
+}
+
+// unlockPeer releases peer.mu and publishes the events raised while it was
+// held
+func (m *Monitor) unlockPeer(peer *PeerState) {
+	pending := peer.pending
+	peer.pending = pendingEvents{}
+	peer.mu.Unlock()
+
+	for _, finding := range pending.findings {
+		m.findingSubs.publish(finding)
+	}
+	for _, event := range pending.limits {
+		m.limitSubs.publish(event)
+	}
+	for _, event := range pending.convergence {
+		m.convergenceSubs.publish(event)
+	}
+}
+
+// subscribers fans events out to the channels registered with subscribe.
+// A subscriber that does not keep up misses events instead of blocking the
+// publisher.
+type subscribers[T any] struct {
+	describe func(T) string
+	chans    map[chan T]struct{}
+	mu       sync.Mutex
+}
+
+// newSubscribers creates a subscriber list. describe names an event that is
+// dropped for a full channel in the log.
+func newSubscribers[T any](describe func(T) string) *subscribers[T] {
+	return &subscribers[T]{
+		describe: describe,
+		chans:    make(map[chan T]struct{}),
+	}
+}
+
+// subscribe registers a channel that receives every event. The returned
+// function cancels the subscription and closes the channel.
+func (s *subscribers[T]) subscribe() (<-chan T, func()) {
+	ch := make(chan T, 100)
+
+	s.mu.Lock()
+	s.chans[ch] = struct{}{}
+	s.mu.Unlock()
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.chans[ch]; ok {
+			delete(s.chans, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+func (s *subscribers[T]) publish(event T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.chans {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Warning: subscriber channel full, dropping %s", s.describe(event))
+		}
+	}
+}
+
+func describePeerEvent(e PeerEvent) string {
+	return fmt.Sprintf("peer event for %s", e.Address)
+}
+
+func describeFinding(f *Finding) string {
+	return fmt.Sprintf("%s finding for %s", f.Type, f.Route.Prefix)
+}
+
+func describePrefixLimit(e *PrefixLimitEvent) string {
+	return fmt.Sprintf("%s prefix limit event for %s", e.Level, e.Peer)
+}
+
+func describeConvergence(e *ConvergenceEvent) string {
+	return fmt.Sprintf("%s convergence event for %s", e.Type, e.Peer)
+}
+
+func describeInjection(e *InjectionAudit) string {
+	return fmt.Sprintf("%s injection audit entry for %s", e.Action, e.Prefix)
+}
+
+// Subscribe registers a channel that receives every peer state transition.
+// The returned function cancels the subscription and closes the channel.
+func (m *Monitor) Subscribe() (<-chan PeerEvent, func()) {
+	return m.peerSubs.subscribe()
+}
+
+// SubscribeFindings registers a channel that receives every new hijack or
+// route leak finding. The returned function cancels the subscription and
+// closes the channel.
+func (m *Monitor) SubscribeFindings() (<-chan *Finding, func()) {
+	return m.findingSubs.subscribe()
+}
+
+// SubscribePrefixLimits registers a channel that receives every prefix limit
+// threshold crossing. The returned function cancels the subscription and
+// closes the channel.
+func (m *Monitor) SubscribePrefixLimits() (<-chan *PrefixLimitEvent, func()) {
+	return m.limitSubs.subscribe()
+}
+
+// SubscribeConvergence registers a channel that receives every initial
+// convergence and stabilization after a flap. The returned function cancels
+// the subscription and closes the channel.
+func (m *Monitor) SubscribeConvergence() (<-chan *ConvergenceEvent, func()) {
+	return m.convergenceSubs.subscribe()
+}
+
+// SubscribeInjections registers a channel that receives every injection
+// audit entry. The returned function cancels the subscription and closes the
+// channel.
+func (m *Monitor) SubscribeInjections() (<-chan *InjectionAudit, func()) {
+	return m.injectionSubs.subscribe()
+}
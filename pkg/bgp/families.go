@@ -0,0 +1,286 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// How often accepted and advertised counters are read from GoBGP
+const counterInterval = 30 * time.Second
+
+// DefaultFamilies is negotiated when a peer does not configure any families
+var DefaultFamilies = []string{"ipv4-unicast"}
+
+// FamilyCounts holds the prefix counters of a peer for one AFI/SAFI
+type FamilyCounts struct {
+	AFI        string
+	SAFI       string
+	Received   int64
+	Accepted   int64
+	Advertised int64
+	Best       int64
+}
+
+var afiNames = map[uint16]string{
+	bgp.AFI_IP:     "ipv4",
+	bgp.AFI_IP6:    "ipv6",
+	bgp.AFI_L2VPN:  "l2vpn",
+	bgp.AFI_LS:     "ls",
+	bgp.AFI_OPAQUE: "opaque",
+}
+
+var safiNames = map[uint8]string{
+	bgp.SAFI_UNICAST:                  "unicast",
+	bgp.SAFI_MULTICAST:                "multicast",
+	bgp.SAFI_MPLS_LABEL:               "mpls-label",
+	bgp.SAFI_MPLS_VPN:                 "mpls-vpn",
+	bgp.SAFI_MPLS_VPN_MULTICAST:       "mpls-vpn-multicast",
+	bgp.SAFI_EVPN:                     "evpn",
+	bgp.SAFI_VPLS:                     "vpls",
+	bgp.SAFI_LS:                       "ls",
+	bgp.SAFI_FLOW_SPEC_UNICAST:        "flowspec",
+	bgp.SAFI_FLOW_SPEC_VPN:            "flowspec-vpn",
+	bgp.SAFI_ROUTE_TARGET_CONSTRAINTS: "rtc",
+	bgp.SAFI_ENCAPSULATION:            "encapsulation",
+	bgp.SAFI_SRPOLICY:                 "sr-policy",
+	bgp.SAFI_MUP:                      "mup",
+}
+
+// ValidateFamily checks that a family name (e.g. "ipv6-unicast",
+// "l3vpn-ipv4-unicast", "l2vpn-evpn") is known to GoBGP
+func ValidateFamily(name string) error {
+	if _, err := bgp.GetRouteFamily(name); err != nil {
+		return fmt.Errorf("unsupported address family %q", name)
+	}
+	return nil
+}
+
+// FamilyAFISAFI returns the AFI and SAFI label values of a family name
+func FamilyAFISAFI(name string) (string, string) {
+	rf, err := bgp.GetRouteFamily(name)
+	if err != nil {
+		return name, ""
+	}
+
+	afi, safi := bgp.RouteFamilyToAfiSafi(rf)
+	afiName, ok := afiNames[afi]
+	if !ok {
+		afiName = strconv.Itoa(int(afi))
+	}
+	safiName, ok := safiNames[safi]
+	if !ok {
+		safiName = strconv.Itoa(int(safi))
+	}
+	return afiName, safiName
+}
+
+func toAPIFamily(name string) (*api.Family, error) {
+	rf, err := bgp.GetRouteFamily(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported address family %q", name)
+	}
+	afi, safi := bgp.RouteFamilyToAfiSafi(rf)
+	return apiutil.ToApiFamily(afi, safi), nil
+}
+
+// apiFamilies returns the GoBGP families negotiated with the peer
+func (p *PeerState) apiFamilies() []*api.Family {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	families := make([]*api.Family, 0, len(p.families))
+	for _, name := range p.families {
+		if family, err := toAPIFamily(name); err == nil {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// familyCounts merges the live Adj-RIB counts with the counters last read
+// from GoBGP. Callers must hold p.mu.
+func (p *PeerState) familyCounts() map[string]FamilyCounts {
+	counts := make(map[string]FamilyCounts)
+	get := func(name string) FamilyCounts {
+		if c, ok := counts[name]; ok {
+			return c
+		}
+		c := p.counters[name]
+		c.AFI, c.SAFI = FamilyAFISAFI(name)
+		return c
+	}
+
+	for _, name := range p.families {
+		counts[name] = get(name)
+	}
+	for name := range p.counters {
+		counts[name] = get(name)
+	}
+	if p.routes != nil {
+		for name, n := range p.routes.counts {
+			c := get(name)
+			c.Received = n
+			counts[name] = c
+		}
+	}
+	if p.Source != SourceBGP && p.routesOut != nil {
+		for name, n := range p.routesOut.counts {
+			c := get(name)
+			c.Advertised = n
+			counts[name] = c
+		}
+	}
+	return counts
+}
+
+func (m *Monitor) refreshCounters() {
+	ticker := time.NewTicker(counterInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.updateCounters()
+			m.dampening.prune()
+		}
+	}
+}
+
+// bestPaths counts the best paths each peer contributes to the global table,
+// kept up to date from GoBGP best path events instead of walking the table
+type bestPaths struct {
+	// Peer and family of the best path per NLRI
+	owners map[string]bestOwner
+	// Best paths per peer and family
+	counts map[string]map[string]int64
+	mu     sync.Mutex
+}
+
+type bestOwner struct {
+	peer   string
+	family string
+}
+
+func newBestPaths() *bestPaths {
+	return &bestPaths{
+		owners: make(map[string]bestOwner),
+		counts: make(map[string]map[string]int64),
+	}
+}
+
+// update applies best path changes. A withdrawn path means the NLRI has no
+// best path left.
+func (b *bestPaths) update(paths []*api.Path) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, path := range paths {
+		route, err := routeFromPath(path)
+		if err != nil {
+			continue
+		}
+		if old, ok := b.owners[route.Prefix]; ok {
+			b.counts[old.peer][old.family]--
+			delete(b.owners, route.Prefix)
+		}
+		if path.IsWithdraw {
+			continue
+		}
+
+		b.owners[route.Prefix] = bestOwner{peer: path.NeighborIp, family: route.Family}
+		if b.counts[path.NeighborIp] == nil {
+			b.counts[path.NeighborIp] = make(map[string]int64)
+		}
+		b.counts[path.NeighborIp][route.Family]++
+	}
+}
+
+// peerCounts returns the best paths of a peer per family
+func (b *bestPaths) peerCounts(address string) map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counts := make(map[string]int64, len(b.counts[address]))
+	for family, n := range b.counts[address] {
+		counts[family] = n
+	}
+	return counts
+}
+
+// watchBestPaths follows best path changes in the global table
+func (m *Monitor) watchBestPaths() error {
+	req := &api.WatchEventRequest{
+		Table: &api.WatchEventRequest_Table{
+			Filters: []*api.WatchEventRequest_Table_Filter{
+				{
+					Type: api.WatchEventRequest_Table_Filter_BEST,
+					Init: true,
+				},
+			},
+		},
+	}
+
+	return m.server.WatchEvent(m.ctx, req, func(resp *api.WatchEventResponse) {
+		if ev, ok := resp.Event.(*api.WatchEventResponse_Table); ok {
+			m.best.update(ev.Table.Paths)
+		}
+	})
+}
+
+// updateCounters reads accepted and advertised counts per family from GoBGP
+// and adds the best paths each peer contributes to the global table
+func (m *Monitor) updateCounters() {
+	ctx := context.Background()
+	counters := make(map[string]map[string]FamilyCounts)
+
+	err := m.server.ListPeer(ctx, &api.ListPeerRequest{EnableAdvertised: true}, func(p *api.Peer) {
+		if p.State == nil {
+			return
+		}
+		families := make(map[string]FamilyCounts)
+		for _, afiSafi := range p.AfiSafis {
+			if afiSafi.Config == nil || afiSafi.State == nil {
+				continue
+			}
+			name := apiutil.ToRouteFamily(afiSafi.Config.Family).String()
+			families[name] = FamilyCounts{
+				Accepted:   int64(afiSafi.State.Accepted),
+				Advertised: int64(afiSafi.State.Advertised),
+			}
+		}
+		counters[p.State.NeighborAddress] = families
+	})
+	if err != nil {
+		return
+	}
+
+	for address, perFamily := range counters {
+		for name, n := range m.best.peerCounts(address) {
+			c := perFamily[name]
+			c.Best = n
+			perFamily[name] = c
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for address, perFamily := range counters {
+		peer, ok := m.peers[address]
+		if !ok {
+			continue
+		}
+		peer.mu.Lock()
+		peer.counters = perFamily
+		peer.mu.Unlock()
+	}
+}
@@ -0,0 +1,461 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// FlowSpec traffic actions that may be originated
+const (
+	FlowSpecDiscard   = "discard"
+	FlowSpecRateLimit = "rate-limit"
+)
+
+// FlowSpecMatch is one match component of a FlowSpec rule, e.g. type
+// "destination-port" with value ">=1024&<=2048"
+type FlowSpecMatch struct {
+	Type  string
+	Value string
+}
+
+// FlowSpecAction is a traffic action extended community of a FlowSpec rule,
+// e.g. type "rate-limit" with value "8000000 bps"
+type FlowSpecAction struct {
+	Type  string
+	Value string
+}
+
+// FlowSpecRule is a FlowSpec route in a peer's Adj-RIB-In
+type FlowSpecRule struct {
+	Peer     string
+	Family   string
+	Rule     string
+	Match    []FlowSpecMatch
+	Actions  []FlowSpecAction
+	Received time.Time
+}
+
+// FlowSpecRequest originates a FlowSpec rule through the local speaker until
+// the TTL runs out. The destination must be within the injection allow-list.
+// Ports and packet lengths are single values or lo-hi ranges; protocols are
+// names (tcp, udp, icmp, ...) or numbers. Rate is in bits per second and
+// only used by rate-limit rules.
+type FlowSpecRequest struct {
+	Destination      string
+	Source           string
+	Protocols        []string
+	DestinationPorts []string
+	SourcePorts      []string
+	PacketLengths    []string
+	Action           string
+	Rate             uint64
+	TTL              time.Duration
+	User             string
+	Reason           string
+}
+
+// FlowSpecInjection is a FlowSpec rule currently originated through the
+// injection API
+type FlowSpecInjection struct {
+	Rule      string
+	Family    string
+	Match     []FlowSpecMatch
+	Action    string
+	Rate      uint64
+	User      string
+	Reason    string
+	Announced time.Time
+	Expires   time.Time
+
+	// GoBGP path identifier used to withdraw it
+	uuid []byte
+}
+
+// TrafficAction describes what the rule does to matching traffic, e.g.
+// "rate-limit 8000000 bps"
+func (f *FlowSpecInjection) TrafficAction() string {
+	return formatFlowSpecAction(f.Action, f.Rate)
+}
+
+func formatFlowSpecAction(action string, rate uint64) string {
+	if action == FlowSpecRateLimit {
+		return fmt.Sprintf("%s %d bps", action, rate)
+	}
+	return action
+}
+
+// FlowSpecRules returns the IPv4 and IPv6 FlowSpec rules received from every
+// peer, or from one peer, sorted by peer and rule
+func (m *Monitor) FlowSpecRules(address string) ([]*FlowSpecRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	rules := make([]*FlowSpecRule, 0)
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				if rule := flowSpecRule(route); rule != nil {
+					rule.Peer = peer.Address
+					rules = append(rules, rule)
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Peer != rules[j].Peer {
+			return rules[i].Peer < rules[j].Peer
+		}
+		return rules[i].Rule < rules[j].Rule
+	})
+	return rules, nil
+}
+
+// flowSpecRule decodes a route of an IPv4 or IPv6 FlowSpec family, or
+// returns nil for other routes
+func flowSpecRule(route *Route) *FlowSpecRule {
+	var components []bgp.FlowSpecComponentInterface
+	switch nlri := route.nlri.(type) {
+	case *bgp.FlowSpecIPv4Unicast:
+		components = nlri.Value
+	case *bgp.FlowSpecIPv6Unicast:
+		components = nlri.Value
+	default:
+		return nil
+	}
+
+	rule := &FlowSpecRule{
+		Family:   route.Family,
+		Rule:     route.Prefix,
+		Match:    flowSpecMatches(components),
+		Actions:  make([]FlowSpecAction, 0),
+		Received: route.Received,
+	}
+	for _, attr := range route.attrs {
+		ext, ok := attr.(*bgp.PathAttributeExtendedCommunities)
+		if !ok {
+			continue
+		}
+		for _, c := range ext.Value {
+			if action, ok := flowSpecAction(c); ok {
+				rule.Actions = append(rule.Actions, action)
+			}
+		}
+	}
+	return rule
+}
+
+func flowSpecMatches(components []bgp.FlowSpecComponentInterface) []FlowSpecMatch {
+	matches := make([]FlowSpecMatch, 0, len(components))
+	for _, c := range components {
+		typ := c.Type().String()
+		// Components format themselves as "[type: value]"
+		value := strings.TrimSuffix(strings.TrimPrefix(c.String(), "["+typ+": "), "]")
+		matches = append(matches, FlowSpecMatch{Type: typ, Value: value})
+	}
+	return matches
+}
+
+// flowSpecAction decodes a traffic action extended community (RFC 8955)
+func flowSpecAction(c bgp.ExtendedCommunityInterface) (FlowSpecAction, bool) {
+	switch e := c.(type) {
+	case *bgp.TrafficRateExtended:
+		if e.Rate == 0 {
+			return FlowSpecAction{Type: FlowSpecDiscard}, true
+		}
+		// The rate is carried in bytes per second
+		return FlowSpecAction{Type: FlowSpecRateLimit, Value: fmt.Sprintf("%.0f bps", float64(e.Rate)*8)}, true
+	case *bgp.TrafficActionExtended:
+		var flags []string
+		if e.Terminal {
+			flags = append(flags, "terminal")
+		}
+		if e.Sample {
+			flags = append(flags, "sample")
+		}
+		return FlowSpecAction{Type: "traffic-action", Value: strings.Join(flags, ",")}, true
+	case *bgp.TrafficRemarkExtended:
+		return FlowSpecAction{Type: "remark", Value: fmt.Sprintf("dscp %d", e.DSCP)}, true
+	case *bgp.RedirectTwoOctetAsSpecificExtended:
+		return FlowSpecAction{Type: "redirect", Value: e.TwoOctetAsSpecificExtended.String()}, true
+	case *bgp.RedirectIPv4AddressSpecificExtended:
+		return FlowSpecAction{Type: "redirect", Value: e.IPv4AddressSpecificExtended.String()}, true
+	case *bgp.RedirectFourOctetAsSpecificExtended:
+		return FlowSpecAction{Type: "redirect", Value: e.FourOctetAsSpecificExtended.String()}, true
+	}
+	return FlowSpecAction{}, false
+}
+
+// InjectFlowSpec originates a FlowSpec rule to every peer that negotiated
+// the FlowSpec family. Originating a rule that is already announced replaces
+// its action and TTL. Every request, including refused ones, is audited.
+func (m *Monitor) InjectFlowSpec(req FlowSpecRequest) (*FlowSpecInjection, error) {
+	now := time.Now()
+	entry := &InjectionAudit{
+		Timestamp:     now,
+		Action:        InjectionAnnounce,
+		Prefix:        req.Destination,
+		TrafficAction: formatFlowSpecAction(req.Action, req.Rate),
+		TTL:           req.TTL,
+		User:          req.User,
+		Reason:        req.Reason,
+	}
+
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	rule, path, err := m.flowSpecPath(req, now)
+	if err != nil {
+		entry.Action = InjectionDenied
+		entry.Error = err.Error()
+		m.audit(entry)
+		return nil, err
+	}
+	entry.Prefix = rule.Rule
+
+	// Let originated rules through the export policy before the first one
+	// is announced
+	if err := m.ensureInjectPolicy(); err != nil {
+		entry.Error = err.Error()
+		m.audit(entry)
+		return nil, err
+	}
+
+	resp, err := m.server.AddPath(context.Background(), &api.AddPathRequest{
+		TableType: api.TableType_GLOBAL,
+		Path:      path,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to announce FlowSpec rule %s: %w", rule.Rule, err)
+		entry.Error = err.Error()
+		m.audit(entry)
+		return nil, err
+	}
+	rule.uuid = resp.Uuid
+
+	m.flowSpecs[rule.Rule] = rule
+	m.audit(entry)
+
+	r := *rule
+	return &r, nil
+}
+
+// WithdrawFlowSpec withdraws an originated FlowSpec rule before its TTL
+// runs out
+func (m *Monitor) WithdrawFlowSpec(rule, user, reason string) error {
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	injection, ok := m.flowSpecs[rule]
+	if !ok {
+		return fmt.Errorf("FlowSpec rule %s is not announced", rule)
+	}
+	return m.withdrawFlowSpec(injection, InjectionWithdraw, user, reason)
+}
+
+// FlowSpecInjections returns the FlowSpec rules currently originated,
+// sorted by rule
+func (m *Monitor) FlowSpecInjections() []*FlowSpecInjection {
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	rules := make([]*FlowSpecInjection, 0, len(m.flowSpecs))
+	for _, rule := range m.flowSpecs {
+		r := *rule
+		rules = append(rules, &r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Rule < rules[j].Rule
+	})
+	return rules
+}
+
+// flowSpecPath checks a request against the injection guardrails and builds
+// the path to announce. Callers must hold m.injectMu.
+func (m *Monitor) flowSpecPath(req FlowSpecRequest, now time.Time) (*FlowSpecInjection, *api.Path, error) {
+	if req.Destination == "" {
+		return nil, nil, fmt.Errorf("a destination prefix is required")
+	}
+	dst, err := m.checkInjection(req.Destination, req.TTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	ipv4 := dst.Addr().Is4()
+
+	var rate float32
+	switch req.Action {
+	case FlowSpecDiscard:
+		if req.Rate != 0 {
+			return nil, nil, fmt.Errorf("a rate is only allowed with %s", FlowSpecRateLimit)
+		}
+	case FlowSpecRateLimit:
+		if req.Rate == 0 {
+			return nil, nil, fmt.Errorf("%s requires a rate", FlowSpecRateLimit)
+		}
+		rate = float32(req.Rate) / 8
+	default:
+		return nil, nil, fmt.Errorf("action must be %s or %s", FlowSpecDiscard, FlowSpecRateLimit)
+	}
+
+	components := []bgp.FlowSpecComponentInterface{flowSpecPrefix(dst, true)}
+	if req.Source != "" {
+		src, err := parsePrefix(req.Source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid source: %w", err)
+		}
+		if src.Addr().Is4() != ipv4 {
+			return nil, nil, fmt.Errorf("source %s is not in the same address family as %s", src, dst)
+		}
+		components = append(components, flowSpecPrefix(src, false))
+	}
+
+	for _, c := range []struct {
+		typ    bgp.BGPFlowSpecType
+		values []string
+		parse  func(string) ([]*bgp.FlowSpecComponentItem, error)
+	}{
+		{bgp.FLOW_SPEC_TYPE_IP_PROTO, req.Protocols, parseFlowSpecProtocol},
+		{bgp.FLOW_SPEC_TYPE_DST_PORT, req.DestinationPorts, flowSpecRange(65535)},
+		{bgp.FLOW_SPEC_TYPE_SRC_PORT, req.SourcePorts, flowSpecRange(65535)},
+		{bgp.FLOW_SPEC_TYPE_PKT_LEN, req.PacketLengths, flowSpecRange(65535)},
+	} {
+		if len(c.values) == 0 {
+			continue
+		}
+		// Values of a component match if any of them does
+		var items []*bgp.FlowSpecComponentItem
+		for _, v := range c.values {
+			parsed, err := c.parse(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", c.typ, err)
+			}
+			items = append(items, parsed...)
+		}
+		components = append(components, bgp.NewFlowSpecComponent(c.typ, items))
+	}
+
+	var nlri bgp.AddrPrefixInterface
+	nextHop := "0.0.0.0"
+	if ipv4 {
+		nlri = bgp.NewFlowSpecIPv4Unicast(components)
+	} else {
+		nlri = bgp.NewFlowSpecIPv6Unicast(components)
+		nextHop = "::"
+	}
+	attrs := []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+		bgp.NewPathAttributeMpReachNLRI(nextHop, []bgp.AddrPrefixInterface{nlri}),
+		bgp.NewPathAttributeExtendedCommunities([]bgp.ExtendedCommunityInterface{
+			bgp.NewTrafficRateExtended(0, rate),
+		}),
+	}
+
+	path, err := apiutil.NewPath(nlri, false, attrs, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build FlowSpec path: %w", err)
+	}
+
+	injection := &FlowSpecInjection{
+		Rule:      nlri.String(),
+		Family:    bgp.AfiSafiToRouteFamily(nlri.AFI(), nlri.SAFI()).String(),
+		Match:     flowSpecMatches(components),
+		Action:    req.Action,
+		Rate:      req.Rate,
+		User:      req.User,
+		Reason:    req.Reason,
+		Announced: now,
+		Expires:   now.Add(req.TTL),
+	}
+	return injection, path, nil
+}
+
+func flowSpecPrefix(p netip.Prefix, destination bool) bgp.FlowSpecComponentInterface {
+	bits, addr := uint8(p.Bits()), p.Addr().String()
+	switch {
+	case p.Addr().Is4() && destination:
+		return bgp.NewFlowSpecDestinationPrefix(bgp.NewIPAddrPrefix(bits, addr))
+	case p.Addr().Is4():
+		return bgp.NewFlowSpecSourcePrefix(bgp.NewIPAddrPrefix(bits, addr))
+	case destination:
+		return bgp.NewFlowSpecDestinationPrefix6(bgp.NewIPv6AddrPrefix(bits, addr), 0)
+	default:
+		return bgp.NewFlowSpecSourcePrefix6(bgp.NewIPv6AddrPrefix(bits, addr), 0)
+	}
+}
+
+// parseFlowSpecProtocol parses an IP protocol name or number
+func parseFlowSpecProtocol(s string) ([]*bgp.FlowSpecComponentItem, error) {
+	for proto, name := range bgp.ProtocolNameMap {
+		if proto != bgp.Unknown && strings.EqualFold(s, name) {
+			return []*bgp.FlowSpecComponentItem{bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_EQ, uint64(proto))}, nil
+		}
+	}
+	return flowSpecRange(255)(s)
+}
+
+// flowSpecRange returns a parser of a single value or a lo-hi range up to
+// max
+func flowSpecRange(max uint64) func(string) ([]*bgp.FlowSpecComponentItem, error) {
+	return func(s string) ([]*bgp.FlowSpecComponentItem, error) {
+		lo, hi, isRange := strings.Cut(s, "-")
+		low, err := strconv.ParseUint(lo, 10, 64)
+		if err != nil || low > max {
+			return nil, fmt.Errorf("%q is not a number between 0 and %d", s, max)
+		}
+		if !isRange {
+			return []*bgp.FlowSpecComponentItem{bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_EQ, low)}, nil
+		}
+		high, err := strconv.ParseUint(hi, 10, 64)
+		if err != nil || high > max || high < low {
+			return nil, fmt.Errorf("%q is not a range between 0 and %d", s, max)
+		}
+		return []*bgp.FlowSpecComponentItem{
+			bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_GT_EQ, low),
+			bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_AND|bgp.DEC_NUM_OP_LT_EQ, high),
+		}, nil
+	}
+}
+
+// withdrawFlowSpec withdraws an originated FlowSpec rule and audits why.
+// Callers must hold m.injectMu.
+func (m *Monitor) withdrawFlowSpec(rule *FlowSpecInjection, action, user, reason string) error {
+	entry := &InjectionAudit{
+		Timestamp:     time.Now(),
+		Action:        action,
+		Prefix:        rule.Rule,
+		TrafficAction: rule.TrafficAction(),
+		User:          user,
+		Reason:        reason,
+	}
+
+	if err := m.deletePath(rule.Family, rule.uuid); err != nil {
+		err = fmt.Errorf("failed to withdraw FlowSpec rule %s: %w", rule.Rule, err)
+		entry.Error = err.Error()
+		m.audit(entry)
+		return err
+	}
+
+	delete(m.flowSpecs, rule.Rule)
+	m.audit(entry)
+	return nil
+}
@@ -0,0 +1,255 @@
+package bgp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// formatItems formats parsed values the way rules show them
+func formatItems(items []*bgp.FlowSpecComponentItem) string {
+	c := bgp.NewFlowSpecComponent(bgp.FLOW_SPEC_TYPE_DST_PORT, items)
+	return flowSpecMatches([]bgp.FlowSpecComponentInterface{c})[0].Value
+}
+
+func TestFlowSpecRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "single value", value: "80", want: "==80"},
+		{name: "range", value: "1024-2048", want: ">=1024&<=2048"},
+		{name: "range of one", value: "53-53", want: ">=53&<=53"},
+		{name: "maximum", value: "65535", want: "==65535"},
+		{name: "above maximum", value: "65536", wantErr: true},
+		{name: "range above maximum", value: "1-65536", wantErr: true},
+		{name: "reversed range", value: "2048-1024", wantErr: true},
+		{name: "not a number", value: "http", wantErr: true},
+		{name: "open range", value: "1024-", wantErr: true},
+		{name: "negative", value: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := flowSpecRange(65535)(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("flowSpecRange(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && formatItems(items) != tt.want {
+				t.Errorf("flowSpecRange(%q) = %s, want %s", tt.value, formatItems(items), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlowSpecProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "name", value: "tcp", want: "==6"},
+		{name: "name in upper case", value: "UDP", want: "==17"},
+		{name: "number", value: "47", want: "==47"},
+		{name: "range", value: "6-17", want: ">=6&<=17"},
+		{name: "out of range", value: "256", wantErr: true},
+		{name: "unknown name", value: "quic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseFlowSpecProtocol(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlowSpecProtocol(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && formatItems(items) != tt.want {
+				t.Errorf("parseFlowSpecProtocol(%q) = %s, want %s", tt.value, formatItems(items), tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowSpecAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		community bgp.ExtendedCommunityInterface
+		want      FlowSpecAction
+		ok        bool
+	}{
+		{name: "discard", community: bgp.NewTrafficRateExtended(0, 0), want: FlowSpecAction{Type: FlowSpecDiscard}, ok: true},
+		{name: "rate limit", community: bgp.NewTrafficRateExtended(0, 1000000), want: FlowSpecAction{Type: FlowSpecRateLimit, Value: "8000000 bps"}, ok: true},
+		{name: "terminal sample", community: bgp.NewTrafficActionExtended(true, true), want: FlowSpecAction{Type: "traffic-action", Value: "terminal,sample"}, ok: true},
+		{name: "no traffic action flags", community: bgp.NewTrafficActionExtended(false, false), want: FlowSpecAction{Type: "traffic-action"}, ok: true},
+		{name: "remark", community: bgp.NewTrafficRemarkExtended(46), want: FlowSpecAction{Type: "remark", Value: "dscp 46"}, ok: true},
+		{name: "redirect to two-octet AS target", community: bgp.NewRedirectTwoOctetAsSpecificExtended(65000, 100), want: FlowSpecAction{Type: "redirect", Value: "65000:100"}, ok: true},
+		{name: "redirect to IPv4 target", community: bgp.NewRedirectIPv4AddressSpecificExtended("192.0.2.1", 100), want: FlowSpecAction{Type: "redirect", Value: "192.0.2.1:100"}, ok: true},
+		{name: "redirect to four-octet AS target", community: bgp.NewRedirectFourOctetAsSpecificExtended(4200000000, 100), want: FlowSpecAction{Type: "redirect", Value: "64086.59904:100"}, ok: true},
+		{name: "route target", community: bgp.NewTwoOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, 65000, 100, true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := flowSpecAction(tt.community)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("flowSpecAction() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFlowSpecRules(t *testing.T) {
+	m := newTestMonitor(t)
+	peer := m.mrtPeer("192.0.2.1", 64500)
+
+	rule := bgp.NewFlowSpecIPv4Unicast([]bgp.FlowSpecComponentInterface{
+		bgp.NewFlowSpecDestinationPrefix(bgp.NewIPAddrPrefix(24, "198.51.100.0")),
+		bgp.NewFlowSpecComponent(bgp.FLOW_SPEC_TYPE_IP_PROTO, []*bgp.FlowSpecComponentItem{bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_EQ, 17)}),
+		bgp.NewFlowSpecComponent(bgp.FLOW_SPEC_TYPE_SRC_PORT, []*bgp.FlowSpecComponentItem{bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_EQ, 123)}),
+	})
+	update := bgp.NewBGPUpdateMessage(nil, []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+		bgp.NewPathAttributeMpReachNLRI("0.0.0.0", []bgp.AddrPrefixInterface{rule}),
+		bgp.NewPathAttributeExtendedCommunities([]bgp.ExtendedCommunityInterface{
+			bgp.NewTrafficRateExtended(0, 125000),
+			bgp.NewTwoOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, 65000, 100, true),
+		}),
+	}, nil).Body.(*bgp.BGPUpdate)
+	unicast := bgp.NewBGPUpdateMessage(nil, testAttrs(64500), []*bgp.IPAddrPrefix{ipPrefix("203.0.113.0/24")}).Body.(*bgp.BGPUpdate)
+
+	peer.mu.Lock()
+	m.applyUpdate(peer, false, update, mrtTime)
+	m.applyUpdate(peer, false, unicast, mrtTime)
+	m.unlockPeer(peer)
+
+	rules, err := m.FlowSpecRules("")
+	if err != nil {
+		t.Fatalf("FlowSpecRules: %v", err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+	got := rules[0]
+	if got.Peer != "192.0.2.1" || got.Family != "ipv4-flowspec" || got.Rule != rule.String() {
+		t.Errorf("rule = %s %s from %s, want %s ipv4-flowspec from 192.0.2.1", got.Rule, got.Family, got.Peer, rule)
+	}
+	wantMatch := []FlowSpecMatch{
+		{Type: "destination", Value: "198.51.100.0/24"},
+		{Type: "protocol", Value: "==udp"},
+		{Type: "source-port", Value: "==123"},
+	}
+	if len(got.Match) != len(wantMatch) {
+		t.Fatalf("match = %+v, want %+v", got.Match, wantMatch)
+	}
+	for i := range wantMatch {
+		if got.Match[i] != wantMatch[i] {
+			t.Errorf("match = %+v, want %+v", got.Match, wantMatch)
+			break
+		}
+	}
+	if len(got.Actions) != 1 || got.Actions[0] != (FlowSpecAction{Type: FlowSpecRateLimit, Value: "1000000 bps"}) {
+		t.Errorf("actions = %+v, want a 1000000 bps rate limit", got.Actions)
+	}
+
+	if _, err := m.FlowSpecRules("192.0.2.2"); err == nil {
+		t.Error("FlowSpecRules() of an unknown peer did not fail")
+	}
+}
+
+func TestInjectFlowSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        FlowSpecRequest
+		wantRule   string
+		wantFamily string
+		wantAction string
+		wantErr    string
+	}{
+		{
+			name:       "discard",
+			req:        FlowSpecRequest{Destination: "198.51.100.10/32", Action: FlowSpecDiscard},
+			wantRule:   "[destination: 198.51.100.10/32]",
+			wantFamily: "ipv4-flowspec",
+			wantAction: "discard",
+		},
+		{
+			name: "rate limit with every component",
+			req: FlowSpecRequest{
+				Destination:      "198.51.100.0/24",
+				Source:           "203.0.113.0/24",
+				Protocols:        []string{"udp"},
+				DestinationPorts: []string{"53"},
+				SourcePorts:      []string{"1024-65535"},
+				PacketLengths:    []string{"512-1500"},
+				Action:           FlowSpecRateLimit,
+				Rate:             8000000,
+			},
+			wantRule:   "[destination: 198.51.100.0/24][source: 203.0.113.0/24][protocol: ==udp][destination-port: ==53][source-port: >=1024&<=65535][packet-length: >=512&<=1500]",
+			wantFamily: "ipv4-flowspec",
+			wantAction: "rate-limit 8000000 bps",
+		},
+		{
+			name:       "IPv6",
+			req:        FlowSpecRequest{Destination: "2001:db8::/64", Protocols: []string{"tcp", "udp"}, Action: FlowSpecDiscard},
+			wantRule:   "[destination: 2001:db8::/64/0][protocol: ==tcp ==udp]",
+			wantFamily: "ipv6-flowspec",
+			wantAction: "discard",
+		},
+		{name: "no destination", req: FlowSpecRequest{Action: FlowSpecDiscard}, wantErr: "a destination prefix is required"},
+		{name: "outside the allow-list", req: FlowSpecRequest{Destination: "192.0.2.0/24", Action: FlowSpecDiscard}, wantErr: "not in the injection allow-list"},
+		{name: "rate with discard", req: FlowSpecRequest{Destination: "198.51.100.0/24", Action: FlowSpecDiscard, Rate: 1000}, wantErr: "a rate is only allowed with rate-limit"},
+		{name: "rate limit without rate", req: FlowSpecRequest{Destination: "198.51.100.0/24", Action: FlowSpecRateLimit}, wantErr: "rate-limit requires a rate"},
+		{name: "unknown action", req: FlowSpecRequest{Destination: "198.51.100.0/24", Action: "redirect"}, wantErr: "action must be discard or rate-limit"},
+		{name: "source of another family", req: FlowSpecRequest{Destination: "198.51.100.0/24", Source: "2001:db8::/32", Action: FlowSpecDiscard}, wantErr: "not in the same address family"},
+		{name: "invalid port", req: FlowSpecRequest{Destination: "198.51.100.0/24", DestinationPorts: []string{"70000"}, Action: FlowSpecDiscard}, wantErr: "invalid destination-port"},
+		{name: "invalid protocol", req: FlowSpecRequest{Destination: "198.51.100.0/24", Protocols: []string{"quic"}, Action: FlowSpecDiscard}, wantErr: "invalid protocol"},
+	}
+
+	m := injectionMonitor(t, "ipv4-flowspec", "ipv6-flowspec")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.TTL = time.Hour
+			rule, err := m.InjectFlowSpec(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InjectFlowSpec() error = %v, want %q", err, tt.wantErr)
+				}
+				if len(m.FlowSpecInjections()) != 0 {
+					t.Error("refused rule was announced")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InjectFlowSpec: %v", err)
+			}
+			if rule.Rule != tt.wantRule || rule.Family != tt.wantFamily || rule.TrafficAction() != tt.wantAction {
+				t.Errorf("rule = %s %s %s, want %s %s %s", rule.Rule, rule.Family, rule.TrafficAction(), tt.wantRule, tt.wantFamily, tt.wantAction)
+			}
+
+			if n := len(m.FlowSpecInjections()); n != 1 {
+				t.Fatalf("%d rules announced, want 1", n)
+			}
+
+			// The global export default is reject, the injection policy
+			// lets the rule out
+			if out := adjRIBOut(t, m); len(out) != 1 || out[0] != tt.wantRule {
+				t.Errorf("Adj-RIB-Out = %v, want [%s]", out, tt.wantRule)
+			}
+
+			if err := m.WithdrawFlowSpec(rule.Rule, "test", ""); err != nil {
+				t.Fatalf("WithdrawFlowSpec: %v", err)
+			}
+			if n := len(m.FlowSpecInjections()); n != 0 {
+				t.Errorf("%d rules announced after withdrawal, want 0", n)
+			}
+			if out := adjRIBOut(t, m); len(out) != 0 {
+				t.Errorf("Adj-RIB-Out after withdrawal = %v, want none", out)
+			}
+		})
+	}
+}
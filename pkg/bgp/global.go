@@ -0,0 +1,116 @@
+package bgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Default policy actions
+const (
+	PolicyAccept = "accept"
+	PolicyReject = "reject"
+)
+
+// ErrNotStarted is returned by operations that need a running BGP speaker
+var ErrNotStarted = errors.New("BGP speaker is not started: bgp.global.asn and bgp.global.router_id must be configured")
+
+// GlobalConfig is the configuration of the local BGP speaker. A listen port
+// of -1 disables the listener, so sessions are only initiated locally. Routes
+// are imported but only re-advertised with an explicit default export policy
+// of accept; injected routes have their own export policy.
+type GlobalConfig struct {
+	ASN                 uint32
+	RouterID            string
+	ListenAddresses     []string
+	ListenPort          int32
+	DefaultImportPolicy string
+	DefaultExportPolicy string
+}
+
+// StartBGP starts the local BGP speaker. It must be called before peers are
+// added.
+func (m *Monitor) StartBGP(cfg GlobalConfig) error {
+	if cfg.DefaultImportPolicy == "" {
+		cfg.DefaultImportPolicy = PolicyAccept
+	}
+	if cfg.DefaultExportPolicy == "" {
+		cfg.DefaultExportPolicy = PolicyReject
+	}
+	importAction, err := toRouteAction(cfg.DefaultImportPolicy)
+	if err != nil {
+		return fmt.Errorf("invalid default import policy: %w", err)
+	}
+	exportAction, err := toRouteAction(cfg.DefaultExportPolicy)
+	if err != nil {
+		return fmt.Errorf("invalid default export policy: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.global != nil {
+		return fmt.Errorf("BGP speaker is already started as AS %d", m.global.ASN)
+	}
+
+	ctx := context.Background()
+	if err := m.server.StartBgp(ctx, &api.StartBgpRequest{
+		Global: &api.Global{
+			Asn:             cfg.ASN,
+			RouterId:        cfg.RouterID,
+			ListenPort:      cfg.ListenPort,
+			ListenAddresses: cfg.ListenAddresses,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to start BGP speaker: %w", err)
+	}
+
+	// Policies added later only append to the global assignments and keep
+	// these defaults
+	for _, a := range []struct {
+		direction api.PolicyDirection
+		action    api.RouteAction
+	}{
+		{api.PolicyDirection_IMPORT, importAction},
+		{api.PolicyDirection_EXPORT, exportAction},
+	} {
+		if err := m.server.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+			Assignment: &api.PolicyAssignment{
+				Name:          "global",
+				Direction:     a.direction,
+				DefaultAction: a.action,
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to set default %s policy: %w", a.direction, err)
+		}
+	}
+
+	cfg.ListenAddresses = append([]string(nil), cfg.ListenAddresses...)
+	m.global = &cfg
+	return nil
+}
+
+// Global returns the configuration of the running BGP speaker
+func (m *Monitor) Global() (*GlobalConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.global == nil {
+		return nil, ErrNotStarted
+	}
+	g := *m.global
+	g.ListenAddresses = append([]string(nil), g.ListenAddresses...)
+	return &g, nil
+}
+
+func toRouteAction(policy string) (api.RouteAction, error) {
+	switch policy {
+	case PolicyAccept:
+		return api.RouteAction_ACCEPT, nil
+	case PolicyReject:
+		return api.RouteAction_REJECT, nil
+	}
+	return api.RouteAction_NONE, fmt.Errorf("unknown policy %q (must be accept or reject)", policy)
+}
@@ -0,0 +1,250 @@
+package bgp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/log"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+)
+
+// Number of FSM transitions kept per peer
+const maxHistory = 100
+
+// Notification directions
+const (
+	NotificationSent     = "sent"
+	NotificationReceived = "received"
+)
+
+// Notification is a decoded BGP NOTIFICATION message
+type Notification struct {
+	Direction     string
+	Code          uint8
+	Subcode       uint8
+	Error         string
+	Reason        string
+	Communication string
+}
+
+func (n *Notification) String() string {
+	s := n.Error
+	if n.Reason != "" {
+		s += "/" + n.Reason
+	}
+	if n.Communication != "" {
+		s += fmt.Sprintf(" %q", n.Communication)
+	}
+	return fmt.Sprintf("%s %s", s, n.Direction)
+}
+
+// FSMTransition is one entry of a peer's session history. Uptime is set when
+// an established session goes down.
+type FSMTransition struct {
+	Timestamp    time.Time
+	OldState     string
+	NewState     string
+	Reason       string
+	Notification *Notification
+	Uptime       time.Duration
+}
+
+// downCause is why a session went down, recorded by whichever source saw it
+// until the state change arrives
+type downCause struct {
+	reason       string
+	notification *Notification
+}
+
+// NOTIFICATION error codes and subcodes (RFC 4271, 4486, 5492, 7313, 8538,
+// 9234)
+var notificationErrors = map[uint8]string{
+	bgp.BGP_ERROR_MESSAGE_HEADER_ERROR:        "Message Header Error",
+	bgp.BGP_ERROR_OPEN_MESSAGE_ERROR:          "OPEN Message Error",
+	bgp.BGP_ERROR_UPDATE_MESSAGE_ERROR:        "UPDATE Message Error",
+	bgp.BGP_ERROR_HOLD_TIMER_EXPIRED:          "Hold Timer Expired",
+	bgp.BGP_ERROR_FSM_ERROR:                   "Finite State Machine Error",
+	bgp.BGP_ERROR_CEASE:                       "Cease",
+	bgp.BGP_ERROR_ROUTE_REFRESH_MESSAGE_ERROR: "ROUTE-REFRESH Message Error",
+}
+
+var notificationReasons = map[uint8]map[uint8]string{
+	bgp.BGP_ERROR_MESSAGE_HEADER_ERROR: {
+		1: "Connection Not Synchronized",
+		2: "Bad Message Length",
+		3: "Bad Message Type",
+	},
+	bgp.BGP_ERROR_OPEN_MESSAGE_ERROR: {
+		1:  "Unsupported Version Number",
+		2:  "Bad Peer AS",
+		3:  "Bad BGP Identifier",
+		4:  "Unsupported Optional Parameter",
+		6:  "Unacceptable Hold Time",
+		7:  "Unsupported Capability",
+		11: "Role Mismatch",
+	},
+	bgp.BGP_ERROR_UPDATE_MESSAGE_ERROR: {
+		1:  "Malformed Attribute List",
+		2:  "Unrecognized Well-known Attribute",
+		3:  "Missing Well-known Attribute",
+		4:  "Attribute Flags Error",
+		5:  "Attribute Length Error",
+		6:  "Invalid ORIGIN Attribute",
+		8:  "Invalid NEXT_HOP Attribute",
+		9:  "Optional Attribute Error",
+		10: "Invalid Network Field",
+		11: "Malformed AS_PATH",
+	},
+	bgp.BGP_ERROR_FSM_ERROR: {
+		1: "Unexpected Message in OpenSent State",
+		2: "Unexpected Message in OpenConfirm State",
+		3: "Unexpected Message in Established State",
+	},
+	bgp.BGP_ERROR_CEASE: {
+		1:  "Maximum Number of Prefixes Reached",
+		2:  "Administrative Shutdown",
+		3:  "Peer De-configured",
+		4:  "Administrative Reset",
+		5:  "Connection Rejected",
+		6:  "Other Configuration Change",
+		7:  "Connection Collision Resolution",
+		8:  "Out of Resources",
+		9:  "Hard Reset",
+		10: "BFD Down",
+	},
+	bgp.BGP_ERROR_ROUTE_REFRESH_MESSAGE_ERROR: {
+		1: "Invalid Message Length",
+	},
+}
+
+// decodeNotification names the error code and subcode of a NOTIFICATION
+func decodeNotification(direction string, code, subcode uint8, data []byte) *Notification {
+	n := &Notification{
+		Direction: direction,
+		Code:      code,
+		Subcode:   subcode,
+		Error:     notificationErrors[code],
+		Reason:    notificationReasons[code][subcode],
+	}
+	if n.Error == "" {
+		n.Error = fmt.Sprintf("Unknown Error %d", code)
+	}
+	if n.Reason == "" && subcode != 0 {
+		n.Reason = fmt.Sprintf("Subcode %d", subcode)
+	}
+
+	// Shutdown communication (RFC 9003): a length byte and UTF-8 text
+	if code == bgp.BGP_ERROR_CEASE && (subcode == bgp.BGP_ERROR_SUB_ADMINISTRATIVE_SHUTDOWN || subcode == bgp.BGP_ERROR_SUB_ADMINISTRATIVE_RESET) &&
+		len(data) > 0 && int(data[0]) <= len(data)-1 {
+		n.Communication = strings.ToValidUTF8(string(data[1:1+data[0]]), "?")
+	}
+	return n
+}
+
+func notificationFromMessage(direction string, msg *bgp.BGPMessage) *Notification {
+	if msg == nil {
+		return nil
+	}
+	body, ok := msg.Body.(*bgp.BGPNotification)
+	if !ok {
+		return nil
+	}
+	return decodeNotification(direction, body.ErrorCode, body.ErrorSubcode, body.Data)
+}
+
+// setDownCause remembers why a peer's session went down, to be attached to
+// the next state change of that peer
+func (m *Monitor) setDownCause(address, reason string, notification *Notification) {
+	m.causeMu.Lock()
+	defer m.causeMu.Unlock()
+	m.downCauses[address] = &downCause{reason: reason, notification: notification}
+}
+
+func (m *Monitor) takeDownCause(address string) *downCause {
+	m.causeMu.Lock()
+	defer m.causeMu.Unlock()
+	cause := m.downCauses[address]
+	delete(m.downCauses, address)
+	return cause
+}
+
+// record appends a transition to the peer's bounded history. Caller holds
+// p.mu.
+func (p *PeerState) record(t FSMTransition) {
+	if len(p.history) >= maxHistory {
+		copy(p.history, p.history[1:])
+		p.history = p.history[:maxHistory-1]
+	}
+	p.history = append(p.history, t)
+}
+
+// PeerHistory returns the FSM transitions of a peer, oldest first
+func (m *Monitor) PeerHistory(address string) ([]FSMTransition, error) {
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+
+	history := make([]FSMTransition, len(peer.history))
+	copy(history, peer.history)
+	return history, nil
+}
+
+// bmpDownCause decodes the reason of a BMP Peer Down notification (RFC 7854)
+func bmpDownCause(body *bmp.BMPPeerDownNotification) (string, *Notification) {
+	switch body.Reason {
+	case bmp.BMP_PEER_DOWN_REASON_LOCAL_BGP_NOTIFICATION:
+		return "local-notification", notificationFromMessage(NotificationSent, body.BGPNotification)
+	case bmp.BMP_PEER_DOWN_REASON_LOCAL_NO_NOTIFICATION:
+		return "local-no-notification", nil
+	case bmp.BMP_PEER_DOWN_REASON_REMOTE_BGP_NOTIFICATION:
+		return "remote-notification", notificationFromMessage(NotificationReceived, body.BGPNotification)
+	case bmp.BMP_PEER_DOWN_REASON_REMOTE_NO_NOTIFICATION:
+		return "remote-no-notification", nil
+	case bmp.BMP_PEER_DOWN_REASON_PEER_DE_CONFIGURED:
+		return "peer-deconfigured", nil
+	}
+	return "unknown", nil
+}
+
+// GoBGP only reports the cause of a session drop in its "Peer Down" log
+// entry, e.g. "notification-received code 6(cease) subcode 4(administrative
+// reset)" or "hold-timer-expired"
+var gobgpNotificationReason = regexp.MustCompile(`^notification-(sent|received) code (\d+)\(.*\) subcode (\d+)\(`)
+
+// gobgpLogger passes GoBGP's log through and picks up why sessions drop
+type gobgpLogger struct {
+	log.Logger
+	m *Monitor
+}
+
+func (l *gobgpLogger) Info(msg string, fields log.Fields) {
+	if msg == "Peer Down" {
+		address, _ := fields["Key"].(string)
+		reason, _ := fields["Reason"].(string)
+		if address != "" {
+			l.m.setDownCause(parseGoBGPReason(address, reason))
+		}
+	}
+	l.Logger.Info(msg, fields)
+}
+
+func parseGoBGPReason(address, reason string) (string, string, *Notification) {
+	match := gobgpNotificationReason.FindStringSubmatch(reason)
+	if match == nil {
+		return address, reason, nil
+	}
+	code, _ := strconv.Atoi(match[2])
+	subcode, _ := strconv.Atoi(match[3])
+	return address, "notification-" + match[1], decodeNotification(match[1], uint8(code), uint8(subcode), nil)
+}
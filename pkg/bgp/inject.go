@@ -0,0 +1,561 @@
+package bgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Number of injection audit entries kept
+const maxInjectionAudit = 1000
+
+// How often injected routes are checked for expiry
+const injectionExpiryInterval = time.Second
+
+// Injection audit actions
+const (
+	InjectionAnnounce = "announce"
+	InjectionWithdraw = "withdraw"
+	InjectionExpire   = "expire"
+	InjectionDenied   = "denied"
+)
+
+// Name shared by the export policy that advertises injected routes and
+// FlowSpec rules and by its statements and prefix-sets. The global export
+// default stays reject, so only locally originated paths are let out: routes
+// whose prefix is in the per-family prefix-set of injected prefixes, and
+// originated FlowSpec rules.
+const injectPolicyName = "netmeta-injected"
+
+// ErrInjectionDisabled is returned when no prefixes may be injected
+var ErrInjectionDisabled = errors.New("route injection is disabled: no prefixes are allowed")
+
+// InjectionParams are the guardrails for injected routes. Only prefixes
+// equal to or more specific than an allowed prefix may be announced, and
+// each for at most MaxTTL; zero leaves the TTL uncapped.
+type InjectionParams struct {
+	AllowedPrefixes []string
+	MaxTTL          time.Duration
+}
+
+// InjectRequest announces a prefix through the local speaker until the TTL
+// runs out. Without a next hop the speaker's own address is used.
+type InjectRequest struct {
+	Prefix      string
+	NextHop     string
+	Communities []string
+	LocalPref   uint32
+	TTL         time.Duration
+	User        string
+	Reason      string
+}
+
+// Injection is a route currently announced through the injection API
+type Injection struct {
+	Prefix      string
+	Family      string
+	NextHop     string
+	Communities []string
+	LocalPref   uint32
+	User        string
+	Reason      string
+	Announced   time.Time
+	Expires     time.Time
+
+	// GoBGP path identifier used to withdraw it
+	uuid []byte
+}
+
+// InjectionAudit records an announcement, withdrawal, expiry or refused
+// request. For FlowSpec rules, Prefix holds the rule and TrafficAction what
+// it does to matching traffic.
+type InjectionAudit struct {
+	Timestamp     time.Time
+	Action        string
+	Prefix        string
+	NextHop       string
+	Communities   []string
+	LocalPref     uint32
+	TrafficAction string
+	TTL           time.Duration
+	User          string
+	Reason        string
+	Error         string
+}
+
+func (a *InjectionAudit) String() string {
+	s := fmt.Sprintf("%s %s", a.Action, a.Prefix)
+	if a.TrafficAction != "" {
+		s += " " + a.TrafficAction
+	}
+	if a.User != "" {
+		s += " by " + a.User
+	}
+	if a.Reason != "" {
+		s += ": " + a.Reason
+	}
+	if a.Error != "" {
+		s += " (" + a.Error + ")"
+	}
+	return s
+}
+
+// SetInjection sets the prefixes that may be injected and the longest TTL
+func (m *Monitor) SetInjection(params InjectionParams) error {
+	allowed := make([]netip.Prefix, 0, len(params.AllowedPrefixes))
+	for _, s := range params.AllowedPrefixes {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid allowed prefix: %w", err)
+		}
+		allowed = append(allowed, p)
+	}
+	if params.MaxTTL < 0 {
+		return fmt.Errorf("max TTL must not be negative")
+	}
+
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	m.injectParams = params
+	m.injectAllowed = allowed
+	return nil
+}
+
+// InjectRoute announces a route to every peer. Injecting a prefix that is
+// already announced replaces its attributes and TTL. Every request,
+// including refused ones, is audited.
+func (m *Monitor) InjectRoute(req InjectRequest) (*Injection, error) {
+	now := time.Now()
+	entry := &InjectionAudit{
+		Timestamp:   now,
+		Action:      InjectionAnnounce,
+		Prefix:      req.Prefix,
+		NextHop:     req.NextHop,
+		Communities: req.Communities,
+		LocalPref:   req.LocalPref,
+		TTL:         req.TTL,
+		User:        req.User,
+		Reason:      req.Reason,
+	}
+
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	injection, path, err := m.injectionPath(req, now)
+	if err != nil {
+		entry.Action = InjectionDenied
+		entry.Error = err.Error()
+		m.audit(entry)
+		return nil, err
+	}
+	entry.Prefix = injection.Prefix
+	entry.NextHop = injection.NextHop
+
+	// Let the prefix through the export policy before it is announced
+	_, replaced := m.injected[injection.Prefix]
+	if !replaced {
+		if err := m.exportInjected(injection.Prefix); err != nil {
+			entry.Error = err.Error()
+			m.audit(entry)
+			return nil, err
+		}
+	}
+
+	resp, err := m.server.AddPath(context.Background(), &api.AddPathRequest{
+		TableType: api.TableType_GLOBAL,
+		Path:      path,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to announce %s: %w", injection.Prefix, err)
+		entry.Error = err.Error()
+		m.audit(entry)
+		if !replaced {
+			if err := m.unexportInjected(injection.Prefix); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		return nil, err
+	}
+	injection.uuid = resp.Uuid
+
+	m.injected[injection.Prefix] = injection
+	m.audit(entry)
+
+	i := *injection
+	return &i, nil
+}
+
+// WithdrawInjectedRoute withdraws an injected route before its TTL runs out
+func (m *Monitor) WithdrawInjectedRoute(prefix, user, reason string) error {
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return err
+	}
+	injection, ok := m.injected[p.String()]
+	if !ok {
+		return fmt.Errorf("prefix %s is not injected", p)
+	}
+	return m.withdrawInjection(injection, InjectionWithdraw, user, reason)
+}
+
+// Injections returns the routes currently injected, sorted by prefix
+func (m *Monitor) Injections() []*Injection {
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	injections := make([]*Injection, 0, len(m.injected))
+	for _, injection := range m.injected {
+		i := *injection
+		injections = append(injections, &i)
+	}
+	sort.Slice(injections, func(i, j int) bool {
+		return injections[i].Prefix < injections[j].Prefix
+	})
+	return injections
+}
+
+// InjectionAuditLog returns up to limit of the most recent audit entries,
+// oldest first. A limit of 0 returns all of them.
+func (m *Monitor) InjectionAuditLog(limit int) []*InjectionAudit {
+	m.injectMu.Lock()
+	defer m.injectMu.Unlock()
+
+	entries := m.injectAudit
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return append([]*InjectionAudit(nil), entries...)
+}
+
+// injectionPath checks a request against the guardrails and builds the path
+// to announce. Callers must hold m.injectMu.
+func (m *Monitor) injectionPath(req InjectRequest, now time.Time) (*Injection, *api.Path, error) {
+	prefix, err := m.checkInjection(req.Prefix, req.TTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// An unspecified next hop is replaced with the speaker's address when
+	// the route is advertised
+	nextHop := netip.IPv4Unspecified()
+	if prefix.Addr().Is6() {
+		nextHop = netip.IPv6Unspecified()
+	}
+	if req.NextHop != "" {
+		if nextHop, err = netip.ParseAddr(req.NextHop); err != nil {
+			return nil, nil, fmt.Errorf("invalid next hop %q", req.NextHop)
+		}
+		if nextHop.Is4() != prefix.Addr().Is4() {
+			return nil, nil, fmt.Errorf("next hop %s is not in the same address family as %s", nextHop, prefix)
+		}
+	}
+
+	communities := make([]uint32, 0, len(req.Communities))
+	for _, c := range req.Communities {
+		value, err := parseCommunity(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		communities = append(communities, value)
+	}
+
+	var nlri bgp.AddrPrefixInterface
+	attrs := []bgp.PathAttributeInterface{bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP)}
+	if prefix.Addr().Is4() {
+		nlri = bgp.NewIPAddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+		attrs = append(attrs, bgp.NewPathAttributeNextHop(nextHop.String()))
+	} else {
+		nlri = bgp.NewIPv6AddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+		attrs = append(attrs, bgp.NewPathAttributeMpReachNLRI(nextHop.String(), []bgp.AddrPrefixInterface{nlri}))
+	}
+	if len(communities) > 0 {
+		attrs = append(attrs, bgp.NewPathAttributeCommunities(communities))
+	}
+	if req.LocalPref > 0 {
+		attrs = append(attrs, bgp.NewPathAttributeLocalPref(req.LocalPref))
+	}
+
+	path, err := apiutil.NewPath(nlri, false, attrs, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build path for %s: %w", prefix, err)
+	}
+
+	injection := &Injection{
+		Prefix:      prefix.String(),
+		Family:      bgp.AfiSafiToRouteFamily(nlri.AFI(), nlri.SAFI()).String(),
+		NextHop:     nextHop.String(),
+		Communities: req.Communities,
+		LocalPref:   req.LocalPref,
+		User:        req.User,
+		Reason:      req.Reason,
+		Announced:   now,
+		Expires:     now.Add(req.TTL),
+	}
+	return injection, path, nil
+}
+
+// checkInjection checks that the local speaker is running, that a prefix is
+// in the allow-list and that a TTL is within the limit. Callers must hold
+// m.injectMu.
+func (m *Monitor) checkInjection(s string, ttl time.Duration) (netip.Prefix, error) {
+	if _, err := m.Global(); err != nil {
+		return netip.Prefix{}, err
+	}
+	if len(m.injectAllowed) == 0 {
+		return netip.Prefix{}, ErrInjectionDisabled
+	}
+
+	if ttl <= 0 {
+		return netip.Prefix{}, fmt.Errorf("a TTL is required")
+	}
+	if maxTTL := m.injectParams.MaxTTL; maxTTL > 0 && ttl > maxTTL {
+		return netip.Prefix{}, fmt.Errorf("TTL %s exceeds the maximum of %s", ttl, maxTTL)
+	}
+
+	prefix, err := parsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	for _, a := range m.injectAllowed {
+		if a.Addr().Is4() == prefix.Addr().Is4() && a.Bits() <= prefix.Bits() && a.Contains(prefix.Addr()) {
+			return prefix, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("prefix %s is not in the injection allow-list", prefix)
+}
+
+// parseCommunity parses a standard community as ASN:value or by its well
+// known name, such as blackhole
+func parseCommunity(s string) (uint32, error) {
+	if c, ok := bgp.WellKnownCommunityValueMap[strings.ToLower(s)]; ok {
+		return uint32(c), nil
+	}
+	asn, value, ok := strings.Cut(s, ":")
+	if ok {
+		high, err1 := strconv.ParseUint(asn, 10, 16)
+		low, err2 := strconv.ParseUint(value, 10, 16)
+		if err1 == nil && err2 == nil {
+			return uint32(high<<16 | low), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid community %q (must be ASN:value or a well known name)", s)
+}
+
+// withdrawInjection withdraws an injected route and audits why. Callers must
+// hold m.injectMu.
+func (m *Monitor) withdrawInjection(injection *Injection, action, user, reason string) error {
+	entry := &InjectionAudit{
+		Timestamp:   time.Now(),
+		Action:      action,
+		Prefix:      injection.Prefix,
+		NextHop:     injection.NextHop,
+		Communities: injection.Communities,
+		LocalPref:   injection.LocalPref,
+		User:        user,
+		Reason:      reason,
+	}
+
+	if err := m.deletePath(injection.Family, injection.uuid); err != nil {
+		err = fmt.Errorf("failed to withdraw %s: %w", injection.Prefix, err)
+		entry.Error = err.Error()
+		m.audit(entry)
+		return err
+	}
+
+	delete(m.injected, injection.Prefix)
+	m.audit(entry)
+
+	// The route is gone either way, a leftover prefix-set entry only lets a
+	// later injection of the same prefix out
+	if err := m.unexportInjected(injection.Prefix); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return nil
+}
+
+// exportInjected adds an injected prefix to the prefix-set of the export
+// policy. Callers must hold m.injectMu.
+func (m *Monitor) exportInjected(prefix string) error {
+	if err := m.ensureInjectPolicy(); err != nil {
+		return err
+	}
+	if err := m.server.AddDefinedSet(context.Background(), &api.AddDefinedSetRequest{
+		DefinedSet: injectPrefixSet(prefix),
+	}); err != nil {
+		return fmt.Errorf("failed to add %s to export policy: %w", prefix, err)
+	}
+	return nil
+}
+
+// unexportInjected removes a withdrawn prefix from the prefix-set of the
+// export policy. Callers must hold m.injectMu.
+func (m *Monitor) unexportInjected(prefix string) error {
+	if err := m.server.DeleteDefinedSet(context.Background(), &api.DeleteDefinedSetRequest{
+		DefinedSet: injectPrefixSet(prefix),
+	}); err != nil {
+		return fmt.Errorf("failed to remove %s from export policy: %w", prefix, err)
+	}
+	return nil
+}
+
+// injectPrefixSet returns the prefix-set entry of an injected prefix, in the
+// set of its address family
+func injectPrefixSet(prefix string) *api.DefinedSet {
+	p := netip.MustParsePrefix(prefix)
+	return &api.DefinedSet{
+		DefinedType: api.DefinedType_PREFIX,
+		Name:        injectSetName(p.Addr().Is4()),
+		Prefixes: []*api.Prefix{{
+			IpPrefix:      p.String(),
+			MaskLengthMin: uint32(p.Bits()),
+			MaskLengthMax: uint32(p.Bits()),
+		}},
+	}
+}
+
+// injectSetName names the prefix-set and statement for injected prefixes of
+// an address family. Prefix-sets cannot mix address families.
+func injectSetName(ipv4 bool) string {
+	if ipv4 {
+		return injectPolicyName + "-v4"
+	}
+	return injectPolicyName + "-v6"
+}
+
+// ensureInjectPolicy installs the global export policy that accepts locally
+// originated paths for injected prefixes and originated FlowSpec rules.
+// Callers must hold m.injectMu.
+func (m *Monitor) ensureInjectPolicy() error {
+	if m.injectPolicyReady {
+		return nil
+	}
+
+	ctx := context.Background()
+	statements := make([]*api.Statement, 0, 3)
+	for _, ipv4 := range []bool{true, false} {
+		name := injectSetName(ipv4)
+		if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+			DefinedSet: &api.DefinedSet{DefinedType: api.DefinedType_PREFIX, Name: name},
+		}); err != nil {
+			return fmt.Errorf("failed to create injection prefix-set: %w", err)
+		}
+		statements = append(statements, &api.Statement{
+			Name: name,
+			Conditions: &api.Conditions{
+				RouteType: api.Conditions_ROUTE_TYPE_LOCAL,
+				PrefixSet: &api.MatchSet{
+					Type: api.MatchSet_ANY,
+					Name: name,
+				},
+			},
+			Actions: &api.Actions{RouteAction: api.RouteAction_ACCEPT},
+		})
+	}
+
+	// FlowSpec rules carry no prefix to match, and only injected ones are
+	// originated locally
+	statements = append(statements, &api.Statement{
+		Name: injectPolicyName + "-flowspec",
+		Conditions: &api.Conditions{
+			RouteType: api.Conditions_ROUTE_TYPE_LOCAL,
+			AfiSafiIn: []*api.Family{
+				{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_FLOW_SPEC_UNICAST},
+				{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_FLOW_SPEC_UNICAST},
+			},
+		},
+		Actions: &api.Actions{RouteAction: api.RouteAction_ACCEPT},
+	})
+
+	if err := m.server.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{Name: injectPolicyName, Statements: statements},
+	}); err != nil {
+		return fmt.Errorf("failed to create injection export policy: %w", err)
+	}
+
+	// Appended to the global export policies, keeping the default action
+	// configured in bgp.global
+	if err := m.server.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+		Assignment: &api.PolicyAssignment{
+			Name:          "global",
+			Direction:     api.PolicyDirection_EXPORT,
+			Policies:      []*api.Policy{{Name: injectPolicyName}},
+			DefaultAction: api.RouteAction_NONE,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to assign injection export policy: %w", err)
+	}
+
+	m.injectPolicyReady = true
+	return nil
+}
+
+// deletePath withdraws a path added to the global RIB
+func (m *Monitor) deletePath(family string, uuid []byte) error {
+	f, err := toAPIFamily(family)
+	if err != nil {
+		return err
+	}
+	return m.server.DeletePath(context.Background(), &api.DeletePathRequest{
+		TableType: api.TableType_GLOBAL,
+		Family:    f,
+		Uuid:      uuid,
+	})
+}
+
+// audit records an entry and notifies subscribers. Callers must hold
+// m.injectMu.
+func (m *Monitor) audit(entry *InjectionAudit) {
+	m.injectAudit = append(m.injectAudit, entry)
+	if len(m.injectAudit) > maxInjectionAudit {
+		m.injectAudit = m.injectAudit[len(m.injectAudit)-maxInjectionAudit:]
+	}
+	m.injectionSubs.publish(entry)
+}
+
+// expireInjections withdraws injected routes and FlowSpec rules whose TTL
+// ran out
+func (m *Monitor) expireInjections() {
+	ticker := time.NewTicker(injectionExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.injectMu.Lock()
+			for _, injection := range m.injected {
+				if now.Before(injection.Expires) {
+					continue
+				}
+				// A failed withdrawal is retried on the next tick
+				if err := m.withdrawInjection(injection, InjectionExpire, "", "TTL expired"); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			}
+			for _, rule := range m.flowSpecs {
+				if now.Before(rule.Expires) {
+					continue
+				}
+				if err := m.withdrawFlowSpec(rule, InjectionExpire, "", "TTL expired"); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			}
+			m.injectMu.Unlock()
+		}
+	}
+}
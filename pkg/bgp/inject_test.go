@@ -0,0 +1,139 @@
+package bgp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// injectionMonitor starts a speaker with injection allowed for
+// 198.51.100.0/24 and 2001:db8::/32, and a second speaker peering with it
+// over loopback. Routes are only advertised on established sessions.
+func injectionMonitor(t *testing.T, families ...string) *Monitor {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m := newTestMonitor(t)
+	if err := m.StartBGP(GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenAddresses: []string{"127.0.0.1"}, ListenPort: int32(port)}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+	if err := m.AddPeer(PeerConfig{Address: "127.0.0.1", ASN: 64500, Passive: true, Families: families}); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := m.SetInjection(InjectionParams{AllowedPrefixes: []string{"198.51.100.0/24", "2001:db8::/32"}}); err != nil {
+		t.Fatalf("SetInjection: %v", err)
+	}
+
+	remote := newTestMonitor(t)
+	if err := remote.StartBGP(GlobalConfig{ASN: 64500, RouterID: "192.0.2.1", ListenPort: -1}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+	if err := remote.AddPeer(PeerConfig{Address: "127.0.0.1", ASN: 64496, Port: uint16(port), Families: families}); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		if peer, err := m.GetPeer("127.0.0.1"); err == nil && peer.Established {
+			return m
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session with the second speaker not established")
+		}
+	}
+}
+
+// adjRIBOut returns the prefixes advertised to the peer
+func adjRIBOut(t *testing.T, m *Monitor) []string {
+	t.Helper()
+	routes, err := m.ListAdjRIBOut("127.0.0.1", "", "")
+	if err != nil {
+		t.Fatalf("ListAdjRIBOut: %v", err)
+	}
+	prefixes := make([]string, 0, len(routes))
+	for _, route := range routes {
+		prefixes = append(prefixes, route.Prefix)
+	}
+	return prefixes
+}
+
+func TestInjectRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     InjectRequest
+		want    string
+		wantErr string
+	}{
+		{name: "IPv4", req: InjectRequest{Prefix: "198.51.100.10/32", Communities: []string{"blackhole"}}, want: "198.51.100.10/32"},
+		{name: "whole allowed prefix", req: InjectRequest{Prefix: "198.51.100.0/24", LocalPref: 200}, want: "198.51.100.0/24"},
+		{name: "IPv6", req: InjectRequest{Prefix: "2001:db8:1::/48"}, want: "2001:db8:1::/48"},
+		{name: "outside the allow-list", req: InjectRequest{Prefix: "192.0.2.0/24"}, wantErr: "not in the injection allow-list"},
+		{name: "less specific than allowed", req: InjectRequest{Prefix: "198.51.0.0/16"}, wantErr: "not in the injection allow-list"},
+		{name: "next hop of another family", req: InjectRequest{Prefix: "198.51.100.0/24", NextHop: "2001:db8::1"}, wantErr: "not in the same address family"},
+		{name: "invalid community", req: InjectRequest{Prefix: "198.51.100.0/24", Communities: []string{"65536:1"}}, wantErr: "invalid community"},
+	}
+
+	m := injectionMonitor(t, "ipv4-unicast", "ipv6-unicast")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.TTL = time.Hour
+			injection, err := m.InjectRoute(tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InjectRoute() error = %v, want %q", err, tt.wantErr)
+				}
+				if out := adjRIBOut(t, m); len(out) != 0 {
+					t.Errorf("refused route advertised: %v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InjectRoute: %v", err)
+			}
+			if injection.Prefix != tt.want {
+				t.Errorf("injected %s, want %s", injection.Prefix, tt.want)
+			}
+
+			// The global export default is reject, the injection policy
+			// lets the route out
+			if out := adjRIBOut(t, m); len(out) != 1 || out[0] != tt.want {
+				t.Errorf("Adj-RIB-Out = %v, want [%s]", out, tt.want)
+			}
+
+			if err := m.WithdrawInjectedRoute(tt.want, "test", ""); err != nil {
+				t.Fatalf("WithdrawInjectedRoute: %v", err)
+			}
+			if out := adjRIBOut(t, m); len(out) != 0 {
+				t.Errorf("Adj-RIB-Out after withdrawal = %v, want none", out)
+			}
+			if audit := m.InjectionAuditLog(2); audit[0].Action != InjectionAnnounce || audit[1].Action != InjectionWithdraw {
+				t.Errorf("audit log = %v, want an announcement and a withdrawal", audit)
+			}
+		})
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		for _, lp := range []uint32{100, 200} {
+			if _, err := m.InjectRoute(InjectRequest{Prefix: "198.51.100.0/24", LocalPref: lp, TTL: time.Hour}); err != nil {
+				t.Fatalf("InjectRoute: %v", err)
+			}
+		}
+		if out := adjRIBOut(t, m); len(out) != 1 {
+			t.Errorf("Adj-RIB-Out = %v, want the replaced route once", out)
+		}
+
+		// Withdrawing the replaced route also closes the export policy for it
+		if err := m.WithdrawInjectedRoute("198.51.100.0/24", "test", ""); err != nil {
+			t.Fatalf("WithdrawInjectedRoute: %v", err)
+		}
+		if out := adjRIBOut(t, m); len(out) != 0 {
+			t.Errorf("Adj-RIB-Out after withdrawal = %v, want none", out)
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Soft reset directions
+const (
+	ResetIn   = "in"
+	ResetOut  = "out"
+	ResetBoth = "both"
+)
+
+// livePeer returns a peer that netmeta has a BGP session with
+func (m *Monitor) livePeer(address string) (*PeerState, error) {
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+	if peer.Source != SourceBGP {
+		return nil, fmt.Errorf("peer %s is monitored through %s and has no BGP session", address, strings.ToUpper(peer.Source))
+	}
+	return peer, nil
+}
+
+// RemovePeer tears down the session with a peer and forgets its routes,
+// history and filtering policies
+func (m *Monitor) RemovePeer(address string) error {
+	if _, err := m.livePeer(address); err != nil {
+		return err
+	}
+
+	// Left in place, they would apply to a peer added again with the same
+	// address
+	if err := m.forgetPeerPolicies(address); err != nil {
+		return err
+	}
+
+	if err := m.server.DeletePeer(context.Background(), &api.DeletePeerRequest{
+		Address: address,
+	}); err != nil {
+		return fmt.Errorf("failed to remove peer %s: %w", address, err)
+	}
+
+	m.mu.Lock()
+	delete(m.peers, address)
+	m.mu.Unlock()
+
+	m.dampening.forget(address)
+	m.takeDownCause(address)
+	return nil
+}
+
+// forgetPeerPolicies takes a peer out of the withdraw neighbor-sets and
+// deletes its reject policies
+func (m *Monitor) forgetPeerPolicies(address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sets := make([]string, 0, len(m.vrfPolicies)+1)
+	if m.withdrawPolicyReady {
+		sets = append(sets, withdrawPolicyName)
+	}
+	for name := range m.vrfPolicies {
+		sets = append(sets, name)
+	}
+	sort.Strings(sets)
+
+	ctx := context.Background()
+	for _, name := range sets {
+		if err := m.server.DeleteDefinedSet(ctx, &api.DeleteDefinedSetRequest{
+			DefinedSet: &api.DefinedSet{
+				DefinedType: api.DefinedType_NEIGHBOR,
+				Name:        name,
+				List:        []string{neighborSetEntry(address)},
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to remove %s from %s: %w", address, name, err)
+		}
+	}
+	return m.deleteRejectPolicies(address)
+}
+
+// UpdatePeer applies a new configuration to an existing peer. GoBGP resets
+// the session only when the change requires it, e.g. a new ASN or new
+// families; policy-relevant changes are applied with a soft reset.
+func (m *Monitor) UpdatePeer(cfg PeerConfig) error {
+	peer, err := m.livePeer(cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Families) == 0 {
+		cfg.Families = DefaultFamilies
+	}
+	peerConfig, err := cfg.apiPeer()
+	if err != nil {
+		return fmt.Errorf("failed to update peer %s: %w", cfg.Address, err)
+	}
+
+	// An update must not bring a disabled peer back up
+	peer.mu.RLock()
+	peerConfig.Conf.AdminDown = peer.Disabled
+	peer.mu.RUnlock()
+
+	if _, err := m.server.UpdatePeer(context.Background(), &api.UpdatePeerRequest{
+		Peer:          peerConfig,
+		DoSoftResetIn: true,
+	}); err != nil {
+		return fmt.Errorf("failed to update peer %s: %w", cfg.Address, err)
+	}
+
+	peer.mu.Lock()
+	peer.ASN = cfg.ASN
+	peer.families = cfg.Families
+	peer.Config = cfg
+	m.checkPrefixLimits(peer)
+	m.unlockPeer(peer)
+	return nil
+}
+
+// DisablePeer administratively shuts down the session with a peer. The
+// reason is sent to the peer as a shutdown communication (RFC 8203). The
+// drop is not counted as a flap.
+func (m *Monitor) DisablePeer(address, reason string) error {
+	peer, err := m.livePeer(address)
+	if err != nil {
+		return err
+	}
+
+	peer.mu.Lock()
+	wasDisabled := peer.Disabled
+	peer.Disabled = true
+	peer.mu.Unlock()
+
+	if err := m.server.DisablePeer(context.Background(), &api.DisablePeerRequest{
+		Address:       address,
+		Communication: reason,
+	}); err != nil {
+		peer.mu.Lock()
+		peer.Disabled = wasDisabled
+		peer.mu.Unlock()
+		return fmt.Errorf("failed to disable peer %s: %w", address, err)
+	}
+	return nil
+}
+
+// EnablePeer brings a disabled peer back up
+func (m *Monitor) EnablePeer(address string) error {
+	peer, err := m.livePeer(address)
+	if err != nil {
+		return err
+	}
+
+	if err := m.server.EnablePeer(context.Background(), &api.EnablePeerRequest{
+		Address: address,
+	}); err != nil {
+		return fmt.Errorf("failed to enable peer %s: %w", address, err)
+	}
+
+	peer.mu.Lock()
+	peer.Disabled = false
+	peer.mu.Unlock()
+	return nil
+}
+
+// SoftResetPeer re-applies policies to a peer's routes without tearing down
+// the session. Inbound resets use route refresh (RFC 2918), outbound resets
+// re-advertise the Adj-RIB-Out.
+func (m *Monitor) SoftResetPeer(address, direction string) error {
+	if _, err := m.livePeer(address); err != nil {
+		return err
+	}
+
+	var dir api.ResetPeerRequest_SoftResetDirection
+	switch direction {
+	case ResetIn:
+		dir = api.ResetPeerRequest_IN
+	case ResetOut:
+		dir = api.ResetPeerRequest_OUT
+	case ResetBoth, "":
+		dir = api.ResetPeerRequest_BOTH
+	default:
+		return fmt.Errorf("invalid soft reset direction %q (must be in, out or both)", direction)
+	}
+
+	if err := m.server.ResetPeer(context.Background(), &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: dir,
+	}); err != nil {
+		return fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+	return nil
+}
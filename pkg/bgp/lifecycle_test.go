@@ -0,0 +1,82 @@
+package bgp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+func TestRemovePeer(t *testing.T) {
+	m := newTestMonitor(t)
+	if err := m.StartBGP(GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenPort: -1}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+	if err := m.SetVRFs([]VRFConfig{{Name: "blue", ImportTargets: []string{"64500:100"}}}); err != nil {
+		t.Fatalf("SetVRFs: %v", err)
+	}
+	for _, address := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := m.AddPeer(PeerConfig{Address: address, ASN: 64500, Passive: true}); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+		if err := m.RejectPrefixes(address, []string{"198.51.100.0/24", "2001:db8::/32"}); err != nil {
+			t.Fatalf("RejectPrefixes: %v", err)
+		}
+		if _, err := m.WithdrawAllPrefixes(address); err != nil {
+			t.Fatalf("WithdrawAllPrefixes: %v", err)
+		}
+		if _, err := m.WithdrawVRFPrefixes(address, "blue"); err != nil {
+			t.Fatalf("WithdrawVRFPrefixes: %v", err)
+		}
+	}
+
+	if err := m.RemovePeer("192.0.2.1"); err != nil {
+		t.Fatalf("RemovePeer: %v", err)
+	}
+
+	// Only the other peer's policy state is left
+	ctx := context.Background()
+	neighbors := make(map[string][]string)
+	var sets []string
+	for _, typ := range []api.DefinedType{api.DefinedType_NEIGHBOR, api.DefinedType_PREFIX} {
+		if err := m.server.ListDefinedSet(ctx, &api.ListDefinedSetRequest{DefinedType: typ}, func(d *api.DefinedSet) {
+			sets = append(sets, d.Name)
+			if typ == api.DefinedType_NEIGHBOR {
+				neighbors[d.Name] = d.List
+			}
+		}); err != nil {
+			t.Fatalf("ListDefinedSet: %v", err)
+		}
+	}
+	for _, name := range []string{withdrawPolicyName, vrfWithdrawPolicyPrefix + "blue"} {
+		if list := neighbors[name]; len(list) != 1 || list[0] != "192.0.2.2/32" {
+			t.Errorf("neighbor-set %s = %v, want [192.0.2.2/32]", name, list)
+		}
+	}
+	var policies []string
+	if err := m.server.ListPolicy(ctx, &api.ListPolicyRequest{}, func(p *api.Policy) {
+		policies = append(policies, p.Name)
+	}); err != nil {
+		t.Fatalf("ListPolicy: %v", err)
+	}
+	for _, name := range append(sets, policies...) {
+		if strings.Contains(name, "192_0_2_1") {
+			t.Errorf("%s left behind", name)
+		}
+	}
+	if !strings.Contains(strings.Join(policies, " "), "192_0_2_2") {
+		t.Errorf("policies = %v, want the reject policies of 192.0.2.2", policies)
+	}
+
+	// Added again, the peer has nothing rejected
+	if err := m.AddPeer(PeerConfig{Address: "192.0.2.1", ASN: 64500, Passive: true}); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+	if err := m.AcceptPrefix("192.0.2.1", "198.51.100.0/24"); err == nil || !strings.Contains(err.Error(), "is not rejected") {
+		t.Errorf("AcceptPrefix() error = %v, want not rejected", err)
+	}
+	if err := m.RejectPrefix("192.0.2.1", "198.51.100.0/24"); err != nil {
+		t.Errorf("RejectPrefix: %v", err)
+	}
+}
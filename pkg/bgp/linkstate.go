@@ -0,0 +1,669 @@
+package bgp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// FamilyLinkState is the BGP-LS address family (RFC 7752). Peers configured
+// with it export their IGP topology.
+var FamilyLinkState = bgp.RF_LS.String()
+
+// LSTopology is the IGP topology learned through BGP-LS. Like ospf.Topology
+// it maps every router to the links it originates; the attributes of the
+// routers themselves and the prefixes they advertise are kept in Nodes.
+type LSTopology struct {
+	Routers map[string][]LSLink
+	Nodes   map[string]*LSNode
+}
+
+// LSNode is a router, or a pseudonode for a broadcast segment, described by
+// a BGP-LS node NLRI. Nodes only known from links have no attributes.
+type LSNode struct {
+	ID         string
+	Name       string
+	Protocol   string
+	ASN        uint32
+	Area       string
+	RouterIDs  []string
+	Pseudonode bool
+	Overload   bool
+	Prefixes   []LSPrefix
+
+	// Segment routing global and local blocks, and supported algorithms
+	SRGB         []SIDRange
+	SRLB         []SIDRange
+	SRAlgorithms []uint8
+
+	// BGP-LS speakers the node was learned from
+	Peers []string
+}
+
+// SIDRange is a block of SR labels
+type SIDRange struct {
+	Begin uint32
+	End   uint32
+}
+
+// LSLink is a unidirectional adjacency from a router to one of its
+// neighbors. Bandwidths are in bits per second; SIDs are nil when not
+// advertised.
+type LSLink struct {
+	RemoteRouterID      string
+	Protocol            string
+	LocalAddress        string
+	RemoteAddress       string
+	LocalLinkID         uint32
+	RemoteLinkID        uint32
+	Name                string
+	IGPMetric           uint32
+	TEMetric            uint32
+	AdminGroup          uint32
+	MaxBandwidth        float64
+	ReservableBandwidth float64
+	UnreservedBandwidth []float64
+	SRLGs               []uint32
+	AdjacencySID        *uint32
+	State               string
+}
+
+// LSPrefix is a prefix a router advertises into the IGP
+type LSPrefix struct {
+	Prefix    string
+	RouteType string
+	PrefixSID *uint32
+	Down      bool
+}
+
+// Link state for links that are advertised
+const linkUp = "Up"
+
+var ospfRouteTypes = map[bgp.LsOspfRouteType]string{
+	bgp.LS_OSPF_ROUTE_TYPE_INTRA_AREA: "intra-area",
+	bgp.LS_OSPF_ROUTE_TYPE_INTER_AREA: "inter-area",
+	bgp.LS_OSPF_ROUTE_TYPE_EXTERNAL1:  "external-1",
+	bgp.LS_OSPF_ROUTE_TYPE_EXTERNAL2:  "external-2",
+	bgp.LS_OSPF_ROUTE_TYPE_NSSA1:      "nssa-1",
+	bgp.LS_OSPF_ROUTE_TYPE_NSSA2:      "nssa-2",
+}
+
+// LinkStateTopology builds the topology from the BGP-LS routes of every
+// peer. Objects reported by several speakers are merged.
+func (m *Monitor) LinkStateTopology() *LSTopology {
+	topology := &LSTopology{
+		Routers: make(map[string][]LSLink),
+		Nodes:   make(map[string]*LSNode),
+	}
+
+	// Routes are replaced rather than modified once stored, so they can be
+	// decoded without holding the locks
+	type lsRoute struct {
+		peer  string
+		route *Route
+	}
+	var routes []lsRoute
+	m.mu.RLock()
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				if route.Family == FamilyLinkState {
+					routes = append(routes, lsRoute{peer.Address, route})
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+
+	links := make(map[string]map[string]LSLink)
+	prefixes := make(map[string]map[string]LSPrefix)
+	for _, r := range routes {
+		prefix, ok := r.route.nlri.(*bgp.LsAddrPrefix)
+		if !ok {
+			continue
+		}
+		attrs := &bgp.LsAttribute{}
+		for _, attr := range r.route.attrs {
+			if ls, ok := attr.(*bgp.PathAttributeLs); ok {
+				attrs = ls.Extract()
+			}
+		}
+
+		switch nlri := prefix.NLRI.(type) {
+		case *bgp.LsNodeNLRI:
+			node := topology.node(nodeDescriptor(nlri.LocalNodeDesc), nlri.ProtocolID, r.peer)
+			node.setAttributes(&attrs.Node)
+
+		case *bgp.LsLinkNLRI:
+			local := topology.node(nodeDescriptor(nlri.LocalNodeDesc), nlri.ProtocolID, r.peer)
+			remote := topology.node(nodeDescriptor(nlri.RemoteNodeDesc), nlri.ProtocolID, r.peer)
+			link := newLSLink(remote.ID, nlri, &attrs.Link)
+			if links[local.ID] == nil {
+				links[local.ID] = make(map[string]LSLink)
+			}
+			key := fmt.Sprintf("%s|%s|%s|%d", link.RemoteRouterID, link.LocalAddress, link.RemoteAddress, link.LocalLinkID)
+			links[local.ID][key] = link
+
+		case *bgp.LsPrefixV4NLRI:
+			node := topology.node(nodeDescriptor(nlri.LocalNodeDesc), nlri.ProtocolID, r.peer)
+			addPrefixes(prefixes, node.ID, nlri.PrefixDesc, false, &attrs.Prefix)
+
+		case *bgp.LsPrefixV6NLRI:
+			node := topology.node(nodeDescriptor(nlri.LocalNodeDesc), nlri.ProtocolID, r.peer)
+			addPrefixes(prefixes, node.ID, nlri.PrefixDesc, true, &attrs.Prefix)
+		}
+	}
+
+	for id, node := range topology.Nodes {
+		routerLinks := make([]LSLink, 0, len(links[id]))
+		for _, link := range links[id] {
+			routerLinks = append(routerLinks, link)
+		}
+		sort.Slice(routerLinks, func(i, j int) bool {
+			if routerLinks[i].RemoteRouterID != routerLinks[j].RemoteRouterID {
+				return routerLinks[i].RemoteRouterID < routerLinks[j].RemoteRouterID
+			}
+			return routerLinks[i].LocalAddress < routerLinks[j].LocalAddress
+		})
+		topology.Routers[id] = routerLinks
+
+		for _, p := range prefixes[id] {
+			node.Prefixes = append(node.Prefixes, p)
+		}
+		sort.Slice(node.Prefixes, func(i, j int) bool {
+			return node.Prefixes[i].Prefix < node.Prefixes[j].Prefix
+		})
+		sort.Strings(node.Peers)
+	}
+	return topology
+}
+
+// node returns the topology node for a descriptor, adding it if needed
+func (t *LSTopology) node(desc *bgp.LsNodeDescriptor, protocol bgp.LsProtocolID, peer string) *LSNode {
+	id := desc.IGPRouterID
+	if id == "" && desc.BGPRouterID != nil {
+		id = desc.BGPRouterID.String()
+	}
+
+	node, ok := t.Nodes[id]
+	if !ok {
+		node = &LSNode{
+			ID:         id,
+			Protocol:   protocol.String(),
+			ASN:        desc.Asn,
+			Pseudonode: desc.PseudoNode,
+		}
+		if protocol == bgp.LS_PROTOCOL_OSPF_V2 || protocol == bgp.LS_PROTOCOL_OSPF_V3 {
+			node.Area = net.IPv4(byte(desc.OspfAreaID>>24), byte(desc.OspfAreaID>>16), byte(desc.OspfAreaID>>8), byte(desc.OspfAreaID)).String()
+		}
+		t.Nodes[id] = node
+	}
+	for _, p := range node.Peers {
+		if p == peer {
+			return node
+		}
+	}
+	node.Peers = append(node.Peers, peer)
+	return node
+}
+
+func nodeDescriptor(tlv bgp.LsTLVInterface) *bgp.LsNodeDescriptor {
+	if desc, ok := tlv.(*bgp.LsTLVNodeDescriptor); ok {
+		return desc.Extract()
+	}
+	return &bgp.LsNodeDescriptor{}
+}
+
+// setAttributes copies the attributes of a node NLRI
+func (n *LSNode) setAttributes(a *bgp.LsAttributeNode) {
+	if a.Name != nil {
+		n.Name = *a.Name
+	}
+	if a.IsisArea != nil {
+		n.Area = fmt.Sprintf("%x", *a.IsisArea)
+	}
+	n.RouterIDs = nil
+	for _, id := range []*net.IP{a.LocalRouterID, a.LocalRouterIDv6} {
+		if id != nil {
+			n.RouterIDs = append(n.RouterIDs, id.String())
+		}
+	}
+	if a.Flags != nil {
+		n.Overload = a.Flags.Overload
+	}
+	if a.SrCapabilties != nil {
+		n.SRGB = sidRanges(a.SrCapabilties.Ranges)
+	}
+	if a.SrLocalBlock != nil {
+		n.SRLB = sidRanges(a.SrLocalBlock.Ranges)
+	}
+	if a.SrAlgorithms != nil {
+		n.SRAlgorithms = append([]uint8(nil), *a.SrAlgorithms...)
+	}
+}
+
+func sidRanges(ranges []bgp.LsSrRange) []SIDRange {
+	out := make([]SIDRange, 0, len(ranges))
+	for _, r := range ranges {
+		out = append(out, SIDRange{Begin: r.Begin, End: r.End})
+	}
+	return out
+}
+
+// newLSLink decodes a link NLRI and its attributes. GoBGP reports
+// bandwidths in bytes per second.
+func newLSLink(remote string, nlri *bgp.LsLinkNLRI, a *bgp.LsAttributeLink) LSLink {
+	link := LSLink{
+		RemoteRouterID: remote,
+		Protocol:       nlri.ProtocolID.String(),
+		State:          linkUp,
+	}
+
+	desc := &bgp.LsLinkDescriptor{}
+	desc.ParseTLVs(nlri.LinkDesc)
+	if desc.LinkLocalID != nil {
+		link.LocalLinkID = *desc.LinkLocalID
+	}
+	if desc.LinkRemoteID != nil {
+		link.RemoteLinkID = *desc.LinkRemoteID
+	}
+	for _, addr := range []*net.IP{desc.InterfaceAddrIPv4, desc.InterfaceAddrIPv6} {
+		if addr != nil && link.LocalAddress == "" {
+			link.LocalAddress = addr.String()
+		}
+	}
+	for _, addr := range []*net.IP{desc.NeighborAddrIPv4, desc.NeighborAddrIPv6} {
+		if addr != nil && link.RemoteAddress == "" {
+			link.RemoteAddress = addr.String()
+		}
+	}
+
+	if a.Name != nil {
+		link.Name = *a.Name
+	}
+	if a.IGPMetric != nil {
+		link.IGPMetric = *a.IGPMetric
+	}
+	if a.DefaultTEMetric != nil {
+		link.TEMetric = *a.DefaultTEMetric
+	}
+	if a.AdminGroup != nil {
+		link.AdminGroup = *a.AdminGroup
+	}
+	if a.Bandwidth != nil {
+		link.MaxBandwidth = float64(*a.Bandwidth) * 8
+	}
+	if a.ReservableBandwidth != nil {
+		link.ReservableBandwidth = float64(*a.ReservableBandwidth) * 8
+	}
+	if a.UnreservedBandwidth != nil {
+		for _, bw := range *a.UnreservedBandwidth {
+			link.UnreservedBandwidth = append(link.UnreservedBandwidth, float64(bw)*8)
+		}
+	}
+	if a.Srlgs != nil {
+		link.SRLGs = append([]uint32(nil), *a.Srlgs...)
+	}
+	if a.SrAdjacencySID != nil {
+		sid := *a.SrAdjacencySID
+		link.AdjacencySID = &sid
+	}
+	return link
+}
+
+// addPrefixes records the prefixes of a prefix NLRI for a node
+func addPrefixes(prefixes map[string]map[string]LSPrefix, node string, tlvs []bgp.LsTLVInterface, ipv6 bool, a *bgp.LsAttributePrefix) {
+	desc := &bgp.LsPrefixDescriptor{}
+	desc.ParseTLVs(tlvs, ipv6)
+
+	if prefixes[node] == nil {
+		prefixes[node] = make(map[string]LSPrefix)
+	}
+	for _, ipnet := range desc.IPReachability {
+		p := LSPrefix{
+			Prefix:    ipnet.String(),
+			RouteType: ospfRouteTypes[desc.OSPFRouteType],
+		}
+		if a.SrPrefixSID != nil {
+			sid := *a.SrPrefixSID
+			p.PrefixSID = &sid
+		}
+		if a.IGPFlags != nil {
+			p.Down = a.IGPFlags.Down
+		}
+		prefixes[node][p.Prefix] = p
+	}
+}
+
+// lsFromPath decodes a BGP-LS path. GoBGP's conversion from the API garbles
+// IGP router IDs and prefix descriptors and drops most node and prefix
+// attributes, so the NLRI and the BGP-LS attribute are rebuilt here.
+func lsFromPath(path *api.Path) (bgp.AddrPrefixInterface, []bgp.PathAttributeInterface, error) {
+	ls := &api.LsAddrPrefix{}
+	if err := path.Nlri.UnmarshalTo(ls); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode NLRI: %w", err)
+	}
+	inner, err := ls.Nlri.UnmarshalNew()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode NLRI: %w", err)
+	}
+
+	hdr := bgp.LsNLRI{
+		NLRIType:   bgp.LsNLRIType(ls.Type),
+		ProtocolID: bgp.LsProtocolID(ls.ProtocolId),
+		Identifier: ls.Identifier,
+	}
+	var native bgp.LsNLRIInterface
+	switch v := inner.(type) {
+	case *api.LsNodeNLRI:
+		local, err := lsNodeTLV(v.LocalNode, bgp.LS_TLV_LOCAL_NODE_DESC)
+		if err != nil {
+			return nil, nil, err
+		}
+		native = &bgp.LsNodeNLRI{LsNLRI: hdr, LocalNodeDesc: local}
+
+	case *api.LsLinkNLRI:
+		local, err := lsNodeTLV(v.LocalNode, bgp.LS_TLV_LOCAL_NODE_DESC)
+		if err != nil {
+			return nil, nil, err
+		}
+		remote, err := lsNodeTLV(v.RemoteNode, bgp.LS_TLV_REMOTE_NODE_DESC)
+		if err != nil {
+			return nil, nil, err
+		}
+		native = &bgp.LsLinkNLRI{LsNLRI: hdr, LocalNodeDesc: local, RemoteNodeDesc: remote, LinkDesc: lsLinkTLVs(v.LinkDescriptor)}
+
+	case *api.LsPrefixV4NLRI:
+		local, err := lsNodeTLV(v.LocalNode, bgp.LS_TLV_LOCAL_NODE_DESC)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlvs, err := lsPrefixTLVs(v.PrefixDescriptor)
+		if err != nil {
+			return nil, nil, err
+		}
+		native = &bgp.LsPrefixV4NLRI{LsNLRI: hdr, LocalNodeDesc: local, PrefixDesc: tlvs}
+
+	case *api.LsPrefixV6NLRI:
+		local, err := lsNodeTLV(v.LocalNode, bgp.LS_TLV_LOCAL_NODE_DESC)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlvs, err := lsPrefixTLVs(v.PrefixDescriptor)
+		if err != nil {
+			return nil, nil, err
+		}
+		native = &bgp.LsPrefixV6NLRI{LsNLRI: hdr, LocalNodeDesc: local, PrefixDesc: tlvs}
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported BGP-LS NLRI type %s", ls.Type)
+	}
+
+	b, err := native.Serialize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode NLRI: %w", err)
+	}
+	nlri := &bgp.LsAddrPrefix{Type: hdr.NLRIType, Length: uint16(len(b)), NLRI: native}
+
+	attrs := make([]bgp.PathAttributeInterface, 0, len(path.Pattrs))
+	for _, an := range path.Pattrs {
+		if a := (&api.LsAttribute{}); an.MessageIs(a) {
+			if err := an.UnmarshalTo(a); err != nil {
+				return nil, nil, fmt.Errorf("failed to decode path attributes: %w", err)
+			}
+			attrs = append(attrs, lsAttribute(a))
+			continue
+		}
+		attr, err := apiutil.UnmarshalAttribute(an)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode path attributes: %w", err)
+		}
+		if reach, ok := attr.(*bgp.PathAttributeMpReachNLRI); ok {
+			attr = bgp.NewPathAttributeMpReachNLRI(reach.Nexthop.String(), []bgp.AddrPrefixInterface{nlri})
+		}
+		attrs = append(attrs, attr)
+	}
+	return nlri, attrs, nil
+}
+
+func lsNodeTLV(d *api.LsNodeDescriptor, typ bgp.LsTLVType) (*bgp.LsTLVNodeDescriptor, error) {
+	if d == nil {
+		return nil, fmt.Errorf("missing BGP-LS node descriptor")
+	}
+	id, err := igpRouterID(d.IgpRouterId)
+	if err != nil {
+		return nil, err
+	}
+	desc := &bgp.LsNodeDescriptor{
+		Asn:                    d.Asn,
+		BGPLsID:                d.BgpLsId,
+		OspfAreaID:             d.OspfAreaId,
+		BGPConfederationMember: d.BgpConfederationMember,
+		// Taken as the raw bytes of the ID
+		IGPRouterID: string(id),
+	}
+	if ip := lsAddress(d.BgpRouterId, true); ip != nil {
+		desc.BGPRouterID = *ip
+	}
+	tlv := bgp.NewLsTLVNodeDescriptor(desc, typ)
+	return &tlv, nil
+}
+
+// igpRouterID reverses the formatting of IGP router IDs: an IPv4 address for
+// OSPF and a system ID for IS-IS, followed by the designated router or the
+// pseudonode ID for pseudonodes
+func igpRouterID(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if router, dr, ok := strings.Cut(s, ":"); ok {
+		a, errA := netip.ParseAddr(router)
+		b, errB := netip.ParseAddr(dr)
+		if errA != nil || errB != nil || !a.Is4() || !b.Is4() {
+			return nil, fmt.Errorf("invalid IGP router ID %q", s)
+		}
+		return append(a.AsSlice(), b.AsSlice()...), nil
+	}
+	if addr, err := netip.ParseAddr(s); err == nil && addr.Is4() {
+		return addr.AsSlice(), nil
+	}
+
+	system, pseudonode, ok := strings.Cut(s, "-")
+	id, err := hex.DecodeString(strings.ReplaceAll(system, ".", ""))
+	if err != nil || len(id) != 6 {
+		return nil, fmt.Errorf("invalid IGP router ID %q", s)
+	}
+	if ok {
+		b, err := hex.DecodeString(pseudonode)
+		if err != nil || len(b) != 1 {
+			return nil, fmt.Errorf("invalid IGP router ID %q", s)
+		}
+		id = append(id, b...)
+	}
+	return id, nil
+}
+
+func lsLinkTLVs(d *api.LsLinkDescriptor) []bgp.LsTLVInterface {
+	if d == nil {
+		return nil
+	}
+	desc := &bgp.LsLinkDescriptor{}
+	if d.LinkLocalId != 0 || d.LinkRemoteId != 0 {
+		desc.LinkLocalID = &d.LinkLocalId
+		desc.LinkRemoteID = &d.LinkRemoteId
+	}
+	desc.InterfaceAddrIPv4 = lsAddress(d.InterfaceAddrIpv4, true)
+	desc.NeighborAddrIPv4 = lsAddress(d.NeighborAddrIpv4, true)
+	desc.InterfaceAddrIPv6 = lsAddress(d.InterfaceAddrIpv6, false)
+	desc.NeighborAddrIPv6 = lsAddress(d.NeighborAddrIpv6, false)
+	return bgp.NewLsLinkTLVs(desc)
+}
+
+// lsPrefixTLVs encodes a prefix descriptor. Default routes are left out as
+// GoBGP cannot print them.
+func lsPrefixTLVs(d *api.LsPrefixDescriptor) ([]bgp.LsTLVInterface, error) {
+	if d == nil {
+		return nil, nil
+	}
+	var tlvs []bgp.LsTLVInterface
+	for _, reach := range d.IpReachability {
+		p, err := netip.ParsePrefix(reach)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BGP-LS prefix %q: %w", reach, err)
+		}
+		if p.Bits() == 0 {
+			continue
+		}
+		n := (p.Bits() + 7) / 8
+		tlvs = append(tlvs, &bgp.LsTLVIPReachability{
+			LsTLV:        bgp.LsTLV{Type: bgp.LS_TLV_IP_REACH_INFO, Length: uint16(1 + n)},
+			PrefixLength: uint8(p.Bits()),
+			Prefix:       p.Masked().Addr().AsSlice()[:n],
+		})
+	}
+	if d.OspfRouteType != api.LsOspfRouteType_LS_OSPF_ROUTE_TYPE_UNKNOWN {
+		tlvs = append(tlvs, &bgp.LsTLVOspfRouteType{
+			LsTLV:     bgp.LsTLV{Type: bgp.LS_TLV_OSPF_ROUTE_TYPE, Length: 1},
+			RouteType: bgp.LsOspfRouteType(d.OspfRouteType),
+		})
+	}
+	return tlvs, nil
+}
+
+// lsAttribute encodes a BGP-LS attribute. The API reports absent values as
+// zero.
+func lsAttribute(a *api.LsAttribute) *bgp.PathAttributeLs {
+	attr := &bgp.LsAttribute{}
+
+	if n := a.Node; n != nil {
+		if n.Flags != nil {
+			attr.Node.Flags = &bgp.LsNodeFlags{
+				Overload: n.Flags.Overload,
+				Attached: n.Flags.Attached,
+				External: n.Flags.External,
+				ABR:      n.Flags.Abr,
+				Router:   n.Flags.Router,
+				V6:       n.Flags.V6,
+			}
+		}
+		if n.Name != "" {
+			attr.Node.Name = &n.Name
+		}
+		if len(n.IsisArea) > 0 {
+			attr.Node.IsisArea = &n.IsisArea
+		}
+		if len(n.Opaque) > 0 {
+			attr.Node.Opaque = &n.Opaque
+		}
+		attr.Node.LocalRouterID = lsAddress(n.LocalRouterId, true)
+		attr.Node.LocalRouterIDv6 = lsAddress(n.LocalRouterIdV6, false)
+		if n.SrCapabilities != nil {
+			attr.Node.SrCapabilties = &bgp.LsSrCapabilities{
+				IPv4Supported: n.SrCapabilities.Ipv4Supported,
+				IPv6Supported: n.SrCapabilities.Ipv6Supported,
+			}
+			for _, r := range n.SrCapabilities.Ranges {
+				attr.Node.SrCapabilties.Ranges = append(attr.Node.SrCapabilties.Ranges, bgp.LsSrRange{Begin: r.Begin, End: r.End})
+			}
+		}
+		if len(n.SrAlgorithms) > 0 {
+			attr.Node.SrAlgorithms = &n.SrAlgorithms
+		}
+		if n.SrLocalBlock != nil {
+			attr.Node.SrLocalBlock = &bgp.LsSrLocalBlock{}
+			for _, r := range n.SrLocalBlock.Ranges {
+				attr.Node.SrLocalBlock.Ranges = append(attr.Node.SrLocalBlock.Ranges, bgp.LsSrRange{Begin: r.Begin, End: r.End})
+			}
+		}
+	}
+
+	if l := a.Link; l != nil {
+		if l.Name != "" {
+			attr.Link.Name = &l.Name
+		}
+		attr.Link.LocalRouterID = lsAddress(l.LocalRouterId, true)
+		attr.Link.LocalRouterIDv6 = lsAddress(l.LocalRouterIdV6, false)
+		attr.Link.RemoteRouterID = lsAddress(l.RemoteRouterId, true)
+		attr.Link.RemoteRouterIDv6 = lsAddress(l.RemoteRouterIdV6, false)
+		if l.AdminGroup != 0 {
+			attr.Link.AdminGroup = &l.AdminGroup
+		}
+		if l.DefaultTeMetric != 0 {
+			attr.Link.DefaultTEMetric = &l.DefaultTeMetric
+		}
+		if l.IgpMetric != 0 {
+			attr.Link.IGPMetric = &l.IgpMetric
+		}
+		if len(l.Opaque) > 0 {
+			attr.Link.Opaque = &l.Opaque
+		}
+		if l.Bandwidth != 0 {
+			attr.Link.Bandwidth = &l.Bandwidth
+		}
+		if l.ReservableBandwidth != 0 {
+			attr.Link.ReservableBandwidth = &l.ReservableBandwidth
+		}
+		if len(l.UnreservedBandwidth) > 0 {
+			var bw [8]float32
+			copy(bw[:], l.UnreservedBandwidth)
+			attr.Link.UnreservedBandwidth = &bw
+		}
+		if len(l.Srlgs) > 0 {
+			attr.Link.Srlgs = &l.Srlgs
+		}
+		if l.SrAdjacencySid != 0 {
+			attr.Link.SrAdjacencySID = &l.SrAdjacencySid
+		}
+	}
+
+	if p := a.Prefix; p != nil {
+		if p.IgpFlags != nil {
+			attr.Prefix.IGPFlags = &bgp.LsIGPFlags{
+				Down:          p.IgpFlags.Down,
+				NoUnicast:     p.IgpFlags.NoUnicast,
+				LocalAddress:  p.IgpFlags.LocalAddress,
+				PropagateNSSA: p.IgpFlags.PropagateNssa,
+			}
+		}
+		if len(p.Opaque) > 0 {
+			attr.Prefix.Opaque = &p.Opaque
+		}
+		if p.SrPrefixSid != 0 {
+			attr.Prefix.SrPrefixSID = &p.SrPrefixSid
+		}
+	}
+
+	tlvs := bgp.NewLsAttributeTLVs(attr)
+	var length uint16
+	for _, tlv := range tlvs {
+		length += uint16(tlv.Len())
+	}
+	return &bgp.PathAttributeLs{
+		PathAttribute: bgp.PathAttribute{
+			Flags:  bgp.PathAttrFlags[bgp.BGP_ATTR_TYPE_LS],
+			Type:   bgp.BGP_ATTR_TYPE_LS,
+			Length: length,
+		},
+		TLVs: tlvs,
+	}
+}
+
+func lsAddress(s string, ipv4 bool) *net.IP {
+	ip := net.ParseIP(s)
+	if ipv4 {
+		ip = ip.To4()
+	}
+	if ip == nil {
+		return nil
+	}
+	return &ip
+}
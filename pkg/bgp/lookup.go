@@ -0,0 +1,319 @@
+package bgp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// ErrNoRoute is returned when no peer has a route covering an address
+var ErrNoRoute = errors.New("no route")
+
+// Routes without LOCAL_PREF, e.g. from eBGP peers, are compared with the
+// default value routers assign them
+const defaultLocalPref = 100
+
+// Best path decision steps, in the order they are applied
+const (
+	StepLocalPref   = "local-pref"
+	StepASPath      = "as-path"
+	StepOrigin      = "origin"
+	StepMED         = "med"
+	StepEBGP        = "ebgp-over-ibgp"
+	StepRouterID    = "router-id"
+	StepPeerAddress = "peer-address"
+)
+
+// LookupPath is a candidate path for a looked up address
+type LookupPath struct {
+	Peer      string
+	PeerASN   uint32
+	RouterID  string
+	Source    string
+	IBGP      bool
+	LocalPref uint32
+	Route     *Route
+
+	// Best is the path chosen by the decision process below. Installed is
+	// set on the path GoBGP selected for its Loc-RIB, which may differ when
+	// import policies modify routes.
+	Best      bool
+	Installed bool
+
+	// Decision step that ruled the path out
+	EliminatedBy string
+}
+
+// DecisionStep explains one step of the best path selection
+type DecisionStep struct {
+	Step      string
+	Detail    string
+	Remaining int
+}
+
+// LookupResult is the longest prefix match of an address across every peer
+type LookupResult struct {
+	Address string
+	Prefix  string
+	Paths   []*LookupPath
+	Steps   []DecisionStep
+}
+
+// Lookup finds the most specific unicast prefix covering an IP address in
+// any peer's Adj-RIB-In, and runs the BGP decision process (RFC 4271
+// section 9.1.2.2) over every path for it. Peers in the local AS are
+// treated as iBGP.
+func (m *Monitor) Lookup(ip string) (*LookupResult, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	addr = addr.Unmap().WithZone("")
+
+	family := bgp.RF_IPv4_UC.String()
+	if addr.Is6() {
+		family = bgp.RF_IPv6_UC.String()
+	}
+
+	result := &LookupResult{Address: addr.String()}
+
+	m.mu.RLock()
+	var localASN uint32
+	if m.global != nil {
+		localASN = m.global.ASN
+	}
+	for bits := addr.BitLen(); bits >= 0 && len(result.Paths) == 0; bits-- {
+		prefix := netip.PrefixFrom(addr, bits).Masked().String()
+		for _, peer := range m.peers {
+			peer.mu.RLock()
+			if peer.routes != nil {
+				if route, ok := peer.routes.routes[prefix]; ok && route.Family == family {
+					result.Prefix = prefix
+					result.Paths = append(result.Paths, &LookupPath{
+						Peer:      peer.Address,
+						PeerASN:   peer.ASN,
+						RouterID:  peer.RouterID,
+						Source:    peer.Source,
+						IBGP:      localASN != 0 && peer.ASN == localASN,
+						LocalPref: effectiveLocalPref(route),
+						Route:     route,
+					})
+				}
+			}
+			peer.mu.RUnlock()
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(result.Paths) == 0 {
+		return nil, fmt.Errorf("%w to %s", ErrNoRoute, result.Address)
+	}
+
+	sort.Slice(result.Paths, func(i, j int) bool {
+		return result.Paths[i].Peer < result.Paths[j].Peer
+	})
+	result.Steps = selectBestPath(result.Paths)
+	m.markInstalled(family, result)
+
+	// Best path first, then in the order they were eliminated
+	order := map[string]int{"": 0}
+	for i, s := range result.Steps {
+		order[s.Step] = len(result.Steps) - i
+	}
+	sort.SliceStable(result.Paths, func(i, j int) bool {
+		return order[result.Paths[i].EliminatedBy] < order[result.Paths[j].EliminatedBy]
+	})
+	return result, nil
+}
+
+// markInstalled flags the path GoBGP selected as best for the prefix
+func (m *Monitor) markInstalled(family string, result *LookupResult) {
+	apiFamily, err := toAPIFamily(family)
+	if err != nil {
+		return
+	}
+
+	m.server.ListPath(context.Background(), &api.ListPathRequest{
+		TableType: api.TableType_GLOBAL,
+		Family:    apiFamily,
+		Prefixes:  []*api.TableLookupPrefix{{Prefix: result.Prefix}},
+	}, func(d *api.Destination) {
+		for _, path := range d.Paths {
+			if !path.Best {
+				continue
+			}
+			for _, p := range result.Paths {
+				if p.Source == SourceBGP && p.Peer == path.NeighborIp {
+					p.Installed = true
+				}
+			}
+		}
+	})
+}
+
+func effectiveLocalPref(route *Route) uint32 {
+	for _, attr := range route.attrs {
+		if _, ok := attr.(*bgp.PathAttributeLocalPref); ok {
+			return route.LocalPref
+		}
+	}
+	return defaultLocalPref
+}
+
+// selectBestPath runs the decision process, marking the best path and why
+// every other path lost
+func selectBestPath(paths []*LookupPath) []DecisionStep {
+	remaining := paths
+	steps := make([]DecisionStep, 0)
+
+	for _, step := range []struct {
+		name   string
+		filter func([]*LookupPath) ([]*LookupPath, string)
+	}{
+		{StepLocalPref, preferLocalPref},
+		{StepASPath, preferShortestASPath},
+		{StepOrigin, preferLowestOrigin},
+		{StepMED, preferLowestMED},
+		{StepEBGP, preferEBGP},
+		{StepRouterID, preferLowestRouterID},
+		{StepPeerAddress, preferLowestPeerAddress},
+	} {
+		if len(remaining) == 1 {
+			break
+		}
+
+		kept, detail := step.filter(remaining)
+		keep := make(map[*LookupPath]bool, len(kept))
+		for _, p := range kept {
+			keep[p] = true
+		}
+		for _, p := range remaining {
+			if !keep[p] {
+				p.EliminatedBy = step.name
+			}
+		}
+		remaining = kept
+
+		steps = append(steps, DecisionStep{Step: step.name, Detail: detail, Remaining: len(remaining)})
+	}
+
+	remaining[0].Best = true
+	return steps
+}
+
+// keepBy keeps the paths with the lowest key
+func keepBy(paths []*LookupPath, key func(*LookupPath) int64) ([]*LookupPath, int64) {
+	best := key(paths[0])
+	for _, p := range paths[1:] {
+		best = min(best, key(p))
+	}
+	kept := make([]*LookupPath, 0, len(paths))
+	for _, p := range paths {
+		if key(p) == best {
+			kept = append(kept, p)
+		}
+	}
+	return kept, best
+}
+
+func preferLocalPref(paths []*LookupPath) ([]*LookupPath, string) {
+	kept, best := keepBy(paths, func(p *LookupPath) int64 { return -int64(p.LocalPref) })
+	return kept, fmt.Sprintf("highest local-pref %d", -best)
+}
+
+func preferShortestASPath(paths []*LookupPath) ([]*LookupPath, string) {
+	kept, best := keepBy(paths, func(p *LookupPath) int64 { return int64(len(p.Route.ASPath)) })
+	return kept, fmt.Sprintf("shortest AS path length %d", best)
+}
+
+var originRank = map[string]int64{"igp": 0, "egp": 1, "incomplete": 2}
+
+func preferLowestOrigin(paths []*LookupPath) ([]*LookupPath, string) {
+	kept, _ := keepBy(paths, func(p *LookupPath) int64 {
+		if rank, ok := originRank[p.Route.Origin]; ok {
+			return rank
+		}
+		return 2
+	})
+	return kept, fmt.Sprintf("lowest origin %s (igp < egp < incomplete)", kept[0].Route.Origin)
+}
+
+// preferLowestMED compares MED only between paths from the same neighbor AS
+func preferLowestMED(paths []*LookupPath) ([]*LookupPath, string) {
+	groups := make(map[uint32][]*LookupPath)
+	for _, p := range paths {
+		groups[neighborAS(p)] = append(groups[neighborAS(p)], p)
+	}
+
+	kept := make([]*LookupPath, 0, len(paths))
+	for _, p := range paths {
+		group, _ := keepBy(groups[neighborAS(p)], func(q *LookupPath) int64 { return int64(q.Route.MED) })
+		for _, q := range group {
+			if q == p {
+				kept = append(kept, p)
+			}
+		}
+	}
+
+	if len(groups) == 1 {
+		return kept, fmt.Sprintf("lowest MED %d from AS%d", kept[0].Route.MED, neighborAS(kept[0]))
+	}
+	return kept, "lowest MED per neighbor AS, MEDs from different ASes are not compared"
+}
+
+// neighborAS is the AS a path was learned from, the first in its AS path
+func neighborAS(p *LookupPath) uint32 {
+	if len(p.Route.ASPath) == 0 {
+		return p.PeerASN
+	}
+	return p.Route.ASPath[0]
+}
+
+func preferEBGP(paths []*LookupPath) ([]*LookupPath, string) {
+	kept, best := keepBy(paths, func(p *LookupPath) int64 {
+		if p.IBGP {
+			return 1
+		}
+		return 0
+	})
+	switch {
+	case best == 1:
+		return kept, "all paths are iBGP"
+	case len(kept) == len(paths):
+		return kept, "all paths are eBGP"
+	default:
+		return kept, "eBGP paths preferred over iBGP"
+	}
+}
+
+func preferLowestRouterID(paths []*LookupPath) ([]*LookupPath, string) {
+	kept, best := keepBy(paths, func(p *LookupPath) int64 {
+		if id, err := netip.ParseAddr(p.RouterID); err == nil && id.Is4() {
+			b := id.As4()
+			return int64(b[0])<<24 | int64(b[1])<<16 | int64(b[2])<<8 | int64(b[3])
+		}
+		// Unknown router IDs lose
+		return 1 << 32
+	})
+	if best == 1<<32 {
+		return kept, "router IDs unknown"
+	}
+	return kept, fmt.Sprintf("lowest router ID %s", kept[0].RouterID)
+}
+
+func preferLowestPeerAddress(paths []*LookupPath) ([]*LookupPath, string) {
+	lowest := paths[0]
+	for _, p := range paths[1:] {
+		a, errA := netip.ParseAddr(p.Peer)
+		b, errB := netip.ParseAddr(lowest.Peer)
+		if errA == nil && errB == nil && a.Less(b) {
+			lowest = p
+		}
+	}
+	return []*LookupPath{lowest}, fmt.Sprintf("lowest peer address %s", lowest.Peer)
+}
@@ -0,0 +1,167 @@
+package bgp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectBestPath(t *testing.T) {
+	// path is an eBGP path with local-pref 100, origin IGP and MED 0
+	path := func(peer, routerID string, asPath ...uint32) *LookupPath {
+		return &LookupPath{
+			Peer:      peer,
+			PeerASN:   asPath[0],
+			RouterID:  routerID,
+			LocalPref: 100,
+			Route:     &Route{Origin: "igp", ASPath: asPath},
+		}
+	}
+	with := func(p *LookupPath, change func(p *LookupPath)) *LookupPath {
+		change(p)
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		paths      []*LookupPath
+		best       string
+		eliminated map[string]string
+		steps      []string
+		detail     string
+	}{
+		{
+			name:  "single path",
+			paths: []*LookupPath{path("192.0.2.1", "192.0.2.1", 64500)},
+			best:  "192.0.2.1",
+			steps: []string{},
+		},
+		{
+			name: "local-pref before AS path",
+			paths: []*LookupPath{
+				path("192.0.2.1", "192.0.2.1", 64500),
+				with(path("192.0.2.2", "192.0.2.2", 64510, 64511, 64512), func(p *LookupPath) { p.LocalPref = 200 }),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepLocalPref},
+			steps:      []string{StepLocalPref},
+			detail:     "highest local-pref 200",
+		},
+		{
+			name: "AS path before origin",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.Route.Origin = "incomplete" }),
+				path("192.0.2.2", "192.0.2.2", 64510, 64511),
+			},
+			best:       "192.0.2.1",
+			eliminated: map[string]string{"192.0.2.2": StepASPath},
+			steps:      []string{StepLocalPref, StepASPath},
+			detail:     "shortest AS path length 1",
+		},
+		{
+			name: "origin before MED",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.Route.Origin = "egp" }),
+				with(path("192.0.2.2", "192.0.2.2", 64500), func(p *LookupPath) { p.Route.MED = 50 }),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepOrigin},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin},
+			detail:     "lowest origin igp (igp < egp < incomplete)",
+		},
+		{
+			name: "MED from the same neighbor AS",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.Route.MED = 10 }),
+				with(path("192.0.2.2", "192.0.2.2", 64500), func(p *LookupPath) { p.Route.MED = 5 }),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepMED},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED},
+			detail:     "lowest MED 5 from AS64500",
+		},
+		{
+			name: "MED not compared across neighbor ASes",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.Route.MED = 10 }),
+				with(path("192.0.2.2", "192.0.2.2", 64510), func(p *LookupPath) { p.Route.MED = 5 }),
+				with(path("192.0.2.3", "192.0.2.3", 64500), func(p *LookupPath) { p.Route.MED = 20 }),
+			},
+			best:       "192.0.2.1",
+			eliminated: map[string]string{"192.0.2.2": StepRouterID, "192.0.2.3": StepMED},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED, StepEBGP, StepRouterID},
+			detail:     "lowest router ID 192.0.2.1",
+		},
+		{
+			name: "neighbor AS of an empty AS path is the peer AS",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.Route.ASPath = nil; p.Route.MED = 10 }),
+				with(path("192.0.2.2", "192.0.2.2", 64500), func(p *LookupPath) { p.Route.ASPath = nil; p.Route.MED = 5 }),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepMED},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED},
+			detail:     "lowest MED 5 from AS64500",
+		},
+		{
+			name: "eBGP over iBGP",
+			paths: []*LookupPath{
+				with(path("192.0.2.1", "192.0.2.1", 64500), func(p *LookupPath) { p.IBGP = true }),
+				path("192.0.2.2", "192.0.2.2", 64510),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepEBGP},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED, StepEBGP},
+			detail:     "eBGP paths preferred over iBGP",
+		},
+		{
+			name: "unknown router IDs lose",
+			paths: []*LookupPath{
+				path("192.0.2.1", "", 64500),
+				path("192.0.2.2", "192.0.2.200", 64510),
+			},
+			best:       "192.0.2.2",
+			eliminated: map[string]string{"192.0.2.1": StepRouterID},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED, StepEBGP, StepRouterID},
+			detail:     "lowest router ID 192.0.2.200",
+		},
+		{
+			name: "peer address compared numerically",
+			paths: []*LookupPath{
+				path("192.0.2.10", "192.0.2.1", 64500),
+				path("192.0.2.9", "192.0.2.1", 64510),
+			},
+			best:       "192.0.2.9",
+			eliminated: map[string]string{"192.0.2.10": StepPeerAddress},
+			steps:      []string{StepLocalPref, StepASPath, StepOrigin, StepMED, StepEBGP, StepRouterID, StepPeerAddress},
+			detail:     "lowest peer address 192.0.2.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := selectBestPath(tt.paths)
+
+			names := make([]string, 0, len(steps))
+			for _, s := range steps {
+				names = append(names, s.Step)
+			}
+			if !reflect.DeepEqual(names, tt.steps) {
+				t.Errorf("steps = %v, want %v", names, tt.steps)
+			}
+			if tt.detail != "" {
+				if last := steps[len(steps)-1]; last.Detail != tt.detail || last.Remaining != 1 {
+					t.Errorf("last step = %q with %d left, want %q with 1", last.Detail, last.Remaining, tt.detail)
+				}
+			}
+
+			for _, p := range tt.paths {
+				if p.Best != (p.Peer == tt.best) {
+					t.Errorf("path from %s best = %v, want %v", p.Peer, p.Best, !p.Best)
+				}
+				if p.EliminatedBy != tt.eliminated[p.Peer] {
+					t.Errorf("path from %s eliminated by %q, want %q", p.Peer, p.EliminatedBy, tt.eliminated[p.Peer])
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,15 @@ package bgp
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/netip"
 	"sync"
 	"time"
 
+	"github.com/namesarnav/netmeta/pkg/rpki"
 	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/log"
 	"github.com/osrg/gobgp/v3/pkg/server"
-	"google.golang.org/protobuf/types/known/anypb"
 )
 
 type PeerState struct {
@@ -19,63 +22,211 @@ type PeerState struct {
 	FlapCount    int64
 	LastFlapTime time.Time
 	Established  bool
+	Disabled     bool
+	Source       string
+	Router       string
+	RouterID     string
+	Families     map[string]FamilyCounts
+	RPKI         RPKICounts
+	ASPA         ASPACounts
+	Anomalies    map[string]int64
+	VRFs         map[string]VRFCounts
+	Limits       map[string]PrefixLimitStatus
+	Updates      UpdateStats
+	BMP          BMPStats
+	Config       PeerConfig
 	mu           sync.RWMutex
+
+	// Routes currently in the peer's Adj-RIB-In, and the Adj-RIB-Out
+	// reported by BMP routers
+	routes    *ribTable
+	routesOut *ribTable
+
+	// Neighbor address of BMP peers, whose address also names the router
+	neighbor string
+
+	// Negotiated families and the counters last read from GoBGP
+	families []string
+	counters map[string]FamilyCounts
+
+	// Prefix limit level last reported per family
+	limitLevels map[string]string
+
+	// FSM transitions, oldest first, and when the session last came up
+	history       []FSMTransition
+	establishedAt time.Time
+
+	// Withdrawn routes per VRF
+	vrfWithdrawals map[string]int64
+
+	convergence convergence
+
+	// Events raised while mu is held, published by unlockPeer
+	pending pendingEvents
 }
 
+// Peer sources
+const (
+	SourceBGP = "bgp"
+	SourceBMP = "bmp"
+)
+
+// StateUnknown is used when a peer's state can no longer be observed
+const StateUnknown = "Unknown"
+
 type Monitor struct {
 	server   *server.BgpServer
 	peers    map[string]*PeerState
 	mu       sync.RWMutex
 	ctx      context.Context
 	cancel   context.CancelFunc
+
+	bmpListener net.Listener
+
+	// Local speaker configuration, set once StartBGP succeeds
+	global *GlobalConfig
+
+	withdrawPolicyReady bool
+
+	// Route origin validation and AS path verification
+	rpki   *rpki.Table
+	aspa   *rpki.Table
+	rpkiMu sync.RWMutex
+
+	// Per-peer prefix reject and per-VRF withdraw policies installed so far
+	rejectPolicies map[string]bool
+	vrfPolicies    map[string]bool
+
+	// VRFs that VPN routes are imported into
+	vrfs  []*vrf
+	vrfMu sync.RWMutex
+
+	peerSubs        *subscribers[PeerEvent]
+	findingSubs     *subscribers[*Finding]
+	limitSubs       *subscribers[*PrefixLimitEvent]
+	convergenceSubs *subscribers[*ConvergenceEvent]
+	injectionSubs   *subscribers[*InjectionAudit]
+
+	// Hijack and route leak detection
+	detector *detector
+	detectMu sync.RWMutex
+
+	dampening *dampeningTracker
+
+	// Best paths per peer in the global table
+	best *bestPaths
+
+	// Routes and FlowSpec rules announced through the injection API, keyed
+	// by prefix and rule, and their audit trail
+	injectParams  InjectionParams
+	injectAllowed []netip.Prefix
+	injected      map[string]*Injection
+	flowSpecs     map[string]*FlowSpecInjection
+	injectAudit   []*InjectionAudit
+	injectMu      sync.Mutex
+
+	injectPolicyReady bool
+
+	// Periodic RIB snapshots
+	snapshotStore  SnapshotStore
+	snapshotParams SnapshotParams
+	snapshotMu     sync.RWMutex
+
+	// Operator supplied community names
+	communityNames *communityNames
+	namesMu        sync.RWMutex
+
+	// Why sessions went down, until the state change is processed
+	downCauses map[string]*downCause
+	causeMu    sync.Mutex
+
+	// Session timelines decoded from packet captures
+	pcapSessions []*BGPSession
+	pcapMu       sync.Mutex
 }
 
 func NewMonitor() (*Monitor, error) {
-	s := server.NewBgpServer()
-	go s.Serve()
-
 	ctx, cancel := context.WithCancel(context.Background())
 
 	m := &Monitor{
-		server: s,
-		peers:  make(map[string]*PeerState),
-		ctx:    ctx,
-		cancel: cancel,
+		peers:           make(map[string]*PeerState),
+		ctx:             ctx,
+		cancel:          cancel,
+		peerSubs:        newSubscribers(describePeerEvent),
+		findingSubs:     newSubscribers(describeFinding),
+		limitSubs:       newSubscribers(describePrefixLimit),
+		convergenceSubs: newSubscribers(describeConvergence),
+		injectionSubs:   newSubscribers(describeInjection),
+		injected:        make(map[string]*Injection),
+		flowSpecs:       make(map[string]*FlowSpecInjection),
+		rejectPolicies:  make(map[string]bool),
+		vrfPolicies:     make(map[string]bool),
+		dampening:       newDampeningTracker(DefaultDampening),
+		best:            newBestPaths(),
+		downCauses:      make(map[string]*downCause),
 	}
 
+	s := server.NewBgpServer(server.LoggerOption(&gobgpLogger{Logger: log.NewDefaultLogger(), m: m}))
+	go s.Serve()
+	m.server = s
+
 	// Start monitoring
-	go m.monitorPeers()
+	if err := m.watchEvents(); err != nil {
+		cancel()
+		s.Stop()
+		return nil, fmt.Errorf("failed to watch BGP events: %w", err)
+	}
+	if err := m.watchBestPaths(); err != nil {
+		cancel()
+		s.Stop()
+		return nil, fmt.Errorf("failed to watch best paths: %w", err)
+	}
+	go m.refreshCounters()
+	go m.watchConvergence()
+	go m.expireInjections()
 
 	return m, nil
 }
 
-func (m *Monitor) AddPeer(address string, asn uint32, port uint16) error {
+func (m *Monitor) AddPeer(cfg PeerConfig) error {
+	if len(cfg.Families) == 0 {
+		cfg.Families = DefaultFamilies
+	}
+
+	// Configure peer in GoBGP
+	peerConfig, err := cfg.apiPeer()
+	if err != nil {
+		return fmt.Errorf("failed to add peer %s: %w", cfg.Address, err)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.global == nil {
+		return fmt.Errorf("failed to add peer %s: %w", cfg.Address, ErrNotStarted)
+	}
+	if _, ok := m.peers[cfg.Address]; ok {
+		return fmt.Errorf("peer %s already exists", cfg.Address)
+	}
+
 	peer := &PeerState{
-		Address:     address,
-		ASN:         asn,
+		Address:     cfg.Address,
+		ASN:         cfg.ASN,
 		State:       "Idle",
 		Established: false,
+		Source:      SourceBGP,
+		Config:      cfg,
+		routes:      newRIBTable(),
+		routesOut:   newRIBTable(),
+		families:    cfg.Families,
 	}
-	m.peers[address] = peer
-
-	// Configure peer in GoBGP
-	peerConfig := &api.Peer{
-		Conf: &api.PeerConf{
-			NeighborAddress: address,
-			PeerAsn:         asn,
-		},
-		Transport: &api.Transport{
-			RemotePort: uint32(port),
-		},
-	}
+	m.peers[cfg.Address] = peer
 
 	if err := m.server.AddPeer(context.Background(), &api.AddPeerRequest{
 		Peer: peerConfig,
 	}); err != nil {
-		return fmt.Errorf("failed to add peer %s: %w", address, err)
+		delete(m.peers, cfg.Address)
+		return fmt.Errorf("failed to add peer %s: %w", cfg.Address, err)
 	}
 
 	return nil
@@ -90,19 +241,7 @@ func (m *Monitor) GetPeer(address string) (*PeerState, error) {
 		return nil, fmt.Errorf("peer %s not found", address)
 	}
 
-	peer.mu.RLock()
-	defer peer.mu.RUnlock()
-
-	// Create a copy to avoid race conditions
-	return &PeerState{
-		Address:      peer.Address,
-		ASN:          peer.ASN,
-		State:        peer.State,
-		PrefixCount:  peer.PrefixCount,
-		FlapCount:    peer.FlapCount,
-		LastFlapTime: peer.LastFlapTime,
-		Established:  peer.Established,
-	}, nil
+	return peer.snapshot(), nil
 }
 
 func (m *Monitor) GetAllPeers() []*PeerState {
@@ -111,147 +250,193 @@ func (m *Monitor) GetAllPeers() []*PeerState {
 
 	peers := make([]*PeerState, 0, len(m.peers))
 	for _, peer := range m.peers {
-		peer.mu.RLock()
-		peers = append(peers, &PeerState{
-			Address:      peer.Address,
-			ASN:          peer.ASN,
-			State:        peer.State,
-			PrefixCount:  peer.PrefixCount,
-			FlapCount:    peer.FlapCount,
-			LastFlapTime: peer.LastFlapTime,
-			Established:  peer.Established,
-		})
-		peer.mu.RUnlock()
+		peers = append(peers, peer.snapshot())
 	}
 	return peers
 }
 
-func (m *Monitor) monitorPeers() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// snapshot returns a copy of the peer state to avoid race conditions, with
+// the password redacted
+func (p *PeerState) snapshot() *PeerState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	for {
-		select {
-		case <-m.ctx.Done():
-			return
-		case <-ticker.C:
-			m.updatePeerStates()
-		}
+	return &PeerState{
+		Address:      p.Address,
+		ASN:          p.ASN,
+		State:        p.State,
+		PrefixCount:  p.PrefixCount,
+		FlapCount:    p.FlapCount,
+		LastFlapTime: p.LastFlapTime,
+		Established:  p.Established,
+		Disabled:     p.Disabled,
+		Source:       p.Source,
+		Router:       p.Router,
+		RouterID:     p.RouterID,
+		Families:     p.familyCounts(),
+		RPKI:         p.rpkiCounts(),
+		ASPA:         p.aspaCounts(),
+		Anomalies:    p.anomalyCounts(),
+		VRFs:         p.vrfCounts(),
+		Limits:       p.limitStatus(),
+		Updates:      p.Updates,
+		BMP:          p.BMP,
+		Config:       p.Config.redacted(),
 	}
 }
 
-func (m *Monitor) updatePeerStates() {
+// watchEvents subscribes to GoBGP peer and Adj-RIB-In events so that every
+// FSM transition and route change is seen as it happens
+func (m *Monitor) watchEvents() error {
+	req := &api.WatchEventRequest{
+		Peer: &api.WatchEventRequest_Peer{},
+		Table: &api.WatchEventRequest_Table{
+			Filters: []*api.WatchEventRequest_Table_Filter{
+				{
+					Type: api.WatchEventRequest_Table_Filter_ADJIN,
+					Init: true,
+				},
+			},
+		},
+	}
+
+	return m.server.WatchEvent(m.ctx, req, func(resp *api.WatchEventResponse) {
+		switch ev := resp.Event.(type) {
+		case *api.WatchEventResponse_Peer:
+			m.handlePeerEvent(ev.Peer)
+		case *api.WatchEventResponse_Table:
+			m.handleTableEvent(ev.Table)
+		}
+	})
+}
+
+func (m *Monitor) handlePeerEvent(ev *api.WatchEventResponse_PeerEvent) {
+	if ev.Type != api.WatchEventResponse_PeerEvent_STATE || ev.Peer.GetState() == nil {
+		return
+	}
+
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	peer, ok := m.peers[ev.Peer.State.NeighborAddress]
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	if ev.Peer.State.SessionState == api.PeerState_ESTABLISHED {
+		peer.mu.Lock()
+		peer.RouterID = ev.Peer.State.RouterId
+		peer.mu.Unlock()
+		m.setPeerState(peer, "Established", true, time.Now())
+	} else {
+		m.setPeerState(peer, ev.Peer.State.SessionState.String(), false, time.Now())
+	}
+}
 
-	for address, peer := range m.peers {
-		// Get peer state from GoBGP
-		req := &api.GetPeerRequest{
-			Address: address,
+func (m *Monitor) handleTableEvent(ev *api.WatchEventResponse_TableEvent) {
+	for _, path := range ev.Paths {
+		m.mu.RLock()
+		peer, ok := m.peers[path.NeighborIp]
+		m.mu.RUnlock()
+		if !ok {
+			continue
 		}
 
-		resp, err := m.server.GetPeer(context.Background(), req)
+		route, err := routeFromPath(path)
 		if err != nil {
 			continue
 		}
 
 		peer.mu.Lock()
-		wasEstablished := peer.Established
-
-		if resp.Peer.State.SessionState == api.PeerState_ESTABLISHED {
-			peer.State = "Established"
-			peer.Established = true
-			// Count prefixes
-			peer.PrefixCount = int64(resp.Peer.State.AdjTable.Advertised)
+		if path.IsWithdraw {
+			old := peer.routes.remove(route.Prefix)
+			m.dampening.withdraw(peer.Address, old, time.Now())
+			peer.countVRFWithdrawal(old)
+			m.countUpdate(peer, 0, 1, time.Now())
 		} else {
-			peer.State = resp.Peer.State.SessionState.String()
-			peer.Established = false
+			m.validate(route)
+			m.assignVRFs(route)
+			m.verifyPath(peer, route)
+			m.inspect(peer, route)
+			old := peer.routes.insert(route)
+			m.dampening.announce(peer.Address, old, route, route.Received)
+			m.countUpdate(peer, 1, 0, route.Received)
 		}
-
-		// Detect flaps
-		if wasEstablished && !peer.Established {
-			peer.FlapCount++
-			peer.LastFlapTime = time.Now()
-		}
-
-		peer.mu.Unlock()
+		peer.PrefixCount = int64(peer.routes.len())
+		m.checkPrefixLimits(peer)
+		m.unlockPeer(peer)
 	}
 }
 
-func (m *Monitor) WithdrawAllPrefixes(address string) error {
-	m.mu.RLock()
-	peer, ok := m.peers[address]
-	m.mu.RUnlock()
+// setPeerState records an FSM transition at the given time, counts a flap
+// when an established session goes down and notifies subscribers. The cause
+// of a drop is taken from what the source recorded with setDownCause.
+func (m *Monitor) setPeerState(peer *PeerState, state string, established bool, at time.Time) {
+	cause := m.takeDownCause(peer.Address)
 
-	if !ok {
-		return fmt.Errorf("peer %s not found", address)
+	peer.mu.Lock()
+	if peer.State == state {
+		peer.mu.Unlock()
+		return
 	}
 
-	// Get all paths from the peer
-	req := &api.ListPathRequest{
-		TableType: api.TableType_GLOBAL,
-		Family: &api.Family{
-			Afi:  api.Family_AFI_IP,
-			Safi: api.Family_SAFI_UNICAST,
-		},
+	event := PeerEvent{
+		Timestamp:   at,
+		Address:     peer.Address,
+		ASN:         peer.ASN,
+		OldState:    peer.State,
+		NewState:    state,
+		Established: established,
 	}
 
-	stream, err := m.server.ListPath(context.Background(), req)
-	if err != nil {
-		return fmt.Errorf("failed to list paths: %w", err)
+	transition := FSMTransition{
+		Timestamp: at,
+		OldState:  peer.State,
+		NewState:  state,
+	}
+	if !established && cause != nil {
+		transition.Reason = cause.reason
+		transition.Notification = cause.notification
+		event.Reason = cause.reason
+		event.Notification = cause.notification
+	}
+	if established && !peer.Established {
+		peer.establishedAt = at
+		peer.startConvergence()
 	}
 
-	for {
-		path, err := stream.Recv()
-		if err != nil {
-			break
+	if peer.Established && !established {
+		if !peer.establishedAt.IsZero() {
+			transition.Uptime = at.Sub(peer.establishedAt)
 		}
 
-		// Withdraw path
-		withdraw := &api.Path{
-			Family: path.Path.Family,
-			Nlri:   path.Path.Nlri,
-		}
+		// Routes are flushed when the session drops
+		peer.routes = newRIBTable()
+		peer.routesOut = newRIBTable()
+		peer.counters = nil
+		peer.PrefixCount = 0
+		peer.limitLevels = nil
 
-		if err := m.server.DeletePath(context.Background(), &api.DeletePathRequest{
-			Path: withdraw,
-		}); err != nil {
-			continue
+		// Administrative shutdowns are not flaps
+		flapped := state != StateUnknown && !peer.Disabled
+		if flapped {
+			peer.FlapCount++
+			peer.LastFlapTime = at
 		}
+		peer.stopConvergence(flapped)
 	}
-
-	peer.mu.Lock()
-	peer.FlapCount = 0
+	peer.State = state
+	peer.Established = established
+	peer.record(transition)
 	peer.mu.Unlock()
 
-	return nil
+	m.peerSubs.publish(event)
 }
 
 func (m *Monitor) Close() {
 	m.cancel()
-	m.server.Stop()
-}
-
-// GetPeerMetrics returns metrics for Prometheus
-func (m *Monitor) GetPeerMetrics() map[string]float64 {
-	metrics := make(map[string]float64)
-	peers := m.GetAllPeers()
-
-	for _, peer := range peers {
-		key := fmt.Sprintf("bgp_peer_up{peer=\"%s\"}", peer.Address)
-		if peer.Established {
-			metrics[key] = 1
-		} else {
-			metrics[key] = 0
-		}
-
-		key = fmt.Sprintf("bgp_prefix_count{peer=\"%s\",afi=\"ipv4\"}", peer.Address)
-		metrics[key] = float64(peer.PrefixCount)
-
-		key = fmt.Sprintf("bgp_session_flaps_total{peer=\"%s\"}", peer.Address)
-		metrics[key] = float64(peer.FlapCount)
+	if m.bmpListener != nil {
+		m.bmpListener.Close()
 	}
-
-	return metrics
+	m.server.Stop()
 }
 
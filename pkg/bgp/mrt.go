@@ -0,0 +1,393 @@
+package bgp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/mrt"
+)
+
+// SourceMRT marks peers loaded from MRT (RFC 6396) archives
+const SourceMRT = "mrt"
+
+// Maximum size of a single MRT record. RIB records of large collectors carry
+// one entry per peer and can be much bigger than a BGP message.
+const mrtMaxRecordSize = 16 << 20
+
+// ErrMRTTooLarge is returned when a decompressed MRT dump exceeds the import limit
+var ErrMRTTooLarge = errors.New("MRT dump is too large")
+
+// MRTImportStats summarizes an MRT import
+type MRTImportStats struct {
+	File         string
+	Records      int
+	RIBEntries   int
+	Updates      int
+	StateChanges int
+	Peers        int
+	Skipped      int
+	First        time.Time
+	Last         time.Time
+}
+
+// Magic numbers of compressed MRT archives. The bzip2 one includes the
+// block header, since a raw dump may start with "BZh" as its timestamp.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = regexp.MustCompile(`^BZh[1-9]\x31\x41\x59\x26\x53\x59`)
+)
+
+// ImportMRTFile loads an MRT file into the monitor
+func (m *Monitor) ImportMRTFile(path string) (*MRTImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MRT file: %w", err)
+	}
+	defer f.Close()
+
+	return m.ImportMRTArchive(f, path, 0)
+}
+
+// ImportMRTArchive loads an MRT dump, reported under name, into the monitor.
+// Dumps compressed with gzip or bzip2, as published by RouteViews and RIPE
+// RIS, are recognized by their magic number and decompressed on the fly.
+// A positive limit caps the size of the decompressed dump; reading past it
+// fails with ErrMRTTooLarge.
+func (m *Monitor) ImportMRTArchive(r io.Reader, name string, limit int64) (*MRTImportStats, error) {
+	buf := bufio.NewReader(r)
+	magic, _ := buf.Peek(10)
+
+	var dump io.Reader = buf
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open MRT file: %w", err)
+		}
+		defer gz.Close()
+		dump = gz
+	case bzip2Magic.Match(magic):
+		dump = bzip2.NewReader(buf)
+	}
+	if limit > 0 {
+		dump = &cappedReader{r: dump, n: limit, err: ErrMRTTooLarge}
+	}
+
+	stats, err := m.ImportMRT(dump)
+	if stats != nil {
+		stats.File = name
+	}
+	return stats, err
+}
+
+// ImportMRT loads TABLE_DUMP_V2 RIB dumps and BGP4MP update/state archives
+// into the monitor. Every peer found in the archive becomes a peer with
+// source "mrt", so route browsing and flap analysis work the same way as for
+// live peers. Archives should be imported in chronological order.
+func (m *Monitor) ImportMRT(r io.Reader) (*MRTImportStats, error) {
+	stats := &MRTImportStats{}
+	seen := make(map[string]bool)
+
+	// Peer index of the TABLE_DUMP_V2 dump being read
+	var index []*PeerState
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), mrtMaxRecordSize)
+	scanner.Split(mrt.SplitMrt)
+
+	for scanner.Scan() {
+		// Decoded attributes may point into the record, so it must outlive
+		// the scanner's buffer
+		data := append([]byte(nil), scanner.Bytes()...)
+		hdr := &mrt.MRTHeader{}
+		if err := hdr.DecodeFromBytes(data[:mrt.MRT_COMMON_HEADER_LEN]); err != nil {
+			return stats, fmt.Errorf("failed to decode MRT header: %w", err)
+		}
+		stats.Records++
+
+		msg, err := mrt.ParseMRTBody(hdr, data[mrt.MRT_COMMON_HEADER_LEN:])
+		if err != nil {
+			// Unsupported types and broken records are skipped
+			stats.Skipped++
+			continue
+		}
+
+		ts := hdr.GetTime()
+		if stats.First.IsZero() || ts.Before(stats.First) {
+			stats.First = ts
+		}
+		if ts.After(stats.Last) {
+			stats.Last = ts
+		}
+
+		switch body := msg.Body.(type) {
+		case *mrt.PeerIndexTable:
+			index = make([]*PeerState, len(body.Peers))
+			for i, p := range body.Peers {
+				peer := m.mrtPeer(p.IpAddress.String(), p.AS)
+				if peer == nil {
+					continue
+				}
+				// A new dump replaces whatever the peer had before
+				peer.mu.Lock()
+				peer.routes = newRIBTable()
+				peer.PrefixCount = 0
+				peer.RouterID = p.BgpId.String()
+				peer.mu.Unlock()
+				m.setPeerState(peer, "Established", true, ts)
+
+				index[i] = peer
+				seen[peer.Address] = true
+			}
+
+		case *mrt.Rib:
+			for _, entry := range body.Entries {
+				if int(entry.PeerIndex) >= len(index) || index[entry.PeerIndex] == nil {
+					stats.Skipped++
+					continue
+				}
+				peer := index[entry.PeerIndex]
+
+				route := newRoute(body.Prefix, entry.PathAttributes, time.Unix(int64(entry.OriginatedTime), 0))
+				m.validate(route)
+				m.assignVRFs(route)
+
+				peer.mu.Lock()
+				m.verifyPath(peer, route)
+				m.inspect(peer, route)
+				peer.routes.insert(route)
+				peer.PrefixCount = int64(peer.routes.len())
+				m.unlockPeer(peer)
+				stats.RIBEntries++
+			}
+
+		case *mrt.BGP4MPStateChange:
+			peer := m.mrtPeer(body.PeerIpAddress.String(), body.PeerAS)
+			if peer == nil {
+				stats.Skipped++
+				continue
+			}
+			seen[peer.Address] = true
+			stats.StateChanges++
+
+			if body.NewState == mrt.ESTABLISHED {
+				m.setPeerState(peer, "Established", true, ts)
+			} else {
+				m.setPeerState(peer, api.PeerState_SessionState(body.NewState).String(), false, ts)
+			}
+
+		case *mrt.BGP4MPMessage:
+			// A NOTIFICATION explains the state change that follows it
+			if _, ok := body.BGPMessage.Body.(*bgp.BGPNotification); ok {
+				direction := NotificationReceived
+				if isLocalMRTMessage(hdr) {
+					direction = NotificationSent
+				}
+				m.setDownCause(body.PeerIpAddress.String(), "notification-"+direction,
+					notificationFromMessage(direction, body.BGPMessage))
+				continue
+			}
+
+			update, ok := body.BGPMessage.Body.(*bgp.BGPUpdate)
+			if !ok {
+				continue
+			}
+			peer := m.mrtPeer(body.PeerIpAddress.String(), body.PeerAS)
+			if peer == nil {
+				stats.Skipped++
+				continue
+			}
+			seen[peer.Address] = true
+			stats.Updates++
+
+			// Updates are only exchanged on established sessions, and update
+			// archives do not always start with a state change
+			peer.mu.RLock()
+			established := peer.Established
+			peer.mu.RUnlock()
+			if !established {
+				m.setPeerState(peer, "Established", true, ts)
+			}
+
+			peer.mu.Lock()
+			m.applyUpdate(peer, isLocalMRTMessage(hdr), update, ts)
+			m.unlockPeer(peer)
+		}
+	}
+
+	stats.Peers = len(seen)
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read MRT data: %w", err)
+	}
+	return stats, nil
+}
+
+// isLocalMRTMessage reports whether a BGP4MP message was sent by the
+// collector rather than received from the peer
+func isLocalMRTMessage(hdr *mrt.MRTHeader) bool {
+	switch mrt.MRTSubTypeBGP4MP(hdr.SubType) {
+	case mrt.MESSAGE_LOCAL, mrt.MESSAGE_AS4_LOCAL, mrt.MESSAGE_LOCAL_ADDPATH, mrt.MESSAGE_AS4_LOCAL_ADDPATH:
+		return true
+	}
+	return false
+}
+
+// mrtPeer returns the MRT peer with the given address, creating it on first
+// sight. It returns nil if the address belongs to a live or BMP peer.
+func (m *Monitor) mrtPeer(address string, asn uint32) *PeerState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peer, ok := m.peers[address]
+	if !ok {
+		peer = &PeerState{
+			Address:   address,
+			ASN:       asn,
+			State:     "Idle",
+			Source:    SourceMRT,
+			routes:    newRIBTable(),
+			routesOut: newRIBTable(),
+		}
+		m.peers[address] = peer
+	}
+	if peer.Source != SourceMRT {
+		return nil
+	}
+	return peer
+}
+
+// ExportMRT writes the current Adj-RIB-In of every peer as a TABLE_DUMP_V2
+// RIB dump (a PEER_INDEX_TABLE followed by one RIB record per prefix). BMP
+// peers are exported under their neighbor address.
+func (m *Monitor) ExportMRT(w io.Writer) error {
+	now := time.Now()
+
+	type entry struct {
+		peer  uint16
+		route *Route
+	}
+	prefixes := make(map[string][]entry)
+	nlris := make(map[string]bgp.AddrPrefixInterface)
+
+	// Take a consistent copy of every RIB first
+	m.mu.RLock()
+	peers := make([]*PeerState, 0, len(m.peers))
+	for _, peer := range m.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Address < peers[j].Address })
+
+	mrtPeers := make([]*mrt.Peer, 0, len(peers))
+	for _, peer := range peers {
+		peer.mu.RLock()
+		if peer.routes == nil || peer.routes.len() == 0 {
+			peer.mu.RUnlock()
+			continue
+		}
+		idx := uint16(len(mrtPeers))
+		routerID := peer.RouterID
+		if routerID == "" {
+			routerID = "0.0.0.0"
+		}
+		address := peer.Address
+		if peer.neighbor != "" {
+			address = peer.neighbor
+		}
+		mrtPeers = append(mrtPeers, mrt.NewPeer(routerID, address, peer.ASN, true))
+		for _, route := range peer.routes.routes {
+			key := route.Family + " " + route.Prefix
+			prefixes[key] = append(prefixes[key], entry{peer: idx, route: route})
+			nlris[key] = route.nlri
+		}
+		peer.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+
+	if err := writeMRT(w, now, mrt.TABLE_DUMPv2, mrt.PEER_INDEX_TABLE,
+		mrt.NewPeerIndexTable("0.0.0.0", "netmeta", mrtPeers)); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(prefixes))
+	for key := range prefixes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for seq, key := range keys {
+		entries := make([]*mrt.RibEntry, 0, len(prefixes[key]))
+		for _, e := range prefixes[key] {
+			entries = append(entries, mrt.NewRibEntry(e.peer, uint32(e.route.Received.Unix()), 0, e.route.attrs, false))
+		}
+
+		nlri := nlris[key]
+		subtype := mrt.RIB_GENERIC
+		switch bgp.AfiSafiToRouteFamily(nlri.AFI(), nlri.SAFI()) {
+		case bgp.RF_IPv4_UC:
+			subtype = mrt.RIB_IPV4_UNICAST
+		case bgp.RF_IPv4_MC:
+			subtype = mrt.RIB_IPV4_MULTICAST
+		case bgp.RF_IPv6_UC:
+			subtype = mrt.RIB_IPV6_UNICAST
+		case bgp.RF_IPv6_MC:
+			subtype = mrt.RIB_IPV6_MULTICAST
+		}
+
+		if err := writeMRT(w, now, mrt.TABLE_DUMPv2, subtype, mrt.NewRib(uint32(seq), nlri, entries)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeMRT(w io.Writer, ts time.Time, typ mrt.MRTType, subtype mrt.MRTSubTyper, body mrt.Body) error {
+	msg, err := mrt.NewMRTMessage(uint32(ts.Unix()), typ, subtype, body)
+	if err != nil {
+		return fmt.Errorf("failed to build MRT record: %w", err)
+	}
+	data, err := msg.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to encode MRT record: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write MRT record: %w", err)
+	}
+	return nil
+}
+
+// cappedReader reads at most n bytes from r and fails with err instead of
+// stopping silently, so a truncated import is not taken for a complete one.
+type cappedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.n <= 0 {
+		// Only fail if there is more data to read
+		var b [1]byte
+		if n, err := io.ReadFull(c.r, b[:]); n == 0 {
+			return 0, err
+		}
+		return 0, c.err
+	}
+	if int64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,309 @@
+package bgp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+	"github.com/osrg/gobgp/v3/pkg/packet/mrt"
+)
+
+func newTestMonitor(t *testing.T) *Monitor {
+	t.Helper()
+	m, err := NewMonitor()
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+var mrtTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mrtRecord is an MRT record for mrtDump
+type mrtRecord struct {
+	typ     mrt.MRTType
+	subtype mrt.MRTSubTyper
+	body    mrt.Body
+}
+
+func mrtDump(t *testing.T, records ...mrtRecord) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, r := range records {
+		if err := writeMRT(&buf, mrtTime.Add(time.Duration(i)*time.Second), r.typ, r.subtype, r.body); err != nil {
+			t.Fatalf("writeMRT: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func peerIndex(peers ...*mrt.Peer) mrtRecord {
+	return mrtRecord{mrt.TABLE_DUMPv2, mrt.PEER_INDEX_TABLE, mrt.NewPeerIndexTable("192.0.2.254", "test", peers)}
+}
+
+func ribRecord(seq uint32, prefix string, peers ...uint16) mrtRecord {
+	entries := make([]*mrt.RibEntry, 0, len(peers))
+	for _, p := range peers {
+		entries = append(entries, mrt.NewRibEntry(p, uint32(mrtTime.Unix()), 0, testAttrs(64500, 64501), false))
+	}
+	return mrtRecord{mrt.TABLE_DUMPv2, mrt.RIB_IPV4_UNICAST, mrt.NewRib(seq, ipPrefix(prefix), entries)}
+}
+
+func updateRecord(peer string, asn uint32, withdrawn, announced []string) mrtRecord {
+	var nlri, gone []*bgp.IPAddrPrefix
+	for _, p := range announced {
+		nlri = append(nlri, ipPrefix(p))
+	}
+	for _, p := range withdrawn {
+		gone = append(gone, ipPrefix(p))
+	}
+	var attrs []bgp.PathAttributeInterface
+	if len(nlri) > 0 {
+		attrs = testAttrs(asn, 64501)
+	}
+	msg := bgp.NewBGPUpdateMessage(gone, attrs, nlri)
+	return mrtRecord{mrt.BGP4MP, mrt.MESSAGE_AS4, mrt.NewBGP4MPMessage(asn, 64496, 0, peer, "192.0.2.254", true, msg)}
+}
+
+func stateRecord(peer string, asn uint32, from, to mrt.BGPState) mrtRecord {
+	return mrtRecord{mrt.BGP4MP, mrt.STATE_CHANGE_AS4, mrt.NewBGP4MPStateChange(asn, 64496, 0, peer, "192.0.2.254", true, from, to)}
+}
+
+func testAttrs(path ...uint32) []bgp.PathAttributeInterface {
+	return []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+		bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, path)}),
+		bgp.NewPathAttributeNextHop("192.0.2.1"),
+	}
+}
+
+func ipPrefix(s string) *bgp.IPAddrPrefix {
+	p, err := bgp.NewPrefixFromRouteFamily(bgp.AFI_IP, bgp.SAFI_UNICAST, s)
+	if err != nil {
+		panic(err)
+	}
+	return p.(*bgp.IPAddrPrefix)
+}
+
+func TestImportMRT(t *testing.T) {
+	peers := []*mrt.Peer{
+		mrt.NewPeer("192.0.2.1", "192.0.2.1", 64500, true),
+		mrt.NewPeer("192.0.2.2", "192.0.2.2", 64510, true),
+	}
+
+	tests := []struct {
+		name     string
+		records  []mrtRecord
+		want     MRTImportStats
+		prefixes map[string]int64
+		states   map[string]string
+		flaps    map[string]int64
+	}{
+		{
+			name: "RIB dump",
+			records: []mrtRecord{
+				peerIndex(peers...),
+				ribRecord(0, "198.51.100.0/24", 0, 1),
+				ribRecord(1, "203.0.113.0/24", 0),
+			},
+			want:     MRTImportStats{Records: 3, RIBEntries: 3, Peers: 2},
+			prefixes: map[string]int64{"192.0.2.1": 2, "192.0.2.2": 1},
+			states:   map[string]string{"192.0.2.1": "Established", "192.0.2.2": "Established"},
+		},
+		{
+			name: "RIB entry with unknown peer index",
+			records: []mrtRecord{
+				peerIndex(peers[0]),
+				ribRecord(0, "198.51.100.0/24", 0, 5),
+			},
+			want:     MRTImportStats{Records: 2, RIBEntries: 1, Peers: 1, Skipped: 1},
+			prefixes: map[string]int64{"192.0.2.1": 1},
+		},
+		{
+			name: "updates without state change",
+			records: []mrtRecord{
+				updateRecord("192.0.2.1", 64500, nil, []string{"198.51.100.0/24", "203.0.113.0/24"}),
+				updateRecord("192.0.2.1", 64500, []string{"203.0.113.0/24"}, nil),
+			},
+			want:     MRTImportStats{Records: 2, Updates: 2, Peers: 1},
+			prefixes: map[string]int64{"192.0.2.1": 1},
+			states:   map[string]string{"192.0.2.1": "Established"},
+		},
+		{
+			name: "session drop flushes routes",
+			records: []mrtRecord{
+				stateRecord("192.0.2.1", 64500, mrt.OPENCONFIRM, mrt.ESTABLISHED),
+				updateRecord("192.0.2.1", 64500, nil, []string{"198.51.100.0/24"}),
+				stateRecord("192.0.2.1", 64500, mrt.ESTABLISHED, mrt.IDLE),
+			},
+			want:     MRTImportStats{Records: 3, Updates: 1, StateChanges: 2, Peers: 1},
+			prefixes: map[string]int64{"192.0.2.1": 0},
+			states:   map[string]string{"192.0.2.1": "IDLE"},
+			flaps:    map[string]int64{"192.0.2.1": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMonitor(t)
+			dump := mrtDump(t, tt.records...)
+
+			stats, err := m.ImportMRT(bytes.NewReader(dump))
+			if err != nil {
+				t.Fatalf("ImportMRT: %v", err)
+			}
+			tt.want.First = mrtTime
+			tt.want.Last = mrtTime.Add(time.Duration(len(tt.records)-1) * time.Second)
+			if !stats.First.Equal(tt.want.First) || !stats.Last.Equal(tt.want.Last) {
+				t.Errorf("time range = %s - %s, want %s - %s", stats.First, stats.Last, tt.want.First, tt.want.Last)
+			}
+			stats.First, stats.Last = tt.want.First, tt.want.Last
+			if *stats != tt.want {
+				t.Errorf("stats = %+v, want %+v", *stats, tt.want)
+			}
+
+			for address, want := range tt.prefixes {
+				peer, err := m.GetPeer(address)
+				if err != nil {
+					t.Fatalf("GetPeer(%s): %v", address, err)
+				}
+				if peer.Source != SourceMRT {
+					t.Errorf("peer %s source = %s, want %s", address, peer.Source, SourceMRT)
+				}
+				if peer.PrefixCount != want {
+					t.Errorf("peer %s prefixes = %d, want %d", address, peer.PrefixCount, want)
+				}
+				if state, ok := tt.states[address]; ok && peer.State != state {
+					t.Errorf("peer %s state = %s, want %s", address, peer.State, state)
+				}
+				if peer.FlapCount != tt.flaps[address] {
+					t.Errorf("peer %s flaps = %d, want %d", address, peer.FlapCount, tt.flaps[address])
+				}
+			}
+		})
+	}
+}
+
+func TestImportMRTArchive(t *testing.T) {
+	dump := mrtDump(t,
+		peerIndex(mrt.NewPeer("192.0.2.1", "192.0.2.1", 64500, true)),
+		ribRecord(0, "198.51.100.0/24", 0),
+	)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(dump)
+	w.Close()
+
+	bz2, err := os.ReadFile("testdata/rib.mrt.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A raw dump whose timestamp reads "BZh" (April 2005)
+	bzhTime := []byte("BZh1")
+	bzh := append([]byte(nil), dump...)
+	copy(bzh, bzhTime)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		limit int64
+		err   error
+	}{
+		{name: "raw", data: dump},
+		{name: "gzip", data: gz.Bytes()},
+		{name: "bzip2", data: bz2},
+		{name: "raw with BZh timestamp", data: bzh},
+		{name: "gzip at limit", data: gz.Bytes(), limit: int64(len(dump))},
+		{name: "gzip over limit", data: gz.Bytes(), limit: int64(len(dump)) - 1, err: ErrMRTTooLarge},
+		{name: "raw over limit", data: dump, limit: 10, err: ErrMRTTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMonitor(t)
+			stats, err := m.ImportMRTArchive(bytes.NewReader(tt.data), "upload", tt.limit)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ImportMRTArchive: err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportMRTArchive: %v", err)
+			}
+			if stats.File != "upload" || stats.RIBEntries != 1 {
+				t.Errorf("stats = %+v, want file upload with 1 RIB entry", *stats)
+			}
+		})
+	}
+}
+
+func TestExportMRT(t *testing.T) {
+	m := newTestMonitor(t)
+	dump := mrtDump(t,
+		peerIndex(
+			mrt.NewPeer("192.0.2.1", "192.0.2.1", 64500, true),
+			mrt.NewPeer("192.0.2.2", "192.0.2.2", 64510, true),
+		),
+		ribRecord(0, "198.51.100.0/24", 0, 1),
+		ribRecord(1, "203.0.113.0/24", 1),
+	)
+	if _, err := m.ImportMRT(bytes.NewReader(dump)); err != nil {
+		t.Fatalf("ImportMRT: %v", err)
+	}
+
+	// A BMP peer in a VRF, named 192.0.2.3[64520:1]@198.51.100.1
+	hdr := *bmp.NewBMPPeerHeader(bmp.BMP_PEER_TYPE_L3VPN, 0, 64520<<32|1, "192.0.2.3", 64520, "192.0.2.3", 1704067200)
+	for _, msg := range []*bmp.BMPMessage{
+		bmp.NewBMPPeerUpNotification(hdr, "192.0.2.254", 179, 40000, bmpOpen(64496, "192.0.2.254"), bmpOpen(64520, "192.0.2.3")),
+		bmp.NewBMPRouteMonitoring(hdr, bgp.NewBGPUpdateMessage(nil, testAttrs(64520), []*bgp.IPAddrPrefix{ipPrefix("198.51.100.0/24")})),
+	} {
+		m.processBMPMessage(bmpRouter, bmpWire(t, msg))
+	}
+
+	var exported bytes.Buffer
+	if err := m.ExportMRT(&exported); err != nil {
+		t.Fatalf("ExportMRT: %v", err)
+	}
+
+	// Re-importing the export gives the same RIBs
+	other := newTestMonitor(t)
+	stats, err := other.ImportMRT(&exported)
+	if err != nil {
+		t.Fatalf("ImportMRT of export: %v", err)
+	}
+	if stats.Records != 3 || stats.RIBEntries != 4 || stats.Peers != 3 {
+		t.Errorf("export stats = %+v, want 3 records, 4 RIB entries, 3 peers", *stats)
+	}
+	for address, exportedAs := range map[string]string{
+		"192.0.2.1":                       "192.0.2.1",
+		"192.0.2.2":                       "192.0.2.2",
+		"192.0.2.3[64520:1]@" + bmpRouter: "192.0.2.3",
+	} {
+		want, _ := m.ListAdjRIBIn(address, "", MatchExact)
+		got, err := other.ListAdjRIBIn(exportedAs, "", MatchExact)
+		if err != nil {
+			t.Fatalf("ListAdjRIBIn(%s): %v", exportedAs, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("peer %s has %d routes after round trip, want %d", address, len(got), len(want))
+		}
+		paths := make(map[string]string)
+		for _, r := range got {
+			paths[r.Prefix] = formatPath(r.ASPath)
+		}
+		for _, r := range want {
+			if paths[r.Prefix] != formatPath(r.ASPath) {
+				t.Errorf("peer %s route %s has path %q after round trip, want %q", address, r.Prefix, paths[r.Prefix], formatPath(r.ASPath))
+			}
+		}
+	}
+}
@@ -0,0 +1,729 @@
+package bgp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/google/gopacket/reassembly"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// SourcePCAP marks peers rebuilt from packet captures
+const SourcePCAP = "pcap"
+
+// Block type of the section header that starts every pcapng file, the same
+// in either byte order
+const pcapngMagic = 0x0a0d0d0a
+
+// Sessions seen in captures that are kept, oldest dropped first
+const maxPCAPSessions = 1000
+
+// Live captures release connections idle for longer than the largest hold
+// time
+const pcapIdleTimeout = 65535 * time.Second
+
+// Session timeline event types besides the BGP message types
+const (
+	SessionEventEstablished = "ESTABLISHED"
+	SessionEventFIN         = "TCP-FIN"
+	SessionEventRST         = "TCP-RST"
+	SessionEventGap         = "GAP"
+	SessionEventError       = "ERROR"
+)
+
+var bgpMarker = bytes.Repeat([]byte{0xff}, 16)
+
+var bgpMessageTypes = map[uint8]string{
+	bgp.BGP_MSG_OPEN:          "OPEN",
+	bgp.BGP_MSG_UPDATE:        "UPDATE",
+	bgp.BGP_MSG_NOTIFICATION:  "NOTIFICATION",
+	bgp.BGP_MSG_KEEPALIVE:     "KEEPALIVE",
+	bgp.BGP_MSG_ROUTE_REFRESH: "ROUTE-REFRESH",
+}
+
+// PCAPOptions controls how captured sessions map to peers
+type PCAPOptions struct {
+	// Addresses of the router the capture was taken on. The other end of
+	// its sessions becomes a peer, with the UPDATEs the router sent it as
+	// its Adj-RIB-Out. Without any, both ends of every session are peers.
+	Local []string
+}
+
+// PCAPImportStats summarizes a packet capture import
+type PCAPImportStats struct {
+	File     string
+	Packets  int
+	Messages map[string]int
+	Sessions int
+	Peers    int
+	Skipped  int
+	First    time.Time
+	Last     time.Time
+}
+
+// BGPSession is the timeline of one BGP session (TCP connection) seen in
+// a packet capture. Speakers holds the end that sent the first packet seen,
+// then the other end. UPDATEs and KEEPALIVEs are only counted, except for
+// End-of-RIB markers and the KEEPALIVEs that bring the session up.
+type BGPSession struct {
+	Speakers    [2]*SessionSpeaker
+	Started     time.Time
+	Established time.Time
+	Ended       time.Time
+	Events      []SessionEvent
+}
+
+// SessionSpeaker is one end of a captured session, as announced in its
+// OPEN
+type SessionSpeaker struct {
+	Address      string
+	Port         uint16
+	ASN          uint32
+	RouterID     string
+	HoldTime     uint16
+	Capabilities []string
+	Messages     map[string]int
+	Announced    int
+	Withdrawn    int
+	LastMessage  time.Time
+}
+
+// SessionEvent is a message or TCP event of a captured session
+type SessionEvent struct {
+	Timestamp    time.Time
+	From         string
+	Type         string
+	Detail       string
+	Notification *Notification
+}
+
+// ImportPCAPFile rebuilds the BGP sessions of a packet capture. Every
+// speaker found becomes a peer with source "pcap", so route browsing, flap
+// and convergence analysis work as for live peers, and each session's
+// timeline is kept for PCAPSessions.
+func (m *Monitor) ImportPCAPFile(path string, opts PCAPOptions) (*PCAPImportStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pcap file: %w", err)
+	}
+	defer file.Close()
+
+	return m.ImportPCAP(file, path, opts)
+}
+
+// ImportPCAP is ImportPCAPFile for a capture read from in and reported under
+// name
+func (m *Monitor) ImportPCAP(in io.Reader, name string, opts PCAPOptions) (*PCAPImportStats, error) {
+	r, err := m.newPCAPReader(opts)
+	if err != nil {
+		return nil, err
+	}
+	file := &pcapFile{r: in}
+	source, err := openPCAP(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pcap file: %w", err)
+	}
+
+	r.stats.File = name
+	r.read(source, false)
+	r.assembler.FlushAll()
+
+	r.stats.Peers = len(r.seen)
+	if file.err != nil {
+		return r.stats, fmt.Errorf("failed to read pcap file: %w", file.err)
+	}
+	return r.stats, nil
+}
+
+// pcapFile keeps the first error reading a capture and ends the capture
+// there. Packet sources stop only on EOF-like errors and retry any other one
+// forever, such as an upload going over its size limit.
+type pcapFile struct {
+	r   io.Reader
+	err error
+}
+
+func (f *pcapFile) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF {
+		f.err = err
+		if n == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	}
+	return n, err
+}
+
+// openPCAP reads a pcap or pcapng file, told apart by the magic number of
+// its first block
+func openPCAP(file *bufio.Reader) (*gopacket.PacketSource, error) {
+	magic, err := file.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(magic) == pcapngMagic {
+		ng, err := pcapgo.NewNgReader(file, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, err
+		}
+		return gopacket.NewPacketSource(ng, ng.LinkType()), nil
+	}
+	reader, err := pcapgo.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return gopacket.NewPacketSource(reader, reader.LinkType()), nil
+}
+
+// PCAPSessions returns the sessions seen in captures, oldest first,
+// optionally only those with one end at an address
+func (m *Monitor) PCAPSessions(address string) []*BGPSession {
+	m.pcapMu.Lock()
+	defer m.pcapMu.Unlock()
+
+	sessions := make([]*BGPSession, 0)
+	for _, s := range m.pcapSessions {
+		if address != "" && s.Speakers[0].Address != address && s.Speakers[1].Address != address {
+			continue
+		}
+		sessions = append(sessions, s.copy())
+	}
+	return sessions
+}
+
+// copy returns a deep copy of a session. Callers must hold m.pcapMu.
+func (s *BGPSession) copy() *BGPSession {
+	c := *s
+	for i, speaker := range s.Speakers {
+		sc := *speaker
+		sc.Capabilities = append([]string(nil), speaker.Capabilities...)
+		sc.Messages = make(map[string]int, len(speaker.Messages))
+		for typ, n := range speaker.Messages {
+			sc.Messages[typ] = n
+		}
+		c.Speakers[i] = &sc
+	}
+	c.Events = append([]SessionEvent(nil), s.Events...)
+	return &c
+}
+
+// pcapPeer returns the capture peer with the given address, creating it on
+// first sight. It returns nil if the address belongs to another source.
+func (m *Monitor) pcapPeer(address string) *PeerState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peer, ok := m.peers[address]
+	if !ok {
+		peer = &PeerState{
+			Address:   address,
+			State:     "Idle",
+			Source:    SourcePCAP,
+			routes:    newRIBTable(),
+			routesOut: newRIBTable(),
+		}
+		m.peers[address] = peer
+	}
+	if peer.Source != SourcePCAP {
+		return nil
+	}
+	return peer
+}
+
+// pcapReader feeds the packets of one capture through TCP reassembly
+type pcapReader struct {
+	m         *Monitor
+	local     map[string]bool
+	stats     *PCAPImportStats
+	seen      map[string]bool
+	assembler *reassembly.Assembler
+}
+
+func (m *Monitor) newPCAPReader(opts PCAPOptions) (*pcapReader, error) {
+	r := &pcapReader{
+		m:     m,
+		local: make(map[string]bool),
+		stats: &PCAPImportStats{Messages: make(map[string]int)},
+		seen:  make(map[string]bool),
+	}
+	for _, address := range opts.Local {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid local address %q", address)
+		}
+		r.local[ip.String()] = true
+	}
+	r.assembler = reassembly.NewAssembler(reassembly.NewStreamPool(r))
+	return r, nil
+}
+
+// captureContext passes the capture time of a packet through reassembly
+type captureContext gopacket.CaptureInfo
+
+func (c *captureContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return gopacket.CaptureInfo(*c)
+}
+
+func (r *pcapReader) read(source *gopacket.PacketSource, live bool) {
+	var lastFlush time.Time
+	for packet := range source.Packets() {
+		r.stats.Packets++
+		ci := packet.Metadata().CaptureInfo
+		if r.stats.First.IsZero() || ci.Timestamp.Before(r.stats.First) {
+			r.stats.First = ci.Timestamp
+		}
+		if ci.Timestamp.After(r.stats.Last) {
+			r.stats.Last = ci.Timestamp
+		}
+
+		network := packet.NetworkLayer()
+		tcp, ok := packet.TransportLayer().(*layers.TCP)
+		if network == nil || !ok || (tcp.SrcPort != bgp.BGP_PORT && tcp.DstPort != bgp.BGP_PORT) {
+			continue
+		}
+		ctx := captureContext(ci)
+		r.assembler.AssembleWithContext(network.NetworkFlow(), tcp, &ctx)
+
+		if live && ci.Timestamp.Sub(lastFlush) > time.Minute {
+			r.assembler.FlushCloseOlderThan(ci.Timestamp.Add(-pcapIdleTimeout))
+			lastFlush = ci.Timestamp
+		}
+	}
+}
+
+// New starts a stream for a TCP connection, implementing
+// reassembly.StreamFactory
+func (r *pcapReader) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
+	ts := ac.GetCaptureInfo().Timestamp
+	s := &bgpStream{
+		r: r,
+		session: &BGPSession{
+			Speakers: [2]*SessionSpeaker{
+				newSessionSpeaker(netFlow.Src(), tcpFlow.Src()),
+				newSessionSpeaker(netFlow.Dst(), tcpFlow.Dst()),
+			},
+			Started: ts,
+		},
+	}
+	for i, speaker := range s.session.Speakers {
+		s.remote[i] = !r.local[speaker.Address]
+	}
+
+	r.stats.Sessions++
+	r.m.pcapMu.Lock()
+	if len(r.m.pcapSessions) >= maxPCAPSessions {
+		r.m.pcapSessions = r.m.pcapSessions[1:]
+	}
+	r.m.pcapSessions = append(r.m.pcapSessions, s.session)
+	r.m.pcapMu.Unlock()
+	return s
+}
+
+func newSessionSpeaker(address, port gopacket.Endpoint) *SessionSpeaker {
+	p, _ := strconv.ParseUint(port.String(), 10, 16)
+	return &SessionSpeaker{
+		Address:  address.String(),
+		Port:     uint16(p),
+		Messages: make(map[string]int),
+	}
+}
+
+// bgpStream splits both directions of a TCP connection into BGP messages.
+// Index 0 is the direction from the end that sent the first packet seen.
+type bgpStream struct {
+	r       *pcapReader
+	session *BGPSession
+
+	// Bytes not yet part of a complete message, and whether the stream
+	// must be resynchronized on the next marker
+	buf    [2][]byte
+	resync [2]bool
+
+	// Ends that are peers, the OPENs they sent and the options to decode
+	// their UPDATEs with
+	remote    [2]bool
+	opens     [2]*bgp.BGPMessage
+	keepalive [2]bool
+	options   [2]*bgp.MarshallingOption
+
+	// Once a NOTIFICATION, FIN or RST ended the session, messages still
+	// delivered for it are only counted
+	established bool
+	ended       bool
+	closed      bool
+}
+
+func direction(dir reassembly.TCPFlowDirection) int {
+	if dir == reassembly.TCPDirClientToServer {
+		return 0
+	}
+	return 1
+}
+
+// Accept takes every segment, including those of sessions that were
+// already up when the capture started
+func (s *bgpStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	*start = true
+	// A reset carries no data that would reach ReassembledSG
+	if tcp.RST {
+		s.close(direction(dir), SessionEventRST, ci.Timestamp)
+	}
+	return true
+}
+
+func (s *bgpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	dir, _, end, skip := sg.Info()
+	i := direction(dir)
+	length, _ := sg.Lengths()
+	data := sg.Fetch(length)
+
+	if skip != 0 {
+		if skip > 0 {
+			s.event(i, SessionEventGap, fmt.Sprintf("%d bytes missing from the capture", skip), nil, sg.CaptureInfo(0).Timestamp)
+		}
+		s.buf[i] = nil
+		s.resync[i] = true
+	}
+
+	// Offsets into the buffer map to the segment each message ended in
+	buffered := len(s.buf[i])
+	buf := append(s.buf[i], data...)
+	pos := 0
+	for {
+		if s.resync[i] || !bytes.HasPrefix(buf[pos:], bgpMarker[:min(len(bgpMarker), len(buf)-pos)]) {
+			idx := bytes.Index(buf[pos:], bgpMarker)
+			if idx < 0 {
+				// Keep what could be the start of a marker
+				pos = max(pos, len(buf)-len(bgpMarker)+1)
+				s.resync[i] = true
+				break
+			}
+			pos += idx
+			s.resync[i] = false
+		}
+		if len(buf)-pos < bgp.BGP_HEADER_LENGTH {
+			break
+		}
+
+		n := int(binary.BigEndian.Uint16(buf[pos+16:]))
+		if _, ok := bgpMessageTypes[buf[pos+18]]; !ok || n < bgp.BGP_HEADER_LENGTH {
+			// Not a message header after all
+			pos++
+			s.resync[i] = true
+			continue
+		}
+		if len(buf)-pos < n {
+			break
+		}
+
+		ts := sg.CaptureInfo(max(pos+n-1-buffered, 0)).Timestamp
+		s.message(i, append([]byte(nil), buf[pos:pos+n]...), ts)
+		pos += n
+	}
+	s.buf[i] = append([]byte(nil), buf[pos:]...)
+
+	if end {
+		// A bare FIN has no data to take the capture time from
+		ts := sg.CaptureInfo(max(length-1, 0)).Timestamp
+		if ac != nil && length == 0 {
+			ts = ac.GetCaptureInfo().Timestamp
+		}
+		s.close(i, SessionEventFIN, ts)
+	}
+}
+
+// ReassemblyComplete is called once both directions are closed or the
+// capture ends, which is not a session drop by itself
+func (s *bgpStream) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	return true
+}
+
+// message handles a BGP message sent by end i
+func (s *bgpStream) message(i int, data []byte, ts time.Time) {
+	from := s.session.Speakers[i]
+	msg, err := bgp.ParseBGPMessage(data, s.options[i])
+	if err != nil {
+		s.r.stats.Skipped++
+		s.event(i, SessionEventError, fmt.Sprintf("undecodable %s: %v", bgpMessageTypes[data[18]], err), nil, ts)
+		return
+	}
+
+	typ := bgpMessageTypes[msg.Header.Type]
+	s.r.stats.Messages[typ]++
+	s.r.m.pcapMu.Lock()
+	from.Messages[typ]++
+	from.LastMessage = ts
+	s.r.m.pcapMu.Unlock()
+	if s.ended {
+		return
+	}
+
+	switch body := msg.Body.(type) {
+	case *bgp.BGPOpen:
+		s.open(i, msg, body, ts)
+
+	case *bgp.BGPKeepAlive:
+		if s.established {
+			return
+		}
+		s.event(i, typ, "", nil, ts)
+		s.keepalive[i] = true
+		if s.opens[0] != nil && s.opens[1] != nil && s.keepalive[0] && s.keepalive[1] {
+			s.establish(ts)
+		}
+
+	case *bgp.BGPUpdate:
+		// Captures often start on sessions that are already up
+		if !s.established {
+			s.establish(ts)
+		}
+		s.update(i, body, ts)
+
+	case *bgp.BGPNotification:
+		// Each peer sees it from its own side
+		notification := notificationFromMessage(NotificationSent, msg)
+		s.event(i, typ, notification.String(), notification, ts)
+		for j, peer := range s.peers() {
+			if peer == nil {
+				continue
+			}
+			direction := NotificationSent
+			if j == i {
+				direction = NotificationReceived
+			}
+			s.r.m.setDownCause(peer.Address, "notification-"+direction, notificationFromMessage(direction, msg))
+		}
+		s.down(ts)
+
+	case *bgp.BGPRouteRefresh:
+		family := bgp.AfiSafiToRouteFamily(body.AFI, body.SAFI).String()
+		switch body.Demarcation {
+		case 1:
+			family += " begin"
+		case 2:
+			family += " end"
+		}
+		s.event(i, typ, family, nil, ts)
+	}
+}
+
+// open records an OPEN from end i
+func (s *bgpStream) open(i int, msg *bgp.BGPMessage, body *bgp.BGPOpen, ts time.Time) {
+	speaker := s.session.Speakers[i]
+	asn := uint32(body.MyAS)
+	var caps []string
+	for _, c := range openCapabilities(msg) {
+		if as4, ok := c.(*bgp.CapFourOctetASNumber); ok {
+			asn = as4.CapValue
+		}
+		caps = append(caps, c.Code().String())
+	}
+
+	s.r.m.pcapMu.Lock()
+	speaker.ASN = asn
+	speaker.RouterID = body.ID.String()
+	speaker.HoldTime = body.HoldTime
+	speaker.Capabilities = caps
+	s.r.m.pcapMu.Unlock()
+	s.event(i, "OPEN", fmt.Sprintf("AS%d router ID %s hold time %ds", asn, body.ID, body.HoldTime), nil, ts)
+
+	// A new OPEN starts the session over
+	s.opens[i] = msg
+	s.keepalive = [2]bool{}
+	if s.established {
+		s.established = false
+		for _, peer := range s.peers() {
+			if peer != nil {
+				s.r.m.setDownCause(peer.Address, "new-open", nil)
+			}
+		}
+	}
+
+	if peer := s.peer(i); peer != nil {
+		peer.mu.Lock()
+		peer.ASN = asn
+		peer.RouterID = speaker.RouterID
+		peer.mu.Unlock()
+	}
+	for _, peer := range s.peers() {
+		if peer != nil {
+			s.r.m.setPeerState(peer, "OpenConfirm", false, ts)
+		}
+	}
+
+	if s.opens[0] != nil && s.opens[1] != nil {
+		s.options[0] = addPathOption(s.opens[0], s.opens[1])
+		s.options[1] = addPathOption(s.opens[1], s.opens[0])
+	}
+}
+
+// addPathOption returns the options to decode the UPDATEs a speaker sends
+// with, given both OPENs of the session
+func addPathOption(sender, receiver *bgp.BGPMessage) *bgp.MarshallingOption {
+	receives := make(map[bgp.RouteFamily]bool)
+	for _, c := range openCapabilities(receiver) {
+		if a, ok := c.(*bgp.CapAddPath); ok {
+			for _, t := range a.Tuples {
+				if t.Mode&bgp.BGP_ADD_PATH_RECEIVE != 0 {
+					receives[t.RouteFamily] = true
+				}
+			}
+		}
+	}
+
+	modes := make(map[bgp.RouteFamily]bgp.BGPAddPathMode)
+	for _, c := range openCapabilities(sender) {
+		if a, ok := c.(*bgp.CapAddPath); ok {
+			for _, t := range a.Tuples {
+				if t.Mode&bgp.BGP_ADD_PATH_SEND != 0 && receives[t.RouteFamily] {
+					modes[t.RouteFamily] = bgp.BGP_ADD_PATH_RECEIVE
+				}
+			}
+		}
+	}
+	if len(modes) == 0 {
+		return nil
+	}
+	return &bgp.MarshallingOption{AddPath: modes}
+}
+
+// establish brings the session's peers up
+func (s *bgpStream) establish(ts time.Time) {
+	s.established = true
+	s.r.m.pcapMu.Lock()
+	s.session.Established = ts
+	s.r.m.pcapMu.Unlock()
+	s.event(-1, SessionEventEstablished, "", nil, ts)
+
+	for _, peer := range s.peers() {
+		if peer == nil {
+			continue
+		}
+		s.r.m.setPeerState(peer, "Established", true, ts)
+		if s.opens[0] != nil && s.opens[1] != nil {
+			peer.mu.Lock()
+			peer.expectEndOfRIB(openFamilies(s.opens[0], s.opens[1]))
+			peer.mu.Unlock()
+		}
+	}
+}
+
+// update applies an UPDATE from end i to its Adj-RIB-In if it is a peer,
+// and to the other end's Adj-RIB-Out if that one is
+func (s *bgpStream) update(i int, update *bgp.BGPUpdate, ts time.Time) {
+	announced, withdrawn := len(update.NLRI), len(update.WithdrawnRoutes)
+	for _, attr := range update.PathAttributes {
+		switch a := attr.(type) {
+		case *bgp.PathAttributeMpReachNLRI:
+			announced += len(a.Value)
+		case *bgp.PathAttributeMpUnreachNLRI:
+			withdrawn += len(a.Value)
+		}
+	}
+	s.r.m.pcapMu.Lock()
+	s.session.Speakers[i].Announced += announced
+	s.session.Speakers[i].Withdrawn += withdrawn
+	s.r.m.pcapMu.Unlock()
+	if eor, family := update.IsEndOfRib(); eor {
+		s.event(i, "UPDATE", "End-of-RIB "+family.String(), nil, ts)
+	}
+
+	for j, peer := range s.peers() {
+		if peer == nil {
+			continue
+		}
+		peer.mu.Lock()
+		s.r.m.applyUpdate(peer, j != i, update, ts)
+		s.r.m.unlockPeer(peer)
+	}
+}
+
+// close handles a FIN or RST from end i
+func (s *bgpStream) close(i int, typ string, ts time.Time) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.event(i, typ, "", nil, ts)
+
+	if s.established {
+		reason := "connection-closed"
+		if typ == SessionEventRST {
+			reason = "connection-reset"
+		}
+		for _, peer := range s.peers() {
+			if peer != nil {
+				s.r.m.setDownCause(peer.Address, reason, nil)
+			}
+		}
+	}
+	s.down(ts)
+}
+
+// down takes the session's peers down
+func (s *bgpStream) down(ts time.Time) {
+	if s.ended {
+		return
+	}
+	s.established = false
+	s.ended = true
+	s.r.m.pcapMu.Lock()
+	s.session.Ended = ts
+	s.r.m.pcapMu.Unlock()
+
+	for _, peer := range s.peers() {
+		if peer != nil {
+			s.r.m.setPeerState(peer, "Idle", false, ts)
+		}
+	}
+}
+
+// peer returns the peer at end i, or nil if that end is the local router or
+// belongs to another source
+func (s *bgpStream) peer(i int) *PeerState {
+	if !s.remote[i] {
+		return nil
+	}
+	address := s.session.Speakers[i].Address
+	peer := s.r.m.pcapPeer(address)
+	if peer == nil {
+		// Only reported once per session
+		s.remote[i] = false
+		log.Printf("Ignoring captured BGP session with %s, already monitored from another source", address)
+		return nil
+	}
+	s.r.seen[address] = true
+	return peer
+}
+
+func (s *bgpStream) peers() [2]*PeerState {
+	return [2]*PeerState{s.peer(0), s.peer(1)}
+}
+
+// event appends to the session timeline; i is the sending end, or -1 for
+// the session itself
+func (s *bgpStream) event(i int, typ, detail string, notification *Notification, ts time.Time) {
+	e := SessionEvent{Timestamp: ts, Type: typ, Detail: detail, Notification: notification}
+	if i >= 0 {
+		e.From = s.session.Speakers[i].Address
+	}
+
+	s.r.m.pcapMu.Lock()
+	s.session.Events = append(s.session.Events, e)
+	s.r.m.pcapMu.Unlock()
+}
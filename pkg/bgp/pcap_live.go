@@ -0,0 +1,46 @@
+//go:build pcap
+
+package bgp
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+// Live captures keep whole segments of BGP sessions only
+const (
+	pcapSnapLen = 65535
+	pcapFilter  = "tcp port 179"
+)
+
+// StartPCAPCapture decodes the BGP sessions crossing a network interface
+// until the monitor is closed
+func (m *Monitor) StartPCAPCapture(iface string, opts PCAPOptions) error {
+	r, err := m.newPCAPReader(opts)
+	if err != nil {
+		return err
+	}
+	handle, err := pcap.OpenLive(iface, pcapSnapLen, true, pcap.BlockForever)
+	if err != nil {
+		return fmt.Errorf("failed to open interface %s: %w", iface, err)
+	}
+	if err := handle.SetBPFFilter(pcapFilter); err != nil {
+		handle.Close()
+		return fmt.Errorf("failed to set BPF filter: %w", err)
+	}
+
+	// Closing the handle ends the packet source
+	go func() {
+		<-m.ctx.Done()
+		handle.Close()
+	}()
+
+	go func() {
+		r.read(gopacket.NewPacketSource(handle, handle.LinkType()), true)
+		log.Printf("BGP capture on %s stopped after %d packets", iface, r.stats.Packets)
+	}()
+	return nil
+}
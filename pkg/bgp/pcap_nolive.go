@@ -0,0 +1,11 @@
+//go:build !pcap
+
+package bgp
+
+import "errors"
+
+// StartPCAPCapture needs libpcap, which is only linked into builds with the
+// pcap tag
+func (m *Monitor) StartPCAPCapture(iface string, opts PCAPOptions) error {
+	return errors.New("live BGP capture is not supported by this build, rebuild with -tags pcap")
+}
@@ -0,0 +1,443 @@
+package bgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Ends of the captured session: the router the capture was taken on, and
+// its peer
+var pcapEnds = [2]struct {
+	ip   net.IP
+	port layers.TCPPort
+}{
+	{net.IPv4(192, 0, 2, 254).To4(), 40000},
+	{net.IPv4(192, 0, 2, 1).To4(), bgp.BGP_PORT},
+}
+
+const (
+	pcapLocal = 0
+	pcapPeer  = 1
+)
+
+// capture builds the packets of one TCP connection between pcapEnds
+type capture struct {
+	t       *testing.T
+	packets [][]byte
+	times   []time.Time
+	seq     [2]uint32
+}
+
+func newCapture(t *testing.T) *capture {
+	return &capture{t: t, seq: [2]uint32{1000, 5000}}
+}
+
+func (c *capture) packet(from int, payload []byte, fin, rst bool) {
+	c.t.Helper()
+	to := 1 - from
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, byte(from + 1)},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, byte(to + 1)},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    pcapEnds[from].ip,
+		DstIP:    pcapEnds[to].ip,
+	}
+	tcp := &layers.TCP{
+		SrcPort: pcapEnds[from].port,
+		DstPort: pcapEnds[to].port,
+		Seq:     c.seq[from],
+		Ack:     c.seq[to],
+		ACK:     true,
+		PSH:     len(payload) > 0,
+		FIN:     fin,
+		RST:     rst,
+		Window:  65535,
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		c.t.Fatalf("failed to build packet: %v", err)
+	}
+	c.packets = append(c.packets, buf.Bytes())
+	c.times = append(c.times, mrtTime.Add(time.Duration(len(c.times))*time.Second))
+
+	c.seq[from] += uint32(len(payload))
+	if fin {
+		c.seq[from]++
+	}
+}
+
+// send writes BGP messages from one end, each in its own segment
+func (c *capture) send(from int, msgs ...*bgp.BGPMessage) *capture {
+	c.t.Helper()
+	for _, msg := range msgs {
+		c.packet(from, c.serialize(msg), false, false)
+	}
+	return c
+}
+
+// split writes a BGP message from one end across two segments
+func (c *capture) split(from int, msg *bgp.BGPMessage) *capture {
+	data := c.serialize(msg)
+	c.packet(from, data[:10], false, false)
+	c.packet(from, data[10:], false, false)
+	return c
+}
+
+// lose drops n bytes sent from one end
+func (c *capture) lose(from int, n uint32) *capture {
+	c.seq[from] += n
+	return c
+}
+
+func (c *capture) fin(from int) *capture {
+	c.packet(from, nil, true, false)
+	return c
+}
+
+func (c *capture) rst(from int) *capture {
+	c.packet(from, nil, false, true)
+	return c
+}
+
+func (c *capture) serialize(msg *bgp.BGPMessage) []byte {
+	c.t.Helper()
+	data, err := msg.Serialize()
+	if err != nil {
+		c.t.Fatalf("failed to serialize BGP message: %v", err)
+	}
+	return data
+}
+
+// handshake exchanges OPENs and KEEPALIVEs. The peer uses a four-octet ASN.
+func (c *capture) handshake() *capture {
+	peerCaps := []bgp.ParameterCapabilityInterface{
+		bgp.NewCapMultiProtocol(bgp.RF_IPv4_UC),
+		bgp.NewCapFourOctetASNumber(4200000000),
+	}
+	c.send(pcapLocal, bmpOpen(64496, "192.0.2.254"))
+	c.send(pcapPeer, bgp.NewBGPOpenMessage(bgp.AS_TRANS, 90, "192.0.2.1",
+		[]bgp.OptionParameterInterface{bgp.NewOptionParameterCapability(peerCaps)}))
+	return c.send(pcapLocal, bgp.NewBGPKeepAliveMessage()).send(pcapPeer, bgp.NewBGPKeepAliveMessage())
+}
+
+func (c *capture) pcap() []byte {
+	c.t.Helper()
+	var out bytes.Buffer
+	w := pcapgo.NewWriter(&out)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		c.t.Fatal(err)
+	}
+	for i, data := range c.packets {
+		ci := gopacket.CaptureInfo{Timestamp: c.times[i], CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func (c *capture) pcapng() []byte {
+	c.t.Helper()
+	var out bytes.Buffer
+	w, err := pcapgo.NewNgWriter(&out, layers.LinkTypeEthernet)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for i, data := range c.packets {
+		ci := gopacket.CaptureInfo{Timestamp: c.times[i], CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		c.t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func pcapUpdate(withdrawn, announced []string) *bgp.BGPMessage {
+	var nlri, gone []*bgp.IPAddrPrefix
+	for _, p := range announced {
+		nlri = append(nlri, ipPrefix(p))
+	}
+	for _, p := range withdrawn {
+		gone = append(gone, ipPrefix(p))
+	}
+	var attrs []bgp.PathAttributeInterface
+	if len(nlri) > 0 {
+		attrs = []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+			bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{bgp.NewAsPathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint16{64500})}),
+			bgp.NewPathAttributeNextHop("192.0.2.1"),
+		}
+	}
+	return bgp.NewBGPUpdateMessage(gone, attrs, nlri)
+}
+
+func TestImportPCAP(t *testing.T) {
+	peerAddress := pcapEnds[pcapPeer].ip.String()
+	localAddress := pcapEnds[pcapLocal].ip.String()
+	notification := bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_CEASE, bgp.BGP_ERROR_SUB_ADMINISTRATIVE_RESET, nil)
+
+	tests := []struct {
+		name     string
+		build    func(c *capture)
+		local    []string
+		messages map[string]int
+		peers    int
+		state    string
+		prefixes int64
+		out      int
+		asn      uint32
+		flaps    int64
+		reason   string
+		events   []string
+	}{
+		{
+			name: "session with updates both ways",
+			build: func(c *capture) {
+				c.handshake().
+					send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24", "203.0.113.0/24"})).
+					send(pcapLocal, pcapUpdate(nil, []string{"192.0.2.0/24"}))
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2, "UPDATE": 2},
+			peers:    1,
+			state:    "Established",
+			prefixes: 2,
+			out:      1,
+			asn:      4200000000,
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished},
+		},
+		{
+			name: "without local addresses both ends are peers",
+			build: func(c *capture) {
+				c.handshake().send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"}))
+			},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2, "UPDATE": 1},
+			peers:    2,
+			state:    "Established",
+			prefixes: 1,
+			asn:      4200000000,
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished},
+		},
+		{
+			name: "capture starting on an established session",
+			build: func(c *capture) {
+				c.send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"}), bgp.NewBGPKeepAliveMessage())
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"UPDATE": 1, "KEEPALIVE": 1},
+			peers:    1,
+			state:    "Established",
+			prefixes: 1,
+			events:   []string{SessionEventEstablished},
+		},
+		{
+			name: "message split across segments",
+			build: func(c *capture) {
+				c.handshake().split(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24", "203.0.113.0/24"}))
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2, "UPDATE": 1},
+			peers:    1,
+			state:    "Established",
+			prefixes: 2,
+			asn:      4200000000,
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished},
+		},
+		{
+			name: "resynchronized after missing bytes",
+			build: func(c *capture) {
+				c.handshake().
+					send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"})).
+					lose(pcapPeer, 30).
+					send(pcapPeer, pcapUpdate(nil, []string{"203.0.113.0/24"}))
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2, "UPDATE": 2},
+			peers:    1,
+			state:    "Established",
+			prefixes: 2,
+			asn:      4200000000,
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished, SessionEventGap},
+		},
+		{
+			name: "notification from the local router",
+			build: func(c *capture) {
+				c.handshake().
+					send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"})).
+					send(pcapLocal, notification).
+					fin(pcapLocal)
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2, "UPDATE": 1, "NOTIFICATION": 1},
+			peers:    1,
+			state:    "Idle",
+			asn:      4200000000,
+			flaps:    1,
+			reason:   "notification-" + NotificationSent,
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished, "NOTIFICATION", SessionEventFIN},
+		},
+		{
+			name: "connection closed",
+			build: func(c *capture) {
+				c.handshake().fin(pcapPeer)
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2},
+			peers:    1,
+			state:    "Idle",
+			asn:      4200000000,
+			flaps:    1,
+			reason:   "connection-closed",
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished, SessionEventFIN},
+		},
+		{
+			name: "connection reset",
+			build: func(c *capture) {
+				c.handshake().rst(pcapLocal)
+			},
+			local:    []string{localAddress},
+			messages: map[string]int{"OPEN": 2, "KEEPALIVE": 2},
+			peers:    1,
+			state:    "Idle",
+			asn:      4200000000,
+			flaps:    1,
+			reason:   "connection-reset",
+			events:   []string{"OPEN", "OPEN", "KEEPALIVE", "KEEPALIVE", SessionEventEstablished, SessionEventRST},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCapture(t)
+			tt.build(c)
+
+			m := newTestMonitor(t)
+			stats, err := m.ImportPCAP(bytes.NewReader(c.pcap()), "upload", PCAPOptions{Local: tt.local})
+			if err != nil {
+				t.Fatalf("ImportPCAP: %v", err)
+			}
+			if stats.File != "upload" || stats.Packets != len(c.packets) || stats.Sessions != 1 || stats.Peers != tt.peers {
+				t.Errorf("stats = %+v, want %d packets, 1 session and %d peers", *stats, len(c.packets), tt.peers)
+			}
+			if len(stats.Messages) != len(tt.messages) {
+				t.Errorf("messages = %v, want %v", stats.Messages, tt.messages)
+			}
+			for typ, n := range tt.messages {
+				if stats.Messages[typ] != n {
+					t.Errorf("messages = %v, want %v", stats.Messages, tt.messages)
+					break
+				}
+			}
+
+			peer, err := m.GetPeer(peerAddress)
+			if err != nil {
+				t.Fatalf("GetPeer: %v", err)
+			}
+			if peer.Source != SourcePCAP || peer.State != tt.state || peer.ASN != tt.asn {
+				t.Errorf("peer = %s AS%d from %s, want %s AS%d from %s", peer.State, peer.ASN, peer.Source, tt.state, tt.asn, SourcePCAP)
+			}
+			if peer.PrefixCount != tt.prefixes || peer.FlapCount != tt.flaps {
+				t.Errorf("peer has %d prefixes and %d flaps, want %d and %d", peer.PrefixCount, peer.FlapCount, tt.prefixes, tt.flaps)
+			}
+			out, _ := m.ListAdjRIBOut(peerAddress, "", MatchExact)
+			if len(out) != tt.out {
+				t.Errorf("Adj-RIB-Out has %d routes, want %d", len(out), tt.out)
+			}
+			if tt.reason != "" {
+				history, _ := m.PeerHistory(peerAddress)
+				if last := history[len(history)-1]; last.Reason != tt.reason {
+					t.Errorf("down reason = %q, want %q", last.Reason, tt.reason)
+				}
+			}
+
+			sessions := m.PCAPSessions(peerAddress)
+			if len(sessions) != 1 {
+				t.Fatalf("got %d sessions, want 1", len(sessions))
+			}
+			var events []string
+			for _, e := range sessions[0].Events {
+				events = append(events, e.Type)
+			}
+			if len(events) != len(tt.events) {
+				t.Fatalf("events = %v, want %v", events, tt.events)
+			}
+			for i := range events {
+				if events[i] != tt.events[i] {
+					t.Fatalf("events = %v, want %v", events, tt.events)
+				}
+			}
+		})
+	}
+}
+
+func TestImportPCAPFormats(t *testing.T) {
+	c := newCapture(t)
+	c.handshake().send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"}))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "pcap", data: c.pcap()},
+		{name: "pcapng", data: c.pcapng()},
+		{name: "not a capture", data: []byte("not a capture file"), wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMonitor(t)
+			stats, err := m.ImportPCAP(bytes.NewReader(tt.data), "upload", PCAPOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportPCAP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (stats.Packets != len(c.packets) || stats.Messages["UPDATE"] != 1) {
+				t.Errorf("stats = %+v, want %d packets and 1 UPDATE", *stats, len(c.packets))
+			}
+		})
+	}
+}
+
+func TestImportPCAPReadError(t *testing.T) {
+	c := newCapture(t)
+	c.handshake().send(pcapPeer, pcapUpdate(nil, []string{"198.51.100.0/24"}))
+	data := c.pcap()
+
+	// Cut in the last packet, as when an upload goes over its size limit
+	m := newTestMonitor(t)
+	body := http.MaxBytesReader(nil, io.NopCloser(bytes.NewReader(data)), int64(len(data)-10))
+	_, err := m.ImportPCAP(body, "upload", PCAPOptions{})
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("ImportPCAP() error = %v, want *http.MaxBytesError", err)
+	}
+}
+
+func TestImportPCAPLocalAddress(t *testing.T) {
+	m := newTestMonitor(t)
+	if _, err := m.ImportPCAP(bytes.NewReader(nil), "upload", PCAPOptions{Local: []string{"router1"}}); err == nil {
+		t.Error("ImportPCAP() accepted an invalid local address")
+	}
+}
@@ -0,0 +1,121 @@
+package bgp
+
+import (
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Shown instead of a peer's MD5 password
+const redactedPassword = "********"
+
+// PeerConfig describes a BGP neighbor. Zero values leave the GoBGP defaults
+// in place.
+type PeerConfig struct {
+	Address              string
+	ASN                  uint32
+	Port                 uint16
+	Families             []string
+	Description          string
+	Password             string
+	LocalAddress         string
+	EBGPMultihopTTL      uint8
+	TTLSecurityHops      uint8
+	HoldTime             uint32
+	KeepaliveInterval    uint32
+	GracefulRestart      bool
+	RestartTime          uint32
+	RouteReflectorClient bool
+	ClusterID            string
+	Passive              bool
+	Role                 string
+	PrefixLimits         []PrefixLimit
+}
+
+// redacted returns a copy of the configuration that is safe to expose
+func (c PeerConfig) redacted() PeerConfig {
+	if c.Password != "" {
+		c.Password = redactedPassword
+	}
+	c.Families = append([]string(nil), c.Families...)
+	c.PrefixLimits = append([]PrefixLimit(nil), c.PrefixLimits...)
+	return c
+}
+
+// apiPeer converts the configuration into a GoBGP peer
+func (c PeerConfig) apiPeer() (*api.Peer, error) {
+	families := c.Families
+	if len(families) == 0 {
+		families = DefaultFamilies
+	}
+
+	afiSafis := make([]*api.AfiSafi, 0, len(families))
+	for _, name := range families {
+		family, err := toAPIFamily(name)
+		if err != nil {
+			return nil, err
+		}
+		afiSafi := &api.AfiSafi{
+			Config: &api.AfiSafiConfig{
+				Family:  family,
+				Enabled: true,
+			},
+		}
+		if c.GracefulRestart {
+			afiSafi.MpGracefulRestart = &api.MpGracefulRestart{
+				Config: &api.MpGracefulRestartConfig{Enabled: true},
+			}
+		}
+		afiSafis = append(afiSafis, afiSafi)
+	}
+
+	peer := &api.Peer{
+		Conf: &api.PeerConf{
+			NeighborAddress: c.Address,
+			PeerAsn:         c.ASN,
+			Description:     c.Description,
+			AuthPassword:    c.Password,
+		},
+		Transport: &api.Transport{
+			RemotePort:   uint32(c.Port),
+			LocalAddress: c.LocalAddress,
+			PassiveMode:  c.Passive,
+		},
+		AfiSafis: afiSafis,
+	}
+
+	if c.EBGPMultihopTTL > 0 {
+		peer.EbgpMultihop = &api.EbgpMultihop{
+			Enabled:     true,
+			MultihopTtl: uint32(c.EBGPMultihopTTL),
+		}
+	}
+	if c.TTLSecurityHops > 0 {
+		// GTSM (RFC 5082): accept only packets that crossed at most this
+		// many hops
+		peer.TtlSecurity = &api.TtlSecurity{
+			Enabled: true,
+			TtlMin:  256 - uint32(c.TTLSecurityHops),
+		}
+	}
+	if c.HoldTime > 0 || c.KeepaliveInterval > 0 {
+		peer.Timers = &api.Timers{
+			Config: &api.TimersConfig{
+				HoldTime:          uint64(c.HoldTime),
+				KeepaliveInterval: uint64(c.KeepaliveInterval),
+			},
+		}
+	}
+	if c.GracefulRestart {
+		peer.GracefulRestart = &api.GracefulRestart{
+			Enabled:     true,
+			RestartTime: c.RestartTime,
+		}
+	}
+	if c.RouteReflectorClient {
+		peer.RouteReflector = &api.RouteReflector{
+			RouteReflectorClient:    true,
+			RouteReflectorClusterId: c.ClusterID,
+		}
+	}
+
+	return peer, nil
+}
@@ -0,0 +1,474 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Policy route actions and simulation outcomes
+const (
+	OutcomeAccept = "accept"
+	OutcomeReject = "reject"
+	OutcomeModify = "modify"
+)
+
+// Set match options
+const (
+	MatchAny    = "any"
+	MatchAll    = "all"
+	MatchInvert = "invert"
+)
+
+// Policy is a routing policy that can be simulated against the Adj-RIB-In.
+// Statements are evaluated in order: the first statement with a route
+// action ends evaluation, statements without one only modify the route.
+// Routes no accepting or rejecting statement matches get the default
+// action.
+type Policy struct {
+	Name          string
+	Peers         []string
+	DefaultAction string
+	PrefixSets    []PrefixSet
+	ASPathSets    []ASPathSet
+	CommunitySets []CommunitySet
+	Statements    []PolicyStatement
+}
+
+// PrefixSet is a named list of prefixes. A mask length range of "24..28"
+// also matches more-specifics of that length; without it a prefix only
+// matches itself.
+type PrefixSet struct {
+	Name     string
+	Prefixes []PrefixMatch
+}
+
+type PrefixMatch struct {
+	Prefix          string
+	MaskLengthRange string
+}
+
+// ASPathSet is a named list of AS path regular expressions. As on routers,
+// "_" matches the start or end of the path or the space between two ASNs,
+// e.g. "_65001_" or "^65000_".
+type ASPathSet struct {
+	Name    string
+	ASPaths []string
+}
+
+// CommunitySet is a named list of regular expressions matched against the
+// decoded value (e.g. "65000:100", "rt:65000:10") or name of a community
+type CommunitySet struct {
+	Name        string
+	Communities []string
+}
+
+// PolicyStatement applies its actions to routes matching all its conditions
+type PolicyStatement struct {
+	Name       string
+	Conditions PolicyConditions
+	Actions    PolicyActions
+}
+
+// PolicyConditions reference sets by name. Each set has its own match
+// option: any (default), all (AS path and community sets) or invert.
+type PolicyConditions struct {
+	PrefixSet         string
+	PrefixSetMatch    string
+	ASPathSet         string
+	ASPathSetMatch    string
+	CommunitySet      string
+	CommunitySetMatch string
+}
+
+// PolicyActions modify a route and optionally accept or reject it. Zero
+// values leave the attribute unchanged.
+type PolicyActions struct {
+	RouteAction       string
+	SetLocalPref      uint32
+	SetMED            *uint32
+	AddCommunities    []string
+	RemoveCommunities []string
+	PrependASN        uint32
+	PrependCount      int
+}
+
+// SimulatedRoute is the effect of a policy on one route: the statements
+// that matched it ("default" when the default action applied) and the
+// attribute changes of accepted routes
+type SimulatedRoute struct {
+	Prefix     string
+	Outcome    string
+	Statements []string
+	Changes    []string
+	Route      *Route
+}
+
+// PeerSimulation summarizes the effect of a policy on a peer's routes.
+// Unchanged accepted routes are only counted.
+type PeerSimulation struct {
+	Peer     string
+	PeerASN  uint32
+	Accepted int64
+	Rejected int64
+	Modified int64
+	Routes   []*SimulatedRoute
+}
+
+// SimulationResult is the effect of a policy on every peer it applies to
+type SimulationResult struct {
+	Policy string
+	Peers  []*PeerSimulation
+}
+
+type compiledPolicy struct {
+	*Policy
+	prefixSets    map[string][]prefixRange
+	asPathSets    map[string][]*regexp.Regexp
+	communitySets map[string][]*regexp.Regexp
+
+	// Community removal expressions per statement
+	removals [][]*regexp.Regexp
+}
+
+type prefixRange struct {
+	prefix netip.Prefix
+	min    int
+	max    int
+}
+
+// SimulatePolicy dry-runs a policy against the Adj-RIB-In of every peer it
+// applies to, optionally limited to one peer. Nothing is installed.
+func (m *Monitor) SimulatePolicy(policy *Policy, address string) (*SimulationResult, error) {
+	p, err := compilePolicy(policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", policy.Name, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	applies := make(map[string]bool, len(policy.Peers))
+	for _, peer := range policy.Peers {
+		applies[peer] = true
+	}
+
+	result := &SimulationResult{Policy: policy.Name, Peers: make([]*PeerSimulation, 0)}
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		if len(applies) > 0 && !applies[peer.Address] {
+			continue
+		}
+
+		sim := &PeerSimulation{Peer: peer.Address, PeerASN: peer.ASN, Routes: make([]*SimulatedRoute, 0)}
+		peer.mu.RLock()
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				r := m.evaluate(p, peer, route)
+				switch r.Outcome {
+				case OutcomeReject:
+					sim.Rejected++
+				case OutcomeModify:
+					sim.Modified++
+				default:
+					sim.Accepted++
+					continue
+				}
+				sim.Routes = append(sim.Routes, r)
+			}
+		}
+		peer.mu.RUnlock()
+
+		sort.Slice(sim.Routes, func(i, j int) bool {
+			return sim.Routes[i].Prefix < sim.Routes[j].Prefix
+		})
+		result.Peers = append(result.Peers, sim)
+	}
+
+	sort.Slice(result.Peers, func(i, j int) bool {
+		return result.Peers[i].Peer < result.Peers[j].Peer
+	})
+	return result, nil
+}
+
+func compilePolicy(policy *Policy) (*compiledPolicy, error) {
+	p := &compiledPolicy{
+		Policy:        policy,
+		prefixSets:    make(map[string][]prefixRange),
+		asPathSets:    make(map[string][]*regexp.Regexp),
+		communitySets: make(map[string][]*regexp.Regexp),
+	}
+	if policy.DefaultAction != OutcomeAccept && policy.DefaultAction != OutcomeReject {
+		return nil, fmt.Errorf("invalid default action %q", policy.DefaultAction)
+	}
+
+	for _, set := range policy.PrefixSets {
+		for _, pm := range set.Prefixes {
+			r, err := parsePrefixRange(pm)
+			if err != nil {
+				return nil, fmt.Errorf("prefix set %s: %w", set.Name, err)
+			}
+			p.prefixSets[set.Name] = append(p.prefixSets[set.Name], r)
+		}
+	}
+	for _, set := range policy.ASPathSets {
+		for _, expr := range set.ASPaths {
+			re, err := regexp.Compile(strings.ReplaceAll(expr, "_", "(^|[ ]|$)"))
+			if err != nil {
+				return nil, fmt.Errorf("AS path set %s: invalid expression %q: %w", set.Name, expr, err)
+			}
+			p.asPathSets[set.Name] = append(p.asPathSets[set.Name], re)
+		}
+	}
+	for _, set := range policy.CommunitySets {
+		for _, expr := range set.Communities {
+			re, err := compileCommunity(expr)
+			if err != nil {
+				return nil, fmt.Errorf("community set %s: %w", set.Name, err)
+			}
+			p.communitySets[set.Name] = append(p.communitySets[set.Name], re)
+		}
+	}
+
+	for _, s := range policy.Statements {
+		if a := s.Actions.RouteAction; a != "" && a != OutcomeAccept && a != OutcomeReject {
+			return nil, fmt.Errorf("statement %s: invalid route action %q", s.Name, a)
+		}
+
+		var removals []*regexp.Regexp
+		for _, expr := range s.Actions.RemoveCommunities {
+			re, err := compileCommunity(expr)
+			if err != nil {
+				return nil, fmt.Errorf("statement %s: %w", s.Name, err)
+			}
+			removals = append(removals, re)
+		}
+		p.removals = append(p.removals, removals)
+
+		c := s.Conditions
+		for _, ref := range []struct {
+			kind, name string
+			ok         bool
+		}{
+			{"prefix", c.PrefixSet, p.prefixSets[c.PrefixSet] != nil},
+			{"AS path", c.ASPathSet, p.asPathSets[c.ASPathSet] != nil},
+			{"community", c.CommunitySet, p.communitySets[c.CommunitySet] != nil},
+		} {
+			if ref.name != "" && !ref.ok {
+				return nil, fmt.Errorf("statement %s: unknown %s set %s", s.Name, ref.kind, ref.name)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// compileCommunity compiles a community expression, which must match a
+// whole value or name
+func compileCommunity(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid community expression %q: %w", expr, err)
+	}
+	return re, nil
+}
+
+func parsePrefixRange(pm PrefixMatch) (prefixRange, error) {
+	prefix, err := netip.ParsePrefix(pm.Prefix)
+	if err != nil {
+		return prefixRange{}, fmt.Errorf("invalid prefix %q", pm.Prefix)
+	}
+	r := prefixRange{prefix: prefix.Masked(), min: prefix.Bits(), max: prefix.Bits()}
+	if pm.MaskLengthRange == "" {
+		return r, nil
+	}
+
+	lo, hi, ok := strings.Cut(pm.MaskLengthRange, "..")
+	if !ok {
+		return prefixRange{}, fmt.Errorf("invalid mask length range %q, expected e.g. 24..28", pm.MaskLengthRange)
+	}
+	r.min, err = strconv.Atoi(lo)
+	if err == nil {
+		r.max, err = strconv.Atoi(hi)
+	}
+	if err != nil || r.min < prefix.Bits() || r.max < r.min || r.max > prefix.Addr().BitLen() {
+		return prefixRange{}, fmt.Errorf("invalid mask length range %q for %s", pm.MaskLengthRange, pm.Prefix)
+	}
+	return r, nil
+}
+
+// evaluate runs a route through the policy. Conditions are checked against
+// the route as modified by earlier statements. Callers must hold peer.mu.
+func (m *Monitor) evaluate(p *compiledPolicy, peer *PeerState, route *Route) *SimulatedRoute {
+	r := &SimulatedRoute{Prefix: route.Prefix, Route: route}
+
+	localPref := effectiveLocalPref(route)
+	med := route.MED
+	asPath := route.ASPath
+	communities := m.communities(route)
+
+	action := ""
+	for i, s := range p.Statements {
+		if !p.matches(s.Conditions, route.Prefix, asPath, communities) {
+			continue
+		}
+		r.Statements = append(r.Statements, s.Name)
+
+		a := s.Actions
+		if a.SetLocalPref != 0 && a.SetLocalPref != localPref {
+			r.Changes = append(r.Changes, fmt.Sprintf("local-pref %d -> %d", localPref, a.SetLocalPref))
+			localPref = a.SetLocalPref
+		}
+		if a.SetMED != nil && *a.SetMED != med {
+			r.Changes = append(r.Changes, fmt.Sprintf("med %d -> %d", med, *a.SetMED))
+			med = *a.SetMED
+		}
+		if len(p.removals[i]) > 0 {
+			kept := make([]Community, 0, len(communities))
+			for _, c := range communities {
+				if matchSet(p.removals[i], MatchAny, func(re *regexp.Regexp) bool { return re.MatchString(c.Value) }) {
+					r.Changes = append(r.Changes, "remove community "+c.Value)
+					continue
+				}
+				kept = append(kept, c)
+			}
+			communities = kept
+		}
+		for _, value := range a.AddCommunities {
+			if !hasCommunity(communities, value) {
+				r.Changes = append(r.Changes, "add community "+value)
+				communities = append(communities, Community{Value: value, Name: m.communityName(value)})
+			}
+		}
+		if a.PrependCount > 0 {
+			asn := a.PrependASN
+			if asn == 0 {
+				asn = peer.ASN
+			}
+			prepended := make([]uint32, 0, len(asPath)+a.PrependCount)
+			for n := 0; n < a.PrependCount; n++ {
+				prepended = append(prepended, asn)
+			}
+			asPath = append(prepended, asPath...)
+			r.Changes = append(r.Changes, fmt.Sprintf("prepend AS%d x%d", asn, a.PrependCount))
+		}
+
+		if a.RouteAction != "" {
+			action = a.RouteAction
+			break
+		}
+	}
+	if action == "" {
+		action = p.DefaultAction
+		r.Statements = append(r.Statements, "default")
+	}
+
+	switch {
+	case action == OutcomeReject:
+		r.Outcome = OutcomeReject
+		r.Changes = nil
+	case len(r.Changes) > 0:
+		r.Outcome = OutcomeModify
+	default:
+		r.Outcome = OutcomeAccept
+	}
+	return r
+}
+
+// matches reports whether a route meets every condition of a statement
+func (p *compiledPolicy) matches(c PolicyConditions, prefix string, asPath []uint32, communities []Community) bool {
+	if c.PrefixSet != "" {
+		matched := false
+		if pfx, err := netip.ParsePrefix(prefix); err == nil {
+			for _, r := range p.prefixSets[c.PrefixSet] {
+				if r.prefix.Addr().Is4() == pfx.Addr().Is4() && r.prefix.Contains(pfx.Addr()) &&
+					pfx.Bits() >= r.min && pfx.Bits() <= r.max {
+					matched = true
+					break
+				}
+			}
+		}
+		if matched == (c.PrefixSetMatch == MatchInvert) {
+			return false
+		}
+	}
+
+	if c.ASPathSet != "" {
+		path := formatPath(asPath)
+		if !matchSet(p.asPathSets[c.ASPathSet], c.ASPathSetMatch, func(re *regexp.Regexp) bool {
+			return re.MatchString(path)
+		}) {
+			return false
+		}
+	}
+
+	if c.CommunitySet != "" {
+		if !matchSet(p.communitySets[c.CommunitySet], c.CommunitySetMatch, func(re *regexp.Regexp) bool {
+			for _, community := range communities {
+				if re.MatchString(community.Value) || community.Name != "" && re.MatchString(community.Name) {
+					return true
+				}
+			}
+			return false
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchSet applies a match option to the expressions of a set
+func matchSet(set []*regexp.Regexp, option string, match func(*regexp.Regexp) bool) bool {
+	switch option {
+	case MatchAll:
+		for _, re := range set {
+			if !match(re) {
+				return false
+			}
+		}
+		return true
+	case MatchInvert:
+		for _, re := range set {
+			if match(re) {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, re := range set {
+			if match(re) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func formatPath(path []uint32) string {
+	asns := make([]string, len(path))
+	for i, asn := range path {
+		asns[i] = strconv.FormatUint(uint64(asn), 10)
+	}
+	return strings.Join(asns, " ")
+}
+
+func hasCommunity(communities []Community, value string) bool {
+	for _, c := range communities {
+		if c.Value == value {
+			return true
+		}
+	}
+	return false
+}
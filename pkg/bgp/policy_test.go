@@ -0,0 +1,210 @@
+package bgp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+func TestCompilePolicy(t *testing.T) {
+	valid := func(change func(p *Policy)) *Policy {
+		p := &Policy{
+			Name:          "test",
+			DefaultAction: OutcomeAccept,
+			PrefixSets:    []PrefixSet{{Name: "customers", Prefixes: []PrefixMatch{{Prefix: "198.51.100.0/24", MaskLengthRange: "24..28"}}}},
+			ASPathSets:    []ASPathSet{{Name: "transit", ASPaths: []string{"_65001_"}}},
+			Statements:    []PolicyStatement{{Name: "s1", Conditions: PolicyConditions{PrefixSet: "customers", ASPathSet: "transit"}}},
+		}
+		change(p)
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr string
+	}{
+		{name: "valid", policy: valid(func(p *Policy) {})},
+		{name: "invalid default action", policy: valid(func(p *Policy) { p.DefaultAction = "drop" }), wantErr: `invalid default action "drop"`},
+		{name: "invalid prefix", policy: valid(func(p *Policy) { p.PrefixSets[0].Prefixes[0].Prefix = "198.51.100.0" }), wantErr: "invalid prefix"},
+		{name: "range without dots", policy: valid(func(p *Policy) { p.PrefixSets[0].Prefixes[0].MaskLengthRange = "24-28" }), wantErr: "expected e.g. 24..28"},
+		{name: "range shorter than the prefix", policy: valid(func(p *Policy) { p.PrefixSets[0].Prefixes[0].MaskLengthRange = "16..24" }), wantErr: "invalid mask length range"},
+		{name: "range reversed", policy: valid(func(p *Policy) { p.PrefixSets[0].Prefixes[0].MaskLengthRange = "28..24" }), wantErr: "invalid mask length range"},
+		{name: "range past the address length", policy: valid(func(p *Policy) { p.PrefixSets[0].Prefixes[0].MaskLengthRange = "24..33" }), wantErr: "invalid mask length range"},
+		{name: "invalid AS path expression", policy: valid(func(p *Policy) { p.ASPathSets[0].ASPaths[0] = "_(65001_" }), wantErr: "invalid expression"},
+		{name: "invalid route action", policy: valid(func(p *Policy) { p.Statements[0].Actions.RouteAction = "drop" }), wantErr: `invalid route action "drop"`},
+		{name: "unknown set", policy: valid(func(p *Policy) { p.Statements[0].Conditions.CommunitySet = "none" }), wantErr: "unknown community set none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compilePolicy(tt.policy)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compilePolicy: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compilePolicy() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyConditions(t *testing.T) {
+	v6, err := bgp.NewPrefixFromRouteFamily(bgp.AFI_IP6, bgp.SAFI_UNICAST, "2001:db8::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		conditions PolicyConditions
+		route      *Route
+		want       bool
+	}{
+		{name: "exact prefix", conditions: PolicyConditions{PrefixSet: "exact"}, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64500)), want: true},
+		{name: "more-specific without a range", conditions: PolicyConditions{PrefixSet: "exact"}, route: pathRoute(ipPrefix("198.51.100.0/25"), seq(64500))},
+		{name: "below the range", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(ipPrefix("203.0.113.0/24"), seq(64500))},
+		{name: "start of the range", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(ipPrefix("203.0.113.128/25"), seq(64500)), want: true},
+		{name: "end of the range", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(ipPrefix("203.0.113.16/28"), seq(64500)), want: true},
+		{name: "past the range", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(ipPrefix("203.0.113.16/29"), seq(64500))},
+		{name: "outside the range prefix", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(ipPrefix("203.0.112.0/25"), seq(64500))},
+		{name: "IPv6 in the range", conditions: PolicyConditions{PrefixSet: "range"}, route: pathRoute(v6, seq(64500)), want: true},
+		{name: "inverted prefix match", conditions: PolicyConditions{PrefixSet: "exact", PrefixSetMatch: MatchInvert}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(64500)), want: true},
+		{name: "inverted prefix miss", conditions: PolicyConditions{PrefixSet: "exact", PrefixSetMatch: MatchInvert}, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(64500))},
+
+		{name: "ASN in the middle", conditions: PolicyConditions{ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 65001, 65002)), want: true},
+		{name: "ASN alone", conditions: PolicyConditions{ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65001)), want: true},
+		{name: "ASN as a prefix of another", conditions: PolicyConditions{ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(650010, 65002))},
+		{name: "ASN as a suffix of another", conditions: PolicyConditions{ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 165001))},
+		{name: "anchored neighbor AS", conditions: PolicyConditions{ASPathSet: "from-65000"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 65001)), want: true},
+		{name: "anchored neighbor AS later in the path", conditions: PolicyConditions{ASPathSet: "from-65000"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65001, 65000))},
+		{name: "anchored origin AS", conditions: PolicyConditions{ASPathSet: "origin-65010"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 65010)), want: true},
+		{name: "anchored origin AS earlier in the path", conditions: PolicyConditions{ASPathSet: "origin-65010"}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65010, 65000))},
+		{name: "all expressions", conditions: PolicyConditions{ASPathSet: "both", ASPathSetMatch: MatchAll}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 65001)), want: true},
+		{name: "not all expressions", conditions: PolicyConditions{ASPathSet: "both", ASPathSetMatch: MatchAll}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65000, 65002))},
+		{name: "inverted AS path", conditions: PolicyConditions{ASPathSet: "via-65001", ASPathSetMatch: MatchInvert}, route: pathRoute(ipPrefix("192.0.2.0/24"), seq(65002)), want: true},
+
+		{name: "every condition", conditions: PolicyConditions{PrefixSet: "exact", ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(65001)), want: true},
+		{name: "one condition missed", conditions: PolicyConditions{PrefixSet: "exact", ASPathSet: "via-65001"}, route: pathRoute(ipPrefix("198.51.100.0/24"), seq(65002))},
+	}
+
+	m := newTestMonitor(t)
+	peer := &PeerState{Address: "192.0.2.1", ASN: 65000}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := compilePolicy(&Policy{
+				Name:          "test",
+				DefaultAction: OutcomeAccept,
+				PrefixSets: []PrefixSet{
+					{Name: "exact", Prefixes: []PrefixMatch{{Prefix: "198.51.100.0/24"}}},
+					{Name: "range", Prefixes: []PrefixMatch{
+						{Prefix: "203.0.113.0/24", MaskLengthRange: "25..28"},
+						{Prefix: "2001:db8::/32", MaskLengthRange: "32..48"},
+					}},
+				},
+				ASPathSets: []ASPathSet{
+					{Name: "via-65001", ASPaths: []string{"_65001_"}},
+					{Name: "from-65000", ASPaths: []string{"^65000_"}},
+					{Name: "origin-65010", ASPaths: []string{"_65010$"}},
+					{Name: "both", ASPaths: []string{"^65000_", "_65001_"}},
+				},
+				Statements: []PolicyStatement{
+					{Name: "match", Conditions: tt.conditions, Actions: PolicyActions{RouteAction: OutcomeReject}},
+				},
+			})
+			if err != nil {
+				t.Fatalf("compilePolicy: %v", err)
+			}
+
+			r := m.evaluate(p, peer, tt.route)
+			if got := r.Outcome == OutcomeReject; got != tt.want {
+				t.Errorf("%s via %s matched = %v, want %v", tt.route.Prefix, formatPath(tt.route.ASPath), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyActions(t *testing.T) {
+	med := uint32(50)
+
+	tests := []struct {
+		name       string
+		statements []PolicyStatement
+		outcome    string
+		matched    []string
+		changes    []string
+	}{
+		{
+			name:    "default action",
+			outcome: OutcomeAccept,
+			matched: []string{"default"},
+		},
+		{
+			name: "modifications then accept",
+			statements: []PolicyStatement{
+				{Name: "pref", Actions: PolicyActions{SetLocalPref: 200, SetMED: &med}},
+				{Name: "tag", Actions: PolicyActions{AddCommunities: []string{"65000:100"}, PrependCount: 2, RouteAction: OutcomeAccept}},
+				{Name: "never", Actions: PolicyActions{RouteAction: OutcomeReject}},
+			},
+			outcome: OutcomeModify,
+			matched: []string{"pref", "tag"},
+			changes: []string{"local-pref 100 -> 200", "med 0 -> 50", "add community 65000:100", "prepend AS65000 x2"},
+		},
+		{
+			name: "modifications then default",
+			statements: []PolicyStatement{
+				{Name: "prepend", Actions: PolicyActions{PrependASN: 64999, PrependCount: 1}},
+			},
+			outcome: OutcomeModify,
+			matched: []string{"prepend", "default"},
+			changes: []string{"prepend AS64999 x1"},
+		},
+		{
+			name: "unchanged values are not changes",
+			statements: []PolicyStatement{
+				{Name: "same", Actions: PolicyActions{SetLocalPref: 100, RouteAction: OutcomeAccept}},
+			},
+			outcome: OutcomeAccept,
+			matched: []string{"same"},
+		},
+		{
+			name: "reject drops the changes",
+			statements: []PolicyStatement{
+				{Name: "pref", Actions: PolicyActions{SetLocalPref: 200}},
+				{Name: "drop", Actions: PolicyActions{RouteAction: OutcomeReject}},
+			},
+			outcome: OutcomeReject,
+			matched: []string{"pref", "drop"},
+		},
+	}
+
+	m := newTestMonitor(t)
+	peer := &PeerState{Address: "192.0.2.1", ASN: 65000}
+	route := pathRoute(ipPrefix("198.51.100.0/24"), seq(65000, 65001))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := compilePolicy(&Policy{Name: "test", DefaultAction: OutcomeAccept, Statements: tt.statements})
+			if err != nil {
+				t.Fatalf("compilePolicy: %v", err)
+			}
+
+			r := m.evaluate(p, peer, route)
+			if r.Outcome != tt.outcome {
+				t.Errorf("outcome = %s, want %s", r.Outcome, tt.outcome)
+			}
+			if !reflect.DeepEqual(r.Statements, tt.matched) {
+				t.Errorf("statements = %v, want %v", r.Statements, tt.matched)
+			}
+			if !reflect.DeepEqual(r.Changes, tt.changes) {
+				t.Errorf("changes = %q, want %q", r.Changes, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package bgp
+
+import (
+	"fmt"
+	"time"
+)
+
+// Prefix limit levels
+const (
+	LimitOK       = "ok"
+	LimitWarning  = "warning"
+	LimitCritical = "critical"
+)
+
+// Prefix limit actions taken at the critical level
+const (
+	LimitActionAlert    = "alert"
+	LimitActionTeardown = "teardown"
+)
+
+// PrefixLimit caps the number of prefixes a peer may announce for one
+// family. The warning and critical levels are percentages of MaxPrefixes.
+type PrefixLimit struct {
+	Family          string
+	MaxPrefixes     int64
+	WarningPercent  int
+	CriticalPercent int
+	Action          string
+}
+
+// PrefixLimitStatus is how close a peer is to its limit for one family
+type PrefixLimitStatus struct {
+	Count   int64
+	Limit   int64
+	Percent float64
+	Level   string
+	Action  string
+}
+
+// PrefixLimitEvent is published whenever a peer crosses a prefix limit
+// threshold, in either direction
+type PrefixLimitEvent struct {
+	Timestamp     time.Time
+	Peer          string
+	PeerASN       uint32
+	Family        string
+	Count         int64
+	Limit         int64
+	Percent       float64
+	Level         string
+	PreviousLevel string
+	Action        string
+}
+
+// LimitLevelValue maps a limit level to 0 (ok), 1 (warning) or 2 (critical)
+func LimitLevelValue(level string) int {
+	switch level {
+	case LimitCritical:
+		return 2
+	case LimitWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// level returns the limit level reached by a prefix count. Like a router's
+// maximum-prefix, the critical level is only reached once the count exceeds
+// it, so a peer may announce exactly its limit.
+func (l PrefixLimit) level(count int64) string {
+	switch {
+	case count*100 > l.MaxPrefixes*int64(l.CriticalPercent):
+		return LimitCritical
+	case count*100 >= l.MaxPrefixes*int64(l.WarningPercent):
+		return LimitWarning
+	default:
+		return LimitOK
+	}
+}
+
+// limitStatus returns the prefix limit status per family. Callers must hold
+// p.mu.
+func (p *PeerState) limitStatus() map[string]PrefixLimitStatus {
+	status := make(map[string]PrefixLimitStatus, len(p.Config.PrefixLimits))
+	for _, l := range p.Config.PrefixLimits {
+		var count int64
+		if p.routes != nil {
+			count = p.routes.counts[l.Family]
+		}
+		status[l.Family] = PrefixLimitStatus{
+			Count:   count,
+			Limit:   l.MaxPrefixes,
+			Percent: float64(count) * 100 / float64(l.MaxPrefixes),
+			Level:   l.level(count),
+			Action:  l.Action,
+		}
+	}
+	return status
+}
+
+// checkPrefixLimits compares the Adj-RIB-In of a peer against its limits and
+// queues an event for every family whose level changed. Callers must hold
+// peer.mu and release it with unlockPeer.
+func (m *Monitor) checkPrefixLimits(peer *PeerState) {
+	if len(peer.Config.PrefixLimits) == 0 {
+		return
+	}
+	if peer.limitLevels == nil {
+		peer.limitLevels = make(map[string]string)
+	}
+
+	now := time.Now()
+	for family, status := range peer.limitStatus() {
+		previous, ok := peer.limitLevels[family]
+		if !ok {
+			previous = LimitOK
+		}
+		if status.Level == previous {
+			continue
+		}
+		peer.limitLevels[family] = status.Level
+
+		peer.pending.limits = append(peer.pending.limits, &PrefixLimitEvent{
+			Timestamp:     now,
+			Peer:          peer.Address,
+			PeerASN:       peer.ASN,
+			Family:        family,
+			Count:         status.Count,
+			Limit:         status.Limit,
+			Percent:       status.Percent,
+			Level:         status.Level,
+			PreviousLevel: previous,
+			Action:        status.Action,
+		})
+	}
+}
+
+// String describes the threshold crossing, e.g. for a shutdown communication
+func (e *PrefixLimitEvent) String() string {
+	return fmt.Sprintf("%s prefix limit %s: %d of %d prefixes (%.0f%%)",
+		e.Family, e.Level, e.Count, e.Limit, e.Percent)
+}
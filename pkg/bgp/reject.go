@@ -0,0 +1,293 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Prefix of the per-peer policies that reject individual prefixes, used for
+// RPKI-invalid, dampened and hijacked routes
+const rejectPolicyPrefix = "netmeta-reject-"
+
+// RejectPrefix stops accepting a prefix from a peer through a per-peer
+// import reject policy, leaving the rest of its routes in place. An empty
+// address rejects the prefix from every peer that currently announces it.
+func (m *Monitor) RejectPrefix(address, prefix string) error {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid prefix %q: %w", prefix, err)
+	}
+	p = p.Masked()
+
+	peers := []string{address}
+	if address == "" {
+		peers = m.peersWithPrefix(p.String())
+		if len(peers) == 0 {
+			return fmt.Errorf("no peer announces %s", p)
+		}
+	}
+
+	for _, addr := range peers {
+		if err := m.RejectPrefixes(addr, []string{p.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Monitor) peersWithPrefix(prefix string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	peers := make([]string, 0)
+	for _, peer := range m.peers {
+		peer.mu.RLock()
+		if _, ok := peer.routes.routes[prefix]; ok && peer.Source == SourceBGP {
+			peers = append(peers, peer.Address)
+		}
+		peer.mu.RUnlock()
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// RejectPrefixes adds several prefixes to a peer's reject policy with a
+// single soft reset
+func (m *Monitor) RejectPrefixes(address string, prefixes []string) error {
+	sets, err := rejectPrefixSets(address, prefixes)
+	if err != nil || len(sets) == 0 {
+		return err
+	}
+
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("peer %s not found", address)
+	}
+	if peer.Source != SourceBGP {
+		return fmt.Errorf("peer %s is monitored through %s and cannot be filtered", address, strings.ToUpper(peer.Source))
+	}
+
+	ctx := context.Background()
+	for _, name := range sortedSetNames(sets) {
+		if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+			DefinedSet: sets[name],
+		}); err != nil {
+			return fmt.Errorf("failed to add prefixes to reject policy of %s: %w", address, err)
+		}
+		if err := m.ensureRejectPolicy(name, address); err != nil {
+			return err
+		}
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		return fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+	return nil
+}
+
+// AcceptPrefix removes a prefix from a peer's reject policy so that it is
+// accepted again
+func (m *Monitor) AcceptPrefix(address, prefix string) error {
+	return m.AcceptPrefixes(address, []string{prefix})
+}
+
+// AcceptPrefixes removes several prefixes from a peer's reject policy with
+// a single soft reset
+func (m *Monitor) AcceptPrefixes(address string, prefixes []string) error {
+	sets, err := rejectPrefixSets(address, prefixes)
+	if err != nil || len(sets) == 0 {
+		return err
+	}
+
+	m.mu.RLock()
+	for name, set := range sets {
+		if !m.rejectPolicies[name] {
+			m.mu.RUnlock()
+			return fmt.Errorf("%s is not rejected from %s", set.Prefixes[0].IpPrefix, address)
+		}
+	}
+	m.mu.RUnlock()
+
+	ctx := context.Background()
+	for _, name := range sortedSetNames(sets) {
+		if err := m.server.DeleteDefinedSet(ctx, &api.DeleteDefinedSetRequest{
+			DefinedSet: sets[name],
+		}); err != nil {
+			return fmt.Errorf("failed to remove prefixes from reject policy of %s: %w", address, err)
+		}
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		return fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+	return nil
+}
+
+// rejectPrefixSets groups prefixes into the reject prefix-sets of a peer,
+// one per address family
+func rejectPrefixSets(address string, prefixes []string) (map[string]*api.DefinedSet, error) {
+	sets := make(map[string]*api.DefinedSet)
+	for _, prefix := range prefixes {
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q: %w", prefix, err)
+		}
+		p = p.Masked()
+
+		name := rejectPolicyName(address, p)
+		set, ok := sets[name]
+		if !ok {
+			set = &api.DefinedSet{DefinedType: api.DefinedType_PREFIX, Name: name}
+			sets[name] = set
+		}
+		set.Prefixes = append(set.Prefixes, &api.Prefix{
+			IpPrefix:      p.String(),
+			MaskLengthMin: uint32(p.Bits()),
+			MaskLengthMax: uint32(p.Bits()),
+		})
+	}
+	return sets, nil
+}
+
+func sortedSetNames(sets map[string]*api.DefinedSet) []string {
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rejectPolicyName names the reject policy of a peer for the family of a
+// prefix. Prefix-sets cannot mix address families, so each peer gets one
+// neighbor-set, prefix-set, statement and policy per family, all sharing the
+// same name.
+func rejectPolicyName(address string, prefix netip.Prefix) string {
+	family := "v4"
+	if prefix.Addr().Is6() {
+		family = "v6"
+	}
+	return rejectPolicyPrefix + strings.NewReplacer(".", "_", ":", "_").Replace(address) + "-" + family
+}
+
+// ensureRejectPolicy installs the global import policy that rejects the
+// prefixes in a peer's reject prefix-set
+func (m *Monitor) ensureRejectPolicy(name, address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rejectPolicies[name] {
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        name,
+			List:        []string{neighborSetEntry(address)},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create reject neighbor-set for %s: %w", address, err)
+	}
+
+	if err := m.server.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{
+			Name: name,
+			Statements: []*api.Statement{
+				{
+					Name: name,
+					Conditions: &api.Conditions{
+						NeighborSet: &api.MatchSet{
+							Type: api.MatchSet_ANY,
+							Name: name,
+						},
+						PrefixSet: &api.MatchSet{
+							Type: api.MatchSet_ANY,
+							Name: name,
+						},
+					},
+					Actions: &api.Actions{
+						RouteAction: api.RouteAction_REJECT,
+					},
+				},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create reject policy for %s: %w", address, err)
+	}
+
+	// Appended to the global import policies, keeping the default action
+	// configured in bgp.global
+	if err := m.server.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+		Assignment: &api.PolicyAssignment{
+			Name:          "global",
+			Direction:     api.PolicyDirection_IMPORT,
+			Policies:      []*api.Policy{{Name: name}},
+			DefaultAction: api.RouteAction_NONE,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to assign reject policy for %s: %w", address, err)
+	}
+
+	m.rejectPolicies[name] = true
+	return nil
+}
+
+// deleteRejectPolicies removes the reject policies of a peer along with
+// their sets. The caller holds m.mu.
+func (m *Monitor) deleteRejectPolicies(address string) error {
+	ctx := context.Background()
+	for _, all := range []netip.Prefix{
+		netip.PrefixFrom(netip.IPv4Unspecified(), 0),
+		netip.PrefixFrom(netip.IPv6Unspecified(), 0),
+	} {
+		name := rejectPolicyName(address, all)
+		if !m.rejectPolicies[name] {
+			continue
+		}
+
+		if err := m.server.DeletePolicyAssignment(ctx, &api.DeletePolicyAssignmentRequest{
+			Assignment: &api.PolicyAssignment{
+				Name:      "global",
+				Direction: api.PolicyDirection_IMPORT,
+				Policies:  []*api.Policy{{Name: name}},
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to unassign reject policy for %s: %w", address, err)
+		}
+		if err := m.server.DeletePolicy(ctx, &api.DeletePolicyRequest{
+			Policy: &api.Policy{Name: name},
+			All:    true,
+		}); err != nil {
+			return fmt.Errorf("failed to delete reject policy for %s: %w", address, err)
+		}
+		for _, typ := range []api.DefinedType{api.DefinedType_NEIGHBOR, api.DefinedType_PREFIX} {
+			if err := m.server.DeleteDefinedSet(ctx, &api.DeleteDefinedSetRequest{
+				DefinedSet: &api.DefinedSet{DefinedType: typ, Name: name},
+				All:        true,
+			}); err != nil {
+				return fmt.Errorf("failed to delete reject sets for %s: %w", address, err)
+			}
+		}
+
+		delete(m.rejectPolicies, name)
+	}
+	return nil
+}
@@ -0,0 +1,469 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/apiutil"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// Route is a single path in a peer's Adj-RIB-In or Adj-RIB-Out
+type Route struct {
+	Prefix              string
+	Family              string
+	NextHop             string
+	ASPath              []uint32
+	OriginAS            uint32
+	Origin              string
+	MED                 uint32
+	LocalPref           uint32
+	Communities         []string
+	ExtendedCommunities []string
+	LargeCommunities    []string
+	Received            time.Time
+	Validation          rpki.State
+	PathValidation      rpki.State
+	Anomalies           []Anomaly
+	RD                  string
+	VRFs                []string
+
+	nlri  bgp.AddrPrefixInterface
+	attrs []bgp.PathAttributeInterface
+}
+
+// MatchType selects how a prefix filter is compared against routes
+type MatchType string
+
+const (
+	MatchExact   MatchType = "exact"
+	MatchLonger  MatchType = "longer"
+	MatchShorter MatchType = "shorter"
+)
+
+// RIB directions
+const (
+	RIBIn  = "in"
+	RIBOut = "out"
+)
+
+func newRoute(nlri bgp.AddrPrefixInterface, attrs []bgp.PathAttributeInterface, received time.Time) *Route {
+	r := &Route{
+		Prefix:   nlri.String(),
+		Family:   bgp.AfiSafiToRouteFamily(nlri.AFI(), nlri.SAFI()).String(),
+		RD:       routeDistinguisher(nlri),
+		Received: received,
+		nlri:     nlri,
+		attrs:    attrs,
+	}
+
+	for _, attr := range attrs {
+		switch a := attr.(type) {
+		case *bgp.PathAttributeOrigin:
+			switch a.Value {
+			case bgp.BGP_ORIGIN_ATTR_TYPE_IGP:
+				r.Origin = "igp"
+			case bgp.BGP_ORIGIN_ATTR_TYPE_EGP:
+				r.Origin = "egp"
+			default:
+				r.Origin = "incomplete"
+			}
+		case *bgp.PathAttributeAsPath:
+			for _, param := range a.Value {
+				r.ASPath = append(r.ASPath, param.GetAS()...)
+			}
+			// The origin is only known if the path ends in an AS_SEQUENCE
+			if n := len(a.Value); n > 0 && a.Value[n-1].GetType() == bgp.BGP_ASPATH_ATTR_TYPE_SEQ {
+				if asns := a.Value[n-1].GetAS(); len(asns) > 0 {
+					r.OriginAS = asns[len(asns)-1]
+				}
+			}
+		case *bgp.PathAttributeNextHop:
+			r.NextHop = a.Value.String()
+		case *bgp.PathAttributeMpReachNLRI:
+			r.NextHop = a.Nexthop.String()
+		case *bgp.PathAttributeMultiExitDisc:
+			r.MED = a.Value
+		case *bgp.PathAttributeLocalPref:
+			r.LocalPref = a.Value
+		case *bgp.PathAttributeCommunities:
+			for _, c := range a.Value {
+				r.Communities = append(r.Communities, formatCommunity(c))
+			}
+		case *bgp.PathAttributeExtendedCommunities:
+			for _, c := range a.Value {
+				r.ExtendedCommunities = append(r.ExtendedCommunities, c.String())
+			}
+		case *bgp.PathAttributeLargeCommunities:
+			for _, c := range a.Values {
+				r.LargeCommunities = append(r.LargeCommunities, c.String())
+			}
+		}
+	}
+
+	return r
+}
+
+// routeFromPath converts a GoBGP API path into a Route
+func routeFromPath(path *api.Path) (*Route, error) {
+	var nlri bgp.AddrPrefixInterface
+	var attrs []bgp.PathAttributeInterface
+	var err error
+	if path.GetFamily().GetAfi() == api.Family_AFI_LS {
+		nlri, attrs, err = lsFromPath(path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		nlri, err = apiutil.GetNativeNlri(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode NLRI: %w", err)
+		}
+		attrs, err = apiutil.GetNativePathAttributes(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode path attributes: %w", err)
+		}
+	}
+
+	received := time.Now()
+	if path.Age != nil {
+		received = path.Age.AsTime()
+	}
+
+	return newRoute(nlri, attrs, received), nil
+}
+
+// ribTable is a RIB keyed by NLRI that keeps a route count per family, per
+// origin validation and path verification state, per anomaly type and per
+// VRF and family
+type ribTable struct {
+	routes         map[string]*Route
+	counts         map[string]int64
+	validation     map[rpki.State]int64
+	pathValidation map[rpki.State]int64
+	anomalies      map[string]int64
+	vrfs           map[vrfFamily]int64
+}
+
+type vrfFamily struct {
+	vrf    string
+	family string
+}
+
+func newRIBTable() *ribTable {
+	return &ribTable{
+		routes:         make(map[string]*Route),
+		counts:         make(map[string]int64),
+		validation:     make(map[rpki.State]int64),
+		pathValidation: make(map[rpki.State]int64),
+		anomalies:      make(map[string]int64),
+		vrfs:           make(map[vrfFamily]int64),
+	}
+}
+
+// insert adds or replaces a route and returns the route it replaced, if any
+func (t *ribTable) insert(route *Route) *Route {
+	old := t.remove(route.Prefix)
+	t.routes[route.Prefix] = route
+	t.counts[route.Family]++
+	if route.Validation != "" {
+		t.validation[route.Validation]++
+	}
+	if route.PathValidation != "" {
+		t.pathValidation[route.PathValidation]++
+	}
+	for _, a := range route.Anomalies {
+		t.anomalies[a.Type]++
+	}
+	for _, v := range route.VRFs {
+		t.vrfs[vrfFamily{v, route.Family}]++
+	}
+	return old
+}
+
+// remove deletes a route and returns it, or nil if it was not present
+func (t *ribTable) remove(key string) *Route {
+	old, ok := t.routes[key]
+	if !ok {
+		return nil
+	}
+	delete(t.routes, key)
+	t.counts[old.Family]--
+	if old.Validation != "" {
+		t.validation[old.Validation]--
+	}
+	if old.PathValidation != "" {
+		t.pathValidation[old.PathValidation]--
+	}
+	for _, a := range old.Anomalies {
+		t.anomalies[a.Type]--
+	}
+	for _, v := range old.VRFs {
+		t.vrfs[vrfFamily{v, old.Family}]--
+	}
+	return old
+}
+
+// revalidate updates the validation state of every route. Routes are
+// replaced rather than modified since callers may hold on to them.
+func (t *ribTable) revalidate(table *rpki.Table) {
+	for _, route := range t.routes {
+		state := validateRoute(table, route)
+		if state == route.Validation {
+			continue
+		}
+		updated := *route
+		updated.Validation = state
+		t.insert(&updated)
+	}
+}
+
+func (t *ribTable) len() int {
+	return len(t.routes)
+}
+
+// applyUpdate applies the announcements and withdrawals of a BGP UPDATE to
+// the Adj-RIB-In of a peer, or to its Adj-RIB-Out if out is set. Callers
+// must hold peer.mu and release it with unlockPeer.
+func (m *Monitor) applyUpdate(peer *PeerState, out bool, update *bgp.BGPUpdate, received time.Time) {
+	rib := peer.routes
+	if out {
+		rib = peer.routesOut
+	}
+
+	if eor, family := update.IsEndOfRib(); eor {
+		if !out {
+			m.endOfRIB(peer, family, received)
+		}
+		return
+	}
+
+	var announcements, withdrawals int64
+
+	withdraw := func(key string) {
+		withdrawals++
+		old := rib.remove(key)
+		if !out {
+			m.dampening.withdraw(peer.Address, old, received)
+			peer.countVRFWithdrawal(old)
+		}
+	}
+	announce := func(prefix bgp.AddrPrefixInterface) {
+		announcements++
+		route := newRoute(prefix, update.PathAttributes, received)
+		m.validate(route)
+		m.assignVRFs(route)
+		if !out {
+			m.verifyPath(peer, route)
+			m.inspect(peer, route)
+		}
+		old := rib.insert(route)
+		if !out {
+			m.dampening.announce(peer.Address, old, route, received)
+		}
+	}
+
+	for _, prefix := range update.WithdrawnRoutes {
+		withdraw(prefix.String())
+	}
+
+	for _, attr := range update.PathAttributes {
+		if a, ok := attr.(*bgp.PathAttributeMpUnreachNLRI); ok {
+			for _, prefix := range a.Value {
+				withdraw(prefix.String())
+			}
+		}
+	}
+
+	for _, prefix := range update.NLRI {
+		announce(prefix)
+	}
+
+	for _, attr := range update.PathAttributes {
+		if a, ok := attr.(*bgp.PathAttributeMpReachNLRI); ok {
+			for _, prefix := range a.Value {
+				announce(prefix)
+			}
+		}
+	}
+
+	if !out {
+		peer.PrefixCount = int64(rib.len())
+		m.countUpdate(peer, announcements, withdrawals, received)
+	}
+}
+
+// ListAdjRIBIn returns the routes received from a peer, optionally filtered
+// by prefix
+func (m *Monitor) ListAdjRIBIn(address, prefix string, match MatchType) ([]*Route, error) {
+	filter, err := newPrefixFilter(prefix, match)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+
+	peer.mu.RLock()
+	routes := filter.apply(peer.routes.routes)
+	peer.mu.RUnlock()
+
+	return routes, nil
+}
+
+// ListAdjRIBOut returns the routes advertised to a peer, optionally filtered
+// by prefix
+func (m *Monitor) ListAdjRIBOut(address, prefix string, match MatchType) ([]*Route, error) {
+	filter, err := newPrefixFilter(prefix, match)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+
+	// BMP peers only have an Adj-RIB-Out if the router reports one (RFC 8671),
+	// MRT peers if the archive contains locally sent updates
+	if peer.Source != SourceBGP {
+		peer.mu.RLock()
+		routes := filter.apply(peer.routesOut.routes)
+		peer.mu.RUnlock()
+		return routes, nil
+	}
+
+	rib := make(map[string]*Route)
+	for _, family := range peer.apiFamilies() {
+		req := &api.ListPathRequest{
+			TableType: api.TableType_ADJ_OUT,
+			Name:      address,
+			Family:    family,
+		}
+
+		var convErr error
+		err := m.server.ListPath(context.Background(), req, func(d *api.Destination) {
+			for _, path := range d.Paths {
+				route, err := routeFromPath(path)
+				if err != nil {
+					convErr = err
+					continue
+				}
+				rib[route.Prefix] = route
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Adj-RIB-Out of %s: %w", address, err)
+		}
+		if convErr != nil {
+			return nil, convErr
+		}
+	}
+
+	return filter.apply(rib), nil
+}
+
+type prefixFilter struct {
+	prefix netip.Prefix
+	raw    string
+	match  MatchType
+}
+
+func newPrefixFilter(prefix string, match MatchType) (*prefixFilter, error) {
+	if match == "" {
+		match = MatchExact
+	}
+	switch match {
+	case MatchExact, MatchLonger, MatchShorter:
+	default:
+		return nil, fmt.Errorf("invalid match type %q (must be exact, longer or shorter)", match)
+	}
+
+	f := &prefixFilter{raw: prefix, match: match}
+	if prefix == "" {
+		return f, nil
+	}
+
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	f.prefix = p
+	return f, nil
+}
+
+func (f *prefixFilter) apply(rib map[string]*Route) []*Route {
+	routes := make([]*Route, 0)
+	for _, route := range rib {
+		if f.matches(route) {
+			routes = append(routes, route)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Family != routes[j].Family {
+			return routes[i].Family < routes[j].Family
+		}
+		return routes[i].Prefix < routes[j].Prefix
+	})
+	return routes
+}
+
+func (f *prefixFilter) matches(route *Route) bool {
+	if f.raw == "" {
+		return true
+	}
+
+	// VPN routes are matched on their IP prefix, regardless of the RD
+	p, err := netip.ParsePrefix(strings.TrimPrefix(route.Prefix, route.RD+":"))
+	if err != nil {
+		// Non-IP NLRI can only be matched literally
+		return route.Prefix == f.raw
+	}
+	if p.Addr().Is4() != f.prefix.Addr().Is4() {
+		return false
+	}
+
+	switch f.match {
+	case MatchLonger:
+		return p.Bits() >= f.prefix.Bits() && f.prefix.Contains(p.Addr())
+	case MatchShorter:
+		return p.Bits() <= f.prefix.Bits() && p.Contains(f.prefix.Addr())
+	default:
+		return p == f.prefix
+	}
+}
+
+// parsePrefix parses a CIDR prefix, treating a bare address as a host route
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %w", s, err)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %w", s, err)
+	}
+	return p.Masked(), nil
+}
+
+func formatCommunity(c uint32) string {
+	return strconv.FormatUint(uint64(c>>16), 10) + ":" + strconv.FormatUint(uint64(c&0xffff), 10)
+}
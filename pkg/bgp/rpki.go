@@ -0,0 +1,126 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+)
+
+// RPKICounts holds the number of routes in a peer's Adj-RIB-In per route
+// origin validation state
+type RPKICounts struct {
+	Valid    int64
+	Invalid  int64
+	NotFound int64
+}
+
+// InvalidRoute is an RPKI-invalid route and the peer it was learned from
+type InvalidRoute struct {
+	Peer    string
+	PeerASN uint32
+	Route   *Route
+}
+
+// SetRPKI enables route origin validation against a VRP table. Every route
+// is revalidated whenever the table changes.
+func (m *Monitor) SetRPKI(table *rpki.Table) {
+	m.rpkiMu.Lock()
+	m.rpki = table
+	m.rpkiMu.Unlock()
+
+	table.OnChange(m.revalidate)
+	m.revalidate()
+}
+
+func (m *Monitor) rpkiTable() *rpki.Table {
+	m.rpkiMu.RLock()
+	defer m.rpkiMu.RUnlock()
+	return m.rpki
+}
+
+// validate sets the origin validation state of a route before it is stored.
+// Routes that are not plain IP prefixes are left unvalidated.
+func (m *Monitor) validate(route *Route) {
+	if table := m.rpkiTable(); table != nil {
+		route.Validation = validateRoute(table, route)
+	}
+}
+
+func validateRoute(table *rpki.Table, route *Route) rpki.State {
+	prefix, err := netip.ParsePrefix(route.Prefix)
+	if err != nil {
+		return ""
+	}
+	return table.Validate(prefix, route.OriginAS)
+}
+
+// revalidate reruns origin validation on every Adj-RIB-In
+func (m *Monitor) revalidate() {
+	table := m.rpkiTable()
+	if table == nil {
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, peer := range m.peers {
+		peer.mu.Lock()
+		if peer.routes != nil {
+			peer.routes.revalidate(table)
+		}
+		peer.mu.Unlock()
+	}
+}
+
+// rpkiCounts returns the validation counts of the Adj-RIB-In. Callers must
+// hold p.mu.
+func (p *PeerState) rpkiCounts() RPKICounts {
+	if p.routes == nil {
+		return RPKICounts{}
+	}
+	return RPKICounts{
+		Valid:    p.routes.validation[rpki.StateValid],
+		Invalid:  p.routes.validation[rpki.StateInvalid],
+		NotFound: p.routes.validation[rpki.StateNotFound],
+	}
+}
+
+// InvalidRoutes returns every RPKI-invalid route, optionally limited to one
+// peer
+func (m *Monitor) InvalidRoutes(address string) ([]*InvalidRoute, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	invalid := make([]*InvalidRoute, 0)
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		if peer.routes != nil && peer.routes.validation[rpki.StateInvalid] > 0 {
+			for _, route := range peer.routes.routes {
+				if route.Validation == rpki.StateInvalid {
+					invalid = append(invalid, &InvalidRoute{Peer: peer.Address, PeerASN: peer.ASN, Route: route})
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+
+	sort.Slice(invalid, func(i, j int) bool {
+		if invalid[i].Peer != invalid[j].Peer {
+			return invalid[i].Peer < invalid[j].Peer
+		}
+		return invalid[i].Route.Prefix < invalid[j].Route.Prefix
+	})
+	return invalid, nil
+}
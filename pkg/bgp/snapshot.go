@@ -0,0 +1,571 @@
+package bgp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+)
+
+// ErrNoSnapshot is returned when no RIB snapshot is old enough for a time
+var ErrNoSnapshot = errors.New("no RIB snapshot")
+
+// Key prefixes of RIB snapshots and of their summaries. Keys end in the
+// big-endian snapshot time in nanoseconds, so they sort chronologically.
+const (
+	snapshotKeyPrefix     = "bgp/rib/"
+	snapshotInfoKeyPrefix = "bgp/rib-info/"
+)
+
+// SnapshotStore is the key-value store RIB snapshots are persisted to
+type SnapshotStore interface {
+	Set(key, value []byte) error
+	Get(key []byte) ([]byte, error)
+	Delete(key []byte) error
+	Keys(prefix []byte) ([][]byte, error)
+}
+
+// SnapshotParams control periodic snapshots. Snapshots older than Retention
+// or beyond the newest MaxSnapshots are deleted; zero disables either limit.
+type SnapshotParams struct {
+	Interval     time.Duration
+	Retention    time.Duration
+	MaxSnapshots int
+}
+
+// SnapshotInfo describes a stored RIB snapshot
+type SnapshotInfo struct {
+	Time   time.Time
+	Peers  int
+	Routes int64
+	Bytes  int
+}
+
+// RIBSnapshot is the Adj-RIB-In of every peer at one point in time
+type RIBSnapshot struct {
+	Time  time.Time
+	Peers []*SnapshotPeer
+}
+
+// SnapshotPeer is a peer's Adj-RIB-In in a snapshot, sorted by prefix
+type SnapshotPeer struct {
+	Address string
+	ASN     uint32
+	Source  string
+	Routes  []*Route
+}
+
+// RIBDiff lists the routes added, removed and changed between two snapshots.
+// To is zero when compared against the current RIB.
+type RIBDiff struct {
+	From    time.Time
+	To      time.Time
+	Added   []*DiffRoute
+	Removed []*DiffRoute
+	Changed []*RouteChange
+}
+
+// DiffRoute is a route added to or removed from a peer's Adj-RIB-In
+type DiffRoute struct {
+	Peer  string
+	Route *Route
+}
+
+// RouteChange is a route whose attributes changed, with the names of the
+// attributes that did
+type RouteChange struct {
+	Peer    string
+	Prefix  string
+	Old     *Route
+	New     *Route
+	Changes []string
+}
+
+// Encoded snapshot. Routes sharing the same attributes, which most do, store
+// them once.
+type snapshotRecord struct {
+	Time  int64
+	Peers []snapshotPeer
+	Attrs []snapshotAttrs
+}
+
+type snapshotPeer struct {
+	Address string
+	ASN     uint32
+	Source  string
+	Routes  []snapshotRoute
+}
+
+type snapshotRoute struct {
+	Prefix   string
+	RD       string
+	Received int64
+	Attrs    int
+}
+
+type snapshotAttrs struct {
+	Family              string
+	NextHop             string
+	ASPath              []uint32
+	OriginAS            uint32
+	Origin              string
+	MED                 uint32
+	LocalPref           uint32
+	Communities         []string
+	ExtendedCommunities []string
+	LargeCommunities    []string
+	Validation          rpki.State
+	PathValidation      rpki.State
+	VRFs                []string
+}
+
+// SetSnapshots persists RIB snapshots to a store, taking one every interval
+// until the monitor is closed
+func (m *Monitor) SetSnapshots(store SnapshotStore, params SnapshotParams) {
+	m.snapshotMu.Lock()
+	m.snapshotStore = store
+	m.snapshotParams = params
+	m.snapshotMu.Unlock()
+
+	if params.Interval > 0 {
+		go m.takeSnapshots(params.Interval)
+	}
+}
+
+func (m *Monitor) snapshots() (SnapshotStore, SnapshotParams, error) {
+	m.snapshotMu.RLock()
+	defer m.snapshotMu.RUnlock()
+
+	if m.snapshotStore == nil {
+		return nil, SnapshotParams{}, fmt.Errorf("RIB snapshots are not enabled")
+	}
+	return m.snapshotStore, m.snapshotParams, nil
+}
+
+func (m *Monitor) takeSnapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.TakeSnapshot(); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+}
+
+// TakeSnapshot stores the current RIB and applies the retention limits
+func (m *Monitor) TakeSnapshot() (*SnapshotInfo, error) {
+	store, params, err := m.snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := m.currentRIB(time.Now())
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode RIB snapshot: %w", err)
+	}
+	info := snapshot.info()
+	info.Bytes = len(data)
+
+	var summary bytes.Buffer
+	if err := gob.NewEncoder(&summary).Encode(info); err != nil {
+		return nil, fmt.Errorf("failed to encode RIB snapshot: %w", err)
+	}
+	if err := store.Set(snapshotKey(snapshotKeyPrefix, snapshot.Time), data); err != nil {
+		return nil, fmt.Errorf("failed to store RIB snapshot: %w", err)
+	}
+	if err := store.Set(snapshotKey(snapshotInfoKeyPrefix, snapshot.Time), summary.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to store RIB snapshot: %w", err)
+	}
+
+	if err := pruneSnapshots(store, params, snapshot.Time); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ListSnapshots returns every stored snapshot, oldest first
+func (m *Monitor) ListSnapshots() ([]*SnapshotInfo, error) {
+	store, _, err := m.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.Keys([]byte(snapshotInfoKeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list RIB snapshots: %w", err)
+	}
+
+	infos := make([]*SnapshotInfo, 0, len(keys))
+	for _, key := range keys {
+		data, err := store.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RIB snapshot: %w", err)
+		}
+		var info SnapshotInfo
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&info); err != nil {
+			return nil, fmt.Errorf("failed to decode RIB snapshot: %w", err)
+		}
+		infos = append(infos, &info)
+	}
+	return infos, nil
+}
+
+// RIBAt returns the newest snapshot taken at or before a time, optionally
+// limited to one peer
+func (m *Monitor) RIBAt(at time.Time, peer string) (*RIBSnapshot, error) {
+	store, _, err := m.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.Keys([]byte(snapshotKeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list RIB snapshots: %w", err)
+	}
+
+	// Keys are in time order
+	i := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], snapshotKey(snapshotKeyPrefix, at)) > 0
+	})
+	if i == 0 {
+		return nil, fmt.Errorf("%w at or before %s", ErrNoSnapshot, at.UTC().Format(time.RFC3339))
+	}
+
+	snapshot, _, err := loadSnapshot(store, keys[i-1])
+	if err != nil {
+		return nil, err
+	}
+	snapshot.filter(peer)
+	return snapshot, nil
+}
+
+// DiffRIB compares the snapshots in effect at two times, or the snapshot in
+// effect at from with the current RIB when to is zero, optionally for one
+// peer
+func (m *Monitor) DiffRIB(from, to time.Time, peer string) (*RIBDiff, error) {
+	if !to.IsZero() && to.Before(from) {
+		return nil, fmt.Errorf("diff end %s is before its start %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	old, err := m.RIBAt(from, peer)
+	if err != nil {
+		return nil, err
+	}
+	var current *RIBSnapshot
+	if to.IsZero() {
+		current = m.currentRIB(time.Time{})
+		current.filter(peer)
+	} else if current, err = m.RIBAt(to, peer); err != nil {
+		return nil, err
+	}
+
+	return diffSnapshots(old, current), nil
+}
+
+// currentRIB copies the Adj-RIB-In of every peer. Routes are replaced rather
+// than modified once stored, so they are shared with the live RIB.
+func (m *Monitor) currentRIB(at time.Time) *RIBSnapshot {
+	snapshot := &RIBSnapshot{Time: at}
+
+	m.mu.RLock()
+	for _, peer := range m.peers {
+		p := &SnapshotPeer{Address: peer.Address, ASN: peer.ASN, Source: peer.Source}
+		peer.mu.RLock()
+		if peer.routes != nil {
+			p.Routes = make([]*Route, 0, peer.routes.len())
+			for _, route := range peer.routes.routes {
+				p.Routes = append(p.Routes, route)
+			}
+		}
+		peer.mu.RUnlock()
+		snapshot.Peers = append(snapshot.Peers, p)
+	}
+	m.mu.RUnlock()
+
+	snapshot.sort()
+	return snapshot
+}
+
+func (s *RIBSnapshot) sort() {
+	sort.Slice(s.Peers, func(i, j int) bool {
+		return s.Peers[i].Address < s.Peers[j].Address
+	})
+	for _, p := range s.Peers {
+		sort.Slice(p.Routes, func(i, j int) bool {
+			return p.Routes[i].Prefix < p.Routes[j].Prefix
+		})
+	}
+}
+
+func (s *RIBSnapshot) filter(peer string) {
+	if peer == "" {
+		return
+	}
+	s.Peers = slices.DeleteFunc(s.Peers, func(p *SnapshotPeer) bool {
+		return p.Address != peer
+	})
+}
+
+func (s *RIBSnapshot) info() *SnapshotInfo {
+	info := &SnapshotInfo{Time: s.Time, Peers: len(s.Peers)}
+	for _, p := range s.Peers {
+		info.Routes += int64(len(p.Routes))
+	}
+	return info
+}
+
+func diffSnapshots(old, current *RIBSnapshot) *RIBDiff {
+	diff := &RIBDiff{
+		From:    old.Time,
+		To:      current.Time,
+		Added:   make([]*DiffRoute, 0),
+		Removed: make([]*DiffRoute, 0),
+		Changed: make([]*RouteChange, 0),
+	}
+
+	routes := func(s *RIBSnapshot) map[string]map[string]*Route {
+		byPeer := make(map[string]map[string]*Route, len(s.Peers))
+		for _, p := range s.Peers {
+			byPrefix := make(map[string]*Route, len(p.Routes))
+			for _, route := range p.Routes {
+				byPrefix[route.Prefix] = route
+			}
+			byPeer[p.Address] = byPrefix
+		}
+		return byPeer
+	}
+	before, after := routes(old), routes(current)
+
+	for peer, routes := range before {
+		for prefix, route := range routes {
+			if _, ok := after[peer][prefix]; !ok {
+				diff.Removed = append(diff.Removed, &DiffRoute{Peer: peer, Route: route})
+			}
+		}
+	}
+	for peer, routes := range after {
+		for prefix, route := range routes {
+			prev, ok := before[peer][prefix]
+			if !ok {
+				diff.Added = append(diff.Added, &DiffRoute{Peer: peer, Route: route})
+				continue
+			}
+			if changes := routeChanges(prev, route); len(changes) > 0 {
+				diff.Changed = append(diff.Changed, &RouteChange{
+					Peer: peer, Prefix: prefix, Old: prev, New: route, Changes: changes,
+				})
+			}
+		}
+	}
+
+	byPeerPrefix := func(routes []*DiffRoute) {
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Peer != routes[j].Peer {
+				return routes[i].Peer < routes[j].Peer
+			}
+			return routes[i].Route.Prefix < routes[j].Route.Prefix
+		})
+	}
+	byPeerPrefix(diff.Added)
+	byPeerPrefix(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		if diff.Changed[i].Peer != diff.Changed[j].Peer {
+			return diff.Changed[i].Peer < diff.Changed[j].Peer
+		}
+		return diff.Changed[i].Prefix < diff.Changed[j].Prefix
+	})
+	return diff
+}
+
+// routeChanges names the attributes that differ between two routes
+func routeChanges(old, new *Route) []string {
+	var changes []string
+	for _, attr := range []struct {
+		name    string
+		changed bool
+	}{
+		{"next-hop", old.NextHop != new.NextHop},
+		{"as-path", !slices.Equal(old.ASPath, new.ASPath)},
+		{"origin", old.Origin != new.Origin},
+		{"med", old.MED != new.MED},
+		{"local-pref", old.LocalPref != new.LocalPref},
+		{"communities", !slices.Equal(old.Communities, new.Communities)},
+		{"extended-communities", !slices.Equal(old.ExtendedCommunities, new.ExtendedCommunities)},
+		{"large-communities", !slices.Equal(old.LargeCommunities, new.LargeCommunities)},
+		{"rpki", old.Validation != new.Validation},
+		{"aspa", old.PathValidation != new.PathValidation},
+		{"vrfs", !slices.Equal(old.VRFs, new.VRFs)},
+	} {
+		if attr.changed {
+			changes = append(changes, attr.name)
+		}
+	}
+	return changes
+}
+
+func snapshotKey(prefix string, at time.Time) []byte {
+	return binary.BigEndian.AppendUint64([]byte(prefix), uint64(at.UnixNano()))
+}
+
+func snapshotTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[len(key)-8:])))
+}
+
+// pruneSnapshots deletes the snapshots outside the retention limits
+func pruneSnapshots(store SnapshotStore, params SnapshotParams, now time.Time) error {
+	keys, err := store.Keys([]byte(snapshotKeyPrefix))
+	if err != nil {
+		return fmt.Errorf("failed to list RIB snapshots: %w", err)
+	}
+
+	for i, key := range keys {
+		expired := params.Retention > 0 && now.Sub(snapshotTime(key)) > params.Retention
+		excess := params.MaxSnapshots > 0 && len(keys)-i > params.MaxSnapshots
+		if !expired && !excess {
+			break
+		}
+		if err := store.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete RIB snapshot: %w", err)
+		}
+		if err := store.Delete(snapshotKey(snapshotInfoKeyPrefix, snapshotTime(key))); err != nil {
+			return fmt.Errorf("failed to delete RIB snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadSnapshot(store SnapshotStore, key []byte) (*RIBSnapshot, int, error) {
+	data, err := store.Get(key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read RIB snapshot: %w", err)
+	}
+	snapshot, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode RIB snapshot %s: %w",
+			snapshotTime(key).UTC().Format(time.RFC3339), err)
+	}
+	return snapshot, len(data), nil
+}
+
+// encodeSnapshot writes a snapshot as gzip-compressed gob, with every
+// distinct attribute set stored once
+func encodeSnapshot(s *RIBSnapshot) ([]byte, error) {
+	record := snapshotRecord{Time: s.Time.UnixNano()}
+	index := make(map[string]int)
+
+	for _, p := range s.Peers {
+		peer := snapshotPeer{Address: p.Address, ASN: p.ASN, Source: p.Source, Routes: make([]snapshotRoute, 0, len(p.Routes))}
+		for _, route := range p.Routes {
+			attrs := snapshotAttrs{
+				Family:              route.Family,
+				NextHop:             route.NextHop,
+				ASPath:              route.ASPath,
+				OriginAS:            route.OriginAS,
+				Origin:              route.Origin,
+				MED:                 route.MED,
+				LocalPref:           route.LocalPref,
+				Communities:         route.Communities,
+				ExtendedCommunities: route.ExtendedCommunities,
+				LargeCommunities:    route.LargeCommunities,
+				Validation:          route.Validation,
+				PathValidation:      route.PathValidation,
+				VRFs:                route.VRFs,
+			}
+			key := attrs.key()
+			i, ok := index[key]
+			if !ok {
+				i = len(record.Attrs)
+				index[key] = i
+				record.Attrs = append(record.Attrs, attrs)
+			}
+			r := snapshotRoute{Prefix: route.Prefix, RD: route.RD, Attrs: i}
+			if !route.Received.IsZero() {
+				r.Received = route.Received.UnixNano()
+			}
+			peer.Routes = append(peer.Routes, r)
+		}
+		record.Peers = append(record.Peers, peer)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(zw).Encode(&record); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshot(data []byte) (*RIBSnapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var record snapshotRecord
+	if err := gob.NewDecoder(zr).Decode(&record); err != nil {
+		return nil, err
+	}
+
+	s := &RIBSnapshot{Time: time.Unix(0, record.Time)}
+	for _, p := range record.Peers {
+		peer := &SnapshotPeer{Address: p.Address, ASN: p.ASN, Source: p.Source, Routes: make([]*Route, 0, len(p.Routes))}
+		for _, r := range p.Routes {
+			if r.Attrs < 0 || r.Attrs >= len(record.Attrs) {
+				return nil, fmt.Errorf("route %s references missing attributes", r.Prefix)
+			}
+			a := record.Attrs[r.Attrs]
+			route := &Route{
+				Prefix:              r.Prefix,
+				Family:              a.Family,
+				NextHop:             a.NextHop,
+				ASPath:              a.ASPath,
+				OriginAS:            a.OriginAS,
+				Origin:              a.Origin,
+				MED:                 a.MED,
+				LocalPref:           a.LocalPref,
+				Communities:         a.Communities,
+				ExtendedCommunities: a.ExtendedCommunities,
+				LargeCommunities:    a.LargeCommunities,
+				Validation:          a.Validation,
+				PathValidation:      a.PathValidation,
+				RD:                  r.RD,
+				VRFs:                a.VRFs,
+			}
+			if r.Received != 0 {
+				route.Received = time.Unix(0, r.Received)
+			}
+			peer.Routes = append(peer.Routes, route)
+		}
+		s.Peers = append(s.Peers, peer)
+	}
+	return s, nil
+}
+
+// key identifies an attribute set for deduplication
+func (a *snapshotAttrs) key() string {
+	return strings.Join([]string{
+		a.Family, a.NextHop, formatPath(a.ASPath), a.Origin,
+		fmt.Sprint(a.MED), fmt.Sprint(a.LocalPref),
+		strings.Join(a.Communities, " "),
+		strings.Join(a.ExtendedCommunities, " "),
+		strings.Join(a.LargeCommunities, " "),
+		string(a.Validation), string(a.PathValidation),
+		strings.Join(a.VRFs, " "),
+	}, "|")
+}
@@ -0,0 +1,223 @@
+package bgp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namesarnav/netmeta/pkg/rpki"
+)
+
+// memSnapshotStore keeps snapshots in memory, listing keys in order like
+// the on-disk store
+type memSnapshotStore map[string][]byte
+
+func (s memSnapshotStore) Set(key, value []byte) error    { s[string(key)] = value; return nil }
+func (s memSnapshotStore) Get(key []byte) ([]byte, error) { return s[string(key)], nil }
+func (s memSnapshotStore) Delete(key []byte) error        { delete(s, string(key)); return nil }
+
+func (s memSnapshotStore) Keys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	for key := range s {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, []byte(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+func TestEncodeSnapshot(t *testing.T) {
+	attrs := func(prefix string, received time.Time) *Route {
+		return &Route{
+			Prefix:              prefix,
+			Family:              "ipv4-unicast",
+			NextHop:             "192.0.2.1",
+			ASPath:              []uint32{64500, 64501},
+			OriginAS:            64501,
+			Origin:              "igp",
+			MED:                 10,
+			LocalPref:           200,
+			Communities:         []string{"64500:1"},
+			ExtendedCommunities: []string{"rt:64500:100"},
+			LargeCommunities:    []string{"64500:1:2"},
+			Received:            received,
+			Validation:          rpki.StateValid,
+			PathValidation:      rpki.StateUnknown,
+		}
+	}
+	vpn := attrs("198.51.100.0/24", mrtTime)
+	vpn.Family = "l3vpn-ipv4-unicast"
+	vpn.RD = "64500:100"
+	vpn.VRFs = []string{"blue"}
+
+	s := &RIBSnapshot{
+		Time: mrtTime,
+		Peers: []*SnapshotPeer{
+			{Address: "192.0.2.1", ASN: 64500, Source: SourceBGP, Routes: []*Route{
+				attrs("198.51.100.0/24", mrtTime),
+				attrs("203.0.113.0/24", mrtTime.Add(time.Minute)),
+				vpn,
+			}},
+			{Address: "192.0.2.2", ASN: 64510, Source: SourceMRT, Routes: []*Route{
+				attrs("198.51.100.0/24", time.Time{}),
+				{Prefix: "2001:db8::/32", Family: "ipv6-unicast", NextHop: "2001:db8::1", Origin: "incomplete"},
+			}},
+			{Address: "192.0.2.3", ASN: 64520, Source: SourceBMP},
+		},
+	}
+
+	data, err := encodeSnapshot(s)
+	if err != nil {
+		t.Fatalf("encodeSnapshot: %v", err)
+	}
+
+	// Routes with the same attributes share them, whatever their prefix and
+	// receive time
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record snapshotRecord
+	if err := gob.NewDecoder(zr).Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Attrs) != 3 {
+		t.Errorf("%d attribute sets stored, want 3", len(record.Attrs))
+	}
+
+	got, err := decodeSnapshot(data)
+	if err != nil {
+		t.Fatalf("decodeSnapshot: %v", err)
+	}
+	if !got.Time.Equal(s.Time) {
+		t.Errorf("time = %s, want %s", got.Time, s.Time)
+	}
+	if len(got.Peers) != len(s.Peers) {
+		t.Fatalf("%d peers decoded, want %d", len(got.Peers), len(s.Peers))
+	}
+	for i, want := range s.Peers {
+		peer := got.Peers[i]
+		if peer.Address != want.Address || peer.ASN != want.ASN || peer.Source != want.Source {
+			t.Errorf("peer %d = %s AS%d via %s, want %s AS%d via %s", i, peer.Address, peer.ASN, peer.Source, want.Address, want.ASN, want.Source)
+		}
+		if len(peer.Routes) != len(want.Routes) {
+			t.Errorf("peer %s has %d routes, want %d", want.Address, len(peer.Routes), len(want.Routes))
+			continue
+		}
+		for j, route := range peer.Routes {
+			if !route.Received.Equal(want.Routes[j].Received) {
+				t.Errorf("route %s received at %s, want %s", route.Prefix, route.Received, want.Routes[j].Received)
+			}
+			decoded, original := *route, *want.Routes[j]
+			decoded.Received, original.Received = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(decoded, original) {
+				t.Errorf("route decoded as %+v, want %+v", decoded, original)
+			}
+		}
+	}
+
+	if _, err := decodeSnapshot(data[:len(data)/2]); err == nil {
+		t.Error("decoding a truncated snapshot succeeded")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	route := func(prefix string, path ...uint32) *Route {
+		return &Route{Prefix: prefix, NextHop: "192.0.2.1", Origin: "igp", ASPath: path}
+	}
+	changed := route("203.0.113.0/24", 64500, 64502)
+	changed.MED = 10
+
+	old := &RIBSnapshot{Time: mrtTime, Peers: []*SnapshotPeer{
+		{Address: "192.0.2.1", Routes: []*Route{
+			route("198.51.100.0/24", 64500),
+			route("203.0.113.0/24", 64500, 64501),
+			route("192.0.2.0/24", 64500),
+		}},
+		{Address: "192.0.2.2", Routes: []*Route{route("198.51.100.0/24", 64510)}},
+	}}
+	current := &RIBSnapshot{Time: mrtTime.Add(time.Hour), Peers: []*SnapshotPeer{
+		{Address: "192.0.2.1", Routes: []*Route{
+			route("198.51.100.0/24", 64500),
+			changed,
+			route("233.252.0.0/24", 64500),
+		}},
+		{Address: "192.0.2.3", Routes: []*Route{route("198.51.100.0/24", 64520)}},
+	}}
+
+	diff := diffSnapshots(old, current)
+	if !diff.From.Equal(old.Time) || !diff.To.Equal(current.Time) {
+		t.Errorf("diff from %s to %s, want %s to %s", diff.From, diff.To, old.Time, current.Time)
+	}
+
+	format := func(routes []*DiffRoute) []string {
+		out := make([]string, 0, len(routes))
+		for _, r := range routes {
+			out = append(out, r.Peer+" "+r.Route.Prefix)
+		}
+		return out
+	}
+	// A prefix moving between peers is removed from one and added to the other
+	if got, want := format(diff.Added), []string{"192.0.2.1 233.252.0.0/24", "192.0.2.3 198.51.100.0/24"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("added = %v, want %v", got, want)
+	}
+	if got, want := format(diff.Removed), []string{"192.0.2.1 192.0.2.0/24", "192.0.2.2 198.51.100.0/24"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removed = %v, want %v", got, want)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("%d routes changed, want 1", len(diff.Changed))
+	}
+	if c := diff.Changed[0]; c.Peer != "192.0.2.1" || c.Prefix != "203.0.113.0/24" || !reflect.DeepEqual(c.Changes, []string{"as-path", "med"}) {
+		t.Errorf("changed = %s %s %v, want 192.0.2.1 203.0.113.0/24 [as-path med]", c.Peer, c.Prefix, c.Changes)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	now := mrtTime.Add(24 * time.Hour)
+	ages := []time.Duration{48 * time.Hour, 25 * time.Hour, 12 * time.Hour, 2 * time.Hour, time.Hour}
+
+	tests := []struct {
+		name   string
+		params SnapshotParams
+		kept   []time.Duration
+	}{
+		{name: "no limits", kept: ages},
+		{name: "retention", params: SnapshotParams{Retention: 24 * time.Hour}, kept: ages[2:]},
+		{name: "maximum count", params: SnapshotParams{MaxSnapshots: 2}, kept: ages[3:]},
+		{name: "count below retention", params: SnapshotParams{Retention: 24 * time.Hour, MaxSnapshots: 4}, kept: ages[2:]},
+		{name: "retention below count", params: SnapshotParams{Retention: 24 * time.Hour, MaxSnapshots: 1}, kept: ages[4:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memSnapshotStore{}
+			for _, age := range ages {
+				at := now.Add(-age)
+				store.Set(snapshotKey(snapshotKeyPrefix, at), []byte("rib"))
+				store.Set(snapshotKey(snapshotInfoKeyPrefix, at), []byte("info"))
+			}
+
+			if err := pruneSnapshots(store, tt.params, now); err != nil {
+				t.Fatalf("pruneSnapshots: %v", err)
+			}
+
+			// Summaries go with their snapshots
+			for _, prefix := range []string{snapshotKeyPrefix, snapshotInfoKeyPrefix} {
+				keys, _ := store.Keys([]byte(prefix))
+				kept := make([]time.Duration, 0, len(keys))
+				for _, key := range keys {
+					kept = append(kept, now.Sub(snapshotTime(key)))
+				}
+				if !reflect.DeepEqual(kept, tt.kept) {
+					t.Errorf("%s kept %v, want %v", prefix, kept, tt.kept)
+				}
+			}
+		})
+	}
+}
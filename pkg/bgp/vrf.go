@@ -0,0 +1,636 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// VRFUnassigned collects VPN routes that no VRF imports
+const VRFUnassigned = "(none)"
+
+// Prefix of the per-VRF policies that reject a peer's routes in one VRF
+const vrfWithdrawPolicyPrefix = "netmeta-withdraw-vrf-"
+
+// VRF names are used in GoBGP policy names and metric labels
+var vrfNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Families holding VPN routes
+var vpnFamilies = []*api.Family{
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN},
+	{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_MPLS_VPN},
+}
+
+// VRFConfig is a named VRF that imports the VPNv4 and VPNv6 routes carrying
+// any of its route targets
+type VRFConfig struct {
+	Name          string
+	ImportTargets []string
+}
+
+// VRFCounts holds a peer's routes in one VRF per family, and how many were
+// withdrawn
+type VRFCounts struct {
+	Prefixes    map[string]int64
+	Withdrawals int64
+}
+
+// VRFSummary is the content of one VRF across peers, with the routes split
+// by peer, family and route distinguisher
+type VRFSummary struct {
+	Name          string
+	ImportTargets []string
+	Prefixes      int64
+	Peers         map[string]VRFCounts
+	RDs           map[string]int64
+}
+
+// VRFRoute is a VPN route in a VRF as received from a peer
+type VRFRoute struct {
+	Peer  string
+	RD    string
+	Route *Route
+}
+
+type vrf struct {
+	name    string
+	targets []string
+}
+
+// ValidateVRF checks a VRF name and its route targets
+func ValidateVRF(cfg VRFConfig) error {
+	_, err := newVRF(cfg)
+	return err
+}
+
+func newVRF(cfg VRFConfig) (*vrf, error) {
+	if !vrfNameRe.MatchString(cfg.Name) {
+		return nil, fmt.Errorf("invalid VRF name %q (letters, digits, '.', '_' and '-' only)", cfg.Name)
+	}
+	if len(cfg.ImportTargets) == 0 {
+		return nil, fmt.Errorf("VRF %s has no import route targets", cfg.Name)
+	}
+
+	v := &vrf{name: cfg.Name}
+	for _, s := range cfg.ImportTargets {
+		rt, err := parseRouteTarget(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route target %q in VRF %s", s, cfg.Name)
+		}
+		// Compared in GoBGP's formatting, e.g. 4-byte ASNs in asdot
+		v.targets = append(v.targets, rt.String())
+	}
+	return v, nil
+}
+
+// parseRouteTarget parses a route target as ASN:value, asdot ASN:value or
+// IPv4:value. Unlike bgp.ParseRouteTarget, values that do not fit their
+// field are rejected instead of truncated.
+func parseRouteTarget(s string) (bgp.ExtendedCommunityInterface, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "rt:")
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	admin, value := s[:i], s[i+1:]
+
+	if addr, err := netip.ParseAddr(admin); err == nil && addr.Is4() {
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return bgp.NewIPv4AddressSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, admin, uint16(n), true), nil
+	}
+
+	var asn uint64
+	if high, low, ok := strings.Cut(admin, "."); ok {
+		h, err := strconv.ParseUint(high, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.ParseUint(low, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		asn = h<<16 | l
+	} else {
+		n, err := strconv.ParseUint(admin, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		asn = n
+		if asn <= 0xffff {
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			return bgp.NewTwoOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, uint16(asn), uint32(n), true), nil
+		}
+	}
+
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	return bgp.NewFourOctetAsSpecificExtended(bgp.EC_SUBTYPE_ROUTE_TARGET, uint32(asn), uint16(n), true), nil
+}
+
+// SetVRFs replaces the VRFs that VPN routes are imported into and
+// reassigns every received route
+func (m *Monitor) SetVRFs(configs []VRFConfig) error {
+	vrfs := make([]*vrf, 0, len(configs))
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		v, err := newVRF(cfg)
+		if err != nil {
+			return err
+		}
+		if seen[v.name] {
+			return fmt.Errorf("duplicate VRF %s", v.name)
+		}
+		seen[v.name] = true
+		vrfs = append(vrfs, v)
+	}
+
+	m.vrfMu.Lock()
+	m.vrfs = vrfs
+	m.vrfMu.Unlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, peer := range m.peers {
+		peer.mu.Lock()
+		for _, rib := range []*ribTable{peer.routes, peer.routesOut} {
+			if rib == nil {
+				continue
+			}
+			for _, route := range rib.routes {
+				if route.RD == "" {
+					continue
+				}
+				updated := *route
+				m.assignVRFs(&updated)
+				rib.insert(&updated)
+			}
+		}
+		peer.mu.Unlock()
+	}
+	return nil
+}
+
+func (m *Monitor) vrf(name string) (*vrf, error) {
+	m.vrfMu.RLock()
+	defer m.vrfMu.RUnlock()
+
+	for _, v := range m.vrfs {
+		if v.name == name {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("VRF %s not found", name)
+}
+
+// assignVRFs sets the VRFs that import a VPN route, or VRFUnassigned if
+// none does
+func (m *Monitor) assignVRFs(route *Route) {
+	if route.RD == "" {
+		return
+	}
+
+	targets := routeTargets(route)
+	route.VRFs = nil
+
+	m.vrfMu.RLock()
+	for _, v := range m.vrfs {
+		for _, rt := range v.targets {
+			if targets[rt] {
+				route.VRFs = append(route.VRFs, v.name)
+				break
+			}
+		}
+	}
+	m.vrfMu.RUnlock()
+
+	if len(route.VRFs) == 0 {
+		route.VRFs = []string{VRFUnassigned}
+	}
+}
+
+// routeTargets returns the route target extended communities of a route
+func routeTargets(route *Route) map[string]bool {
+	targets := make(map[string]bool)
+	for _, attr := range route.attrs {
+		ext, ok := attr.(*bgp.PathAttributeExtendedCommunities)
+		if !ok {
+			continue
+		}
+		for _, c := range ext.Value {
+			var subtype bgp.ExtendedCommunityAttrSubType
+			switch e := c.(type) {
+			case *bgp.TwoOctetAsSpecificExtended:
+				subtype = e.SubType
+			case *bgp.IPv4AddressSpecificExtended:
+				subtype = e.SubType
+			case *bgp.FourOctetAsSpecificExtended:
+				subtype = e.SubType
+			default:
+				continue
+			}
+			if subtype == bgp.EC_SUBTYPE_ROUTE_TARGET {
+				targets[c.String()] = true
+			}
+		}
+	}
+	return targets
+}
+
+// routeDistinguisher returns the RD of a VPNv4 or VPNv6 route
+func routeDistinguisher(nlri bgp.AddrPrefixInterface) string {
+	switch n := nlri.(type) {
+	case *bgp.LabeledVPNIPAddrPrefix:
+		return n.RD.String()
+	case *bgp.LabeledVPNIPv6AddrPrefix:
+		return n.RD.String()
+	}
+	return ""
+}
+
+// countVRFWithdrawal counts a withdrawn route against its VRFs. Callers
+// must hold p.mu.
+func (p *PeerState) countVRFWithdrawal(old *Route) {
+	if old == nil || len(old.VRFs) == 0 {
+		return
+	}
+	if p.vrfWithdrawals == nil {
+		p.vrfWithdrawals = make(map[string]int64)
+	}
+	for _, name := range old.VRFs {
+		p.vrfWithdrawals[name]++
+	}
+}
+
+// vrfCounts returns the Adj-RIB-In routes per VRF and family, and the
+// withdrawals per VRF. Callers must hold p.mu.
+func (p *PeerState) vrfCounts() map[string]VRFCounts {
+	counts := make(map[string]VRFCounts)
+	get := func(name string) VRFCounts {
+		c, ok := counts[name]
+		if !ok {
+			c = VRFCounts{Prefixes: make(map[string]int64), Withdrawals: p.vrfWithdrawals[name]}
+		}
+		return c
+	}
+
+	if p.routes != nil {
+		for key, n := range p.routes.vrfs {
+			if n == 0 {
+				continue
+			}
+			c := get(key.vrf)
+			c.Prefixes[key.family] = n
+			counts[key.vrf] = c
+		}
+	}
+	for name := range p.vrfWithdrawals {
+		counts[name] = get(name)
+	}
+	return counts
+}
+
+// VRFs returns every configured VRF, and the routes no VRF imports if
+// there are any, with their routes counted per peer, family and RD. An
+// address limits the counts to one peer.
+func (m *Monitor) VRFs(address string) ([]*VRFSummary, error) {
+	summaries := make(map[string]*VRFSummary)
+	m.vrfMu.RLock()
+	for _, v := range m.vrfs {
+		summaries[v.name] = newVRFSummary(v.name, v.targets)
+	}
+	m.vrfMu.RUnlock()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		for name, counts := range peer.vrfCounts() {
+			s, ok := summaries[name]
+			if !ok {
+				// VRFUnassigned, or a VRF removed since its routes
+				// were withdrawn
+				s = newVRFSummary(name, nil)
+				summaries[name] = s
+			}
+			s.Peers[peer.Address] = counts
+			for _, n := range counts.Prefixes {
+				s.Prefixes += n
+			}
+		}
+		if peer.routes != nil {
+			for _, route := range peer.routes.routes {
+				for _, name := range route.VRFs {
+					if s, ok := summaries[name]; ok {
+						s.RDs[route.RD]++
+					}
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+
+	vrfs := make([]*VRFSummary, 0, len(summaries))
+	for _, s := range summaries {
+		vrfs = append(vrfs, s)
+	}
+	sort.Slice(vrfs, func(i, j int) bool { return vrfs[i].Name < vrfs[j].Name })
+	return vrfs, nil
+}
+
+func newVRFSummary(name string, targets []string) *VRFSummary {
+	return &VRFSummary{
+		Name:          name,
+		ImportTargets: append([]string(nil), targets...),
+		Peers:         make(map[string]VRFCounts),
+		RDs:           make(map[string]int64),
+	}
+}
+
+// ListVRFRoutes returns the routes of a VRF from every peer, or from one
+// peer, optionally filtered by prefix regardless of their RD
+func (m *Monitor) ListVRFRoutes(name, address, prefix string, match MatchType) ([]*VRFRoute, error) {
+	if name != VRFUnassigned {
+		if _, err := m.vrf(name); err != nil {
+			return nil, err
+		}
+	}
+	filter, err := newPrefixFilter(prefix, match)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if address != "" {
+		if _, ok := m.peers[address]; !ok {
+			return nil, fmt.Errorf("peer %s not found", address)
+		}
+	}
+
+	routes := make([]*VRFRoute, 0)
+	for _, peer := range m.peers {
+		if address != "" && peer.Address != address {
+			continue
+		}
+		peer.mu.RLock()
+		for _, route := range filter.apply(peer.routes.routes) {
+			for _, v := range route.VRFs {
+				if v == name {
+					routes = append(routes, &VRFRoute{Peer: peer.Address, RD: route.RD, Route: route})
+					break
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Peer != routes[j].Peer {
+			return routes[i].Peer < routes[j].Peer
+		}
+		return routes[i].RD < routes[j].RD
+	})
+	return routes, nil
+}
+
+// WithdrawVRFPrefixes stops using the routes a peer sends for one VRF. The
+// peer is added to an import policy rejecting VPN routes that carry any of
+// the VRF's route targets and soft-reset inbound, leaving its routes in
+// other VRFs untouched unless they share a route target.
+func (m *Monitor) WithdrawVRFPrefixes(address, name string) (*WithdrawReport, error) {
+	v, err := m.vrf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+	if peer.Source != SourceBGP {
+		return nil, fmt.Errorf("peer %s is monitored through %s and cannot be withdrawn", address, strings.ToUpper(peer.Source))
+	}
+
+	report := &WithdrawReport{
+		Peer:      address,
+		Withdrawn: make(map[string][]string),
+		Failed:    make(map[string][]string),
+	}
+
+	// Remember what the peer sent us for the VRF before rejecting it
+	pending := make(map[string][]string)
+	peer.mu.RLock()
+	for _, route := range peer.routes.routes {
+		for _, n := range route.VRFs {
+			if n == name {
+				pending[route.Family] = append(pending[route.Family], route.Prefix)
+				break
+			}
+		}
+	}
+	peer.mu.RUnlock()
+
+	policy := vrfWithdrawPolicyPrefix + v.name
+	if err := m.ensureVRFWithdrawPolicy(v); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, err
+	}
+
+	ctx := context.Background()
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        policy,
+			List:        []string{neighborSetEntry(address)},
+		},
+	}); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, fmt.Errorf("failed to add %s to withdraw policy of VRF %s: %w", address, name, err)
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+
+	// Anything from this peer still in the global table was not withdrawn
+	remaining := make(map[string]bool)
+	for _, family := range vpnFamilies {
+		err := m.server.ListPath(ctx, &api.ListPathRequest{
+			TableType: api.TableType_GLOBAL,
+			Family:    family,
+		}, func(d *api.Destination) {
+			for _, path := range d.Paths {
+				if path.NeighborIp == address {
+					remaining[d.Prefix] = true
+				}
+			}
+		})
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to verify withdrawal: %v", err)
+		}
+	}
+
+	for family, prefixes := range pending {
+		for _, prefix := range prefixes {
+			if remaining[prefix] {
+				report.Failed[family] = append(report.Failed[family], prefix)
+			} else {
+				report.Withdrawn[family] = append(report.Withdrawn[family], prefix)
+			}
+		}
+	}
+
+	if len(report.Failed) > 0 {
+		failed := 0
+		for _, prefixes := range report.Failed {
+			failed += len(prefixes)
+		}
+		return report, fmt.Errorf("failed to withdraw %d prefixes of VRF %s from %s", failed, name, address)
+	}
+	return report, nil
+}
+
+// RestoreVRFPrefixes accepts the routes a peer sends for a VRF again
+func (m *Monitor) RestoreVRFPrefixes(address, name string) error {
+	v, err := m.vrf(name)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := m.server.DeleteDefinedSet(ctx, &api.DeleteDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        vrfWithdrawPolicyPrefix + v.name,
+			List:        []string{neighborSetEntry(address)},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to remove %s from withdraw policy of VRF %s: %w", address, name, err)
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		return fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+	return nil
+}
+
+// ensureVRFWithdrawPolicy installs the global import policy that rejects
+// VPN routes with the route targets of a VRF from every neighbor in its
+// withdraw neighbor-set
+func (m *Monitor) ensureVRFWithdrawPolicy(v *vrf) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := vrfWithdrawPolicyPrefix + v.name
+	if m.vrfPolicies[name] {
+		return nil
+	}
+
+	targets := make([]string, 0, len(v.targets))
+	for _, rt := range v.targets {
+		targets = append(targets, "rt:^"+regexp.QuoteMeta(rt)+"$")
+	}
+
+	ctx := context.Background()
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        name,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create withdraw neighbor-set of VRF %s: %w", v.name, err)
+	}
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_EXT_COMMUNITY,
+			Name:        name,
+			List:        targets,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create route target set of VRF %s: %w", v.name, err)
+	}
+
+	if err := m.server.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{
+			Name: name,
+			Statements: []*api.Statement{
+				{
+					Name: name,
+					Conditions: &api.Conditions{
+						NeighborSet: &api.MatchSet{
+							Type: api.MatchSet_ANY,
+							Name: name,
+						},
+						ExtCommunitySet: &api.MatchSet{
+							Type: api.MatchSet_ANY,
+							Name: name,
+						},
+						AfiSafiIn: vpnFamilies,
+					},
+					Actions: &api.Actions{
+						RouteAction: api.RouteAction_REJECT,
+					},
+				},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create withdraw policy of VRF %s: %w", v.name, err)
+	}
+
+	// Appended to the global import policies, keeping the default action
+	// configured in bgp.global
+	if err := m.server.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+		Assignment: &api.PolicyAssignment{
+			Name:          "global",
+			Direction:     api.PolicyDirection_IMPORT,
+			Policies:      []*api.Policy{{Name: name}},
+			DefaultAction: api.RouteAction_NONE,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to assign withdraw policy of VRF %s: %w", v.name, err)
+	}
+
+	m.vrfPolicies[name] = true
+	return nil
+}
@@ -0,0 +1,106 @@
+package bgp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+func TestWithdrawVRFPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		vrf     string
+		wantErr string
+	}{
+		{name: "IPv4 peer", address: "192.0.2.1", vrf: "blue"},
+		{name: "IPv6 peer", address: "2001:db8::1", vrf: "blue"},
+		{name: "unknown VRF", address: "192.0.2.1", vrf: "red", wantErr: "not found"},
+		{name: "unknown peer", address: "192.0.2.9", vrf: "blue", wantErr: "not found"},
+	}
+
+	m := newTestMonitor(t)
+	if err := m.StartBGP(GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenPort: -1}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+	for _, address := range []string{"192.0.2.1", "2001:db8::1"} {
+		if err := m.AddPeer(PeerConfig{Address: address, ASN: 64500, Passive: true}); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+	}
+	if err := m.SetVRFs([]VRFConfig{{Name: "blue", ImportTargets: []string{"64500:100"}}}); err != nil {
+		t.Fatalf("SetVRFs: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := m.WithdrawVRFPrefixes(tt.address, tt.vrf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WithdrawVRFPrefixes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WithdrawVRFPrefixes: %v", err)
+			}
+			if report.Peer != tt.address || len(report.Failed) != 0 {
+				t.Errorf("report = %+v, want nothing failed for %s", report, tt.address)
+			}
+			if err := m.RestoreVRFPrefixes(tt.address, tt.vrf); err != nil {
+				t.Errorf("RestoreVRFPrefixes: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRouteTarget(t *testing.T) {
+	// 4-byte ASNs are formatted in asdot, however they were written
+	tests := []struct {
+		input   string
+		typ     bgp.ExtendedCommunityAttrType
+		want    string
+		wantErr bool
+	}{
+		{input: "65000:100", typ: bgp.EC_TYPE_TRANSITIVE_TWO_OCTET_AS_SPECIFIC, want: "rt:65000:100"},
+		{input: "RT:65000:100", typ: bgp.EC_TYPE_TRANSITIVE_TWO_OCTET_AS_SPECIFIC, want: "rt:65000:100"},
+		{input: "65000:4294967295", typ: bgp.EC_TYPE_TRANSITIVE_TWO_OCTET_AS_SPECIFIC, want: "rt:65000:4294967295"},
+		{input: "65000:4294967296", wantErr: true},
+		{input: "4200000000:100", typ: bgp.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC, want: "rt:64086.59904:100"},
+		{input: "65536:65535", typ: bgp.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC, want: "rt:1.0:65535"},
+		{input: "4200000000:65536", wantErr: true},
+		{input: "4294967296:1", wantErr: true},
+		{input: "1.10:100", typ: bgp.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC, want: "rt:1.10:100"},
+		{input: "0.100:5", typ: bgp.EC_TYPE_TRANSITIVE_FOUR_OCTET_AS_SPECIFIC, want: "rt:0.100:5"},
+		{input: "1.65536:100", wantErr: true},
+		{input: "65536.1:100", wantErr: true},
+		{input: "1.10:65536", wantErr: true},
+		{input: "192.0.2.1:100", typ: bgp.EC_TYPE_TRANSITIVE_IP4_SPECIFIC, want: "rt:192.0.2.1:100"},
+		{input: "192.0.2.1:65536", wantErr: true},
+		{input: "2001:db8::1:100", wantErr: true},
+		{input: "65000", wantErr: true},
+		{input: "blue:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rt, err := parseRouteTarget(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRouteTarget() = %s, want an error", formatExtendedCommunity(rt))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRouteTarget: %v", err)
+			}
+			if typ, _ := rt.GetTypes(); typ != tt.typ {
+				t.Errorf("type = %v, want %v", typ, tt.typ)
+			}
+			if got := formatExtendedCommunity(rt); got != tt.want {
+				t.Errorf("parseRouteTarget() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package bgp
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	api "github.com/osrg/gobgp/v3/api"
+)
+
+// Name shared by the neighbor-set, statement and policy that reject routes
+// from withdrawn peers
+const withdrawPolicyName = "netmeta-withdrawn"
+
+// Families covered by WithdrawAllPrefixes
+var withdrawFamilies = []*api.Family{
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_UNICAST},
+	{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_UNICAST},
+	{Afi: api.Family_AFI_IP, Safi: api.Family_SAFI_MPLS_VPN},
+	{Afi: api.Family_AFI_IP6, Safi: api.Family_SAFI_MPLS_VPN},
+}
+
+// WithdrawReport describes the outcome of withdrawing a peer's prefixes.
+// Prefixes are grouped by address family.
+type WithdrawReport struct {
+	Peer      string
+	Withdrawn map[string][]string
+	Failed    map[string][]string
+	Error     string
+}
+
+// WithdrawAllPrefixes stops using every route learned from a single peer.
+// The peer is added to a per-neighbor import reject policy and soft-reset
+// inbound, so routes from other peers are left untouched. The session itself
+// stays up.
+func (m *Monitor) WithdrawAllPrefixes(address string) (*WithdrawReport, error) {
+	m.mu.RLock()
+	peer, ok := m.peers[address]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("peer %s not found", address)
+	}
+	if peer.Source != SourceBGP {
+		return nil, fmt.Errorf("peer %s is monitored through %s and cannot be withdrawn", address, strings.ToUpper(peer.Source))
+	}
+
+	report := &WithdrawReport{
+		Peer:      address,
+		Withdrawn: make(map[string][]string),
+		Failed:    make(map[string][]string),
+	}
+
+	// Remember what the peer sent us before rejecting it
+	pending := make(map[string][]string)
+	peer.mu.RLock()
+	for _, route := range peer.routes.routes {
+		pending[route.Family] = append(pending[route.Family], route.Prefix)
+	}
+	peer.mu.RUnlock()
+
+	if err := m.ensureWithdrawPolicy(); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, err
+	}
+
+	ctx := context.Background()
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        withdrawPolicyName,
+			List:        []string{neighborSetEntry(address)},
+		},
+	}); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, fmt.Errorf("failed to add %s to withdraw policy: %w", address, err)
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		report.Failed = pending
+		report.Error = err.Error()
+		return report, fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+
+	// Anything from this peer still in the global table was not withdrawn
+	remaining := make(map[string]bool)
+	for _, family := range withdrawFamilies {
+		err := m.server.ListPath(ctx, &api.ListPathRequest{
+			TableType: api.TableType_GLOBAL,
+			Family:    family,
+		}, func(d *api.Destination) {
+			for _, path := range d.Paths {
+				if path.NeighborIp == address {
+					remaining[d.Prefix] = true
+				}
+			}
+		})
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to verify withdrawal: %v", err)
+		}
+	}
+
+	for family, prefixes := range pending {
+		for _, prefix := range prefixes {
+			if remaining[prefix] {
+				report.Failed[family] = append(report.Failed[family], prefix)
+			} else {
+				report.Withdrawn[family] = append(report.Withdrawn[family], prefix)
+			}
+		}
+	}
+
+	peer.mu.Lock()
+	peer.FlapCount = 0
+	peer.mu.Unlock()
+
+	if len(report.Failed) > 0 {
+		failed := 0
+		for _, prefixes := range report.Failed {
+			failed += len(prefixes)
+		}
+		return report, fmt.Errorf("failed to withdraw %d prefixes from %s", failed, address)
+	}
+	return report, nil
+}
+
+// RestorePrefixes removes a peer from the withdraw policy and accepts its
+// routes again
+func (m *Monitor) RestorePrefixes(address string) error {
+	m.mu.RLock()
+	_, ok := m.peers[address]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("peer %s not found", address)
+	}
+
+	ctx := context.Background()
+	if err := m.server.DeleteDefinedSet(ctx, &api.DeleteDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        withdrawPolicyName,
+			List:        []string{neighborSetEntry(address)},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to remove %s from withdraw policy: %w", address, err)
+	}
+
+	if err := m.server.ResetPeer(ctx, &api.ResetPeerRequest{
+		Address:   address,
+		Soft:      true,
+		Direction: api.ResetPeerRequest_IN,
+	}); err != nil {
+		return fmt.Errorf("failed to soft reset %s: %w", address, err)
+	}
+	return nil
+}
+
+// ensureWithdrawPolicy installs the global import policy that rejects routes
+// from every neighbor in the withdraw neighbor-set
+func (m *Monitor) ensureWithdrawPolicy() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.withdrawPolicyReady {
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := m.server.AddDefinedSet(ctx, &api.AddDefinedSetRequest{
+		DefinedSet: &api.DefinedSet{
+			DefinedType: api.DefinedType_NEIGHBOR,
+			Name:        withdrawPolicyName,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create withdraw neighbor-set: %w", err)
+	}
+
+	if err := m.server.AddPolicy(ctx, &api.AddPolicyRequest{
+		Policy: &api.Policy{
+			Name: withdrawPolicyName,
+			Statements: []*api.Statement{
+				{
+					Name: withdrawPolicyName,
+					Conditions: &api.Conditions{
+						NeighborSet: &api.MatchSet{
+							Type: api.MatchSet_ANY,
+							Name: withdrawPolicyName,
+						},
+						AfiSafiIn: withdrawFamilies,
+					},
+					Actions: &api.Actions{
+						RouteAction: api.RouteAction_REJECT,
+					},
+				},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create withdraw policy: %w", err)
+	}
+
+	// Appended to the global import policies, keeping the default action
+	// configured in bgp.global
+	if err := m.server.AddPolicyAssignment(ctx, &api.AddPolicyAssignmentRequest{
+		Assignment: &api.PolicyAssignment{
+			Name:          "global",
+			Direction:     api.PolicyDirection_IMPORT,
+			Policies:      []*api.Policy{{Name: withdrawPolicyName}},
+			DefaultAction: api.RouteAction_NONE,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to assign withdraw policy: %w", err)
+	}
+
+	m.withdrawPolicyReady = true
+	return nil
+}
+
+// neighborSetEntry returns the host prefix of a peer address. The API only
+// takes prefixes in neighbor-sets.
+func neighborSetEntry(address string) string {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return address
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()).String()
+}
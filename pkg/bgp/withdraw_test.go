@@ -0,0 +1,49 @@
+package bgp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithdrawAllPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr string
+	}{
+		{name: "IPv4 peer", address: "192.0.2.1"},
+		{name: "IPv6 peer", address: "2001:db8::1"},
+		{name: "unknown peer", address: "192.0.2.9", wantErr: "not found"},
+	}
+
+	m := newTestMonitor(t)
+	if err := m.StartBGP(GlobalConfig{ASN: 64496, RouterID: "192.0.2.254", ListenPort: -1}); err != nil {
+		t.Fatalf("StartBGP: %v", err)
+	}
+	for _, address := range []string{"192.0.2.1", "2001:db8::1"} {
+		if err := m.AddPeer(PeerConfig{Address: address, ASN: 64500, Passive: true}); err != nil {
+			t.Fatalf("AddPeer: %v", err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := m.WithdrawAllPrefixes(tt.address)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("WithdrawAllPrefixes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WithdrawAllPrefixes: %v", err)
+			}
+			if report.Peer != tt.address || len(report.Failed) != 0 {
+				t.Errorf("report = %+v, want nothing failed for %s", report, tt.address)
+			}
+			if err := m.RestorePrefixes(tt.address); err != nil {
+				t.Errorf("RestorePrefixes: %v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package monitor
 
 import (
+	"context"
+	"strconv"
+	"time"
+
 	"github.com/namesarnav/netmeta/pkg/auto"
 	"github.com/namesarnav/netmeta/pkg/bgp"
 	"github.com/namesarnav/netmeta/pkg/mpls"
@@ -21,9 +25,9 @@ var (
 	bgpPrefixCount = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "bgp_prefix_count",
-			Help: "Number of prefixes advertised by BGP peer",
+			Help: "Number of prefixes per BGP peer and address family (type = received, accepted, advertised or best)",
 		},
-		[]string{"peer", "afi"},
+		[]string{"peer", "afi", "safi", "type"},
 	)
 
 	bgpSessionFlaps = promauto.NewCounterVec(
@@ -34,6 +38,192 @@ var (
 		[]string{"peer"},
 	)
 
+	bgpAnnouncements = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bgp_announcements_received_total",
+			Help: "Total number of prefixes announced by a BGP peer",
+		},
+		[]string{"peer"},
+	)
+
+	bgpWithdrawals = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bgp_withdrawals_received_total",
+			Help: "Total number of prefixes withdrawn by a BGP peer",
+		},
+		[]string{"peer"},
+	)
+
+	bgpAnnouncementRate = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_announcement_rate",
+			Help: "Prefixes announced by a BGP peer per second over the last minute",
+		},
+		[]string{"peer"},
+	)
+
+	bgpWithdrawalRate = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_withdrawal_rate",
+			Help: "Prefixes withdrawn by a BGP peer per second over the last minute",
+		},
+		[]string{"peer"},
+	)
+
+	bgpConvergence = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bgp_convergence_seconds",
+			Help:    "Time from a BGP session reaching Established to End-of-RIB on every family",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"peer"},
+	)
+
+	bgpStabilization = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bgp_stabilization_seconds",
+			Help:    "Time from a BGP session flap until the peer stopped sending updates",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"peer"},
+	)
+
+	bgpLastConvergence = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_last_convergence_seconds",
+			Help: "Initial convergence time of the current BGP session (0 = not converged yet)",
+		},
+		[]string{"peer"},
+	)
+
+	bgpLastStabilization = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_last_stabilization_seconds",
+			Help: "Time the last BGP session flap took to stabilize (0 = not stable yet or never flapped)",
+		},
+		[]string{"peer"},
+	)
+
+	bgpRPKIRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_rpki_routes",
+			Help: "Number of routes received from a BGP peer per RPKI origin validation state",
+		},
+		[]string{"peer", "state"},
+	)
+
+	bgpASPARoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_aspa_routes",
+			Help: "Number of routes received from a BGP peer per ASPA path verification state",
+		},
+		[]string{"peer", "state"},
+	)
+
+	bgpRouteAnomalies = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_route_anomalies",
+			Help: "Number of routes received from a BGP peer per hijack or leak finding type (moas, more_specific, route_leak)",
+		},
+		[]string{"peer", "type"},
+	)
+
+	bgpVRFPrefixCount = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_vrf_prefix_count",
+			Help: "Number of VPN routes received from a BGP peer per VRF and address family",
+		},
+		[]string{"peer", "vrf", "afi", "safi"},
+	)
+
+	bgpVRFWithdrawals = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_vrf_withdrawals",
+			Help: "Number of VPN routes withdrawn by a BGP peer per VRF since the peer was added",
+		},
+		[]string{"peer", "vrf"},
+	)
+
+	bgpPrefixLimitUsage = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_prefix_limit_usage_percent",
+			Help: "Received prefixes as a percentage of the configured max-prefix limit",
+		},
+		[]string{"peer", "afi", "safi"},
+	)
+
+	bgpPrefixLimitLevel = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_prefix_limit_level",
+			Help: "Max-prefix threshold reached by a BGP peer (0 = ok, 1 = warning, 2 = critical)",
+		},
+		[]string{"peer", "afi", "safi"},
+	)
+
+	bgpPathLengthRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_as_path_length_routes",
+			Help: "Number of routes received from a BGP peer per AS path length",
+		},
+		[]string{"peer", "length"},
+	)
+
+	bgpPathLengthAvg = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_as_path_length_avg",
+			Help: "Average AS path length of the routes received from a BGP peer",
+		},
+		[]string{"peer"},
+	)
+
+	bgpPrependedRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_as_path_prepended_routes",
+			Help: "Number of routes received from a BGP peer whose AS path is prepended",
+		},
+		[]string{"peer"},
+	)
+
+	bgpTopOriginRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_top_origin_as_routes",
+			Help: "Number of routes received from a BGP peer per origin ASN, for the top origins",
+		},
+		[]string{"peer", "asn"},
+	)
+
+	bgpTopTransitRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_top_transit_as_routes",
+			Help: "Number of routes received from a BGP peer per transit ASN, for the top transit ASNs",
+		},
+		[]string{"peer", "asn"},
+	)
+
+	bgpCommunityRoutes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_community_routes",
+			Help: "Number of routes received from a BGP peer per community, for the most common communities",
+		},
+		[]string{"peer", "community", "type", "name"},
+	)
+
+	bgpPrefixPenalty = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_prefix_dampening_penalty",
+			Help: "RFC 2439 flap penalty of the noisiest prefixes",
+		},
+		[]string{"peer", "prefix"},
+	)
+
+	bgpSuppressedPrefixes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bgp_dampening_suppressed_prefixes",
+			Help: "Number of prefixes per BGP peer whose penalty is above the suppress limit",
+		},
+		[]string{"peer"},
+	)
+
 	// MPLS metrics
 	mplsCorruptionEvents = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -52,10 +242,22 @@ var (
 	)
 )
 
+// Interval between updates of the gauges and counters from the monitor
+const updateInterval = 15 * time.Second
+
+// Number of prefixes exported in bgp_prefix_dampening_penalty
+const noisyPrefixLimit = 20
+
+// Number of ASNs and communities exported per peer in the top-N analytics
+const analyticsTopLimit = 10
+
 type Exporter struct {
 	bgpMonitor    *bgp.Monitor
 	mplsValidator *mpls.Validator
 	autoEngine    *auto.Engine
+
+	// Update totals last exported per peer, to add the delta to counters
+	updates map[string]bgp.UpdateStats
 }
 
 func NewExporter(bgpMonitor *bgp.Monitor, mplsValidator *mpls.Validator, autoEngine *auto.Engine) *Exporter {
@@ -63,12 +265,16 @@ func NewExporter(bgpMonitor *bgp.Monitor, mplsValidator *mpls.Validator, autoEng
 		bgpMonitor:    bgpMonitor,
 		mplsValidator: mplsValidator,
 		autoEngine:    autoEngine,
+		updates:       make(map[string]bgp.UpdateStats),
 	}
 }
 
 func (e *Exporter) UpdateMetrics() {
 	// Update BGP metrics
 	peers := e.bgpMonitor.GetAllPeers()
+	// VRFs come and go with the configuration and the routes received
+	bgpVRFPrefixCount.Reset()
+	bgpVRFWithdrawals.Reset()
 	for _, peer := range peers {
 		if peer.Established {
 			bgpPeerUp.WithLabelValues(peer.Address).Set(1)
@@ -76,8 +282,90 @@ func (e *Exporter) UpdateMetrics() {
 			bgpPeerUp.WithLabelValues(peer.Address).Set(0)
 		}
 
-		bgpPrefixCount.WithLabelValues(peer.Address, "ipv4").Set(float64(peer.PrefixCount))
+		for _, counts := range peer.Families {
+			bgpPrefixCount.WithLabelValues(peer.Address, counts.AFI, counts.SAFI, "received").Set(float64(counts.Received))
+			bgpPrefixCount.WithLabelValues(peer.Address, counts.AFI, counts.SAFI, "accepted").Set(float64(counts.Accepted))
+			bgpPrefixCount.WithLabelValues(peer.Address, counts.AFI, counts.SAFI, "advertised").Set(float64(counts.Advertised))
+			bgpPrefixCount.WithLabelValues(peer.Address, counts.AFI, counts.SAFI, "best").Set(float64(counts.Best))
+		}
 		bgpSessionFlaps.WithLabelValues(peer.Address).Add(0) // Counter, so we set the value
+
+		// Totals restart when a peer is removed and added again
+		last := e.updates[peer.Address]
+		if peer.Updates.Announcements < last.Announcements || peer.Updates.Withdrawals < last.Withdrawals {
+			last = bgp.UpdateStats{}
+		}
+		bgpAnnouncements.WithLabelValues(peer.Address).Add(float64(peer.Updates.Announcements - last.Announcements))
+		bgpWithdrawals.WithLabelValues(peer.Address).Add(float64(peer.Updates.Withdrawals - last.Withdrawals))
+		e.updates[peer.Address] = peer.Updates
+
+		bgpAnnouncementRate.WithLabelValues(peer.Address).Set(peer.Updates.AnnounceRate)
+		bgpWithdrawalRate.WithLabelValues(peer.Address).Set(peer.Updates.WithdrawRate)
+		bgpLastConvergence.WithLabelValues(peer.Address).Set(peer.Updates.ConvergenceTime.Seconds())
+		bgpLastStabilization.WithLabelValues(peer.Address).Set(peer.Updates.StabilizationTime.Seconds())
+
+		bgpRPKIRoutes.WithLabelValues(peer.Address, "valid").Set(float64(peer.RPKI.Valid))
+		bgpRPKIRoutes.WithLabelValues(peer.Address, "invalid").Set(float64(peer.RPKI.Invalid))
+		bgpRPKIRoutes.WithLabelValues(peer.Address, "notfound").Set(float64(peer.RPKI.NotFound))
+		bgpASPARoutes.WithLabelValues(peer.Address, "valid").Set(float64(peer.ASPA.Valid))
+		bgpASPARoutes.WithLabelValues(peer.Address, "invalid").Set(float64(peer.ASPA.Invalid))
+		bgpASPARoutes.WithLabelValues(peer.Address, "unknown").Set(float64(peer.ASPA.Unknown))
+
+		for _, typ := range []string{bgp.FindingMOAS, bgp.FindingMoreSpecific, bgp.FindingRouteLeak} {
+			bgpRouteAnomalies.WithLabelValues(peer.Address, typ).Set(float64(peer.Anomalies[typ]))
+		}
+
+		for vrf, counts := range peer.VRFs {
+			for family, n := range counts.Prefixes {
+				afi, safi := bgp.FamilyAFISAFI(family)
+				bgpVRFPrefixCount.WithLabelValues(peer.Address, vrf, afi, safi).Set(float64(n))
+			}
+			bgpVRFWithdrawals.WithLabelValues(peer.Address, vrf).Set(float64(counts.Withdrawals))
+		}
+
+		for _, l := range peer.Config.PrefixLimits {
+			counts := peer.Families[l.Family]
+			status := peer.Limits[l.Family]
+			bgpPrefixLimitUsage.WithLabelValues(peer.Address, counts.AFI, counts.SAFI).Set(status.Percent)
+			bgpPrefixLimitLevel.WithLabelValues(peer.Address, counts.AFI, counts.SAFI).Set(float64(bgp.LimitLevelValue(status.Level)))
+		}
+	}
+
+	// Path lengths and top-N sets change, so stale series are dropped
+	bgpPathLengthRoutes.Reset()
+	bgpTopOriginRoutes.Reset()
+	bgpTopTransitRoutes.Reset()
+	bgpCommunityRoutes.Reset()
+	analytics, _ := e.bgpMonitor.Analytics("", analyticsTopLimit)
+	for _, a := range analytics {
+		for length, routes := range a.PathLengths {
+			bgpPathLengthRoutes.WithLabelValues(a.Peer, strconv.Itoa(length)).Set(float64(routes))
+		}
+		bgpPathLengthAvg.WithLabelValues(a.Peer).Set(a.AvgPathLength)
+		bgpPrependedRoutes.WithLabelValues(a.Peer).Set(float64(a.Prepended))
+		for _, o := range a.TopOrigins {
+			bgpTopOriginRoutes.WithLabelValues(a.Peer, strconv.FormatUint(uint64(o.ASN), 10)).Set(float64(o.Routes))
+		}
+		for _, t := range a.TopTransit {
+			bgpTopTransitRoutes.WithLabelValues(a.Peer, strconv.FormatUint(uint64(t.ASN), 10)).Set(float64(t.Routes))
+		}
+		for _, c := range a.TopCommunities {
+			bgpCommunityRoutes.WithLabelValues(a.Peer, c.Value, c.Type, c.Name).Set(float64(c.Routes))
+		}
+	}
+
+	// Only the noisiest prefixes are exported to keep label cardinality low
+	bgpPrefixPenalty.Reset()
+	for _, d := range e.bgpMonitor.NoisyPrefixes(noisyPrefixLimit, time.Time{}) {
+		bgpPrefixPenalty.WithLabelValues(d.Peer, d.Prefix).Set(d.Penalty)
+	}
+
+	suppressed := make(map[string]int)
+	for _, d := range e.bgpMonitor.SuppressedPrefixes() {
+		suppressed[d.Peer]++
+	}
+	for _, peer := range peers {
+		bgpSuppressedPrefixes.WithLabelValues(peer.Address).Set(float64(suppressed[peer.Address]))
 	}
 
 	// Update MPLS metrics
@@ -85,7 +373,7 @@ func (e *Exporter) UpdateMetrics() {
 	mplsCorruptionEvents.Add(0) // This would need to track deltas
 
 	// Update remediation metrics
-	reasons := []string{"flap", "rpki", "adjacency_down", "manual"}
+	reasons := []string{"flap", "rpki", "dampening", "hijack", "route_leak", "max_prefix", "adjacency_down", "manual"}
 	for _, reason := range reasons {
 		count := e.autoEngine.GetRemediationCount(reason)
 		remediationTotal.WithLabelValues(reason, "true").Add(0) // Would need delta tracking
@@ -94,9 +382,36 @@ func (e *Exporter) UpdateMetrics() {
 	}
 }
 
-// Start starts the metrics update loop
-func (e *Exporter) Start() {
-	// Metrics are automatically exported via prometheus registry
-	// This method can be used for periodic updates if needed
+// Start starts the metrics update loop, which runs until ctx is done
+func (e *Exporter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(updateInterval)
+		defer ticker.Stop()
+		for {
+			e.UpdateMetrics()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Convergence times are observed as they happen
+	events, cancel := e.bgpMonitor.SubscribeConvergence()
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	go func() {
+		for event := range events {
+			switch event.Type {
+			case bgp.ConvergenceEndOfRIB:
+				bgpConvergence.WithLabelValues(event.Peer).Observe(event.Duration.Seconds())
+			case bgp.ConvergenceStable:
+				bgpStabilization.WithLabelValues(event.Peer).Observe(event.Duration.Seconds())
+			}
+		}
+	}()
 }
 
@@ -0,0 +1,224 @@
+package rpki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result of looking up a single hop of an AS path in the ASPA set
+type hopType int
+
+const (
+	hopNoAttestation hopType = iota
+	hopProvider
+	hopNotProvider
+)
+
+// hop reports whether provider is attested as a provider of customer.
+// Callers must hold t.mu.
+func (t *Table) hop(customer, provider uint32) hopType {
+	providers, ok := t.aspas[customer]
+	if !ok {
+		return hopNoAttestation
+	}
+	for _, p := range providers {
+		if p == provider {
+			return hopProvider
+		}
+	}
+	return hopNotProvider
+}
+
+// VerifyASPath performs ASPA verification (draft-ietf-sidrops-aspa-verification)
+// of an AS path, neighbor first and origin last. Routes received from a
+// provider are verified with the downstream procedure, all others with the
+// upstream one. The returned reason explains Invalid and Unknown results.
+func (t *Table) VerifyASPath(path []uint32, downstream bool) (State, string) {
+	// Origin first, as AS(1) in the draft, with prepends removed
+	var ases []uint32
+	for i := len(path) - 1; i >= 0; i-- {
+		if len(ases) == 0 || ases[len(ases)-1] != path[i] {
+			ases = append(ases, path[i])
+		}
+	}
+	n := len(ases)
+	if n == 0 {
+		return StateInvalid, "empty AS path"
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// upRamp returns how many ASes from the origin on form a chain of
+	// customer to provider hops, and the first hop that breaks it. Hops
+	// without an ASPA only break a strict chain.
+	upRamp := func(strict bool) (int, int) {
+		for i := 1; i < n; i++ {
+			if h := t.hop(ases[i-1], ases[i]); h == hopNotProvider || (strict && h == hopNoAttestation) {
+				return i, i
+			}
+		}
+		return n, 0
+	}
+	// downRamp is the same from the neighbor towards the origin
+	downRamp := func(strict bool) (int, int) {
+		for j := n - 1; j > 0; j-- {
+			if h := t.hop(ases[j], ases[j-1]); h == hopNotProvider || (strict && h == hopNoAttestation) {
+				return n - j, j
+			}
+		}
+		return n, 0
+	}
+
+	maxUp, up := upRamp(false)
+	minUp, _ := upRamp(true)
+	if !downstream {
+		if maxUp < n {
+			return StateInvalid, fmt.Sprintf("AS%d is not a provider of AS%d", ases[up], ases[up-1])
+		}
+		if minUp < n {
+			return StateUnknown, t.unattested(ases[:n-1])
+		}
+		return StateValid, ""
+	}
+
+	if n <= 2 {
+		return StateValid, ""
+	}
+	maxDown, down := downRamp(false)
+	minDown, _ := downRamp(true)
+	if maxUp+maxDown < n {
+		return StateInvalid, fmt.Sprintf("AS%d is not a provider of AS%d and AS%d is not a provider of AS%d",
+			ases[up], ases[up-1], ases[down-1], ases[down])
+	}
+	if minUp+minDown < n {
+		return StateUnknown, t.unattested(ases)
+	}
+	return StateValid, ""
+}
+
+// unattested names the ASes of a path without an ASPA. Callers must hold
+// t.mu.
+func (t *Table) unattested(ases []uint32) string {
+	var missing []string
+	for _, asn := range ases {
+		if _, ok := t.aspas[asn]; !ok {
+			missing = append(missing, fmt.Sprintf("AS%d", asn))
+		}
+	}
+	return "no ASPA for " + strings.Join(missing, ", ")
+}
+
+// asID is an AS number written as a number or as "AS64496"
+type asID uint32
+
+func (a *asID) UnmarshalJSON(data []byte) error {
+	s := strings.TrimPrefix(strings.Trim(string(data), `"`), "AS")
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid AS number %s", data)
+	}
+	*a = asID(asn)
+	return nil
+}
+
+// aspaFile is the JSON output of rpki-client (customer_asid) or Routinator
+// (customer); only the ASPAs are read
+type aspaFile struct {
+	ASPAs []struct {
+		CustomerASID asID   `json:"customer_asid"`
+		Customer     asID   `json:"customer"`
+		Providers    []asID `json:"providers"`
+	} `json:"aspas"`
+}
+
+// LoadASPAs reads the ASPAs of a validator's JSON export
+func LoadASPAs(path string) (map[uint32][]uint32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ASPA file: %w", err)
+	}
+	var file aspaFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse ASPA file %s: %w", path, err)
+	}
+
+	aspas := make(map[uint32][]uint32, len(file.ASPAs))
+	for _, a := range file.ASPAs {
+		customer := uint32(a.CustomerASID)
+		if customer == 0 {
+			customer = uint32(a.Customer)
+		}
+		if customer == 0 {
+			return nil, fmt.Errorf("ASPA in %s without a customer AS", path)
+		}
+		providers := aspas[customer]
+		for _, p := range a.Providers {
+			providers = append(providers, uint32(p))
+		}
+		sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+		aspas[customer] = providers
+	}
+	return aspas, nil
+}
+
+// LoadASPAFile replaces the ASPA set with the one of a validator's JSON
+// export, keeping the VRPs
+func (t *Table) LoadASPAFile(path string) error {
+	aspas, err := LoadASPAs(path)
+	if err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	vrps, serial := t.vrps, t.serial
+	t.mu.RUnlock()
+
+	t.Replace(vrps, aspas, serial)
+	return nil
+}
+
+// WatchASPAFile reloads the ASPA file every interval (an hour if zero) if
+// it was modified, until ctx is done
+func (t *Table) WatchASPAFile(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRefresh
+	}
+
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Warning: failed to check ASPA file: %v", err)
+			continue
+		}
+		if info.ModTime().Equal(modified) {
+			continue
+		}
+		if err := t.LoadASPAFile(path); err != nil {
+			log.Printf("Warning: failed to reload ASPA file: %v", err)
+			continue
+		}
+		modified = info.ModTime()
+		log.Printf("Reloaded %d ASPAs from %s", t.ASPALen(), path)
+	}
+}
@@ -0,0 +1,141 @@
+package rpki
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyASPath(t *testing.T) {
+	table := NewTable()
+	table.Replace(nil, map[uint32][]uint32{
+		64500: {64510},
+		64510: {64520},
+		64520: {0},
+		64530: {64520},
+		64550: {64560},
+	}, 1)
+
+	tests := []struct {
+		name       string
+		path       []uint32
+		downstream bool
+		want       State
+		reason     string
+	}{
+		{name: "single AS", path: []uint32{64500}, want: StateValid},
+		{name: "customer to provider", path: []uint32{64510, 64500}, want: StateValid},
+		{name: "customer chain", path: []uint32{64520, 64510, 64500}, want: StateValid},
+		{name: "prepends", path: []uint32{64510, 64510, 64500, 64500}, want: StateValid},
+		{name: "not a provider", path: []uint32{64530, 64500}, want: StateInvalid, reason: "AS64530 is not a provider of AS64500"},
+		{name: "not a provider further up", path: []uint32{64550, 64510, 64500}, want: StateInvalid, reason: "AS64550 is not a provider of AS64510"},
+		{name: "origin without ASPA", path: []uint32{64510, 64540}, want: StateUnknown, reason: "no ASPA for AS64540"},
+		{name: "empty path", path: nil, want: StateInvalid, reason: "empty AS path"},
+		{name: "from provider, up and down", path: []uint32{64530, 64520, 64510, 64500}, downstream: true, want: StateValid},
+		{name: "from provider, two ASes", path: []uint32{64530, 64500}, downstream: true, want: StateValid},
+		{
+			name:       "from provider, valley",
+			path:       []uint32{64520, 64510, 64530, 64500},
+			downstream: true,
+			want:       StateInvalid,
+			reason:     "AS64530 is not a provider of AS64500 and AS64510 is not a provider of AS64520",
+		},
+		{
+			name:       "from provider, ASes without ASPA",
+			path:       []uint32{64580, 64570, 64510, 64500},
+			downstream: true,
+			want:       StateUnknown,
+			reason:     "no ASPA for AS64570, AS64580",
+		},
+		{name: "from provider, empty path", path: nil, downstream: true, want: StateInvalid, reason: "empty AS path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := table.VerifyASPath(tt.path, tt.downstream)
+			if got != tt.want || reason != tt.reason {
+				t.Errorf("VerifyASPath(%v, %v) = %s %q, want %s %q", tt.path, tt.downstream, got, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestLoadASPAs(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[uint32][]uint32
+		wantErr string
+	}{
+		{
+			name: "rpki-client",
+			data: `{"aspas": [{"customer_asid": 64500, "expires": 1704067200, "providers": [64520, 64510]}]}`,
+			want: map[uint32][]uint32{64500: {64510, 64520}},
+		},
+		{
+			name: "Routinator",
+			data: `{"metadata": {}, "aspas": [{"customer": "AS64500", "providers": ["AS64510"]}, {"customer": "AS64520", "providers": ["AS0"]}]}`,
+			want: map[uint32][]uint32{64500: {64510}, 64520: {0}},
+		},
+		{
+			name: "customer listed twice",
+			data: `{"aspas": [{"customer_asid": 64500, "providers": [64530]}, {"customer_asid": 64500, "providers": [64510]}]}`,
+			want: map[uint32][]uint32{64500: {64510, 64530}},
+		},
+		{name: "no ASPAs", data: `{"roas": []}`, want: map[uint32][]uint32{}},
+		{name: "no customer", data: `{"aspas": [{"providers": [64510]}]}`, wantErr: "without a customer AS"},
+		{name: "invalid provider", data: `{"aspas": [{"customer": "AS64500", "providers": ["ASX"]}]}`, wantErr: "invalid AS number"},
+		{name: "not JSON", data: `customer 64500 providers 64510`, wantErr: "failed to parse ASPA file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "aspas.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadASPAs(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadASPAs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadASPAs: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadASPAs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadASPAFile(t *testing.T) {
+	table := NewTable()
+	table.Replace(map[VRP]struct{}{vrp("192.0.2.0/24", 24, 64500): {}}, nil, 7)
+
+	changed := 0
+	table.OnChange(func() { changed++ })
+
+	path := filepath.Join(t.TempDir(), "aspas.json")
+	if err := os.WriteFile(path, []byte(`{"aspas": [{"customer_asid": 64500, "providers": [64510]}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.LoadASPAFile(path); err != nil {
+		t.Fatalf("LoadASPAFile: %v", err)
+	}
+
+	if table.ASPALen() != 1 || table.Len() != 1 || table.Serial() != 7 {
+		t.Errorf("table has %d ASPAs, %d VRPs and serial %d, want 1, 1 and 7", table.ASPALen(), table.Len(), table.Serial())
+	}
+	if changed != 1 {
+		t.Errorf("listeners called %d times, want 1", changed)
+	}
+	if err := table.LoadASPAFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadASPAFile() of a missing file did not fail")
+	}
+}
@@ -0,0 +1,235 @@
+package rpki
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+)
+
+// Cache is a minimal in-process RTR cache. It serves a VRP set, and an ASPA
+// set to version 2 routers, to any number of routers and is meant to stand
+// in for a real RPKI validator when testing the client and the remediation
+// that depends on it.
+type Cache struct {
+	sessionID uint16
+	version   uint8
+	serial    uint32
+	vrps      map[VRP]struct{}
+	aspas     map[uint32][]uint32
+	// history and aspaHistory hold the sets of recent serials so incremental
+	// queries can be answered with a diff
+	history     map[uint32]map[VRP]struct{}
+	aspaHistory map[uint32]map[uint32][]uint32
+	conns       map[net.Conn]uint8
+	mu          sync.Mutex
+}
+
+const cacheHistory = 16
+
+func NewCache(sessionID uint16) *Cache {
+	return &Cache{
+		sessionID:   sessionID,
+		version:     Version2,
+		vrps:        make(map[VRP]struct{}),
+		aspas:       make(map[uint32][]uint32),
+		history:     map[uint32]map[VRP]struct{}{0: {}},
+		aspaHistory: map[uint32]map[uint32][]uint32{0: {}},
+		conns:       make(map[net.Conn]uint8),
+	}
+}
+
+// SetVersion limits the cache to an older RTR version, rejecting queries
+// of newer versions like an older validator would
+func (c *Cache) SetVersion(version uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version = version
+}
+
+// Disconnect closes every router session, as if the cache went away
+func (c *Cache) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for conn := range c.conns {
+		conn.Close()
+	}
+}
+
+// SetVRPs replaces the served VRP set, bumps the serial and notifies all
+// connected routers
+func (c *Cache) SetVRPs(vrps []VRP) {
+	set := make(map[VRP]struct{}, len(vrps))
+	for _, vrp := range vrps {
+		vrp.Prefix = vrp.Prefix.Masked()
+		set[vrp] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.vrps = set
+	c.bump()
+}
+
+// SetASPAs replaces the served ASPA set, keyed by customer ASN, bumps the
+// serial and notifies all connected routers
+func (c *Cache) SetASPAs(aspas map[uint32][]uint32) {
+	set := make(map[uint32][]uint32, len(aspas))
+	for customer, providers := range aspas {
+		set[customer] = append([]uint32(nil), providers...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.aspas = set
+	c.bump()
+}
+
+// bump records the current sets under a new serial and notifies all
+// connected routers. Callers must hold c.mu.
+func (c *Cache) bump() {
+	c.serial++
+	c.history[c.serial] = c.vrps
+	c.aspaHistory[c.serial] = c.aspas
+	delete(c.history, c.serial-cacheHistory)
+	delete(c.aspaHistory, c.serial-cacheHistory)
+
+	for conn, version := range c.conns {
+		writePDU(conn, &pdu{Version: version, Type: pduSerialNotify, SessionID: c.sessionID, Serial: c.serial})
+	}
+}
+
+// Serve accepts RTR sessions until the listener is closed
+func (c *Cache) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go c.handleConn(conn)
+	}
+}
+
+func (c *Cache) handleConn(conn net.Conn) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.conns, conn)
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		p, err := readPDU(conn)
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		version := c.version
+		c.mu.Unlock()
+		if p.Version > version {
+			writePDU(conn, &pdu{Version: version, Type: pduErrorReport, ErrorCode: errUnsupportedProtocolVersion,
+				ErrorText: fmt.Sprintf("unsupported protocol version %d", p.Version)})
+			return
+		}
+
+		c.mu.Lock()
+		c.conns[conn] = p.Version
+		c.mu.Unlock()
+
+		switch p.Type {
+		case pduResetQuery:
+			err = c.sendVRPs(conn, p.Version, nil)
+		case pduSerialQuery:
+			err = c.sendVRPs(conn, p.Version, p)
+		default:
+			writePDU(conn, &pdu{Version: p.Version, Type: pduErrorReport, ErrorCode: errUnsupportedPDUType,
+				ErrorText: fmt.Sprintf("unexpected PDU type %d", p.Type)})
+			return
+		}
+		if err != nil {
+			log.Printf("RTR cache failed to answer %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// sendVRPs answers a Reset Query with the full VRP set, or a Serial Query
+// with the changes since the router's serial. ASPAs are only sent to
+// version 2 routers.
+func (c *Cache) sendVRPs(conn net.Conn, version uint8, query *pdu) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pdus []*pdu
+	old, oldASPAs := map[VRP]struct{}{}, map[uint32][]uint32{}
+	if query != nil {
+		var ok bool
+		old, ok = c.history[query.Serial]
+		if !ok || query.SessionID != c.sessionID {
+			return writePDU(conn, &pdu{Version: version, Type: pduCacheReset})
+		}
+		oldASPAs = c.aspaHistory[query.Serial]
+	}
+	for vrp := range old {
+		if _, ok := c.vrps[vrp]; !ok {
+			pdus = append(pdus, prefixPDU(version, vrp, false))
+		}
+	}
+	for vrp := range c.vrps {
+		if _, ok := old[vrp]; !ok {
+			pdus = append(pdus, prefixPDU(version, vrp, true))
+		}
+	}
+	if version >= Version2 {
+		for customer := range oldASPAs {
+			if _, ok := c.aspas[customer]; !ok {
+				pdus = append(pdus, &pdu{Version: version, Type: pduASPA, ASN: customer})
+			}
+		}
+		for customer, providers := range c.aspas {
+			if prev, ok := oldASPAs[customer]; ok && slices.Equal(prev, providers) {
+				continue
+			}
+			pdus = append(pdus, &pdu{Version: version, Type: pduASPA, Flags: flagAnnounce, ASN: customer, Providers: providers})
+		}
+	}
+
+	if err := writePDU(conn, &pdu{Version: version, Type: pduCacheResponse, SessionID: c.sessionID}); err != nil {
+		return err
+	}
+	for _, p := range pdus {
+		if err := writePDU(conn, p); err != nil {
+			return err
+		}
+	}
+	return writePDU(conn, &pdu{
+		Version:   version,
+		Type:      pduEndOfData,
+		SessionID: c.sessionID,
+		Serial:    c.serial,
+		Refresh:   uint32(defaultRefresh.Seconds()),
+		Retry:     uint32(defaultRetry.Seconds()),
+		Expire:    7200,
+	})
+}
+
+func prefixPDU(version uint8, vrp VRP, announce bool) *pdu {
+	p := &pdu{
+		Version:   version,
+		Type:      pduIPv4Prefix,
+		Prefix:    vrp.Prefix,
+		MaxLength: vrp.MaxLength,
+		ASN:       vrp.ASN,
+	}
+	if vrp.Prefix.Addr().Is6() {
+		p.Type = pduIPv6Prefix
+	}
+	if announce {
+		p.Flags = flagAnnounce
+	}
+	return p
+}
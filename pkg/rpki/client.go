@@ -0,0 +1,350 @@
+package rpki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRefresh = 3600 * time.Second
+	defaultRetry   = 600 * time.Second
+	defaultExpire  = 7200 * time.Second
+	dialTimeout    = 10 * time.Second
+)
+
+// errVersionDowngrade ends a session that is retried right away with a
+// lower protocol version
+var errVersionDowngrade = errors.New("RTR version downgrade")
+
+// Client keeps a Table in sync with an RPKI cache over RTR (RFC 8210). It
+// speaks version 2, which adds ASPAs, and falls back to versions 1 and 0 for
+// older caches.
+type Client struct {
+	address   string
+	table     *Table
+	version   uint8
+	refresh   time.Duration
+	retry     time.Duration
+	expire    time.Duration
+	sessionID uint16
+	serial    uint32
+	synced    bool
+	lastSync  time.Time
+	connected bool
+	mu        sync.RWMutex
+}
+
+// ClientStatus describes the state of the RTR session
+type ClientStatus struct {
+	Address   string
+	Connected bool
+	Version   uint8
+	SessionID uint16
+	Serial    uint32
+	VRPs      int
+	ASPAs     int
+	Updated   time.Time
+}
+
+// NewClient creates an RTR client for the cache at address. A zero refresh
+// interval uses the one announced by the cache.
+func NewClient(address string, refresh time.Duration) *Client {
+	return &Client{
+		address: address,
+		table:   NewTable(),
+		version: Version2,
+		refresh: refresh,
+		retry:   defaultRetry,
+		expire:  defaultExpire,
+	}
+}
+
+func (c *Client) Table() *Table {
+	return c.table
+}
+
+func (c *Client) Status() ClientStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return ClientStatus{
+		Address:   c.address,
+		Connected: c.connected,
+		Version:   c.version,
+		SessionID: c.sessionID,
+		Serial:    c.serial,
+		VRPs:      c.table.Len(),
+		ASPAs:     c.table.ASPALen(),
+		Updated:   c.table.Updated(),
+	}
+}
+
+// Start connects to the cache and keeps the session up until ctx is done
+func (c *Client) Start(ctx context.Context) {
+	for {
+		dialer := net.Dialer{Timeout: dialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", c.address)
+		if err == nil {
+			err = c.Run(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("RTR session with %s ended: %v", c.address, err)
+		if errors.Is(err, errVersionDowngrade) {
+			continue
+		}
+
+		c.mu.RLock()
+		retry := c.retry
+		c.mu.RUnlock()
+
+		if !c.wait(ctx, retry) {
+			return
+		}
+	}
+}
+
+// wait sleeps until the next connection attempt, dropping the VRPs and
+// ASPAs once they are older than the expire interval announced by the
+// cache. It returns false if ctx is done first.
+func (c *Client) wait(ctx context.Context, retry time.Duration) bool {
+	timer := time.NewTimer(retry)
+	defer timer.Stop()
+
+	var expired <-chan time.Time
+	c.mu.RLock()
+	if c.synced {
+		expiry := time.NewTimer(time.Until(c.lastSync.Add(c.expire)))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+	c.mu.RUnlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-expired:
+			log.Printf("RTR data from %s expired, dropping %d VRPs", c.address, c.table.Len())
+			c.mu.Lock()
+			c.synced = false
+			c.mu.Unlock()
+			c.table.Replace(make(map[VRP]struct{}), make(map[uint32][]uint32), 0)
+			expired = nil
+		}
+	}
+}
+
+// Run speaks RTR over an established connection until it fails or ctx is
+// done. It is used by Start and lets the client run against any transport,
+// including an in-process Cache.
+func (c *Client) Run(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.connected = false
+		c.mu.Unlock()
+	}()
+
+	pdus := make(chan *pdu)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			p, err := readPDU(conn)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case pdus <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := c.sendQuery(conn); err != nil {
+		return err
+	}
+
+	// VRPs and ASPAs received since the last Cache Response, applied at End
+	// of Data
+	var staging map[VRP]struct{}
+	var stagingASPAs map[uint32][]uint32
+	refresh := time.NewTimer(c.refreshInterval())
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case err := <-errs:
+			return err
+
+		case <-refresh.C:
+			if err := c.sendQuery(conn); err != nil {
+				return err
+			}
+			refresh.Reset(c.refreshInterval())
+
+		case p := <-pdus:
+			switch p.Type {
+			case pduSerialNotify:
+				if staging == nil {
+					if err := c.sendQuery(conn); err != nil {
+						return err
+					}
+				}
+
+			case pduCacheResponse:
+				c.mu.Lock()
+				reset := !c.synced || c.sessionID != p.SessionID
+				c.sessionID = p.SessionID
+				c.mu.Unlock()
+
+				if reset {
+					staging = make(map[VRP]struct{})
+					stagingASPAs = make(map[uint32][]uint32)
+				} else {
+					staging = c.table.Snapshot()
+					stagingASPAs = c.table.ASPAs()
+				}
+
+			case pduIPv4Prefix, pduIPv6Prefix:
+				if staging == nil {
+					return fmt.Errorf("prefix PDU outside of cache response")
+				}
+				vrp := VRP{Prefix: p.Prefix, MaxLength: p.MaxLength, ASN: p.ASN}
+				if p.Flags&flagAnnounce != 0 {
+					staging[vrp] = struct{}{}
+				} else {
+					delete(staging, vrp)
+				}
+
+			case pduASPA:
+				if staging == nil {
+					return fmt.Errorf("ASPA PDU outside of cache response")
+				}
+				if p.Flags&flagAnnounce != 0 {
+					stagingASPAs[p.ASN] = p.Providers
+				} else {
+					delete(stagingASPAs, p.ASN)
+				}
+
+			case pduEndOfData:
+				if staging == nil {
+					return fmt.Errorf("end of data outside of cache response")
+				}
+				c.table.Replace(staging, stagingASPAs, p.Serial)
+				staging = nil
+
+				c.mu.Lock()
+				c.serial = p.Serial
+				c.synced = true
+				c.lastSync = time.Now()
+				if p.Retry > 0 {
+					c.retry = time.Duration(p.Retry) * time.Second
+				}
+				if p.Expire > 0 {
+					c.expire = time.Duration(p.Expire) * time.Second
+				}
+				c.mu.Unlock()
+
+				refresh.Reset(c.refreshInterval(time.Duration(p.Refresh) * time.Second))
+
+			case pduCacheReset:
+				c.mu.Lock()
+				c.synced = false
+				c.mu.Unlock()
+				if err := c.sendQuery(conn); err != nil {
+					return err
+				}
+
+			case pduRouterKey:
+				// BGPsec router keys are not used
+
+			case pduErrorReport:
+				if p.ErrorCode == errUnsupportedProtocolVersion {
+					from := c.currentVersion()
+					if c.downgrade(p.Version) {
+						return fmt.Errorf("%w: cache does not support RTR version %d, retrying with version %d",
+							errVersionDowngrade, from, c.currentVersion())
+					}
+				}
+				if p.ErrorCode == errNoDataAvailable {
+					log.Printf("RTR cache %s has no data available yet", c.address)
+					continue
+				}
+				return fmt.Errorf("RTR error report %d: %s", p.ErrorCode, p.ErrorText)
+			}
+		}
+	}
+}
+
+// sendQuery asks for the changes since the last serial, or for the full set
+// if the client has not synced yet
+func (c *Client) sendQuery(conn net.Conn) error {
+	c.mu.RLock()
+	p := &pdu{Version: c.version, Type: pduResetQuery}
+	if c.synced {
+		p = &pdu{Version: c.version, Type: pduSerialQuery, SessionID: c.sessionID, Serial: c.serial}
+	}
+	c.mu.RUnlock()
+
+	if err := writePDU(conn, p); err != nil {
+		return fmt.Errorf("failed to send RTR query: %w", err)
+	}
+	return nil
+}
+
+// refreshInterval returns the configured refresh interval, falling back to
+// the one announced by the cache
+func (c *Client) refreshInterval(announced ...time.Duration) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.refresh > 0 {
+		return c.refresh
+	}
+	if len(announced) > 0 && announced[0] > 0 {
+		return announced[0]
+	}
+	return defaultRefresh
+}
+
+// downgrade lowers the protocol version to the one the cache reported in
+// its error, or by one if it reported no lower version
+func (c *Client) downgrade(supported uint8) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.version == Version0 {
+		return false
+	}
+	if supported < c.version {
+		c.version = supported
+	} else {
+		c.version--
+	}
+	c.synced = false
+	return true
+}
+
+func (c *Client) currentVersion() uint8 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
@@ -0,0 +1,140 @@
+package rpki
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// startCache serves cache on a loopback listener and returns its address
+func startCache(t *testing.T, cache *Cache) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go cache.Serve(listener)
+	return listener.Addr().String()
+}
+
+func startClient(t *testing.T, address string) *Client {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	client := NewClient(address, 0)
+	go client.Start(ctx)
+	return client
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func vrp(prefix string, maxLength uint8, asn uint32) VRP {
+	return VRP{Prefix: netip.MustParsePrefix(prefix), MaxLength: maxLength, ASN: asn}
+}
+
+func TestClientSync(t *testing.T) {
+	cache := NewCache(42)
+	cache.SetVRPs([]VRP{vrp("192.0.2.0/24", 24, 64500)})
+	cache.SetASPAs(map[uint32][]uint32{64500: {64501}})
+	client := startClient(t, startCache(t, cache))
+
+	// Reset Query
+	waitFor(t, "initial sync", func() bool { return client.Status().Serial == 2 })
+	status := client.Status()
+	if status.VRPs != 1 || status.ASPAs != 1 || status.SessionID != 42 || status.Version != Version2 {
+		t.Fatalf("unexpected status after reset: %+v", status)
+	}
+
+	// Serial Notify followed by an incremental Serial Query
+	cache.SetVRPs([]VRP{vrp("198.51.100.0/22", 24, 64500), vrp("2001:db8::/32", 48, 64501)})
+	waitFor(t, "incremental sync", func() bool { return client.Status().Serial == 3 })
+
+	vrps := client.Table().Snapshot()
+	for _, want := range []VRP{vrp("198.51.100.0/22", 24, 64500), vrp("2001:db8::/32", 48, 64501)} {
+		if _, ok := vrps[want]; !ok {
+			t.Errorf("missing %+v after incremental sync", want)
+		}
+	}
+	if len(vrps) != 2 {
+		t.Errorf("expected 2 VRPs after incremental sync, got %d", len(vrps))
+	}
+	if client.Table().ASPALen() != 1 {
+		t.Errorf("ASPAs lost in incremental sync")
+	}
+}
+
+func TestClientDowngrade(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache uint8
+		aspas int
+	}{
+		{name: "version 1 cache", cache: Version1, aspas: 0},
+		{name: "version 0 cache", cache: Version0, aspas: 0},
+		{name: "version 2 cache", cache: Version2, aspas: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(1)
+			cache.SetVersion(tt.cache)
+			cache.SetVRPs([]VRP{vrp("192.0.2.0/24", 24, 64500)})
+			cache.SetASPAs(map[uint32][]uint32{64500: {64501}})
+			client := startClient(t, startCache(t, cache))
+
+			// Well within the retry interval, so the downgrade must reconnect
+			// immediately
+			waitFor(t, "sync", func() bool { return client.Status().VRPs == 1 })
+			status := client.Status()
+			if status.Version != tt.cache {
+				t.Errorf("expected version %d, got %d", tt.cache, status.Version)
+			}
+			if status.ASPAs != tt.aspas {
+				t.Errorf("expected %d ASPAs, got %d", tt.aspas, status.ASPAs)
+			}
+		})
+	}
+}
+
+func TestClientDowngradeError(t *testing.T) {
+	client, server := net.Pipe()
+	cache := NewCache(1)
+	cache.SetVersion(Version0)
+	go cache.handleConn(server)
+
+	c := NewClient("pipe", 0)
+	err := c.Run(context.Background(), client)
+	want := "RTR version downgrade: cache does not support RTR version 2, retrying with version 0"
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestClientExpire(t *testing.T) {
+	cache := NewCache(1)
+	cache.SetVRPs([]VRP{vrp("192.0.2.0/24", 24, 64500)})
+	client := startClient(t, startCache(t, cache))
+	waitFor(t, "sync", func() bool { return client.Status().VRPs == 1 })
+
+	client.mu.Lock()
+	client.expire = 100 * time.Millisecond
+	client.mu.Unlock()
+	cache.Disconnect()
+
+	waitFor(t, "expiry", func() bool { return client.Status().VRPs == 0 })
+	if state := client.Table().Validate(netip.MustParsePrefix("192.0.2.0/24"), 64501); state != StateNotFound {
+		t.Errorf("expected %s after expiry, got %s", StateNotFound, state)
+	}
+}
@@ -0,0 +1,219 @@
+package rpki
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// RTR protocol versions (RFC 6810, RFC 8210, draft-ietf-sidrops-8210bis)
+const (
+	Version0 uint8 = 0
+	Version1 uint8 = 1
+	Version2 uint8 = 2
+)
+
+// RTR PDU types
+const (
+	pduSerialNotify  uint8 = 0
+	pduSerialQuery   uint8 = 1
+	pduResetQuery    uint8 = 2
+	pduCacheResponse uint8 = 3
+	pduIPv4Prefix    uint8 = 4
+	pduIPv6Prefix    uint8 = 6
+	pduEndOfData     uint8 = 7
+	pduCacheReset    uint8 = 8
+	pduRouterKey     uint8 = 9
+	pduErrorReport   uint8 = 10
+	pduASPA          uint8 = 11
+)
+
+// RTR error codes
+const (
+	errCorruptData                uint16 = 0
+	errInternalError              uint16 = 1
+	errNoDataAvailable            uint16 = 2
+	errInvalidRequest             uint16 = 3
+	errUnsupportedProtocolVersion uint16 = 4
+	errUnsupportedPDUType         uint16 = 5
+)
+
+const (
+	rtrHeaderLen = 8
+	rtrMaxPDULen = 1 << 16
+
+	flagAnnounce = 1
+)
+
+// pdu is a decoded RTR protocol data unit. Fields are only meaningful for
+// the PDU types that carry them.
+type pdu struct {
+	Version   uint8
+	Type      uint8
+	SessionID uint16
+	Serial    uint32
+
+	// Prefix PDUs
+	Flags     uint8
+	Prefix    netip.Prefix
+	MaxLength uint8
+	ASN       uint32
+
+	// ASPA (version 2 and later). The customer is carried in ASN.
+	Providers []uint32
+
+	// End of Data (version 1 and later)
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+
+	// Error Report
+	ErrorCode uint16
+	ErrorText string
+}
+
+func readPDU(r io.Reader) (*pdu, error) {
+	header := make([]byte, rtrHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[4:8])
+	if length < rtrHeaderLen || length > rtrMaxPDULen {
+		return nil, fmt.Errorf("invalid RTR PDU length %d", length)
+	}
+
+	data := make([]byte, length)
+	copy(data, header)
+	if _, err := io.ReadFull(r, data[rtrHeaderLen:]); err != nil {
+		return nil, err
+	}
+
+	return decodePDU(data)
+}
+
+func decodePDU(data []byte) (*pdu, error) {
+	p := &pdu{
+		Version:   data[0],
+		Type:      data[1],
+		SessionID: binary.BigEndian.Uint16(data[2:4]),
+	}
+	body := data[rtrHeaderLen:]
+
+	switch p.Type {
+	case pduSerialNotify, pduSerialQuery:
+		if len(body) < 4 {
+			return nil, fmt.Errorf("short RTR PDU type %d", p.Type)
+		}
+		p.Serial = binary.BigEndian.Uint32(body[0:4])
+
+	case pduEndOfData:
+		if len(body) < 4 {
+			return nil, fmt.Errorf("short RTR End of Data PDU")
+		}
+		p.Serial = binary.BigEndian.Uint32(body[0:4])
+		if p.Version >= Version1 && len(body) >= 16 {
+			p.Refresh = binary.BigEndian.Uint32(body[4:8])
+			p.Retry = binary.BigEndian.Uint32(body[8:12])
+			p.Expire = binary.BigEndian.Uint32(body[12:16])
+		}
+
+	case pduIPv4Prefix, pduIPv6Prefix:
+		addrLen := 4
+		if p.Type == pduIPv6Prefix {
+			addrLen = 16
+		}
+		if len(body) < 4+addrLen+4 {
+			return nil, fmt.Errorf("short RTR prefix PDU")
+		}
+		p.Flags = body[0]
+		prefixLen := int(body[1])
+		p.MaxLength = body[2]
+		addr, _ := netip.AddrFromSlice(body[4 : 4+addrLen])
+		prefix, err := addr.Prefix(prefixLen)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RTR prefix: %w", err)
+		}
+		p.Prefix = prefix
+		p.ASN = binary.BigEndian.Uint32(body[4+addrLen : 8+addrLen])
+
+	case pduASPA:
+		// The session ID field holds the flags
+		p.Flags = data[2]
+		if len(body) < 4 || len(body)%4 != 0 {
+			return nil, fmt.Errorf("invalid RTR ASPA PDU length %d", len(data))
+		}
+		p.ASN = binary.BigEndian.Uint32(body[0:4])
+		for i := 4; i < len(body); i += 4 {
+			p.Providers = append(p.Providers, binary.BigEndian.Uint32(body[i:i+4]))
+		}
+
+	case pduErrorReport:
+		p.ErrorCode = p.SessionID
+		if len(body) >= 4 {
+			pduLen := int(binary.BigEndian.Uint32(body[0:4]))
+			if len(body) >= 8+pduLen {
+				textLen := int(binary.BigEndian.Uint32(body[4+pduLen : 8+pduLen]))
+				if len(body) >= 8+pduLen+textLen {
+					p.ErrorText = string(body[8+pduLen : 8+pduLen+textLen])
+				}
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func (p *pdu) encode() []byte {
+	var body []byte
+
+	switch p.Type {
+	case pduSerialNotify, pduSerialQuery:
+		body = binary.BigEndian.AppendUint32(nil, p.Serial)
+
+	case pduEndOfData:
+		body = binary.BigEndian.AppendUint32(nil, p.Serial)
+		if p.Version >= Version1 {
+			body = binary.BigEndian.AppendUint32(body, p.Refresh)
+			body = binary.BigEndian.AppendUint32(body, p.Retry)
+			body = binary.BigEndian.AppendUint32(body, p.Expire)
+		}
+
+	case pduIPv4Prefix, pduIPv6Prefix:
+		body = []byte{p.Flags, uint8(p.Prefix.Bits()), p.MaxLength, 0}
+		body = append(body, p.Prefix.Addr().AsSlice()...)
+		body = binary.BigEndian.AppendUint32(body, p.ASN)
+
+	case pduASPA:
+		body = binary.BigEndian.AppendUint32(nil, p.ASN)
+		for _, provider := range p.Providers {
+			body = binary.BigEndian.AppendUint32(body, provider)
+		}
+
+	case pduErrorReport:
+		body = binary.BigEndian.AppendUint32(nil, 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(p.ErrorText)))
+		body = append(body, p.ErrorText...)
+	}
+
+	session := p.SessionID
+	switch p.Type {
+	case pduErrorReport:
+		session = p.ErrorCode
+	case pduASPA:
+		session = uint16(p.Flags) << 8
+	}
+
+	data := make([]byte, rtrHeaderLen, rtrHeaderLen+len(body))
+	data[0] = p.Version
+	data[1] = p.Type
+	binary.BigEndian.PutUint16(data[2:4], session)
+	binary.BigEndian.PutUint32(data[4:8], uint32(rtrHeaderLen+len(body)))
+	return append(data, body...)
+}
+
+func writePDU(w io.Writer, p *pdu) error {
+	_, err := w.Write(p.encode())
+	return err
+}
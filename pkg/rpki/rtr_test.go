@@ -0,0 +1,167 @@
+package rpki
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPDURoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		pdu  pdu
+	}{
+		{name: "Serial Notify", pdu: pdu{Version: Version1, Type: pduSerialNotify, SessionID: 42, Serial: 7}},
+		{name: "Serial Query", pdu: pdu{Version: Version2, Type: pduSerialQuery, SessionID: 42, Serial: 1 << 31}},
+		{name: "Reset Query", pdu: pdu{Version: Version0, Type: pduResetQuery}},
+		{name: "Cache Response", pdu: pdu{Version: Version1, Type: pduCacheResponse, SessionID: 42}},
+		{name: "Cache Reset", pdu: pdu{Version: Version1, Type: pduCacheReset}},
+		{
+			name: "IPv4 Prefix",
+			pdu:  pdu{Version: Version1, Type: pduIPv4Prefix, Flags: flagAnnounce, Prefix: netip.MustParsePrefix("192.0.2.0/24"), MaxLength: 24, ASN: 64500},
+		},
+		{
+			name: "IPv4 Prefix withdrawal",
+			pdu:  pdu{Version: Version1, Type: pduIPv4Prefix, Prefix: netip.MustParsePrefix("198.51.100.0/22"), MaxLength: 24, ASN: 64501},
+		},
+		{
+			name: "IPv6 Prefix",
+			pdu:  pdu{Version: Version2, Type: pduIPv6Prefix, Flags: flagAnnounce, Prefix: netip.MustParsePrefix("2001:db8::/32"), MaxLength: 48, ASN: 4200000000},
+		},
+		{name: "End of Data version 0", pdu: pdu{Version: Version0, Type: pduEndOfData, SessionID: 42, Serial: 9}},
+		{
+			name: "End of Data with timers",
+			pdu:  pdu{Version: Version1, Type: pduEndOfData, SessionID: 42, Serial: 9, Refresh: 3600, Retry: 600, Expire: 7200},
+		},
+		{name: "ASPA", pdu: pdu{Version: Version2, Type: pduASPA, Flags: flagAnnounce, ASN: 64500, Providers: []uint32{64510, 64520}}},
+		{name: "ASPA withdrawal", pdu: pdu{Version: Version2, Type: pduASPA, ASN: 64500}},
+		{name: "Error Report", pdu: pdu{Version: Version1, Type: pduErrorReport, ErrorCode: errNoDataAvailable, ErrorText: "no data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writePDU(&buf, &tt.pdu); err != nil {
+				t.Fatalf("writePDU: %v", err)
+			}
+			got, err := readPDU(&buf)
+			if err != nil {
+				t.Fatalf("readPDU: %v", err)
+			}
+
+			// The session ID field carries the error code or the ASPA flags
+			want := tt.pdu
+			switch want.Type {
+			case pduErrorReport:
+				want.SessionID = want.ErrorCode
+			case pduASPA:
+				want.SessionID = uint16(want.Flags) << 8
+			}
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("readPDU() = %+v, want %+v", *got, want)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%d bytes left after the PDU", buf.Len())
+			}
+		})
+	}
+}
+
+// rawPDU builds a PDU with the given header fields and body
+func rawPDU(version, typ uint8, session uint16, body ...byte) []byte {
+	data := []byte{version, typ, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(data[2:4], session)
+	binary.BigEndian.PutUint32(data[4:8], uint32(rtrHeaderLen+len(body)))
+	return append(data, body...)
+}
+
+func TestReadPDU(t *testing.T) {
+	// An Error Report that encapsulates the Serial Query it refuses
+	query := rawPDU(Version1, pduSerialQuery, 42, 0, 0, 0, 7)
+	report := binary.BigEndian.AppendUint32(nil, uint32(len(query)))
+	report = append(report, query...)
+	report = binary.BigEndian.AppendUint32(report, 7)
+	report = append(report, "corrupt"...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *pdu
+		wantErr string
+	}{
+		{
+			name: "Error Report with encapsulated PDU",
+			data: rawPDU(Version1, pduErrorReport, errCorruptData, report...),
+			want: &pdu{Version: Version1, Type: pduErrorReport, SessionID: errCorruptData, ErrorCode: errCorruptData, ErrorText: "corrupt"},
+		},
+		{
+			name: "Error Report with truncated text",
+			data: rawPDU(Version1, pduErrorReport, errInternalError, 0, 0, 0, 0, 0, 0, 0, 9, 'x'),
+			want: &pdu{Version: Version1, Type: pduErrorReport, SessionID: errInternalError, ErrorCode: errInternalError},
+		},
+		{
+			name: "End of Data version 1 without timers",
+			data: rawPDU(Version1, pduEndOfData, 42, 0, 0, 0, 9),
+			want: &pdu{Version: Version1, Type: pduEndOfData, SessionID: 42, Serial: 9},
+		},
+		{
+			name: "unknown type",
+			data: rawPDU(Version1, 99, 42, 1, 2, 3, 4),
+			want: &pdu{Version: Version1, Type: 99, SessionID: 42},
+		},
+		{name: "short Serial Notify", data: rawPDU(Version1, pduSerialNotify, 42, 0, 0), wantErr: "short RTR PDU type 0"},
+		{name: "short End of Data", data: rawPDU(Version1, pduEndOfData, 42), wantErr: "short RTR End of Data PDU"},
+		{name: "short IPv4 Prefix", data: rawPDU(Version1, pduIPv4Prefix, 0, 1, 24, 24, 0, 192, 0, 2, 0), wantErr: "short RTR prefix PDU"},
+		{name: "short IPv6 Prefix", data: rawPDU(Version1, pduIPv6Prefix, 0, 1, 32, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0), wantErr: "short RTR prefix PDU"},
+		{name: "IPv4 prefix too long", data: rawPDU(Version1, pduIPv4Prefix, 0, 1, 33, 33, 0, 192, 0, 2, 0, 0, 0, 0xfb, 0xf4), wantErr: "invalid RTR prefix"},
+		{name: "ASPA without customer", data: rawPDU(Version2, pduASPA, 0x0100), wantErr: "invalid RTR ASPA PDU length 8"},
+		{name: "ASPA with partial provider", data: rawPDU(Version2, pduASPA, 0x0100, 0, 0, 0xfb, 0xf4, 0, 0), wantErr: "invalid RTR ASPA PDU length 14"},
+		{name: "length below header", data: []byte{1, pduResetQuery, 0, 0, 0, 0, 0, 4}, wantErr: "invalid RTR PDU length 4"},
+		{name: "length above maximum", data: []byte{1, pduResetQuery, 0, 0, 0, 1, 0, 1}, wantErr: "invalid RTR PDU length 65537"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPDU(bytes.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readPDU() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readPDU: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPDU() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPDUTruncated(t *testing.T) {
+	data := (&pdu{Version: Version1, Type: pduSerialNotify, SessionID: 42, Serial: 7}).encode()
+
+	tests := []struct {
+		name string
+		n    int
+		want error
+	}{
+		{name: "no data", n: 0, want: io.EOF},
+		{name: "partial header", n: 4, want: io.ErrUnexpectedEOF},
+		{name: "partial body", n: len(data) - 1, want: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readPDU(bytes.NewReader(data[:tt.n])); !errors.Is(err, tt.want) {
+				t.Errorf("readPDU() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package rpki
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// State is the outcome of route origin validation (RFC 6811) or of AS path
+// verification
+type State string
+
+const (
+	StateValid    State = "Valid"
+	StateInvalid  State = "Invalid"
+	StateNotFound State = "NotFound"
+
+	// No ASPA covers a hop of the path
+	StateUnknown State = "Unknown"
+)
+
+// VRP is a Validated ROA Payload
+type VRP struct {
+	Prefix    netip.Prefix
+	MaxLength uint8
+	ASN       uint32
+}
+
+// Table holds the current VRP and ASPA sets and validates routes against
+// them
+type Table struct {
+	vrps      map[VRP]struct{}
+	index     map[netip.Prefix][]VRP
+	aspas     map[uint32][]uint32
+	serial    uint32
+	updated   time.Time
+	listeners []func()
+	mu        sync.RWMutex
+}
+
+func NewTable() *Table {
+	return &Table{
+		vrps:  make(map[VRP]struct{}),
+		index: make(map[netip.Prefix][]VRP),
+		aspas: make(map[uint32][]uint32),
+	}
+}
+
+// Replace swaps in complete VRP and ASPA sets and notifies listeners. ASPAs
+// map customer ASNs to their providers.
+func (t *Table) Replace(vrps map[VRP]struct{}, aspas map[uint32][]uint32, serial uint32) {
+	index := make(map[netip.Prefix][]VRP)
+	for vrp := range vrps {
+		index[vrp.Prefix] = append(index[vrp.Prefix], vrp)
+	}
+
+	t.mu.Lock()
+	t.vrps = vrps
+	t.index = index
+	t.aspas = aspas
+	t.serial = serial
+	t.updated = time.Now()
+	listeners := append([]func(){}, t.listeners...)
+	t.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// OnChange registers a function that is called after every VRP set update
+func (t *Table) OnChange(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// Snapshot returns a copy of the current VRP set
+func (t *Table) Snapshot() map[VRP]struct{} {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	vrps := make(map[VRP]struct{}, len(t.vrps))
+	for vrp := range t.vrps {
+		vrps[vrp] = struct{}{}
+	}
+	return vrps
+}
+
+// ASPAs returns a copy of the current ASPA set
+func (t *Table) ASPAs() map[uint32][]uint32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	aspas := make(map[uint32][]uint32, len(t.aspas))
+	for customer, providers := range t.aspas {
+		aspas[customer] = providers
+	}
+	return aspas
+}
+
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.vrps)
+}
+
+func (t *Table) ASPALen() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.aspas)
+}
+
+func (t *Table) Serial() uint32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.serial
+}
+
+func (t *Table) Updated() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.updated
+}
+
+// Validate performs route origin validation of a prefix announced by the
+// given origin AS. An origin of 0 means the origin could not be determined
+// (e.g. the AS_PATH ends in an AS_SET) and never matches a VRP.
+func (t *Table) Validate(prefix netip.Prefix, origin uint32) State {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	prefix = prefix.Masked()
+	covered := false
+	for bits := 0; bits <= prefix.Bits(); bits++ {
+		candidate, err := prefix.Addr().Prefix(bits)
+		if err != nil {
+			continue
+		}
+		for _, vrp := range t.index[candidate] {
+			covered = true
+			if origin != 0 && vrp.ASN == origin && prefix.Bits() <= int(vrp.MaxLength) {
+				return StateValid
+			}
+		}
+	}
+
+	if covered {
+		return StateInvalid
+	}
+	return StateNotFound
+}
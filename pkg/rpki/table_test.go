@@ -0,0 +1,45 @@
+package rpki
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestTableValidate(t *testing.T) {
+	table := NewTable()
+	table.Replace(map[VRP]struct{}{
+		vrp("192.0.2.0/24", 24, 64500):    {},
+		vrp("198.51.100.0/22", 24, 64500): {},
+		vrp("198.51.100.0/22", 22, 64501): {},
+		vrp("2001:db8::/32", 48, 64502):   {},
+	}, nil, 1)
+
+	tests := []struct {
+		name   string
+		prefix string
+		origin uint32
+		want   State
+	}{
+		{name: "exact match", prefix: "192.0.2.0/24", origin: 64500, want: StateValid},
+		{name: "wrong origin", prefix: "192.0.2.0/24", origin: 64501, want: StateInvalid},
+		{name: "within max length", prefix: "198.51.101.0/24", origin: 64500, want: StateValid},
+		{name: "beyond max length", prefix: "198.51.101.0/25", origin: 64500, want: StateInvalid},
+		{name: "second VRP for prefix", prefix: "198.51.100.0/22", origin: 64501, want: StateValid},
+		{name: "max length of other VRP", prefix: "198.51.100.0/23", origin: 64501, want: StateInvalid},
+		{name: "less specific than VRP", prefix: "192.0.0.0/16", origin: 64500, want: StateNotFound},
+		{name: "uncovered", prefix: "203.0.113.0/24", origin: 64500, want: StateNotFound},
+		{name: "unknown origin", prefix: "192.0.2.0/24", origin: 0, want: StateInvalid},
+		{name: "unmasked prefix", prefix: "192.0.2.1/24", origin: 64500, want: StateValid},
+		{name: "IPv6 valid", prefix: "2001:db8:1::/48", origin: 64502, want: StateValid},
+		{name: "IPv6 too specific", prefix: "2001:db8:1::/64", origin: 64502, want: StateInvalid},
+		{name: "IPv6 uncovered", prefix: "2001:db9::/32", origin: 64502, want: StateNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.Validate(netip.MustParsePrefix(tt.prefix), tt.origin); got != tt.want {
+				t.Errorf("Validate(%s, %d) = %s, want %s", tt.prefix, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
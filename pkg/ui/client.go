@@ -0,0 +1,519 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namesarnav/netmeta/internal/config"
+	"github.com/namesarnav/netmeta/pkg/bgp"
+)
+
+const clientTimeout = 30 * time.Second
+
+// Client calls the REST API of a running server. CLI commands that change
+// the state of the monitor go through it instead of starting a second one.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	// transfer has no timeout, for uploads and downloads of whole files
+	transfer *http.Client
+}
+
+// NewClient creates a client for the server configured in cfg.API. A
+// wildcard listen address is reached over loopback.
+func NewClient(cfg *config.Config) *Client {
+	host := cfg.API.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return &Client{
+		baseURL:  "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.API.Port)) + "/api/v1",
+		http:     &http.Client{Timeout: clientTimeout},
+		transfer: &http.Client{},
+	}
+}
+
+// AddPeer adds a peer to the running server
+func (c *Client) AddPeer(peer config.BGPPeer) error {
+	return c.do(http.MethodPost, "/bgp/peers", nil, newPeerRequest(peer), nil)
+}
+
+// UpdatePeer replaces the configuration of a peer on the running server
+func (c *Client) UpdatePeer(peer config.BGPPeer) error {
+	return c.do(http.MethodPut, "/bgp/peers/"+url.PathEscape(peer.Address), nil, newPeerRequest(peer), nil)
+}
+
+func (c *Client) RemovePeer(address string) error {
+	return c.do(http.MethodDelete, "/bgp/peers/"+url.PathEscape(address), nil, nil, nil)
+}
+
+func (c *Client) EnablePeer(address string) error {
+	return c.do(http.MethodPost, "/bgp/peers/"+url.PathEscape(address)+"/enable", nil, nil, nil)
+}
+
+func (c *Client) DisablePeer(address, reason string) error {
+	body := map[string]string{"reason": reason}
+	return c.do(http.MethodPost, "/bgp/peers/"+url.PathEscape(address)+"/disable", nil, body, nil)
+}
+
+func (c *Client) ResetPeer(address, direction string) error {
+	query := url.Values{"direction": {direction}}
+	return c.do(http.MethodPost, "/bgp/peers/"+url.PathEscape(address)+"/reset", query, nil, nil)
+}
+
+// RestorePeer accepts the routes of a withdrawn peer again
+func (c *Client) RestorePeer(address string) error {
+	return c.do(http.MethodPost, "/bgp/peers/"+url.PathEscape(address)+"/restore", nil, nil, nil)
+}
+
+// PeerRoutes lists the Adj-RIB-In or Adj-RIB-Out of a peer, optionally
+// filtered by prefix
+func (c *Client) PeerRoutes(address, rib, prefix, match string) ([]*bgp.Route, error) {
+	query := url.Values{"prefix": {prefix}}
+	if rib != "" {
+		query.Set("rib", rib)
+	}
+	if match != "" {
+		query.Set("match", match)
+	}
+	var routes []*bgp.Route
+	if err := c.do(http.MethodGet, "/bgp/peers/"+url.PathEscape(address)+"/routes", query, nil, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// PeerHistory returns the FSM transitions of a peer, oldest first
+func (c *Client) PeerHistory(address string) ([]bgp.FSMTransition, error) {
+	var history []bgp.FSMTransition
+	if err := c.do(http.MethodGet, "/bgp/peers/"+url.PathEscape(address)+"/history", nil, nil, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Lookup explains the best path selection for an address
+func (c *Client) Lookup(ip string) (*bgp.LookupResult, error) {
+	var result bgp.LookupResult
+	if err := c.do(http.MethodGet, "/bgp/lookup", url.Values{"ip": {ip}}, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Findings lists the hijacks and route leaks detected in a peer's routes,
+// or in those of every peer
+func (c *Client) Findings(peer string) ([]*bgp.Finding, error) {
+	var findings []*bgp.Finding
+	if err := c.do(http.MethodGet, "/bgp/findings", url.Values{"peer": {peer}}, nil, &findings); err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+// InvalidRoutes lists the RPKI-invalid routes of a peer, or of every peer
+func (c *Client) InvalidRoutes(peer string) ([]*bgp.InvalidRoute, error) {
+	var invalid []*bgp.InvalidRoute
+	if err := c.do(http.MethodGet, "/rpki/invalid", url.Values{"peer": {peer}}, nil, &invalid); err != nil {
+		return nil, err
+	}
+	return invalid, nil
+}
+
+// ASPASummary counts the ASPA verification states of the routes of a peer,
+// or of every peer, with up to samples routes in the given state
+func (c *Client) ASPASummary(peer, state string, samples int) ([]*bgp.ASPASummary, error) {
+	query := url.Values{"peer": {peer}, "samples": {strconv.Itoa(samples)}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	var summaries []*bgp.ASPASummary
+	if err := c.do(http.MethodGet, "/rpki/aspa", query, nil, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// VRFs summarizes the VRFs and their routes from a peer, or from every peer
+func (c *Client) VRFs(peer string) ([]*bgp.VRFSummary, error) {
+	var vrfs []*bgp.VRFSummary
+	if err := c.do(http.MethodGet, "/bgp/vrfs", url.Values{"peer": {peer}}, nil, &vrfs); err != nil {
+		return nil, err
+	}
+	return vrfs, nil
+}
+
+// VRFRoutes lists the routes imported into a VRF, optionally filtered by
+// peer and prefix
+func (c *Client) VRFRoutes(vrf, peer, prefix, match string) ([]*bgp.VRFRoute, error) {
+	query := url.Values{"peer": {peer}, "prefix": {prefix}}
+	if match != "" {
+		query.Set("match", match)
+	}
+	var routes []*bgp.VRFRoute
+	if err := c.do(http.MethodGet, "/bgp/vrfs/"+url.PathEscape(vrf)+"/routes", query, nil, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// NoisyPrefixes returns up to limit of the prefixes with the highest
+// dampening penalty
+func (c *Client) NoisyPrefixes(limit int) ([]*bgp.PrefixDampening, error) {
+	var prefixes []*bgp.PrefixDampening
+	if err := c.do(http.MethodGet, "/bgp/dampening", url.Values{"limit": {strconv.Itoa(limit)}}, nil, &prefixes); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
+
+// FlowSpecRules lists the FlowSpec rules received from a peer, or from
+// every peer
+func (c *Client) FlowSpecRules(peer string) ([]*bgp.FlowSpecRule, error) {
+	var rules []*bgp.FlowSpecRule
+	if err := c.do(http.MethodGet, "/bgp/flowspec", url.Values{"peer": {peer}}, nil, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// FlowSpecInjections lists the FlowSpec rules originated by the running
+// server
+func (c *Client) FlowSpecInjections() ([]*bgp.FlowSpecInjection, error) {
+	var rules []*bgp.FlowSpecInjection
+	if err := c.do(http.MethodGet, "/bgp/flowspec/injections", nil, nil, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Analytics summarizes the AS paths and communities of a peer's routes, or
+// of every peer's, with the top entries of each ranking
+func (c *Client) Analytics(peer string, top int) ([]*bgp.RouteAnalytics, error) {
+	query := url.Values{"peer": {peer}, "top": {strconv.Itoa(top)}}
+	var analytics []*bgp.RouteAnalytics
+	if err := c.do(http.MethodGet, "/bgp/analytics", query, nil, &analytics); err != nil {
+		return nil, err
+	}
+	return analytics, nil
+}
+
+// LinkStateTopology returns the IGP topology learned through BGP-LS
+func (c *Client) LinkStateTopology() (*bgp.LSTopology, error) {
+	var topology bgp.LSTopology
+	if err := c.do(http.MethodGet, "/bgp/ls/topology", nil, nil, &topology); err != nil {
+		return nil, err
+	}
+	return &topology, nil
+}
+
+// Global returns the configuration of the local BGP speaker
+func (c *Client) Global() (*bgp.GlobalConfig, error) {
+	var global bgp.GlobalConfig
+	if err := c.do(http.MethodGet, "/bgp/global", nil, nil, &global); err != nil {
+		return nil, err
+	}
+	return &global, nil
+}
+
+// Peer returns the state and configuration of a peer, with the password
+// redacted
+func (c *Client) Peer(address string) (*bgp.PeerState, error) {
+	var peer bgp.PeerState
+	if err := c.do(http.MethodGet, "/bgp/peers/"+url.PathEscape(address), nil, nil, &peer); err != nil {
+		return nil, err
+	}
+	return &peer, nil
+}
+
+// InjectRoute announces a route through the running server, which withdraws
+// it when the TTL expires
+func (c *Client) InjectRoute(req bgp.InjectRequest) (*bgp.Injection, error) {
+	body := injectRequest{
+		Prefix:      req.Prefix,
+		NextHop:     req.NextHop,
+		Communities: req.Communities,
+		LocalPref:   req.LocalPref,
+		TTLSec:      int(req.TTL.Seconds()),
+		Reason:      req.Reason,
+	}
+	var injection bgp.Injection
+	if err := c.do(http.MethodPost, "/bgp/injections", nil, body, &injection); err != nil {
+		return nil, err
+	}
+	return &injection, nil
+}
+
+func (c *Client) WithdrawInjectedRoute(prefix, reason string) error {
+	query := url.Values{"prefix": {prefix}, "reason": {reason}}
+	return c.do(http.MethodDelete, "/bgp/injections", query, nil, nil)
+}
+
+// InjectFlowSpec originates a FlowSpec rule through the running server,
+// which withdraws it when the TTL expires
+func (c *Client) InjectFlowSpec(req bgp.FlowSpecRequest) (*bgp.FlowSpecInjection, error) {
+	body := flowSpecInjectRequest{
+		Destination:      req.Destination,
+		Source:           req.Source,
+		Protocols:        req.Protocols,
+		DestinationPorts: req.DestinationPorts,
+		SourcePorts:      req.SourcePorts,
+		PacketLengths:    req.PacketLengths,
+		Action:           req.Action,
+		RateBps:          req.Rate,
+		TTLSec:           int(req.TTL.Seconds()),
+		Reason:           req.Reason,
+	}
+	var rule bgp.FlowSpecInjection
+	if err := c.do(http.MethodPost, "/bgp/flowspec/injections", nil, body, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (c *Client) WithdrawFlowSpec(rule, reason string) error {
+	query := url.Values{"rule": {rule}, "reason": {reason}}
+	return c.do(http.MethodDelete, "/bgp/flowspec/injections", query, nil, nil)
+}
+
+// WithdrawVRF stops using the routes a peer sends for a VRF. On a partial
+// failure the report of what was withdrawn is returned with the error.
+func (c *Client) WithdrawVRF(peer, vrf string) (*bgp.WithdrawReport, error) {
+	var report bgp.WithdrawReport
+	err := c.do(http.MethodPost, "/bgp/vrfs/"+url.PathEscape(vrf)+"/withdraw", url.Values{"peer": {peer}}, nil, &report)
+	var e *responseError
+	if errors.As(err, &e) && len(e.Report) > 0 {
+		if json.Unmarshal(e.Report, &report) == nil {
+			return &report, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) RestoreVRF(peer, vrf string) error {
+	return c.do(http.MethodPost, "/bgp/vrfs/"+url.PathEscape(vrf)+"/restore", url.Values{"peer": {peer}}, nil, nil)
+}
+
+// ListSnapshots lists the RIB snapshots of the running server
+func (c *Client) ListSnapshots() ([]*bgp.SnapshotInfo, error) {
+	var snapshots []*bgp.SnapshotInfo
+	if err := c.do(http.MethodGet, "/bgp/snapshots", nil, nil, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// RIBAt returns the newest snapshot taken at or before at
+func (c *Client) RIBAt(at time.Time, peer string) (*bgp.RIBSnapshot, error) {
+	query := url.Values{"at": {at.Format(time.RFC3339Nano)}, "peer": {peer}}
+	var snapshot bgp.RIBSnapshot
+	if err := c.do(http.MethodGet, "/bgp/rib", query, nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DiffRIB compares the snapshots at from and to, or the current RIB if to
+// is zero
+func (c *Client) DiffRIB(from, to time.Time, peer string) (*bgp.RIBDiff, error) {
+	query := url.Values{"from": {from.Format(time.RFC3339Nano)}, "peer": {peer}}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339Nano))
+	}
+	var diff bgp.RIBDiff
+	if err := c.do(http.MethodGet, "/bgp/diff", query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// ImportMRT uploads an MRT file, compressed or not, to the running server
+func (c *Client) ImportMRT(path string) (*bgp.MRTImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MRT file: %w", err)
+	}
+	defer f.Close()
+
+	var stats bgp.MRTImportStats
+	if err := c.do(http.MethodPost, "/bgp/mrt/import", url.Values{"name": {filepath.Base(path)}}, f, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ExportMRT downloads the RIB of the running server as a TABLE_DUMP_V2 dump
+func (c *Client) ExportMRT(w io.Writer) error {
+	return c.do(http.MethodGet, "/bgp/mrt/export", nil, nil, w)
+}
+
+// ImportPCAP uploads a pcap or pcapng file to the running server. local
+// holds the addresses of the router the capture was taken on.
+func (c *Client) ImportPCAP(path string, local []string) (*bgp.PCAPImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pcap file: %w", err)
+	}
+	defer f.Close()
+
+	query := url.Values{"name": {filepath.Base(path)}, "local": local}
+	var stats bgp.PCAPImportStats
+	if err := c.do(http.MethodPost, "/bgp/pcap/import", query, f, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) PCAPSessions(peer string) ([]*bgp.BGPSession, error) {
+	var sessions []*bgp.BGPSession
+	if err := c.do(http.MethodGet, "/bgp/pcap/sessions", url.Values{"peer": {peer}}, nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// SimulatePolicy dry-runs a YAML, JSON or TOML policy file against the RIB
+// of the running server
+func (c *Client) SimulatePolicy(path, peer string) (*bgp.SimulationResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+	defer f.Close()
+
+	query := url.Values{
+		"peer":   {peer},
+		"name":   {path},
+		"format": {strings.TrimPrefix(filepath.Ext(path), ".")},
+	}
+	var result bgp.SimulationResult
+	if err := c.do(http.MethodPost, "/bgp/policy/simulate", query, f, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// responseError is an error response of the server, with the partial result
+// that some endpoints send along
+type responseError struct {
+	Message string          `json:"error"`
+	Report  json.RawMessage `json:"report"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out, unless it is nil. A body that is an io.Reader is
+// uploaded as is, and an out that is an io.Writer receives the raw response.
+// Error responses are returned with the message of the server.
+func (c *Client) do(method, path string, query url.Values, body, out interface{}) error {
+	client := c.http
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		client = c.transfer
+		reader = b
+		contentType = "application/octet-stream"
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	if _, ok := out.(io.Writer); ok {
+		client = c.transfer
+	}
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach netmeta server at %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e responseError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil && e.Message != "" {
+			return &e
+		}
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	switch o := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		if _, err := io.Copy(o, resp.Body); err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// newPeerRequest is the inverse of bindPeer
+func newPeerRequest(peer config.BGPPeer) peerRequest {
+	req := peerRequest{
+		Address:           peer.Address,
+		ASN:               peer.ASN,
+		Port:              peer.Port,
+		Families:          peer.Families,
+		Description:       peer.Description,
+		Password:          peer.Password,
+		LocalAddress:      peer.LocalAddress,
+		EBGPMultihopTTL:   peer.EBGPMultihopTTL,
+		TTLSecurityHops:   peer.TTLSecurityHops,
+		HoldTime:          peer.HoldTime,
+		KeepaliveInterval: peer.KeepaliveInterval,
+		GracefulRestart: gracefulRestartRequest{
+			Enabled:     peer.GracefulRestart.Enabled,
+			RestartTime: peer.GracefulRestart.RestartTime,
+		},
+		RouteReflectorClient: peer.RouteReflectorClient,
+		ClusterID:            peer.ClusterID,
+		Passive:              peer.Passive,
+		Role:                 peer.Role,
+	}
+	for _, l := range peer.MaxPrefixes {
+		req.MaxPrefixes = append(req.MaxPrefixes, maxPrefixRequest{
+			Family:      l.Family,
+			Limit:       l.Limit,
+			WarningPct:  l.WarningPct,
+			CriticalPct: l.CriticalPct,
+			Action:      l.Action,
+		})
+	}
+	return req
+}
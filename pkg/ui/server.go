@@ -2,9 +2,11 @@ package ui
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +15,17 @@ import (
 	"github.com/namesarnav/netmeta/pkg/auto"
 	"github.com/namesarnav/netmeta/pkg/bgp"
 	"github.com/namesarnav/netmeta/pkg/ospf"
+	"github.com/namesarnav/netmeta/pkg/rpki"
+)
+
+// Upload limits. MRT dumps are capped both as uploaded and once decompressed,
+// as a small compressed archive can expand to fill the memory.
+const (
+	maxMRTUpload = 512 << 20
+	maxMRTSize   = 4 << 30
+
+	maxPCAPUpload   = 1 << 30
+	maxPolicyUpload = 1 << 20
 )
 
 var upgrader = websocket.Upgrader{
@@ -25,11 +38,12 @@ type Server struct {
 	cfg        *config.Config
 	bgpMonitor *bgp.Monitor
 	ospfParser *ospf.Parser
+	rpkiClient *rpki.Client
 	autoEngine *auto.Engine
 	router     *gin.Engine
 }
 
-func NewServer(cfg *config.Config, bgpMonitor *bgp.Monitor, ospfParser *ospf.Parser, autoEngine *auto.Engine) *Server {
+func NewServer(cfg *config.Config, bgpMonitor *bgp.Monitor, ospfParser *ospf.Parser, rpkiClient *rpki.Client, autoEngine *auto.Engine) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
@@ -37,6 +51,7 @@ func NewServer(cfg *config.Config, bgpMonitor *bgp.Monitor, ospfParser *ospf.Par
 		cfg:        cfg,
 		bgpMonitor: bgpMonitor,
 		ospfParser: ospfParser,
+		rpkiClient: rpkiClient,
 		autoEngine: autoEngine,
 		router:     router,
 	}
@@ -59,8 +74,48 @@ func (s *Server) setupRoutes() {
 	// API endpoints
 	api := s.router.Group("/api/v1")
 	{
+		api.GET("/bgp/global", s.handleBGPGlobal)
 		api.GET("/bgp/peers", s.handleBGPPeers)
+		api.POST("/bgp/peers", s.handleBGPPeerAdd)
+		api.GET("/bgp/peers/:address", s.handleBGPPeer)
+		api.PUT("/bgp/peers/:address", s.handleBGPPeerUpdate)
+		api.DELETE("/bgp/peers/:address", s.handleBGPPeerRemove)
+		api.POST("/bgp/peers/:address/enable", s.handleBGPPeerEnable)
+		api.POST("/bgp/peers/:address/disable", s.handleBGPPeerDisable)
+		api.POST("/bgp/peers/:address/reset", s.handleBGPPeerReset)
+		api.POST("/bgp/peers/:address/restore", s.handleBGPPeerRestore)
+		api.GET("/bgp/peers/:address/history", s.handleBGPPeerHistory)
+		api.GET("/bgp/peers/:address/routes", s.handleBGPPeerRoutes)
+		api.GET("/bgp/dampening", s.handleBGPDampening)
+		api.GET("/bgp/analytics", s.handleBGPAnalytics)
+		api.GET("/bgp/lookup", s.handleBGPLookup)
+		api.GET("/bgp/snapshots", s.handleBGPSnapshots)
+		api.POST("/bgp/snapshots", s.handleBGPSnapshotTake)
+		api.GET("/bgp/rib", s.handleBGPRIBAt)
+		api.GET("/bgp/diff", s.handleBGPDiff)
+		api.POST("/bgp/policy/simulate", s.handleBGPPolicySimulate)
+		api.GET("/bgp/injections", s.handleBGPInjections)
+		api.POST("/bgp/injections", s.handleBGPInject)
+		api.DELETE("/bgp/injections", s.handleBGPInjectionWithdraw)
+		api.GET("/bgp/injections/audit", s.handleBGPInjectionAudit)
+		api.GET("/bgp/flowspec", s.handleBGPFlowSpec)
+		api.GET("/bgp/flowspec/injections", s.handleBGPFlowSpecInjections)
+		api.POST("/bgp/flowspec/injections", s.handleBGPFlowSpecInject)
+		api.DELETE("/bgp/flowspec/injections", s.handleBGPFlowSpecWithdraw)
+		api.GET("/bgp/vrfs", s.handleBGPVRFs)
+		api.GET("/bgp/vrfs/:name/routes", s.handleBGPVRFRoutes)
+		api.POST("/bgp/vrfs/:name/withdraw", s.handleBGPVRFWithdraw)
+		api.POST("/bgp/vrfs/:name/restore", s.handleBGPVRFRestore)
+		api.POST("/bgp/mrt/import", s.handleMRTImport)
+		api.GET("/bgp/mrt/export", s.handleMRTExport)
+		api.POST("/bgp/pcap/import", s.handlePCAPImport)
+		api.GET("/bgp/pcap/sessions", s.handlePCAPSessions)
+		api.GET("/bgp/findings", s.handleBGPFindings)
+		api.GET("/rpki/status", s.handleRPKIStatus)
+		api.GET("/rpki/invalid", s.handleRPKIInvalid)
+		api.GET("/rpki/aspa", s.handleASPA)
 		api.GET("/ospf/topology", s.handleOSPFTopology)
+		api.GET("/bgp/ls/topology", s.handleBGPLSTopology)
 		api.GET("/remediation/events", s.handleRemediationEvents)
 	}
 }
@@ -96,6 +151,9 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 					"prefixCount": peer.PrefixCount,
 					"flapCount":   peer.FlapCount,
 					"established": peer.Established,
+					"families":    peer.Families,
+					"rpkiInvalid": peer.RPKI.Invalid,
+					"aspaInvalid": peer.ASPA.Invalid,
 				}
 			}
 
@@ -144,16 +202,689 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	}
 }
 
+func (s *Server) handleBGPGlobal(c *gin.Context) {
+	global, err := s.bgpMonitor.Global()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, global)
+}
+
 func (s *Server) handleBGPPeers(c *gin.Context) {
 	peers := s.bgpMonitor.GetAllPeers()
 	c.JSON(http.StatusOK, peers)
 }
 
+func (s *Server) handleBGPPeer(c *gin.Context) {
+	peer, err := s.bgpMonitor.GetPeer(c.Param("address"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, peer)
+}
+
+// peerRequest is the body of peer add and update requests, with the same
+// fields as a bgp.peers entry in the config file
+type peerRequest struct {
+	Address              string                 `json:"address"`
+	ASN                  uint32                 `json:"asn"`
+	Port                 uint16                 `json:"port"`
+	Families             []string               `json:"families"`
+	Description          string                 `json:"description"`
+	Password             string                 `json:"password"`
+	LocalAddress         string                 `json:"local_address"`
+	EBGPMultihopTTL      int                    `json:"ebgp_multihop_ttl"`
+	TTLSecurityHops      int                    `json:"ttl_security_hops"`
+	HoldTime             int                    `json:"hold_time"`
+	KeepaliveInterval    int                    `json:"keepalive_interval"`
+	GracefulRestart      gracefulRestartRequest `json:"graceful_restart"`
+	RouteReflectorClient bool                   `json:"route_reflector_client"`
+	ClusterID            string                 `json:"cluster_id"`
+	Passive              bool                   `json:"passive"`
+	Role                 string                 `json:"role"`
+	MaxPrefixes          []maxPrefixRequest     `json:"max_prefixes"`
+}
+
+type gracefulRestartRequest struct {
+	Enabled     bool `json:"enabled"`
+	RestartTime int  `json:"restart_time"`
+}
+
+type maxPrefixRequest struct {
+	Family      string `json:"family"`
+	Limit       int64  `json:"limit"`
+	WarningPct  int    `json:"warning_pct"`
+	CriticalPct int    `json:"critical_pct"`
+	Action      string `json:"action"`
+}
+
+// bindPeer reads and validates a peer add or update request
+func bindPeer(c *gin.Context) (*config.BGPPeer, error) {
+	var req peerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	if address := c.Param("address"); address != "" {
+		if req.Address != "" && req.Address != address {
+			return nil, fmt.Errorf("address %s in body does not match %s", req.Address, address)
+		}
+		req.Address = address
+	}
+
+	peer := &config.BGPPeer{
+		Address:           req.Address,
+		ASN:               req.ASN,
+		Port:              req.Port,
+		Families:          req.Families,
+		Description:       req.Description,
+		Password:          req.Password,
+		LocalAddress:      req.LocalAddress,
+		EBGPMultihopTTL:   req.EBGPMultihopTTL,
+		TTLSecurityHops:   req.TTLSecurityHops,
+		HoldTime:          req.HoldTime,
+		KeepaliveInterval: req.KeepaliveInterval,
+		GracefulRestart: config.GracefulRestartConfig{
+			Enabled:     req.GracefulRestart.Enabled,
+			RestartTime: req.GracefulRestart.RestartTime,
+		},
+		RouteReflectorClient: req.RouteReflectorClient,
+		ClusterID:            req.ClusterID,
+		Passive:              req.Passive,
+		Role:                 req.Role,
+	}
+	for _, l := range req.MaxPrefixes {
+		peer.MaxPrefixes = append(peer.MaxPrefixes, config.MaxPrefixConfig{
+			Family:      l.Family,
+			Limit:       l.Limit,
+			WarningPct:  l.WarningPct,
+			CriticalPct: l.CriticalPct,
+			Action:      l.Action,
+		})
+	}
+	if err := peer.Validate(); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+func (s *Server) handleBGPPeerAdd(c *gin.Context) {
+	peer, err := bindPeer(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.bgpMonitor.AddPeer(peer.PeerConfig()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := s.bgpMonitor.GetPeer(peer.Address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, state)
+}
+
+func (s *Server) handleBGPPeerUpdate(c *gin.Context) {
+	peer, err := bindPeer(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.bgpMonitor.UpdatePeer(peer.PeerConfig()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := s.bgpMonitor.GetPeer(peer.Address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+func (s *Server) handleBGPPeerRemove(c *gin.Context) {
+	if err := s.autoEngine.RemovePeer(c.Param("address")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "removed"})
+}
+
+func (s *Server) handleBGPPeerEnable(c *gin.Context) {
+	if err := s.bgpMonitor.EnablePeer(c.Param("address")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "enabled"})
+}
+
+func (s *Server) handleBGPPeerDisable(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := s.bgpMonitor.DisablePeer(c.Param("address"), req.Reason); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+func (s *Server) handleBGPPeerReset(c *gin.Context) {
+	direction := c.DefaultQuery("direction", bgp.ResetBoth)
+	if err := s.bgpMonitor.SoftResetPeer(c.Param("address"), direction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "reset", "direction": direction})
+}
+
+func (s *Server) handleBGPPeerRestore(c *gin.Context) {
+	if err := s.autoEngine.RestorePeer(c.Param("address")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restored"})
+}
+
+func (s *Server) handleBGPPeerHistory(c *gin.Context) {
+	history, err := s.bgpMonitor.PeerHistory(c.Param("address"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (s *Server) handleBGPPeerRoutes(c *gin.Context) {
+	address := c.Param("address")
+	prefix := c.Query("prefix")
+	match := bgp.MatchType(c.DefaultQuery("match", string(bgp.MatchExact)))
+
+	var routes []*bgp.Route
+	var err error
+	switch rib := c.DefaultQuery("rib", bgp.RIBIn); rib {
+	case bgp.RIBIn:
+		routes, err = s.bgpMonitor.ListAdjRIBIn(address, prefix, match)
+	case bgp.RIBOut:
+		routes, err = s.bgpMonitor.ListAdjRIBOut(address, prefix, match)
+	default:
+		err = fmt.Errorf("invalid rib %q (must be in or out)", rib)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, routes)
+}
+
+func (s *Server) handleBGPVRFs(c *gin.Context) {
+	vrfs, err := s.bgpMonitor.VRFs(c.Query("peer"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, vrfs)
+}
+
+func (s *Server) handleBGPVRFRoutes(c *gin.Context) {
+	match := bgp.MatchType(c.DefaultQuery("match", string(bgp.MatchExact)))
+	routes, err := s.bgpMonitor.ListVRFRoutes(c.Param("name"), c.Query("peer"), c.Query("prefix"), match)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, routes)
+}
+
+func (s *Server) handleBGPVRFWithdraw(c *gin.Context) {
+	peer := c.Query("peer")
+	if peer == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "peer is required"})
+		return
+	}
+
+	report, err := s.bgpMonitor.WithdrawVRFPrefixes(peer, c.Param("name"))
+	if err != nil {
+		// Some prefixes may have been withdrawn before the failure
+		if report != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) handleBGPVRFRestore(c *gin.Context) {
+	peer := c.Query("peer")
+	if peer == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "peer is required"})
+		return
+	}
+
+	if err := s.bgpMonitor.RestoreVRFPrefixes(peer, c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "peer": peer, "vrf": c.Param("name")})
+}
+
+func (s *Server) handleBGPDampening(c *gin.Context) {
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", l)})
+			return
+		}
+		limit = parsed
+	}
+
+	// Archived data is analyzed as of a point in time
+	var at time.Time
+	if a := c.Query("at"); a != "" {
+		parsed, err := time.Parse(time.RFC3339, a)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time %q (must be RFC 3339)", a)})
+			return
+		}
+		at = parsed
+	}
+
+	c.JSON(http.StatusOK, s.bgpMonitor.NoisyPrefixes(limit, at))
+}
+
+func (s *Server) handleBGPAnalytics(c *gin.Context) {
+	top := 10
+	if t := c.Query("top"); t != "" {
+		parsed, err := strconv.Atoi(t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid top %q", t)})
+			return
+		}
+		top = parsed
+	}
+
+	analytics, err := s.bgpMonitor.Analytics(c.Query("peer"), top)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, analytics)
+}
+
+func (s *Server) handleBGPLookup(c *gin.Context) {
+	result, err := s.bgpMonitor.Lookup(c.Query("ip"))
+	if errors.Is(err, bgp.ErrNoRoute) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleBGPPolicySimulate dry-runs the policy document uploaded as the
+// request body
+func (s *Server) handleBGPPolicySimulate(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxPolicyUpload)
+	policy, err := config.ReadPolicy(body, c.DefaultQuery("format", "yaml"), c.DefaultQuery("name", "upload"))
+	if err != nil {
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	result, err := s.bgpMonitor.SimulatePolicy(policy.Policy(), c.Query("peer"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// auditUser is who injections are audited under. The API has no
+// authentication, so this is the address the request came from; forwarded
+// headers and request fields are not trusted.
+func auditUser(c *gin.Context) string {
+	return c.RemoteIP()
+}
+
+func (s *Server) handleBGPInjections(c *gin.Context) {
+	c.JSON(http.StatusOK, s.bgpMonitor.Injections())
+}
+
+type injectRequest struct {
+	Prefix      string   `json:"prefix" binding:"required"`
+	NextHop     string   `json:"next_hop"`
+	Communities []string `json:"communities"`
+	LocalPref   uint32   `json:"local_pref"`
+	TTLSec      int      `json:"ttl_sec" binding:"required"`
+	Reason      string   `json:"reason"`
+}
+
+func (s *Server) handleBGPInject(c *gin.Context) {
+	var req injectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	injection, err := s.bgpMonitor.InjectRoute(bgp.InjectRequest{
+		Prefix:      req.Prefix,
+		NextHop:     req.NextHop,
+		Communities: req.Communities,
+		LocalPref:   req.LocalPref,
+		TTL:         time.Duration(req.TTLSec) * time.Second,
+		User:        auditUser(c),
+		Reason:      req.Reason,
+	})
+	if errors.Is(err, bgp.ErrInjectionDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, injection)
+}
+
+func (s *Server) handleBGPInjectionWithdraw(c *gin.Context) {
+	if err := s.bgpMonitor.WithdrawInjectedRoute(c.Query("prefix"), auditUser(c), c.Query("reason")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "withdrawn"})
+}
+
+func (s *Server) handleBGPInjectionAudit(c *gin.Context) {
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", l)})
+			return
+		}
+		limit = parsed
+	}
+	c.JSON(http.StatusOK, s.bgpMonitor.InjectionAuditLog(limit))
+}
+
+func (s *Server) handleBGPFlowSpec(c *gin.Context) {
+	rules, err := s.bgpMonitor.FlowSpecRules(c.Query("peer"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (s *Server) handleBGPFlowSpecInjections(c *gin.Context) {
+	c.JSON(http.StatusOK, s.bgpMonitor.FlowSpecInjections())
+}
+
+type flowSpecInjectRequest struct {
+	Destination      string   `json:"destination" binding:"required"`
+	Source           string   `json:"source"`
+	Protocols        []string `json:"protocols"`
+	DestinationPorts []string `json:"destination_ports"`
+	SourcePorts      []string `json:"source_ports"`
+	PacketLengths    []string `json:"packet_lengths"`
+	Action           string   `json:"action" binding:"required"`
+	RateBps          uint64   `json:"rate_bps"`
+	TTLSec           int      `json:"ttl_sec" binding:"required"`
+	Reason           string   `json:"reason"`
+}
+
+func (s *Server) handleBGPFlowSpecInject(c *gin.Context) {
+	var req flowSpecInjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := s.bgpMonitor.InjectFlowSpec(bgp.FlowSpecRequest{
+		Destination:      req.Destination,
+		Source:           req.Source,
+		Protocols:        req.Protocols,
+		DestinationPorts: req.DestinationPorts,
+		SourcePorts:      req.SourcePorts,
+		PacketLengths:    req.PacketLengths,
+		Action:           req.Action,
+		Rate:             req.RateBps,
+		TTL:              time.Duration(req.TTLSec) * time.Second,
+		User:             auditUser(c),
+		Reason:           req.Reason,
+	})
+	if errors.Is(err, bgp.ErrInjectionDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *Server) handleBGPFlowSpecWithdraw(c *gin.Context) {
+	if err := s.bgpMonitor.WithdrawFlowSpec(c.Query("rule"), auditUser(c), c.Query("reason")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "withdrawn"})
+}
+
+func (s *Server) handleBGPSnapshots(c *gin.Context) {
+	snapshots, err := s.bgpMonitor.ListSnapshots()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+func (s *Server) handleBGPSnapshotTake(c *gin.Context) {
+	info, err := s.bgpMonitor.TakeSnapshot()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+func (s *Server) handleBGPRIBAt(c *gin.Context) {
+	at, err := parseTime(c.Query("at"))
+	if err != nil || at.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time %q (must be RFC 3339)", c.Query("at"))})
+		return
+	}
+
+	snapshot, err := s.bgpMonitor.RIBAt(at, c.Query("peer"))
+	if errors.Is(err, bgp.ErrNoSnapshot) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (s *Server) handleBGPDiff(c *gin.Context) {
+	from, err := parseTime(c.Query("from"))
+	if err != nil || from.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time %q (must be RFC 3339)", c.Query("from"))})
+		return
+	}
+	// Without an end the diff runs up to the current RIB
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid time %q (must be RFC 3339)", c.Query("to"))})
+		return
+	}
+
+	diff, err := s.bgpMonitor.DiffRIB(from, to, c.Query("peer"))
+	if errors.Is(err, bgp.ErrNoSnapshot) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// parseTime parses an optional RFC 3339 query parameter
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleMRTImport imports the MRT dump uploaded as the request body. The
+// API never opens files on the server.
+func (s *Server) handleMRTImport(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxMRTUpload)
+	stats, err := s.bgpMonitor.ImportMRTArchive(body, c.DefaultQuery("name", "upload"), maxMRTSize)
+	if err != nil {
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// uploadStatus returns the status of a failed upload: 413 if it went over one
+// of the limits, 400 otherwise.
+func uploadStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, bgp.ErrMRTTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func (s *Server) handleMRTExport(c *gin.Context) {
+	filename := fmt.Sprintf("netmeta-rib.%s.mrt", time.Now().UTC().Format("20060102.1504"))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := s.bgpMonitor.ExportMRT(c.Writer); err != nil {
+		log.Printf("MRT export failed: %v", err)
+	}
+}
+
+// handlePCAPImport decodes the capture uploaded as the request body
+func (s *Server) handlePCAPImport(c *gin.Context) {
+	opts := bgp.PCAPOptions{Local: c.QueryArray("local")}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxPCAPUpload)
+	stats, err := s.bgpMonitor.ImportPCAP(body, c.DefaultQuery("name", "upload"), opts)
+	if err != nil {
+		c.JSON(uploadStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (s *Server) handlePCAPSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, s.bgpMonitor.PCAPSessions(c.Query("peer")))
+}
+
+func (s *Server) handleBGPFindings(c *gin.Context) {
+	findings, err := s.bgpMonitor.Findings(c.Query("peer"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if typ := c.Query("type"); typ != "" {
+		filtered := make([]*bgp.Finding, 0, len(findings))
+		for _, f := range findings {
+			if f.Type == typ {
+				filtered = append(filtered, f)
+			}
+		}
+		findings = filtered
+	}
+	c.JSON(http.StatusOK, findings)
+}
+
+func (s *Server) handleRPKIStatus(c *gin.Context) {
+	if s.rpkiClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "RPKI is not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, s.rpkiClient.Status())
+}
+
+func (s *Server) handleRPKIInvalid(c *gin.Context) {
+	invalid, err := s.bgpMonitor.InvalidRoutes(c.Query("peer"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, invalid)
+}
+
+func (s *Server) handleASPA(c *gin.Context) {
+	var state rpki.State
+	if st := c.Query("state"); st != "" {
+		parsed, err := bgp.ParseASPAState(st)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		state = parsed
+	}
+
+	samples := 0
+	if n := c.Query("samples"); n != "" {
+		parsed, err := strconv.Atoi(n)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid samples %q", n)})
+			return
+		}
+		samples = parsed
+	}
+
+	summaries, err := s.bgpMonitor.ASPASummary(c.Query("peer"), state, samples)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
 func (s *Server) handleOSPFTopology(c *gin.Context) {
 	topology := s.ospfParser.GetTopology()
 	c.JSON(http.StatusOK, topology)
 }
 
+func (s *Server) handleBGPLSTopology(c *gin.Context) {
+	c.JSON(http.StatusOK, s.bgpMonitor.LinkStateTopology())
+}
+
 func (s *Server) handleRemediationEvents(c *gin.Context) {
 	limit := 100
 	if l := c.Query("limit"); l != "" {